@@ -6,6 +6,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/martian-lang/martian/martian/core"
 	"github.com/martian-lang/martian/martian/syntax"
@@ -14,6 +15,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/martian-lang/docopt.go"
 )
@@ -24,18 +26,37 @@ func main() {
 	doc := `Martian Compiler.
 
 Usage:
+    mrc --graph=<format> [options] <file.mro> <pipeline>
     mrc [options] <file.mro>...
     mrc [options]
     mrc -h | --help | --version
 
 Options:
-    --all           Compile all files in $MROPATH.
-    --json          Output abstract syntax tree as JSON.
+    --all           Compile all files in $MROPATH, and report unused
+                    includes and declarations.
+    --json          Output abstract syntax tree as versioned JSON.
     --strict        Strict syntax validation
     --no-check-src  Do not check that stage source paths exist.
+    --lint          Check for likely mistakes in addition to compiling.
+    --disable=<checks>
+                    Comma-separated list of lint checks to skip.
+    --graph=<format>
+                    Print the data flow graph of the given pipeline, as
+                    one of dot, mermaid, or json.
+    --collapse      Show sub-pipelines in the graph as single nodes.
 
     -h --help       Show this message.
-    --version       Show version.`
+    --version       Show version.
+
+Lint checks:
+    unused-stage          Stages which are never called.
+    unused-input          Pipeline inputs which every caller leaves null.
+    unused-output         Outputs which no caller ever binds.
+    split-without-chunks  Stages which split but have no chunk inputs.
+    naming                Stage and pipeline names which are not
+                          UPPER_SNAKE_CASE.
+    missing-help          Parameters without help strings.
+    duplicate-literal     Literal values bound repeatedly in a pipeline.`
 	martianVersion := util.GetVersion()
 	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
 
@@ -61,25 +82,53 @@ Options:
 		}
 	}
 	mkjson := opts["--json"].(bool)
+	lint := opts["--lint"].(bool)
+	disabled := make(map[string]bool)
+	if checks, ok := opts["--disable"].(string); ok {
+		for _, check := range strings.Split(checks, ",") {
+			check = strings.TrimSpace(check)
+			if _, ok := syntax.LintChecks[check]; !ok {
+				fmt.Fprintln(os.Stderr, "Unknown lint check", check)
+				os.Exit(1)
+			}
+			disabled[check] = true
+		}
+	}
+
+	if format, ok := opts["--graph"].(string); ok {
+		fname := opts["<file.mro>"].([]string)[0]
+		if !filepath.IsAbs(fname) {
+			fname = path.Join(cwd, fname)
+		}
+		printGraph(fname, mroPaths, checkSrcPath,
+			opts["<pipeline>"].(string), format,
+			opts["--collapse"].(bool))
+		return
+	}
+
+	var asts []*syntax.Ast
 
 	count := 0
 	if opts["--all"].(bool) {
 		// Compile all MRO files in MRO path.
-		num, asts, err := core.CompileAll(mroPaths, checkSrcPath)
+		num, all, err := core.CompileAll(mroPaths, checkSrcPath)
 
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
+		asts = all
 
 		if mkjson {
 			fmt.Printf("%s", syntax.JsonDumpAsts(asts))
 		}
+		for _, warning := range syntax.Unused(asts) {
+			fmt.Fprintln(os.Stderr, warning.Error())
+		}
 
 		count += num
 	} else {
 		// Compile just the specified MRO files.
-		var asts []*syntax.Ast
 		for _, fname := range opts["<file.mro>"].([]string) {
 			if !filepath.IsAbs(fname) {
 				fname = path.Join(cwd, fname)
@@ -88,9 +137,7 @@ Options:
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err.Error())
 			} else {
-				if mkjson {
-					asts = append(asts, ast)
-				}
+				asts = append(asts, ast)
 				count++
 			}
 		}
@@ -99,4 +146,45 @@ Options:
 		}
 	}
 	fmt.Fprintln(os.Stderr, "Successfully compiled", count, "mro files.")
+
+	if lint {
+		warnings := syntax.Lint(asts, disabled)
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, warning.Error())
+		}
+		if len(warnings) > 0 {
+			fmt.Fprintln(os.Stderr, len(warnings), "lint warnings.")
+			os.Exit(1)
+		}
+	}
+}
+
+func printGraph(fname string, mroPaths []string, checkSrcPath bool,
+	pipeline, format string, collapse bool) {
+	_, _, ast, err := syntax.Compile(fname, mroPaths, checkSrcPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	graph, err := ast.Graph(pipeline, collapse)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	switch format {
+	case "dot":
+		fmt.Print(graph.Dot())
+	case "mermaid":
+		fmt.Print(graph.Mermaid())
+	case "json":
+		if b, err := json.MarshalIndent(graph, "", "    "); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		} else {
+			fmt.Printf("%s\n", b)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown graph format", format)
+		os.Exit(1)
+	}
 }
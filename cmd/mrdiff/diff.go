@@ -0,0 +1,478 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// Compares two versions of a set of MRO declarations.
+type differ struct {
+	old, new *syntax.JsonAst
+
+	oldStages, newStages       map[string]*syntax.JsonStage
+	oldPipelines, newPipelines map[string]*syntax.JsonPipeline
+
+	// Human-readable descriptions of the changes.
+	changes []string
+}
+
+func newDiffer(old, new *syntax.JsonAst) *differ {
+	d := &differ{
+		old:          old,
+		new:          new,
+		oldStages:    make(map[string]*syntax.JsonStage, len(old.Stages)),
+		newStages:    make(map[string]*syntax.JsonStage, len(new.Stages)),
+		oldPipelines: make(map[string]*syntax.JsonPipeline, len(old.Pipelines)),
+		newPipelines: make(map[string]*syntax.JsonPipeline, len(new.Pipelines)),
+	}
+	for _, stage := range old.Stages {
+		d.oldStages[stage.Name] = stage
+	}
+	for _, stage := range new.Stages {
+		d.newStages[stage.Name] = stage
+	}
+	for _, pipeline := range old.Pipelines {
+		d.oldPipelines[pipeline.Name] = pipeline
+	}
+	for _, pipeline := range new.Pipelines {
+		d.newPipelines[pipeline.Name] = pipeline
+	}
+	return d
+}
+
+func (d *differ) report(format string, v ...interface{}) {
+	d.changes = append(d.changes, fmt.Sprintf(format, v...))
+}
+
+// Compute the changes between the old and new declarations.
+func (d *differ) diff() []string {
+	for _, stage := range d.new.Stages {
+		if old := d.oldStages[stage.Name]; old == nil {
+			d.report("+ stage %s", stage.Name)
+		} else {
+			d.diffStage(old, stage)
+		}
+	}
+	for _, stage := range d.old.Stages {
+		if d.newStages[stage.Name] == nil {
+			d.report("- stage %s", stage.Name)
+		}
+	}
+	for _, pipeline := range d.new.Pipelines {
+		if old := d.oldPipelines[pipeline.Name]; old == nil {
+			d.report("+ pipeline %s", pipeline.Name)
+		} else {
+			d.diffPipeline(old, pipeline)
+		}
+	}
+	for _, pipeline := range d.old.Pipelines {
+		if d.newPipelines[pipeline.Name] == nil {
+			d.report("- pipeline %s", pipeline.Name)
+		}
+	}
+	d.diffCalls("call", d.old.Calls, d.new.Calls)
+	return d.changes
+}
+
+//
+// Declarations
+//
+
+func typeName(param *syntax.JsonParam) string {
+	return param.Type + strings.Repeat("[]", param.ArrayDim)
+}
+
+func (d *differ) diffParams(prefix, kind string, old, new []*syntax.JsonParam) {
+	oldParams := make(map[string]*syntax.JsonParam, len(old))
+	for _, param := range old {
+		oldParams[param.Name] = param
+	}
+	newParams := make(map[string]*syntax.JsonParam, len(new))
+	for _, param := range new {
+		newParams[param.Name] = param
+		oldParam := oldParams[param.Name]
+		if oldParam == nil {
+			d.report("~ %s: added %s %s %s",
+				prefix, kind, typeName(param), param.Name)
+			continue
+		}
+		if oldType, newType := typeName(oldParam), typeName(param); oldType != newType {
+			d.report("~ %s: %s %s changed type from %s to %s",
+				prefix, kind, param.Name, oldType, newType)
+		}
+		if oldDef, newDef := formatExp(oldParam.Default), formatExp(param.Default); oldDef != newDef {
+			d.report("~ %s: %s %s default changed from %s to %s",
+				prefix, kind, param.Name, oldDef, newDef)
+		}
+		if oldParam.OutName != param.OutName {
+			d.report("~ %s: %s %s out name changed from %q to %q",
+				prefix, kind, param.Name, oldParam.OutName, param.OutName)
+		}
+	}
+	for _, param := range old {
+		if newParams[param.Name] == nil {
+			d.report("~ %s: removed %s %s", prefix, kind, param.Name)
+		}
+	}
+}
+
+func formatSrc(src *syntax.JsonSrc) string {
+	if src == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %q %s",
+		src.Lang, src.Path, strings.Join(src.Args, " ")))
+}
+
+func formatResources(res *syntax.JsonResources) string {
+	if res == nil {
+		return "none"
+	}
+	var parts []string
+	if res.ThreadsExp != "" {
+		parts = append(parts, "threads = "+res.ThreadsExp)
+	} else if res.Threads != 0 {
+		parts = append(parts, fmt.Sprintf("threads = %d", res.Threads))
+	}
+	if res.MemGBExp != "" {
+		parts = append(parts, "mem_gb = "+res.MemGBExp)
+	} else if res.MemGB != 0 {
+		parts = append(parts, fmt.Sprintf("mem_gb = %d", res.MemGB))
+	}
+	if res.Special != "" {
+		parts = append(parts, fmt.Sprintf("special = %q", res.Special))
+	}
+	if res.Timeout != 0 {
+		parts = append(parts, fmt.Sprintf("timeout = %d", res.Timeout))
+	}
+	if res.Retries != 0 {
+		parts = append(parts, fmt.Sprintf("retries = %d", res.Retries))
+	}
+	if res.Backoff != 0 {
+		parts = append(parts, fmt.Sprintf("retry_backoff = %d", res.Backoff))
+	}
+	if res.RetryOn != "" {
+		parts = append(parts, fmt.Sprintf("retry_on = %q", res.RetryOn))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (d *differ) diffStage(old, new *syntax.JsonStage) {
+	prefix := "stage " + new.Name
+	d.diffParams(prefix, "input", old.Inputs, new.Inputs)
+	d.diffParams(prefix, "output", old.Outputs, new.Outputs)
+	if oldSrc, newSrc := formatSrc(old.Src), formatSrc(new.Src); oldSrc != newSrc {
+		d.report("~ %s: src changed from %s to %s", prefix, oldSrc, newSrc)
+	}
+	if old.Split && !new.Split {
+		d.report("~ %s: split removed", prefix)
+	} else if new.Split && !old.Split {
+		d.report("~ %s: split added", prefix)
+	}
+	d.diffParams(prefix, "chunk input", old.ChunkInputs, new.ChunkInputs)
+	d.diffParams(prefix, "chunk output", old.ChunkOutputs, new.ChunkOutputs)
+	if oldRes, newRes := formatResources(old.Resources), formatResources(new.Resources); oldRes != newRes {
+		d.report("~ %s: resources changed from (%s) to (%s)", prefix, oldRes, newRes)
+	}
+	if !reflect.DeepEqual(old.Retain, new.Retain) {
+		d.report("~ %s: retain changed from (%s) to (%s)", prefix,
+			strings.Join(old.Retain, ", "), strings.Join(new.Retain, ", "))
+	}
+}
+
+func (d *differ) diffPipeline(old, new *syntax.JsonPipeline) {
+	prefix := "pipeline " + new.Name
+	d.diffParams(prefix, "input", old.Inputs, new.Inputs)
+	d.diffParams(prefix, "output", old.Outputs, new.Outputs)
+	d.diffCalls(prefix+": call", old.Calls, new.Calls)
+	d.diffBindings(prefix+": return", old.Returns, new.Returns)
+}
+
+//
+// Calls
+//
+
+func (d *differ) diffCalls(prefix string, old, new []*syntax.JsonCall) {
+	oldCalls := make(map[string]*syntax.JsonCall, len(old))
+	for _, call := range old {
+		oldCalls[call.Name] = call
+	}
+	newCalls := make(map[string]*syntax.JsonCall, len(new))
+	for _, call := range new {
+		newCalls[call.Name] = call
+		oldCall := oldCalls[call.Name]
+		if oldCall == nil {
+			if strings.HasPrefix(prefix, "pipeline") {
+				d.report("~ %s %s added", prefix, call.Name)
+			} else {
+				d.report("+ %s %s", prefix, call.Name)
+			}
+			continue
+		}
+		callPrefix := prefix + " " + call.Name
+		if oldCall.Callable != call.Callable {
+			d.report("~ %s: now calls %s instead of %s",
+				callPrefix, call.Callable, oldCall.Callable)
+		}
+		if oldMods, newMods := formatModifiers(oldCall), formatModifiers(call); oldMods != newMods {
+			d.report("~ %s: modifiers changed from (%s) to (%s)",
+				callPrefix, oldMods, newMods)
+		}
+		d.diffBindings(callPrefix, oldCall.Bindings, call.Bindings)
+	}
+	for _, call := range old {
+		if newCalls[call.Name] == nil {
+			if strings.HasPrefix(prefix, "pipeline") {
+				d.report("~ %s %s removed", prefix, call.Name)
+			} else {
+				d.report("- %s %s", prefix, call.Name)
+			}
+		}
+	}
+}
+
+func formatModifiers(call *syntax.JsonCall) string {
+	var mods []string
+	for _, m := range []struct {
+		name string
+		set  bool
+	}{
+		{"map", call.Mapped},
+		{"local", call.Local},
+		{"preflight", call.Preflight},
+		{"volatile", call.Volatile},
+	} {
+		if m.set {
+			mods = append(mods, m.name+" = true")
+		}
+	}
+	for _, binding := range call.Modifiers {
+		mods = append(mods, binding.Name+" = "+formatExp(binding.Value))
+	}
+	return strings.Join(mods, ", ")
+}
+
+func formatBinding(binding *syntax.JsonBinding) string {
+	if binding.Sweep {
+		return "sweep(" + formatExp(binding.Value) + ")"
+	} else if binding.Split {
+		return "split " + formatExp(binding.Value)
+	}
+	return formatExp(binding.Value)
+}
+
+func (d *differ) diffBindings(prefix string, old, new []*syntax.JsonBinding) {
+	oldBindings := make(map[string]*syntax.JsonBinding, len(old))
+	for _, binding := range old {
+		oldBindings[binding.Name] = binding
+	}
+	newBindings := make(map[string]*syntax.JsonBinding, len(new))
+	for _, binding := range new {
+		newBindings[binding.Name] = binding
+		if oldBinding := oldBindings[binding.Name]; oldBinding == nil {
+			d.report("~ %s: added binding %s = %s",
+				prefix, binding.Name, formatBinding(binding))
+		} else if oldVal, newVal := formatBinding(oldBinding), formatBinding(binding); oldVal != newVal {
+			d.report("~ %s: binding %s changed from %s to %s",
+				prefix, binding.Name, oldVal, newVal)
+		}
+	}
+	for _, binding := range old {
+		if newBindings[binding.Name] == nil {
+			d.report("~ %s: removed binding %s", prefix, binding.Name)
+		}
+	}
+}
+
+// Format an expression as MRO source.
+func formatExp(exp *syntax.JsonExp) string {
+	if exp == nil {
+		return "null"
+	}
+	switch exp.Kind {
+	case "self":
+		return "self." + exp.Id
+	case "call":
+		if exp.OutputId == "" || exp.OutputId == "default" {
+			return exp.Id
+		}
+		return exp.Id + "." + exp.OutputId
+	case "or":
+		refs := make([]string, len(exp.Elements))
+		for i, e := range exp.Elements {
+			refs[i] = formatExp(e)
+		}
+		return strings.Join(refs, " or ")
+	case "array":
+		elems := make([]string, len(exp.Elements))
+		for i, e := range exp.Elements {
+			elems[i] = formatExp(e)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case "map":
+		keys := make([]string, 0, len(exp.Entries))
+		for k := range exp.Entries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = fmt.Sprintf("%q: %s", k, formatExp(exp.Entries[k]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case "null":
+		return "null"
+	}
+	if b, err := json.Marshal(exp.Value); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(exp.Value)
+}
+
+//
+// Invalidation
+//
+
+// Returns true if a stage changed in a way which may change its outputs.
+// Changes to resources, help text, retained outputs and source locations
+// do not count.
+func stageChanged(old, new *syntax.JsonStage) bool {
+	return stageSignature(old) != stageSignature(new)
+}
+
+func stageSignature(stage *syntax.JsonStage) string {
+	strip := func(params []*syntax.JsonParam) []string {
+		result := make([]string, len(params))
+		for i, param := range params {
+			result[i] = fmt.Sprintf("%s %s %s %s", typeName(param), param.Name,
+				formatExp(param.Default), param.OutName)
+		}
+		return result
+	}
+	b, _ := json.Marshal([]interface{}{
+		strip(stage.Inputs),
+		strip(stage.Outputs),
+		formatSrc(stage.Src),
+		stage.Split,
+		strip(stage.ChunkInputs),
+		strip(stage.ChunkOutputs),
+	})
+	return string(b)
+}
+
+// Returns true if the expression references any of the given inputs of the
+// enclosing pipeline.
+func referencesInputs(exp *syntax.JsonExp, inputs map[string]bool) bool {
+	if exp == nil {
+		return false
+	}
+	if exp.Kind == "self" {
+		return inputs[exp.Id]
+	}
+	for _, e := range exp.Elements {
+		if referencesInputs(e, inputs) {
+			return true
+		}
+	}
+	for _, e := range exp.Entries {
+		if referencesInputs(e, inputs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the inputs of a call whose values may have changed, given the
+// inputs of the enclosing pipeline which changed.  If every input should
+// be considered changed, returns nil and true.
+func changedBindings(old, new *syntax.JsonCall, changedInputs map[string]bool) (map[string]bool, bool) {
+	if old == nil || old.Callable != new.Callable ||
+		formatModifiers(old) != formatModifiers(new) {
+		return nil, true
+	}
+	oldBindings := make(map[string]*syntax.JsonBinding, len(old.Bindings))
+	for _, binding := range old.Bindings {
+		oldBindings[binding.Name] = binding
+	}
+	changed := make(map[string]bool)
+	for _, binding := range new.Bindings {
+		oldBinding := oldBindings[binding.Name]
+		if oldBinding == nil ||
+			formatBinding(oldBinding) != formatBinding(binding) ||
+			referencesInputs(binding.Value, changedInputs) {
+			changed[binding.Name] = true
+		}
+	}
+	if len(old.Bindings) != len(new.Bindings) {
+		return nil, true
+	}
+	return changed, false
+}
+
+// Get the partially qualified names of the stages in the new top-level call
+// which must be rerun, in the form accepted by mrt_helper -inv.
+//
+// Stages are included if their declaration changed, if the call was added
+// or rewired, or if any of their bindings changed, directly or through the
+// inputs of their enclosing pipelines.  Stages downstream of those are not
+// included, since mrt_helper finds them itself.
+func (d *differ) invalidated() []string {
+	if len(d.new.Calls) == 0 {
+		return nil
+	}
+	top := d.new.Calls[0]
+	var oldTop *syntax.JsonCall
+	for _, call := range d.old.Calls {
+		if call.Name == top.Name {
+			oldTop = call
+		}
+	}
+	var result []string
+	d.invalidateCall(top.Name, oldTop, top, nil, &result)
+	return result
+}
+
+func (d *differ) invalidateCall(fqname string, old, new *syntax.JsonCall,
+	changedInputs map[string]bool, result *[]string) {
+	changed, all := changedBindings(old, new, changedInputs)
+	if stage := d.newStages[new.Callable]; stage != nil {
+		if all || len(changed) > 0 || d.oldStages[new.Callable] == nil ||
+			stageChanged(d.oldStages[new.Callable], stage) {
+			*result = append(*result, fqname)
+		}
+		return
+	}
+	pipeline := d.newPipelines[new.Callable]
+	if pipeline == nil {
+		return
+	}
+	var oldPipeline *syntax.JsonPipeline
+	if !all {
+		oldPipeline = d.oldPipelines[new.Callable]
+	}
+	oldCalls := make(map[string]*syntax.JsonCall)
+	if oldPipeline != nil {
+		for _, call := range oldPipeline.Calls {
+			oldCalls[call.Name] = call
+		}
+	}
+	for _, call := range pipeline.Calls {
+		var oldCall *syntax.JsonCall
+		if oldPipeline != nil {
+			oldCall = oldCalls[call.Name]
+		}
+		d.invalidateCall(fqname+"."+call.Name, oldCall, call, changed, result)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+const oldSrc = `
+filetype bam;
+filetype json;
+
+stage SORT(
+    in  bam   reads,
+    out bam   sorted,
+    src py    "stages/sort",
+) using (
+    mem_gb = 4,
+)
+
+stage COUNT(
+    in  bam   reads,
+    out int   count,
+    src py    "stages/count",
+)
+
+stage REPORT(
+    in  int   count,
+    in  int   min_count,
+    out json  report,
+    src py    "stages/report",
+)
+
+stage OLD_STAGE(
+    in  bam   reads,
+    src py    "stages/old",
+)
+
+pipeline INNER(
+    in  int   count,
+    in  int   min_count,
+    out json  report,
+)
+{
+    call REPORT(
+        count     = self.count,
+        min_count = self.min_count,
+    )
+
+    return (
+        report = REPORT.report,
+    )
+}
+
+pipeline OUTER(
+    in  bam   reads,
+    out json  report,
+)
+{
+    call SORT(
+        reads = self.reads,
+    )
+
+    call COUNT(
+        reads = SORT.sorted,
+    )
+
+    call INNER(
+        count     = COUNT.count,
+        min_count = 10,
+    )
+
+    return (
+        report = INNER.report,
+    )
+}
+
+call OUTER(
+    reads = "/data/reads.bam",
+)
+`
+
+func parse(t *testing.T, src string) *syntax.JsonAst {
+	t.Helper()
+	_, _, ast, err := syntax.ParseSource(src, "test.mro", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return syntax.NewJsonAst([]*syntax.Ast{ast})
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	d := newDiffer(parse(t, oldSrc), parse(t, oldSrc))
+	if changes := d.diff(); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+	if inv := d.invalidated(); len(inv) != 0 {
+		t.Errorf("Expected no invalidated stages, got %v", inv)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	newSrc := strings.NewReplacer(
+		// Changed resources.
+		"mem_gb = 4,", "mem_gb = 8,\n    timeout = 3600,\n    retries = 2,\n    retry_on = \"^IOError\",",
+		// Changed parameter type.
+		"out int   count,", "out float count,",
+		"in  int   count,", "in  float count,",
+		// Changed binding.
+		"min_count = 10", "min_count = 20",
+		// Removed stage.
+		`stage OLD_STAGE(
+    in  bam   reads,
+    src py    "stages/old",
+)`, `stage NEW_STAGE(
+    in  bam   reads,
+    src py    "stages/new",
+)`,
+	).Replace(oldSrc)
+	d := newDiffer(parse(t, oldSrc), parse(t, newSrc))
+	if changes, expect := d.diff(), []string{
+		"~ stage SORT: resources changed from (mem_gb = 4) to (mem_gb = 8, timeout = 3600, retries = 2, retry_on = \"^IOError\")",
+		"~ stage COUNT: output count changed type from int to float",
+		"~ stage REPORT: input count changed type from int to float",
+		"+ stage NEW_STAGE",
+		"- stage OLD_STAGE",
+		"~ pipeline INNER: input count changed type from int to float",
+		"~ pipeline OUTER: call INNER: binding min_count changed from 10 to 20",
+	}; !reflect.DeepEqual(changes, expect) {
+		t.Errorf("Expected\n%s\ngot\n%s",
+			strings.Join(expect, "\n"), strings.Join(changes, "\n"))
+	}
+	// SORT only changed resources, so does not need to be rerun.
+	if inv, expect := d.invalidated(), []string{
+		"OUTER.COUNT",
+		"OUTER.INNER.REPORT",
+	}; !reflect.DeepEqual(inv, expect) {
+		t.Errorf("Expected %v, got %v", expect, inv)
+	}
+}
+
+func TestDiffRewired(t *testing.T) {
+	newSrc := strings.Replace(oldSrc,
+		"reads = SORT.sorted,", "reads = self.reads,", 1)
+	d := newDiffer(parse(t, oldSrc), parse(t, newSrc))
+	if changes, expect := d.diff(), []string{
+		"~ pipeline OUTER: call COUNT: binding reads changed from SORT.sorted to self.reads",
+	}; !reflect.DeepEqual(changes, expect) {
+		t.Errorf("Expected %v, got %v", expect, changes)
+	}
+	if inv, expect := d.invalidated(), []string{
+		"OUTER.COUNT",
+	}; !reflect.DeepEqual(inv, expect) {
+		t.Errorf("Expected %v, got %v", expect, inv)
+	}
+}
+
+func TestDiffMapped(t *testing.T) {
+	const mappedSrc = `
+filetype bam;
+
+stage COUNT(
+    in  bam   reads,
+    out int   count,
+    src py    "stages/count",
+)
+
+stage SUM(
+    in  int[] counts,
+    out int   total,
+    src py    "stages/sum",
+)
+
+pipeline COUNT_ALL(
+    in  bam[] reads,
+    out int   total,
+)
+{
+    map call COUNT(
+        reads = split self.reads,
+    )
+
+    call SUM(
+        counts = COUNT.count,
+    )
+
+    return (
+        total = SUM.total,
+    )
+}
+
+call COUNT_ALL(
+    reads = ["/data/a.bam", "/data/b.bam"],
+)
+`
+	newSrc := strings.NewReplacer(
+		"in  bam   reads,", "in  bam[] reads,",
+		"out int   count,", "out int[] count,",
+		"map call COUNT(", "call COUNT(",
+		"reads = split self.reads,", "reads = self.reads,",
+	).Replace(mappedSrc)
+	d := newDiffer(parse(t, mappedSrc), parse(t, newSrc))
+	if changes, expect := d.diff(), []string{
+		"~ stage COUNT: input reads changed type from bam to bam[]",
+		"~ stage COUNT: output count changed type from int to int[]",
+		"~ pipeline COUNT_ALL: call COUNT: modifiers changed from (map = true) to ()",
+		"~ pipeline COUNT_ALL: call COUNT: binding reads changed from split self.reads to self.reads",
+	}; !reflect.DeepEqual(changes, expect) {
+		t.Errorf("Expected\n%s\ngot\n%s",
+			strings.Join(expect, "\n"), strings.Join(changes, "\n"))
+	}
+	if inv, expect := d.invalidated(), []string{
+		"COUNT_ALL.COUNT",
+	}; !reflect.DeepEqual(inv, expect) {
+		t.Errorf("Expected %v, got %v", expect, inv)
+	}
+
+	// Mapping a call with the same bindings still reruns it.
+	if changed, all := changedBindings(
+		&syntax.JsonCall{Callable: "COUNT", Mapped: true},
+		&syntax.JsonCall{Callable: "COUNT"}, nil); changed != nil || !all {
+		t.Errorf("Expected all bindings to change, got %v", changed)
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Martian semantic diff for MRO files.
+//
+// mrdiff compiles two versions of an MRO file, for example the _mrosource
+// of an old pipestance and the invocation for a new one, and reports the
+// structural differences between their declarations and calls.
+//
+// With --inv, it instead prints the comma-separated list of stages which
+// would need to be rerun, suitable for passing to mrt_helper -inv.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetupSignalHandlers()
+	// Command-line arguments.
+	doc := `Martian Semantic Diff.
+
+Usage:
+    mrdiff [options] <old.mro> <new.mro>
+    mrdiff -h | --help | --version
+
+Options:
+    --inv                 Print the stages to invalidate, as a
+                          comma-separated list for mrt_helper -inv.
+    --old-mropath=<path>  MROPATH for the old file.  Defaults to $MROPATH.
+    --new-mropath=<path>  MROPATH for the new file.  Defaults to $MROPATH.
+    -h --help             Show this message.
+    --version             Show version.`
+	martianVersion := util.GetVersion()
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	// Martian environment variables.
+	cwd, _ := os.Getwd()
+	mroPaths := util.ParseMroPath(cwd)
+	if value := os.Getenv("MROPATH"); len(value) > 0 {
+		mroPaths = util.ParseMroPath(value)
+	}
+	oldPaths, newPaths := mroPaths, mroPaths
+	if value, ok := opts["--old-mropath"].(string); ok {
+		oldPaths = util.ParseMroPath(value)
+	}
+	if value, ok := opts["--new-mropath"].(string); ok {
+		newPaths = util.ParseMroPath(value)
+	}
+
+	old := compile(opts["<old.mro>"].(string), oldPaths)
+	new := compile(opts["<new.mro>"].(string), newPaths)
+	d := newDiffer(old, new)
+
+	if opts["--inv"].(bool) {
+		fmt.Println(strings.Join(d.invalidated(), ","))
+		return
+	}
+	changes := d.diff()
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func compile(fname string, mroPaths []string) *syntax.JsonAst {
+	_, _, ast, err := syntax.Compile(fname, mroPaths, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	return syntax.NewJsonAst([]*syntax.Ast{ast})
+}
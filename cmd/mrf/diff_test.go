@@ -0,0 +1,55 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	if d := unifiedDiff("same.mro", "a\nb\n", "a\nb\n"); d != "" {
+		t.Errorf("Expected no diff, got\n%s", d)
+	}
+	original := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	formatted := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n16\nseventeen"
+	if d, expect := unifiedDiff("test.mro", original, formatted), `--- test.mro.orig
++++ test.mro
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,6 +11,6 @@
+ 11
+ 12
+ 13
+-14
+ 15
+ 16
++seventeen
+\ No newline at end of file
+`; d != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, d)
+	}
+	// Changes less than 2*diffContext lines apart share a hunk.
+	if d, expect := unifiedDiff("test.mro", "a\nb\nc\nd\ne\nf\n", "x\nb\nc\nd\ne\ny\n"),
+		`--- test.mro.orig
++++ test.mro
+@@ -1,6 +1,6 @@
+-a
++x
+ b
+ c
+ d
+ e
+-f
++y
+`; d != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, d)
+	}
+}
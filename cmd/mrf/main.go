@@ -12,6 +12,11 @@
 // configurable.  This is a deliberate choice.  By preventing users from
 // making different style choices, pointless whitespace-only diffs should
 // be prevented and arguments about style can be avoided.
+//
+// For continuous integration, --check prints a unified diff of the changes
+// which would be made instead of the formatted source, and exits with a
+// non-zero status if any file is not already formatted.  With --stdin, the
+// source is read from standard input, for use from editors.
 package main
 
 import (
@@ -20,6 +25,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 
 	"github.com/martian-lang/docopt.go"
 	"github.com/martian-lang/martian/martian/syntax"
@@ -32,14 +38,22 @@ func main() {
 	doc := `Martian Formatter.
 
 Usage:
-    mrf <file.mro>... [--rewrite]
-    mrf --all
+    mrf <file.mro>... [--rewrite] [--width=<n>]
+    mrf --check <file.mro>... [--width=<n>]
+    mrf --all [--check] [--width=<n>]
+    mrf --stdin [--check] [--width=<n>]
     mrf -h | --help | --version
 
 Options:
     --rewrite     Rewrite the specified file(s) in place in addition to
                   printing reformatted source to stdout.
     --all         Rewrite all files in MROPATH.
+    --check       Print a diff of the changes which would be made instead,
+                  and exit with status 1 if any file is not formatted.
+    --stdin       Format source read from stdin.
+    --width=<n>   Wrap help strings which extend past this column.  The
+                  line breaks become part of the help text, so help
+                  strings are not wrapped by default.
     -h --help     Show this message.
     --version     Show version.`
 	martianVersion := util.GetVersion()
@@ -52,29 +66,74 @@ Options:
 		mroPaths = util.ParseMroPath(value)
 	}
 
-	if opts["--all"].(bool) {
+	width := syntax.DefaultFormatWidth
+	if value, ok := opts["--width"].(string); ok {
+		w, err := strconv.Atoi(value)
+		if err != nil || w < 0 {
+			fmt.Fprintln(os.Stderr, "Invalid width", value)
+			os.Exit(1)
+		}
+		width = w
+	}
+	check := opts["--check"].(bool)
+	unformatted := false
+	checkFile := func(fname, src, fsrc string) {
+		if src != fsrc {
+			unformatted = true
+			fmt.Print(unifiedDiff(fname, src, fsrc))
+		}
+	}
+
+	if opts["--stdin"].(bool) {
+		data, err := ioutil.ReadAll(os.Stdin)
+		util.DieIf(err)
+		fsrc, err := syntax.FormatWidth(string(data), "<stdin>", width)
+		util.DieIf(err)
+		if check {
+			checkFile("<stdin>", string(data), fsrc)
+		} else {
+			fmt.Print(fsrc)
+		}
+	} else if opts["--all"].(bool) {
 		// Format all MRO files in MRO path.
 		numFiles := 0
 		for _, mroPath := range mroPaths {
 			fnames, err := filepath.Glob(mroPath + "/*.mro")
 			util.DieIf(err)
 			for _, fname := range fnames {
-				fsrc, err := syntax.FormatFile(fname)
+				data, err := ioutil.ReadFile(fname)
 				util.DieIf(err)
-				ioutil.WriteFile(fname, []byte(fsrc), 0644)
+				fsrc, err := syntax.FormatWidth(string(data), fname, width)
+				util.DieIf(err)
+				if check {
+					checkFile(fname, string(data), fsrc)
+				} else {
+					ioutil.WriteFile(fname, []byte(fsrc), 0644)
+				}
 			}
 			numFiles += len(fnames)
 		}
-		fmt.Printf("Successfully reformatted %d files.\n", numFiles)
+		if !check {
+			fmt.Printf("Successfully reformatted %d files.\n", numFiles)
+		}
 	} else {
 		// Format just the specified MRO files.
 		for _, fname := range opts["<file.mro>"].([]string) {
-			fsrc, err := syntax.FormatFile(fname)
+			data, err := ioutil.ReadFile(fname)
 			util.DieIf(err)
+			fsrc, err := syntax.FormatWidth(string(data), fname, width)
+			util.DieIf(err)
+			if check {
+				checkFile(fname, string(data), fsrc)
+				continue
+			}
 			fmt.Print(fsrc)
 			if opts["--rewrite"].(bool) {
 				ioutil.WriteFile(fname, []byte(fsrc), 0644)
 			}
 		}
 	}
+	if unformatted {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var tomlKeyValueRe = regexp.MustCompile(`^[A-Za-z0-9_."'-]+\s*=`)
+
+// Guess the format of the input from its first significant line.
+func detectFormat(src string) string {
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} else if strings.HasPrefix(line, "{") {
+			return "json"
+		} else if strings.HasPrefix(line, "[") || tomlKeyValueRe.MatchString(line) {
+			return "toml"
+		}
+		return "yaml"
+	}
+	return "json"
+}
+
+// Parse the invocation input in the given format, or detect the format if
+// it is empty.
+func parseInput(src, format string) (map[string]interface{}, error) {
+	if format == "" {
+		format = detectFormat(src)
+	}
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader([]byte(src)))
+		dec.UseNumber()
+		var input map[string]interface{}
+		if err := dec.Decode(&input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	case "yaml":
+		return parseYaml(src)
+	case "toml":
+		return parseToml(src)
+	default:
+		return nil, fmt.Errorf("unknown input format %s", format)
+	}
+}
+
+// Convert the decoded input into the types produced by decoding JSON, except
+// that integers are int64.  Values which have no JSON equivalent, such as
+// TOML dates, are errors.
+func normalizeInput(input interface{}) (map[string]interface{}, error) {
+	val, err := normalizeValue("", input)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := val.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	} else {
+		return m, nil
+	}
+}
+
+func normalizeValue(name string, val interface{}) (interface{}, error) {
+	switch val := val.(type) {
+	case nil, string, bool, int64, float64:
+		return val, nil
+	case int:
+		return int64(val), nil
+	case uint64:
+		return float64(val), nil
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, v := range val {
+			var err error
+			if result[i], err = normalizeValue(fmt.Sprintf("%s[%d]", name, i), v); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []map[string]interface{}:
+		// TOML arrays of tables.
+		result := make([]interface{}, len(val))
+		for i, v := range val {
+			var err error
+			if result[i], err = normalizeValue(fmt.Sprintf("%s[%d]", name, i), v); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			var err error
+			if result[k], err = normalizeValue(joinKey(name, k), v); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		// YAML mappings, which may have keys of any type.
+		result := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			key := fmt.Sprint(k)
+			var err error
+			if result[key], err = normalizeValue(joinKey(name, key), v); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v for %s", val, name)
+	}
+}
+
+func joinKey(name, key string) string {
+	if name == "" {
+		return key
+	}
+	return name + "." + key
+}
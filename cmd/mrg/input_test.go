@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// The invocation which each of the inputs below should produce.
+var expectInput = map[string]interface{}{
+	"call":     "SORT",
+	"incpaths": []interface{}{"sort.mro"},
+	"args": map[string]interface{}{
+		"reads":   []interface{}{"a.bam", "b # c.bam"},
+		"count":   int64(1000),
+		"ratio":   0.5,
+		"verbose": true,
+		"label":   nil,
+		"point":   map[string]interface{}{"x": int64(1), "y": int64(-2)},
+		"grid":    []interface{}{[]interface{}{int64(1)}, []interface{}{}},
+	},
+	"sweepargs": []interface{}{"count"},
+}
+
+func checkInput(t *testing.T, src, format string) {
+	t.Helper()
+	if detected := detectFormat(src); detected != format {
+		t.Errorf("Expected %s input, detected %s", format, detected)
+	}
+	input, err := parseInput(src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input, expectInput) {
+		expect, _ := json.Marshal(expectInput)
+		actual, _ := json.Marshal(input)
+		t.Errorf("Expected\n%s\ngot\n%s", expect, actual)
+	}
+}
+
+func TestParseYaml(t *testing.T) {
+	checkInput(t, `# An invocation.
+---
+call: SORT
+incpaths: [sort.mro]
+args:
+  reads:
+  - a.bam
+  - "b # c.bam"   # comment
+  count: 1000
+  ratio: 0.5
+  verbose: true
+  label: ~
+  point:
+    x: 1
+    'y': -2
+  grid: [[1], []]
+sweepargs:
+  - count
+`, "yaml")
+	for _, src := range []string{
+		"args:\n  a: 1\n   b: 2\n",
+		"args: [1, 2\n",
+		"- a\n",
+	} {
+		if _, err := parseYaml(src); err == nil {
+			t.Errorf("Expected an error parsing\n%s", src)
+		}
+	}
+}
+
+func TestParseToml(t *testing.T) {
+	// TOML has no null.
+	delete(expectInput["args"].(map[string]interface{}), "label")
+	defer func() {
+		expectInput["args"].(map[string]interface{})["label"] = nil
+	}()
+	checkInput(t, `# An invocation.
+call = "SORT"
+incpaths = ['sort.mro']
+sweepargs = [
+    "count",  # comment
+]
+
+[args]
+reads = ["a.bam", "b # c.bam"]
+count = 1_000
+ratio = 0.5
+verbose = true
+point = { x = 1, y = -2 }
+grid = [[1], []]
+`, "toml")
+	if input, err := parseToml(`
+[[runs]]
+name = "a"
+[[runs]]
+name = "b"
+[runs.opts]
+fast = true
+`); err != nil {
+		t.Error(err)
+	} else if expect := map[string]interface{}{
+		"runs": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{
+				"name": "b",
+				"opts": map[string]interface{}{"fast": true},
+			},
+		},
+	}; !reflect.DeepEqual(input, expect) {
+		t.Errorf("Incorrect array of tables %v", input)
+	}
+	for _, src := range []string{
+		"a = 1\na = 2\n",
+		"a = 1979-05-27\n",
+		"a = 1 b = 2\n",
+	} {
+		if _, err := parseToml(src); err == nil {
+			t.Errorf("Expected an error parsing\n%s", src)
+		}
+	}
+}
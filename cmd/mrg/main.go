@@ -6,11 +6,11 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/martian-lang/docopt.go"
 	"github.com/martian-lang/martian/martian/core"
 	"github.com/martian-lang/martian/martian/util"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -21,15 +21,26 @@ func main() {
 	// Command-line arguments.
 	doc := `Martian Invocation Generator.
 
+Reads the invocation from stdin as JSON, YAML or TOML, with keys call, args,
+and optionally sweepargs and incpaths.  The format is detected from the
+input unless given with --format.  Values must have a JSON equivalent, so
+for example TOML dates are not accepted.
+
 Usage:
-    mrg
+    mrg [--format=<fmt>]
     mrg -h | --help | --version
 
 Options:
+    --format=<fmt>  Input format: json, yaml or toml.
     -h --help       Show this message.
     --version       Show version.`
 	martianVersion := util.GetVersion()
-	docopt.Parse(doc, nil, true, martianVersion, false)
+	opts, _ := docopt.Parse(doc, nil, true, martianVersion, false)
+
+	format := ""
+	if value, ok := opts["--format"].(string); ok {
+		format = value
+	}
 
 	util.ENABLE_LOGGING = false
 
@@ -40,47 +51,59 @@ Options:
 		mroPaths = util.ParseMroPath(value)
 	}
 
-	// Read and parse JSON from stdin.
-	dec := json.NewDecoder(os.Stdin)
-	dec.UseNumber()
-	var input map[string]interface{}
-	if err := dec.Decode(&input); err == nil {
-		incpaths := []string{}
-		if ilist, ok := input["incpaths"].([]interface{}); ok {
-			incpaths = util.ArrayToString(ilist)
-		}
-		name, ok := input["call"].(string)
-		if !ok {
-			fmt.Println("No pipeline or stage specified.")
-			os.Exit(1)
-		}
-		callable, err := core.GetCallable(mroPaths, name)
-		if err != nil {
-			fmt.Printf("Could not find %s: %v\n", name, err)
-		}
+	// Read and parse the invocation from stdin.
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	input, err := parseInput(string(data), format)
+	if err != nil {
+		fmt.Printf("Could not parse input: %v\n", err)
+		os.Exit(1)
+	}
+	incpaths := []string{}
+	if ilist, ok := input["incpaths"].([]interface{}); ok {
+		incpaths = util.ArrayToString(ilist)
+	}
+	name, ok := input["call"].(string)
+	if !ok {
+		fmt.Println("No pipeline or stage specified.")
+		os.Exit(1)
+	}
+	callable, err := core.GetCallable(mroPaths, name)
+	if err != nil {
+		fmt.Printf("Could not find %s: %v\n", name, err)
+		os.Exit(1)
+	}
+
+	args, ok := input["args"].(map[string]interface{})
+	if !ok {
+		fmt.Println("No args given.")
+		os.Exit(1)
+	}
 
-		args, ok := input["args"].(map[string]interface{})
-		if !ok {
-			fmt.Println("No args given.")
-			os.Exit(1)
-		}
+	sweepargs := []string{}
+	if sweeplist, ok := input["sweepargs"].([]interface{}); ok {
+		sweepargs = util.ArrayToString(sweeplist)
+	}
 
-		sweepargs := []string{}
-		if sweeplist, ok := input["sweepargs"].([]interface{}); ok {
-			sweepargs = util.ArrayToString(sweeplist)
-		}
+	// Report every problem with the arguments at once.
+	if err := core.ArgumentMap(args).ValidateInvocation(
+		callable.GetInParams(), sweepargs); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-		src, bldErr := core.BuildCallSource(
-			incpaths, name, args, sweepargs,
-			callable)
+	src, bldErr := core.BuildCallSource(
+		incpaths, name, args, sweepargs,
+		callable)
 
-		if bldErr == nil {
-			fmt.Print(src)
-			os.Exit(0)
-		} else {
-			fmt.Println(bldErr)
-			os.Exit(1)
-		}
+	if bldErr == nil {
+		fmt.Print(src)
+		os.Exit(0)
+	} else {
+		fmt.Println(bldErr)
+		os.Exit(1)
 	}
-	os.Exit(1)
 }
@@ -0,0 +1,17 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+)
+
+func parseToml(src string) (map[string]interface{}, error) {
+	var input map[string]interface{}
+	if _, err := toml.Decode(src, &input); err != nil {
+		return nil, err
+	}
+	return normalizeInput(input)
+}
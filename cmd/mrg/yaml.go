@@ -0,0 +1,17 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"gopkg.in/yaml.v2"
+)
+
+func parseYaml(src string) (map[string]interface{}, error) {
+	var input interface{}
+	if err := yaml.Unmarshal([]byte(src), &input); err != nil {
+		return nil, err
+	}
+	return normalizeInput(input)
+}
@@ -424,10 +424,20 @@ func (self *runner) WaitLoop() {
 	err := func() error {
 		defer self.errorReader.Close()
 		timer := time.NewTimer(MemorySampleInterval)
+		var deadline <-chan time.Time
+		if self.jobInfo.Timeout > 0 {
+			timeout := time.NewTimer(time.Duration(self.jobInfo.Timeout) * time.Second)
+			defer timeout.Stop()
+			deadline = timeout.C
+		}
 		for {
 			select {
 			case err := <-wait:
 				return err
+			case <-deadline:
+				self.job.Process.Kill()
+				return &stageReturnedError{message: core.TimeoutMessage(
+					time.Duration(self.jobInfo.Timeout) * time.Second)}
 			case <-timer.C:
 				if err := self.monitor(&lastHeartbeat); err != nil {
 					return err
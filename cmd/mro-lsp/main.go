@@ -0,0 +1,49 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+// Language server for MRO files.
+//
+// mro-lsp speaks the language server protocol over stdin and stdout.  It
+// reports compilation errors as diagnostics, and supports go-to-definition,
+// hover and document formatting.  Included files are resolved against the
+// directory of the open file and MROPATH.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/martian-lang/docopt.go"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func main() {
+	util.SetupSignalHandlers()
+	// Command-line arguments.
+	doc := `Martian Language Server.
+
+Usage:
+    mro-lsp
+    mro-lsp -h | --help | --version
+
+Options:
+    -h --help     Show this message.
+    --version     Show version.`
+	martianVersion := util.GetVersion()
+	docopt.Parse(doc, nil, true, martianVersion, false)
+
+	// Martian environment variables.
+	cwd, _ := filepath.Abs(path.Dir(os.Args[0]))
+	mroPaths := util.ParseMroPath(cwd)
+	if value := os.Getenv("MROPATH"); len(value) > 0 {
+		mroPaths = util.ParseMroPath(value)
+	}
+
+	if err := newServer(os.Stdin, os.Stdout, mroPaths).serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,203 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+// The subset of the language server protocol used by mro-lsp.
+//
+// See https://microsoft.github.io/language-server-protocol/specification
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// A request or notification from the client.
+	request struct {
+		JsonRPC string           `json:"jsonrpc"`
+		Id      *json.RawMessage `json:"id,omitempty"`
+		Method  string           `json:"method"`
+		Params  json.RawMessage  `json:"params,omitempty"`
+	}
+
+	response struct {
+		JsonRPC string           `json:"jsonrpc"`
+		Id      *json.RawMessage `json:"id"`
+		Result  interface{}      `json:"result"`
+	}
+
+	errorResponse struct {
+		JsonRPC string           `json:"jsonrpc"`
+		Id      *json.RawMessage `json:"id"`
+		Error   *responseError   `json:"error"`
+	}
+
+	notification struct {
+		JsonRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params"`
+	}
+
+	responseError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	// A zero-based line and character offset.
+	Position struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+
+	Range struct {
+		Start Position `json:"start"`
+		End   Position `json:"end"`
+	}
+
+	Location struct {
+		Uri   string `json:"uri"`
+		Range Range  `json:"range"`
+	}
+
+	Diagnostic struct {
+		Range    Range  `json:"range"`
+		Severity int    `json:"severity"`
+		Source   string `json:"source"`
+		Message  string `json:"message"`
+	}
+
+	TextEdit struct {
+		Range   Range  `json:"range"`
+		NewText string `json:"newText"`
+	}
+
+	MarkupContent struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+
+	Hover struct {
+		Contents MarkupContent `json:"contents"`
+	}
+
+	TextDocumentIdentifier struct {
+		Uri string `json:"uri"`
+	}
+
+	TextDocumentItem struct {
+		Uri     string `json:"uri"`
+		Text    string `json:"text"`
+		Version int    `json:"version"`
+	}
+
+	TextDocumentPositionParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Position     Position               `json:"position"`
+	}
+
+	DidOpenTextDocumentParams struct {
+		TextDocument TextDocumentItem `json:"textDocument"`
+	}
+
+	DidChangeTextDocumentParams struct {
+		TextDocument   TextDocumentIdentifier `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+
+	DidCloseTextDocumentParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+
+	DocumentFormattingParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+
+	PublishDiagnosticsParams struct {
+		Uri         string        `json:"uri"`
+		Diagnostics []*Diagnostic `json:"diagnostics"`
+	}
+)
+
+const (
+	severityError = 1
+
+	// Full document synchronization.
+	syncFull = 1
+
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+)
+
+// Reads and writes messages with the base protocol's Content-Length framing.
+type conn struct {
+	in   *textproto.Reader
+	out  io.Writer
+	lock sync.Mutex
+}
+
+func newConn(in io.Reader, out io.Writer) *conn {
+	return &conn{
+		in:  textproto.NewReader(bufio.NewReader(in)),
+		out: out,
+	}
+}
+
+func (c *conn) read() (*request, error) {
+	header, err := c.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.in.R, body); err != nil {
+		return nil, err
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (c *conn) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.out.Write(body)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result interface{}) error {
+	return c.write(&response{JsonRPC: "2.0", Id: id, Result: result})
+}
+
+func (c *conn) replyError(id *json.RawMessage, code int, msg string) error {
+	return c.write(&errorResponse{
+		JsonRPC: "2.0",
+		Id:      id,
+		Error:   &responseError{Code: code, Message: msg},
+	})
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	return c.write(&notification{JsonRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,551 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// An open MRO file.
+type document struct {
+	uri  string
+	path string
+	text string
+
+	// The most recent AST which compiled successfully, used for
+	// navigation while the file is being edited.
+	ast *syntax.Ast
+}
+
+type server struct {
+	conn     *conn
+	mroPaths []string
+	docs     map[string]*document
+	shutdown bool
+}
+
+func newServer(in io.Reader, out io.Writer, mroPaths []string) *server {
+	return &server{
+		conn:     newConn(in, out),
+		mroPaths: mroPaths,
+		docs:     make(map[string]*document),
+	}
+}
+
+// Serve requests until the client sends exit.  Returns an error if the
+// connection is lost, or the client exits without a shutdown request.
+func (s *server) serve() error {
+	for {
+		req, err := s.conn.read()
+		if err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(req *request) error {
+	switch req.Method {
+	case "initialize":
+		return s.conn.reply(req.Id, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           syncFull,
+				"definitionProvider":         true,
+				"hoverProvider":              true,
+				"documentFormattingProvider": true,
+			},
+		})
+	case "shutdown":
+		s.shutdown = true
+		return s.conn.reply(req.Id, nil)
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc := &document{
+			uri:  params.TextDocument.Uri,
+			path: uriToPath(params.TextDocument.Uri),
+			text: params.TextDocument.Text,
+		}
+		s.docs[doc.uri] = doc
+		return s.publishDiagnostics(doc)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc := s.docs[params.TextDocument.Uri]
+		if doc == nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.publishDiagnostics(doc)
+	case "textDocument/didSave":
+		// Saving may change files which other open files include.
+		for _, doc := range s.docs {
+			if err := s.publishDiagnostics(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.Uri)
+		return s.conn.notify("textDocument/publishDiagnostics",
+			&PublishDiagnosticsParams{
+				Uri:         params.TextDocument.Uri,
+				Diagnostics: []*Diagnostic{},
+			})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		doc, err := s.positionDoc(req, &params)
+		if doc == nil {
+			return err
+		}
+		return s.conn.reply(req.Id, s.definition(doc, params.Position))
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		doc, err := s.positionDoc(req, &params)
+		if doc == nil {
+			return err
+		}
+		return s.conn.reply(req.Id, s.hover(doc, params.Position))
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.conn.replyError(req.Id, errInvalidParams, err.Error())
+		}
+		doc := s.docs[params.TextDocument.Uri]
+		if doc == nil {
+			return s.conn.replyError(req.Id, errInvalidParams,
+				"unknown document "+params.TextDocument.Uri)
+		}
+		formatted, err := syntax.Format(doc.text, doc.path)
+		if err != nil {
+			return s.conn.replyError(req.Id, errInvalidParams, err.Error())
+		}
+		lines := strings.Count(doc.text, "\n") + 1
+		return s.conn.reply(req.Id, []*TextEdit{{
+			Range: Range{
+				End: Position{Line: lines},
+			},
+			NewText: formatted,
+		}})
+	default:
+		if req.Id != nil {
+			return s.conn.replyError(req.Id, errMethodNotFound,
+				"unsupported method "+req.Method)
+		}
+		// Ignore unsupported notifications.
+		return nil
+	}
+}
+
+// Parse the parameters of a position request.  Returns nil if the document
+// was not found, in which case an error response has been sent.
+func (s *server) positionDoc(req *request,
+	params *TextDocumentPositionParams) (*document, error) {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return nil, s.conn.replyError(req.Id, errInvalidParams, err.Error())
+	}
+	doc := s.docs[params.TextDocument.Uri]
+	if doc == nil {
+		return nil, s.conn.replyError(req.Id, errInvalidParams,
+			"unknown document "+params.TextDocument.Uri)
+	}
+	return doc, nil
+}
+
+func uriToPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+func pathToUri(p string) string {
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+//
+// Diagnostics
+//
+
+func (s *server) publishDiagnostics(doc *document) error {
+	_, _, ast, err := syntax.ParseSource(doc.text, doc.path, s.mroPaths, false)
+	if err == nil {
+		doc.ast = ast
+	}
+	return s.conn.notify("textDocument/publishDiagnostics",
+		&PublishDiagnosticsParams{
+			Uri:         doc.uri,
+			Diagnostics: s.diagnostics(doc, err, []*Diagnostic{}),
+		})
+}
+
+func (s *server) diagnostics(doc *document, err error,
+	diags []*Diagnostic) []*Diagnostic {
+	if err == nil {
+		return diags
+	}
+	var node *syntax.AstNode
+	msg := err.Error()
+	switch err := err.(type) {
+	case syntax.ErrorList:
+		for _, e := range err {
+			diags = s.diagnostics(doc, e, diags)
+		}
+		return diags
+	case *syntax.AstError:
+		node = err.Node
+		msg = err.Msg
+	case *syntax.ParseError:
+		node = err.Node()
+		msg = fmt.Sprintf("ParseError: unexpected token '%s'", err.Token())
+	}
+	var rng Range
+	if node == nil {
+		rng = lineRange(doc.text, 0)
+	} else if node.Fname == filepath.Base(doc.path) && len(node.IncludeStack) == 0 {
+		rng = nodeRange(doc.text, node)
+	} else {
+		rng = lineRange(doc.text, docLine(doc, node))
+		msg += fmt.Sprintf(" (at %s:%d)", node.Fname, node.Loc)
+	}
+	return append(diags, &Diagnostic{
+		Range:    rng,
+		Severity: severityError,
+		Source:   "mro",
+		Message:  msg,
+	})
+}
+
+// Get the zero-based line in the document at which to report an error at
+// the given node.  Errors in included files are reported at the @include.
+func docLine(doc *document, node *syntax.AstNode) int {
+	base := filepath.Base(doc.path)
+	if len(node.IncludeStack) == 0 {
+		if node.Fname == base {
+			return node.Loc - 1
+		}
+		return 0
+	}
+	outer := node.IncludeStack[len(node.IncludeStack)-1]
+	if i := strings.LastIndex(outer, ":"); i > 0 && outer[:i] == base {
+		if line, err := strconv.Atoi(outer[i+1:]); err == nil {
+			return line - 1
+		}
+	}
+	return 0
+}
+
+func lineRange(text string, line int) Range {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		line = 0
+	}
+	return Range{
+		Start: Position{Line: line},
+		End: Position{
+			Line:      line,
+			Character: len(utf16.Encode([]rune(lines[line]))),
+		},
+	}
+}
+
+// Convert a 1-based byte column in a line into a zero-based UTF-16 offset.
+func utf16Col(line string, col int) int {
+	if col < 1 {
+		return 0
+	} else if col > len(line) {
+		return len(utf16.Encode([]rune(line))) + col - len(line) - 1
+	}
+	return len(utf16.Encode([]rune(line[:col-1])))
+}
+
+// Get the range of the token for a node in the given text.
+func nodeRange(text string, node *syntax.AstNode) Range {
+	if node.Col == 0 {
+		return lineRange(text, node.Loc-1)
+	}
+	lines := strings.Split(text, "\n")
+	pos := func(line, col int) Position {
+		if line < 1 || line > len(lines) {
+			return Position{Line: line - 1, Character: col - 1}
+		}
+		return Position{Line: line - 1, Character: utf16Col(lines[line-1], col)}
+	}
+	return Range{
+		Start: pos(node.Loc, node.Col),
+		End:   pos(node.EndLoc, node.EndCol),
+	}
+}
+
+//
+// Navigation
+//
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Get the (possibly dotted) identifier at the given position.
+func wordAt(text string, pos Position) string {
+	lines := strings.Split(text, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return ""
+	}
+	line := lines[pos.Line]
+	// Convert the UTF-16 character offset into a byte offset.
+	i, units := 0, 0
+	for i < len(line) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		units += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+	start, end := i, i
+	for start > 0 && isIdentByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdentByte(line[end]) {
+		end++
+	}
+	return strings.Trim(line[start:end], ".")
+}
+
+// Find the pipeline in the document which contains the given one-based
+// line, if any.
+func enclosingPipeline(doc *document, line int) *syntax.Pipeline {
+	base := filepath.Base(doc.path)
+	var found *syntax.Pipeline
+	for _, pipeline := range doc.ast.Pipelines {
+		node := &pipeline.Node
+		if node.Fname == base && len(node.IncludeStack) == 0 &&
+			node.Loc <= line && (found == nil || node.Loc > found.Node.Loc) {
+			found = pipeline
+		}
+	}
+	return found
+}
+
+// Find the call in the pipeline which contains the given one-based line.
+func enclosingCall(pipeline *syntax.Pipeline, line int) *syntax.CallStm {
+	var found *syntax.CallStm
+	for _, call := range pipeline.Calls {
+		if call.Node.Loc <= line && (found == nil || call.Node.Loc > found.Node.Loc) {
+			found = call
+		}
+	}
+	if found != nil && pipeline.Ret != nil && pipeline.Ret.Node.Loc <= line {
+		return nil
+	}
+	return found
+}
+
+func findCall(pipeline *syntax.Pipeline, id string) *syntax.CallStm {
+	for _, call := range pipeline.Calls {
+		if call.Id == id {
+			return call
+		}
+	}
+	return nil
+}
+
+func callableNode(callable syntax.Callable) *syntax.AstNode {
+	switch c := callable.(type) {
+	case *syntax.Stage:
+		return &c.Node
+	case *syntax.Pipeline:
+		return &c.Node
+	}
+	return nil
+}
+
+func paramNode(param syntax.Param) *syntax.AstNode {
+	switch p := param.(type) {
+	case *syntax.InParam:
+		return &p.Node
+	case *syntax.OutParam:
+		return &p.Node
+	}
+	return nil
+}
+
+// The declaration referred to by an identifier in a document.  Exactly one
+// of the fields is set.
+type declaration struct {
+	callable syntax.Callable
+	param    syntax.Param
+	node     *syntax.AstNode
+}
+
+func (d *declaration) getNode() *syntax.AstNode {
+	if d.callable != nil {
+		return callableNode(d.callable)
+	} else if d.param != nil {
+		return paramNode(d.param)
+	}
+	return d.node
+}
+
+// Find the declaration for the identifier at the given position.
+func (s *server) lookup(doc *document, pos Position) *declaration {
+	ast := doc.ast
+	word := wordAt(doc.text, pos)
+	if ast == nil || word == "" {
+		return nil
+	}
+	if callable := ast.Callables.Table[word]; callable != nil {
+		return &declaration{callable: callable}
+	}
+	if st := ast.StructTypeTable[word]; st != nil {
+		return &declaration{node: &st.Node}
+	}
+	if ut := ast.UserTypeTable[word]; ut != nil {
+		return &declaration{node: &ut.Node}
+	}
+	pipeline := enclosingPipeline(doc, pos.Line+1)
+	if pipeline == nil {
+		return nil
+	}
+	if strings.HasPrefix(word, "self.") {
+		if param := pipeline.InParams.Table[word[len("self."):]]; param != nil {
+			return &declaration{param: param}
+		}
+		return nil
+	}
+	if i := strings.Index(word, "."); i > 0 {
+		// A reference to the output of a call.
+		if call := findCall(pipeline, word[:i]); call != nil {
+			if callable := ast.Callables.Table[call.DecId]; callable != nil {
+				if param := callable.GetOutParams().Table[word[i+1:]]; param != nil {
+					return &declaration{param: param}
+				}
+				return &declaration{callable: callable}
+			}
+		}
+		return nil
+	}
+	if call := findCall(pipeline, word); call != nil {
+		if callable := ast.Callables.Table[call.DecId]; callable != nil {
+			return &declaration{callable: callable}
+		}
+	}
+	// The name of a parameter being bound.
+	if call := enclosingCall(pipeline, pos.Line+1); call != nil {
+		if callable := ast.Callables.Table[call.DecId]; callable != nil {
+			if param := callable.GetInParams().Table[word]; param != nil {
+				return &declaration{param: param}
+			}
+		}
+	} else if param := pipeline.OutParams.Table[word]; param != nil {
+		return &declaration{param: param}
+	}
+	return nil
+}
+
+func (s *server) definition(doc *document, pos Position) *Location {
+	decl := s.lookup(doc, pos)
+	if decl == nil {
+		return nil
+	}
+	node := decl.getNode()
+	uri, text := doc.uri, doc.text
+	if node.Fname != filepath.Base(doc.path) || len(node.IncludeStack) != 0 {
+		p, found := util.SearchPaths(node.Fname,
+			append([]string{filepath.Dir(doc.path)}, s.mroPaths...))
+		if !found {
+			return nil
+		}
+		uri = pathToUri(p)
+		if data, err := ioutil.ReadFile(p); err == nil {
+			text = string(data)
+		} else {
+			text = ""
+		}
+	}
+	return &Location{
+		Uri:   uri,
+		Range: nodeRange(text, node),
+	}
+}
+
+func describeParam(param syntax.Param) string {
+	mode := "in"
+	if _, ok := param.(*syntax.OutParam); ok {
+		mode = "out"
+	}
+	desc := fmt.Sprintf("%s %s%s %s",
+		mode, param.GetTname(),
+		strings.Repeat("[]", param.GetArrayDim()), param.GetId())
+	if def := param.GetDefault(); def != nil {
+		if b, err := json.Marshal(def.ToInterface()); err == nil {
+			desc += " = " + string(b)
+		}
+	}
+	return desc
+}
+
+func describeCallable(callable syntax.Callable) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s %s(\n", callable.Type(), callable.GetId())
+	for _, params := range []*syntax.Params{
+		callable.GetInParams(), callable.GetOutParams(),
+	} {
+		for _, param := range params.List {
+			fmt.Fprintf(&buf, "    %s,", describeParam(param))
+			if help := param.GetHelp(); help != "" {
+				fmt.Fprintf(&buf, " # %s", help)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
+
+func (s *server) hover(doc *document, pos Position) *Hover {
+	decl := s.lookup(doc, pos)
+	if decl == nil {
+		return nil
+	}
+	var value string
+	if decl.callable != nil {
+		value = "```\n" + describeCallable(decl.callable) + "\n```"
+	} else if decl.param != nil {
+		value = "```\n" + describeParam(decl.param) + "\n```"
+		if help := decl.param.GetHelp(); help != "" {
+			value += "\n\n" + help
+		}
+	} else {
+		return nil
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}}
+}
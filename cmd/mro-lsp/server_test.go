@@ -0,0 +1,223 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLib = `filetype bam;
+
+stage SORT(
+    in  bam  reads  "Unsorted reads",
+    out bam  sorted "Sorted reads",
+    src py   "stages/sort",
+)
+`
+
+const testMain = `@include "lib.mro"
+
+pipeline SORT_ALL(
+    in  bam reads,
+    out bam sorted,
+)
+{
+    call SORT(
+        reads = self.reads,
+    )
+
+    return (
+        sorted = SORT.sorted,
+    )
+}
+`
+
+// Run the server on the given messages and return its responses and
+// notifications.
+func runServer(t *testing.T, dir string, msgs ...interface{}) []map[string]interface{} {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, msg := range msgs {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	if err := newServer(&in, &out, []string{dir}).serve(); err != nil {
+		t.Error(err)
+	}
+	c := newConn(&out, nil)
+	var result []map[string]interface{}
+	for {
+		header, err := c.in.ReadMIMEHeader()
+		if err != nil {
+			return result
+		}
+		var n int
+		fmt.Sscan(header.Get("Content-Length"), &n)
+		body := make([]byte, n)
+		if _, err := io.ReadFull(c.in.R, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, msg)
+	}
+}
+
+func msg(id int, method string, params interface{}) map[string]interface{} {
+	m := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id > 0 {
+		m["id"] = id
+	}
+	return m
+}
+
+func openMsg(uri, text string) map[string]interface{} {
+	return msg(0, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "text": text},
+	})
+}
+
+func posMsg(id int, method, uri string, line, char int) map[string]interface{} {
+	return msg(id, method, map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": char},
+	})
+}
+
+func setupFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mro-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.mro"),
+		[]byte(testLib), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, pathToUri(filepath.Join(dir, "main.mro"))
+}
+
+func byId(msgs []map[string]interface{}, id int) map[string]interface{} {
+	for _, m := range msgs {
+		if v, ok := m["id"].(float64); ok && int(v) == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestDefinitionAndHover(t *testing.T) {
+	dir, uri := setupFiles(t)
+	defer os.RemoveAll(dir)
+	msgs := runServer(t, dir,
+		msg(1, "initialize", map[string]interface{}{}),
+		openMsg(uri, testMain),
+		// SORT in "call SORT("
+		posMsg(2, "textDocument/definition", uri, 7, 10),
+		// self.reads
+		posMsg(3, "textDocument/definition", uri, 8, 20),
+		// reads in "reads = "
+		posMsg(4, "textDocument/hover", uri, 8, 9),
+		// SORT.sorted
+		posMsg(5, "textDocument/hover", uri, 12, 20),
+		msg(6, "shutdown", nil),
+		msg(0, "exit", nil))
+
+	if diag := msgs[1]; diag["method"] != "textDocument/publishDiagnostics" {
+		t.Errorf("Expected diagnostics, got %v", diag)
+	} else if d := diag["params"].(map[string]interface{})["diagnostics"]; len(d.([]interface{})) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", d)
+	}
+
+	loc := byId(msgs, 2)["result"].(map[string]interface{})
+	if loc["uri"] != pathToUri(filepath.Join(dir, "lib.mro")) {
+		t.Errorf("Incorrect definition uri %v", loc["uri"])
+	}
+	if start := loc["range"].(map[string]interface{})["start"].(map[string]interface{}); start["line"] != 2.0 || start["character"] != 6.0 {
+		t.Errorf("Incorrect definition start %v", start)
+	}
+	if end := loc["range"].(map[string]interface{})["end"].(map[string]interface{}); end["line"] != 6.0 || end["character"] != 1.0 {
+		t.Errorf("Incorrect definition end %v", end)
+	}
+	loc = byId(msgs, 3)["result"].(map[string]interface{})
+	if loc["uri"] != uri {
+		t.Errorf("Incorrect definition uri %v", loc["uri"])
+	}
+	if line := loc["range"].(map[string]interface{})["start"].(map[string]interface{})["line"]; line != 3.0 {
+		t.Errorf("Incorrect definition line %v", line)
+	}
+
+	hover := byId(msgs, 4)["result"].(map[string]interface{})["contents"].(map[string]interface{})["value"].(string)
+	if !strings.Contains(hover, "in bam reads") ||
+		!strings.Contains(hover, "Unsorted reads") {
+		t.Errorf("Incorrect hover %q", hover)
+	}
+	hover = byId(msgs, 5)["result"].(map[string]interface{})["contents"].(map[string]interface{})["value"].(string)
+	if !strings.Contains(hover, "out bam sorted") ||
+		!strings.Contains(hover, "Sorted reads") {
+		t.Errorf("Incorrect hover %q", hover)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	dir, uri := setupFiles(t)
+	defer os.RemoveAll(dir)
+	msgs := runServer(t, dir,
+		msg(1, "initialize", map[string]interface{}{}),
+		openMsg(uri, strings.Replace(testMain, "self.reads", "self.bogus", 1)),
+		msg(2, "shutdown", nil),
+		msg(0, "exit", nil))
+	diags := msgs[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(diags) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %v", diags)
+	}
+	// Removing the only use of self.reads leaves it unused.
+	if diag := diags[0].(map[string]interface{}); !strings.Contains(diag["message"].(string), "UnusedInputError") {
+		t.Errorf("Incorrect diagnostic message %v", diag["message"])
+	}
+	diag := diags[1].(map[string]interface{})
+	if start := diag["range"].(map[string]interface{})["start"].(map[string]interface{}); start["line"] != 8.0 || start["character"] != 16.0 {
+		t.Errorf("Incorrect diagnostic start %v", start)
+	}
+	if !strings.Contains(diag["message"].(string), "bogus") {
+		t.Errorf("Incorrect diagnostic message %v", diag["message"])
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	dir, uri := setupFiles(t)
+	defer os.RemoveAll(dir)
+	msgs := runServer(t, dir,
+		msg(1, "initialize", map[string]interface{}{}),
+		openMsg(uri, strings.Replace(testMain, "    call", "call", 1)),
+		msg(2, "textDocument/formatting", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+		}),
+		msg(3, "shutdown", nil),
+		msg(0, "exit", nil))
+	edits := byId(msgs, 2)["result"].([]interface{})
+	if len(edits) != 1 {
+		t.Fatalf("Expected 1 edit, got %v", edits)
+	}
+	if text := edits[0].(map[string]interface{})["newText"]; text != testMain {
+		t.Errorf("Incorrect formatting %q", text)
+	}
+}
@@ -48,6 +48,12 @@ import (
 			}
 		}
 	}
+	if structs := getStructTypes(stages); len(structs) > 0 {
+		buffer.WriteString("//\n// Struct types\n//\n\n")
+		for _, st := range structs {
+			writeStructType(&buffer, st)
+		}
+	}
 	for _, stage := range stages {
 		writeStageStructs(&buffer, stage)
 	}
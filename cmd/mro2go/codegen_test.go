@@ -137,3 +137,66 @@ func TestToChunkDef(t *testing.T) {
 		t.Errorf("Incorrect result: %v", def.ToChunkDef())
 	}
 }
+
+func TestMroToGoStruct(t *testing.T) {
+	var dest bytes.Buffer
+	if err := MroToGo(&dest, `
+struct POINT(
+    in int    x,
+    in int    y,
+    in string label,
+)
+
+stage PLOT(
+    in  POINT[] points,
+    out POINT   center,
+    src py      "stages/plot",
+)
+`, "plot.mro", "", nil, "main", "plot.go"); err != nil {
+		t.Fatal(err)
+	}
+	goSrc := dest.String()
+	for _, expect := range []string{
+		"type Point struct {\n\tX     int    `json:\"x\"`\n",
+		"\tPoints []*Point `json:\"points\"`\n",
+		"\tCenter *Point `json:\"center\"`\n",
+	} {
+		if !strings.Contains(goSrc, expect) {
+			t.Errorf("Expected\n%s\nin\n%s", expect, goSrc)
+		}
+	}
+}
+
+func TestMroToGoTypedMap(t *testing.T) {
+	var dest bytes.Buffer
+	if err := MroToGo(&dest, `
+filetype bam;
+
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage COUNT(
+    in  map<bam>        reads,
+    in  map<int[]>      lanes,
+    in  map<POINT>[]    points,
+    out map<map<float>> nested,
+    src py              "stages/count",
+)
+`, "count.mro", "", nil, "main", "count.go"); err != nil {
+		t.Fatal(err)
+	}
+	goSrc := dest.String()
+	for _, expect := range []string{
+		"\tReads  map[string]string   `json:\"reads\"`\n",
+		"\tLanes  map[string][]int    `json:\"lanes\"`\n",
+		"\tPoints []map[string]*Point `json:\"points\"`\n",
+		"\tNested map[string]map[string]float64 `json:\"nested\"`\n",
+		"type Point struct {",
+	} {
+		if !strings.Contains(goSrc, expect) {
+			t.Errorf("Expected\n%s\nin\n%s", expect, goSrc)
+		}
+	}
+}
@@ -121,16 +121,7 @@ func writeParam(buffer *bytes.Buffer, param syntax.Param) {
 			goType,
 			param.GetId())
 	} else {
-		switch param.GetTname() {
-		case "int", "bool":
-			goType = param.GetTname()
-		case "float":
-			goType = "float64"
-		case "map":
-			goType = "map[string]interface{}"
-		default:
-			goType = "string"
-		}
+		goType = goTypeName(param.GetTname(), param.GetStructType())
 		fmt.Fprintf(buffer,
 			"\t%s %s%s `json:\"%s\"`\n",
 			GoName(param.GetId()),
@@ -140,6 +131,28 @@ func writeParam(buffer *bytes.Buffer, param syntax.Param) {
 	}
 }
 
+// Get the go type corresponding to an mro type name.  For typed maps,
+// structType is the struct type of the map elements, if any.
+func goTypeName(tname string, structType *syntax.StructType) string {
+	if elem, dim, ok := syntax.ParseMapType(tname); ok {
+		return "map[string]" + strings.Repeat("[]", dim) +
+			goTypeName(elem, structType)
+	}
+	switch tname {
+	case "int", "bool":
+		return tname
+	case "float":
+		return "float64"
+	case "map":
+		return "map[string]interface{}"
+	default:
+		if structType != nil {
+			return "*" + GoName(structType.Id)
+		}
+		return "string"
+	}
+}
+
 func writeStageArgs(buffer *bytes.Buffer, prefix string, stage *syntax.Stage) {
 	// Args
 	fmt.Fprintf(buffer,
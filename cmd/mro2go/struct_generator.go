@@ -0,0 +1,53 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+// Get the struct types used by the given stages, including struct types
+// used as members of other struct types, in order of first use.
+func getStructTypes(stages []*syntax.Stage) []*syntax.StructType {
+	var structs []*syntax.StructType
+	seen := make(map[*syntax.StructType]struct{})
+	var addParams func(params *syntax.Params)
+	addParams = func(params *syntax.Params) {
+		if params == nil {
+			return
+		}
+		for _, param := range params.List {
+			if st := param.GetStructType(); st != nil {
+				if _, ok := seen[st]; !ok {
+					seen[st] = struct{}{}
+					structs = append(structs, st)
+					addParams(st.Members)
+				}
+			}
+		}
+	}
+	for _, stage := range stages {
+		addParams(stage.InParams)
+		addParams(stage.OutParams)
+		addParams(stage.ChunkIns)
+		addParams(stage.ChunkOuts)
+	}
+	return structs
+}
+
+func writeStructType(buffer *bytes.Buffer, st *syntax.StructType) {
+	fmt.Fprintf(buffer,
+		"// A structure to encode and decode the %s struct.\n",
+		st.Id)
+	fmt.Fprintf(buffer,
+		"type %s struct {\n",
+		GoName(st.Id))
+	for _, param := range st.Members.List {
+		writeParam(buffer, param)
+	}
+	buffer.WriteString("}\n\n")
+}
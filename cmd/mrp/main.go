@@ -462,6 +462,9 @@ Options:
                             disable (default), cpu, mem, or line
     --stackvars         Print local variables in stage code stack trace.
     --monitor           Kill jobs that exceed requested memory resources.
+    --mem-escalation=NUM
+                        Rerun chunks and joins which run out of memory with
+                        twice as much memory, up to NUM GB.
     --inspect           Inspect pipestance without resetting failed stages.
     --debug             Enable debug logging for local job manager.
     --stest             Substitute real stages with stress-testing stage.
@@ -470,6 +473,8 @@ Options:
     --psdir=PATH        The path to the pipestance directory.  The default is
                         to use <pipestance_name>.
     --never-local       Ignore 'local' modifiers on non-preflight stages.
+    --cache=PATH        Reuse the results of identical stage runs from any
+                        pipestance which used the same cache directory.
 
     -h --help           Show this message.
     --version           Show version.`
@@ -568,6 +573,28 @@ Options:
 		}
 	}
 
+	if value := opts["--cache"]; value != nil {
+		if p, err := filepath.Abs(value.(string)); err == nil {
+			config.CacheDir = p
+			util.LogInfo("options", "--cache=%s", config.CacheDir)
+		} else {
+			util.PrintError(err, "options",
+				"Could not resolve --cache path \"%s\"", value.(string))
+			os.Exit(1)
+		}
+	}
+
+	if value := opts["--mem-escalation"]; value != nil {
+		if value, err := strconv.Atoi(value.(string)); err == nil && value > 0 {
+			config.MaxEscalatedMemGB = value
+			util.LogInfo("options", "--mem-escalation=%d", config.MaxEscalatedMemGB)
+		} else {
+			util.PrintInfo("options",
+				"Invalid --mem-escalation value \"%s\"", opts["--mem-escalation"].(string))
+			os.Exit(1)
+		}
+	}
+
 	// Max parallel jobs.
 	if config.JobMode != "local" {
 		config.MaxJobs = 64
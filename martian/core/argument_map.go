@@ -11,7 +11,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/martian-lang/martian/martian/syntax"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -42,18 +44,32 @@ func (self *ArgumentMap) UnmarshalJSON(b []byte) error {
 // Returns true if the given value has the correct mro type.
 // Non-fatal errors are written to alarms.
 func checkType(val interface{}, typename string, arrayDim int,
-	alarms *bytes.Buffer) bool {
+	structType *syntax.StructType, alarms *bytes.Buffer) bool {
 	if arrayDim > 0 {
 		arr, ok := val.([]interface{})
 		if !ok {
 			return false
 		}
 		for _, v := range arr {
-			if !checkType(v, typename, arrayDim-1, alarms) {
+			if !checkType(v, typename, arrayDim-1, structType, alarms) {
+				return false
+			}
+		}
+		return true
+	} else if elemType, elemDim, ok := syntax.ParseMapType(typename); ok {
+		// For typed maps, structType refers to the map elements.
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, v := range m {
+			if v != nil && !checkType(v, elemType, elemDim, structType, alarms) {
 				return false
 			}
 		}
 		return true
+	} else if structType != nil {
+		return checkStruct(val, structType, alarms)
 	} else {
 		switch typename {
 		case "float":
@@ -110,6 +126,39 @@ func checkType(val interface{}, typename string, arrayDim int,
 	}
 }
 
+// Returns true if the given value is a map with the members of the given
+// struct type.  Details of missing or mistyped members are written to alarms.
+func checkStruct(val interface{}, structType *syntax.StructType,
+	alarms *bytes.Buffer) bool {
+	members, ok := val.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, param := range structType.Members.List {
+		if v, ok := members[param.GetId()]; !ok {
+			fmt.Fprintf(alarms,
+				"Missing member '%s' of struct %s.\n",
+				param.GetId(), structType.Id)
+			return false
+		} else if v != nil && !checkType(v, param.GetTname(),
+			param.GetArrayDim(), param.GetStructType(), alarms) {
+			fmt.Fprintf(alarms,
+				"Expected %s member '%s' of struct %s has incorrect type %v.\n",
+				param.GetTname(), param.GetId(), structType.Id,
+				reflect.TypeOf(v))
+			return false
+		}
+	}
+	for key := range members {
+		if _, ok := structType.Members.Table[key]; !ok {
+			fmt.Fprintf(alarms,
+				"Unexpected member '%s' of struct %s.\n",
+				key, structType.Id)
+		}
+	}
+	return true
+}
+
 // Validate that all of the arguments in the map are declared parameters, and
 // that all declared parameters are set in the arguments to a value of the
 // correct type, or null.
@@ -143,7 +192,8 @@ func (self ArgumentMap) Validate(expected *syntax.Params, isInput bool, optional
 		} else if val == nil {
 			// Allow for null output parameters
 			continue
-		} else if !checkType(val, param.GetTname(), param.GetArrayDim(), &alarms) {
+		} else if !checkType(val, param.GetTname(), param.GetArrayDim(),
+			param.GetStructType(), &alarms) {
 			if isInput {
 				fmt.Fprintf(&result,
 					"Expected %s input parameter '%s' has incorrect type %v\n",
@@ -163,7 +213,8 @@ func (self ArgumentMap) Validate(expected *syntax.Params, isInput bool, optional
 			for _, params := range optional {
 				if param, ok := params.Table[key]; ok {
 					isOptional = true
-					if val != nil && !checkType(val, param.GetTname(), param.GetArrayDim(), &alarms) {
+					if val != nil && !checkType(val, param.GetTname(),
+						param.GetArrayDim(), param.GetStructType(), &alarms) {
 						if isInput {
 							fmt.Fprintf(&result,
 								"Optional %s input parameter '%s' has incorrect type %v\n",
@@ -194,6 +245,183 @@ func (self ArgumentMap) Validate(expected *syntax.Params, isInput bool, optional
 	}
 }
 
+// Validate the arguments for an invocation of a pipeline or stage with the
+// given input parameters, before the invocation is generated.
+//
+// This is stricter than Validate: user-defined file types must have the
+// correct extension, and path arguments must exist.  Parameters in sweepargs
+// must be given an array of values to sweep over.  Parameters which are not
+// given are not an error, since the invocation passes them as null.  All
+// problems found are returned together.
+func (self ArgumentMap) ValidateInvocation(params *syntax.Params,
+	sweepargs []string) error {
+	var errs syntax.ErrorList
+	swept := make(map[string]bool, len(sweepargs))
+	for _, id := range sweepargs {
+		if _, ok := params.Table[id]; !ok {
+			errs = append(errs, &RuntimeError{fmt.Sprintf(
+				"Cannot sweep over undeclared parameter '%s'", id)})
+		} else if _, ok := self[id]; !ok {
+			errs = append(errs, &RuntimeError{fmt.Sprintf(
+				"No values given to sweep over for parameter '%s'", id)})
+		}
+		swept[id] = true
+	}
+	for _, param := range params.List {
+		val, ok := self[param.GetId()]
+		if !ok {
+			continue
+		}
+		if swept[param.GetId()] {
+			if arr, ok := val.([]interface{}); !ok {
+				errs = append(errs, &RuntimeError{fmt.Sprintf(
+					"Swept parameter '%s' must be given an array of values",
+					param.GetId())})
+			} else {
+				for i, v := range arr {
+					errs = append(errs, checkInvocationArg(
+						fmt.Sprintf("%s[%d]", param.GetId(), i), v,
+						param.GetTname(), param.GetArrayDim(),
+						param.GetStructType())...)
+				}
+			}
+		} else {
+			errs = append(errs, checkInvocationArg(param.GetId(), val,
+				param.GetTname(), param.GetArrayDim(),
+				param.GetStructType())...)
+		}
+	}
+	for key := range self {
+		if _, ok := params.Table[key]; !ok {
+			errs = append(errs, &RuntimeError{fmt.Sprintf(
+				"Unexpected parameter '%s'", key)})
+		}
+	}
+	return errs.If()
+}
+
+// Check the type of an argument value, and that any files it references
+// exist.  The name is the path to the value, e.g. reads[1] or point.x, for
+// use in error messages.
+func checkInvocationArg(name string, val interface{}, typename string,
+	arrayDim int, structType *syntax.StructType) []error {
+	if val == nil {
+		return nil
+	}
+	typeError := func(expect string) []error {
+		return []error{&RuntimeError{fmt.Sprintf(
+			"Expected %s for '%s' but found %s",
+			expect, name, describeValue(val))}}
+	}
+	if arrayDim > 0 {
+		arr, ok := val.([]interface{})
+		if !ok {
+			return typeError(typename + strings.Repeat("[]", arrayDim))
+		}
+		var errs []error
+		for i, v := range arr {
+			errs = append(errs, checkInvocationArg(
+				fmt.Sprintf("%s[%d]", name, i), v,
+				typename, arrayDim-1, structType)...)
+		}
+		return errs
+	} else if elemType, elemDim, ok := syntax.ParseMapType(typename); ok {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return typeError(typename)
+		}
+		var errs []error
+		for _, key := range sortedKeys(m) {
+			errs = append(errs, checkInvocationArg(name+"."+key, m[key],
+				elemType, elemDim, structType)...)
+		}
+		return errs
+	} else if structType != nil {
+		members, ok := val.(map[string]interface{})
+		if !ok {
+			return typeError(typename)
+		}
+		var errs []error
+		for _, param := range structType.Members.List {
+			if v, ok := members[param.GetId()]; !ok {
+				errs = append(errs, &RuntimeError{fmt.Sprintf(
+					"Missing member '%s' of struct %s for '%s'",
+					param.GetId(), structType.Id, name)})
+			} else {
+				errs = append(errs, checkInvocationArg(
+					name+"."+param.GetId(), v, param.GetTname(),
+					param.GetArrayDim(), param.GetStructType())...)
+			}
+		}
+		for _, key := range sortedKeys(members) {
+			if _, ok := structType.Members.Table[key]; !ok {
+				errs = append(errs, &RuntimeError{fmt.Sprintf(
+					"Unexpected member '%s' of struct %s for '%s'",
+					key, structType.Id, name)})
+			}
+		}
+		return errs
+	}
+	switch typename {
+	case "int", "float", "bool", "map":
+		if !checkType(val, typename, 0, nil, nil) {
+			// Integer values are acceptable for floats.
+			if typename != "float" || !checkType(val, "int", 0, nil, nil) {
+				return typeError(typename)
+			}
+		}
+	case "string", "file":
+		if _, ok := val.(string); !ok {
+			return typeError(typename)
+		}
+	case "path":
+		p, ok := val.(string)
+		if !ok {
+			return typeError(typename)
+		} else if _, err := os.Stat(p); err != nil {
+			return []error{&RuntimeError{fmt.Sprintf(
+				"Path %s for '%s' does not exist", p, name)}}
+		}
+	default:
+		// User-defined file types.
+		p, ok := val.(string)
+		if !ok {
+			return typeError(typename)
+		} else if !strings.HasSuffix(p, "."+typename) {
+			return []error{&RuntimeError{fmt.Sprintf(
+				"Expected a .%s file for '%s' but found %s",
+				typename, name, p)}}
+		}
+	}
+	return nil
+}
+
+func describeValue(val interface{}) string {
+	switch val := val.(type) {
+	case string:
+		return fmt.Sprintf("string %q", val)
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "a map"
+	case json.Number, int, int64, float64:
+		return fmt.Sprintf("number %v", val)
+	case bool:
+		return fmt.Sprintf("bool %v", val)
+	default:
+		return reflect.TypeOf(val).String()
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 var (
 	jsonMarshalerType   = reflect.TypeOf(new(json.Marshaler)).Elem()
 	jsonUnmarshalerType = reflect.TypeOf(new(json.Unmarshaler)).Elem()
@@ -5,6 +5,8 @@ package core
 import (
 	"encoding/json"
 	"github.com/martian-lang/martian/martian/syntax"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -116,6 +118,191 @@ func TestArgumentMapValidate(t *testing.T) {
 	}
 }
 
+func TestArgumentMapValidateStruct(t *testing.T) {
+	args := make(ArgumentMap)
+	if err := json.Unmarshal([]byte(`{
+		"point": { "x": 1, "y": 2 },
+		"points": [{ "x": 3, "y": 4.5 }]
+	}`), &args); err != nil {
+		t.Errorf("Unmarshal failure: %v", err)
+	}
+	point := &syntax.StructType{
+		Id: "POINT",
+		Members: &syntax.Params{
+			Table: make(map[string]syntax.Param),
+		},
+	}
+	for _, id := range []string{"x", "y"} {
+		member := &syntax.InParam{Id: id, Tname: "int"}
+		point.Members.List = append(point.Members.List, member)
+		point.Members.Table[id] = member
+	}
+	plist := []syntax.Param{
+		&syntax.OutParam{
+			Id:     "point",
+			Tname:  "POINT",
+			Struct: point,
+		},
+		&syntax.OutParam{
+			Id:       "points",
+			Tname:    "POINT",
+			ArrayDim: 1,
+			Struct:   point,
+		},
+	}
+	params := syntax.Params{
+		Table: make(map[string]syntax.Param, len(plist)),
+		List:  plist,
+	}
+	for _, p := range plist {
+		params.Table[p.GetId()] = p
+	}
+	if err, alarms := args.Validate(&params, false); err == nil {
+		t.Errorf("Expected error from float member, got none.")
+	} else if strings.TrimSpace(err.Error()) !=
+		"Expected POINT output value 'points' has incorrect type []interface {}" {
+		t.Errorf("Incorrect validation error %v", err)
+	} else if strings.TrimSpace(alarms) !=
+		"Expected int member 'y' of struct POINT has incorrect type json.Number." {
+		t.Errorf("Incorrect validation alarms %s", alarms)
+	}
+	point.Members.Table["y"].(*syntax.InParam).Tname = "float"
+	if err, alarms := args.Validate(&params, false); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	} else if alarms != "" {
+		t.Errorf("Didn't expect a soft error message, got %s", alarms)
+	}
+	delete(args["point"].(map[string]interface{}), "y")
+	args["point"].(map[string]interface{})["z"] = 1
+	if err, alarms := args.Validate(&params, false); err == nil {
+		t.Errorf("Expected error from missing member, got none.")
+	} else if strings.TrimSpace(alarms) != "Missing member 'y' of struct POINT." {
+		t.Errorf("Incorrect validation alarms %s", alarms)
+	}
+}
+
+func TestArgumentMapValidateTypedMap(t *testing.T) {
+	args := make(ArgumentMap)
+	if err := json.Unmarshal([]byte(`{
+		"counts": { "a": 1, "b": null },
+		"lanes": { "a": [1, 2], "b": [] }
+	}`), &args); err != nil {
+		t.Errorf("Unmarshal failure: %v", err)
+	}
+	plist := []syntax.Param{
+		&syntax.InParam{
+			Id:    "counts",
+			Tname: "map<int>",
+		},
+		&syntax.InParam{
+			Id:    "lanes",
+			Tname: "map<int[]>",
+		},
+	}
+	params := syntax.Params{
+		Table: make(map[string]syntax.Param, len(plist)),
+		List:  plist,
+	}
+	for _, p := range plist {
+		params.Table[p.GetId()] = p
+	}
+	if err, alarms := args.Validate(&params, true); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	} else if alarms != "" {
+		t.Errorf("Didn't expect a soft error message, got %s", alarms)
+	}
+	args["counts"].(map[string]interface{})["c"] = "three"
+	if err, _ := args.Validate(&params, true); err == nil {
+		t.Errorf("Expected error from string value, got none.")
+	} else if strings.TrimSpace(err.Error()) !=
+		"Expected map<int> input parameter 'counts' has incorrect type map[string]interface {}" {
+		t.Errorf("Incorrect validation error %v", err)
+	}
+	delete(args["counts"].(map[string]interface{}), "c")
+	args["lanes"] = map[string]interface{}{"a": json.Number("1")}
+	if err, _ := args.Validate(&params, true); err == nil {
+		t.Errorf("Expected error from non-array value, got none.")
+	}
+}
+
+func TestArgumentMapValidateInvocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestArgumentMapValidateInvocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	point := &syntax.StructType{
+		Id: "POINT",
+		Members: &syntax.Params{
+			Table: make(map[string]syntax.Param),
+		},
+	}
+	for _, id := range []string{"x", "y"} {
+		member := &syntax.InParam{Id: id, Tname: "int"}
+		point.Members.List = append(point.Members.List, member)
+		point.Members.Table[id] = member
+	}
+	plist := []syntax.Param{
+		&syntax.InParam{Id: "count", Tname: "int"},
+		&syntax.InParam{Id: "ratio", Tname: "float"},
+		&syntax.InParam{Id: "reads", Tname: "bam", ArrayDim: 1},
+		&syntax.InParam{Id: "ref", Tname: "path"},
+		&syntax.InParam{Id: "origin", Tname: "POINT", Struct: point},
+		&syntax.InParam{
+			Id:      "label",
+			Tname:   "string",
+			Default: &syntax.ValExp{Kind: syntax.KindNull},
+		},
+	}
+	params := syntax.Params{
+		Table: make(map[string]syntax.Param, len(plist)),
+		List:  plist,
+	}
+	for _, p := range plist {
+		params.Table[p.GetId()] = p
+	}
+	args := ArgumentMap{
+		"count":  []interface{}{int64(1), int64(2)},
+		"reads":  []interface{}{"a.bam", "b.bam"},
+		"ref":    dir,
+		"origin": map[string]interface{}{"x": int64(0), "y": int64(0)},
+	}
+	// Parameters which are not given, like ratio, are passed as null.
+	if err := args.ValidateInvocation(&params, []string{"count"}); err != nil {
+		t.Errorf("Expected success, got %v", err)
+	}
+	args["count"] = "three"
+	args["reads"] = []interface{}{"a.bam", "b.sam"}
+	args["ref"] = dir + "/missing"
+	args["origin"] = map[string]interface{}{"x": 1.5, "z": int64(0)}
+	args["extra"] = true
+	if err := args.ValidateInvocation(&params, []string{"count", "nope"}); err == nil {
+		t.Errorf("Expected errors, got none.")
+	} else if errs, ok := err.(syntax.ErrorList); !ok {
+		t.Errorf("Expected an error list, got %v", err)
+	} else {
+		expect := []string{
+			"RuntimeError: Cannot sweep over undeclared parameter 'nope'.",
+			"RuntimeError: Swept parameter 'count' must be given an array of values.",
+			"RuntimeError: Expected a .bam file for 'reads[1]' but found b.sam.",
+			"RuntimeError: Path " + dir + "/missing for 'ref' does not exist.",
+			"RuntimeError: Expected int for 'origin.x' but found number 1.5.",
+			"RuntimeError: Missing member 'y' of struct POINT for 'origin'.",
+			"RuntimeError: Unexpected member 'z' of struct POINT for 'origin'.",
+			"RuntimeError: Unexpected parameter 'extra'.",
+		}
+		if len(errs) != len(expect) {
+			t.Errorf("Expected %d errors, got\n%v", len(expect), err)
+		} else {
+			for i, e := range errs {
+				if e.Error() != expect[i] {
+					t.Errorf("Expected %q, got %q", expect[i], e.Error())
+				}
+			}
+		}
+	}
+}
+
 type toyStruct struct {
 	Iface  interface{}
 	Map    map[string]int
@@ -5,6 +5,8 @@ package core
 // Methods to resolve argument and output bindings.
 
 import (
+	"fmt"
+
 	"github.com/martian-lang/martian/martian/syntax"
 )
 
@@ -20,6 +22,7 @@ type Binding struct {
 	tname       string
 	sweep       bool
 	sweepRootId string
+	split       bool
 	waiting     bool
 	valexp      string
 	mode        string
@@ -38,6 +41,7 @@ type BindingInfo struct {
 	Output      string      `json:"output"`
 	Sweep       bool        `json:"sweep"`
 	SweepRootId string      `json:"sweepRootId"`
+	Split       bool        `json:"split,omitempty"`
 	Node        interface{} `json:"node"`
 	MatchedFork interface{} `json:"matchedFork"`
 	Value       interface{} `json:"value"`
@@ -59,6 +63,7 @@ func (self *Binding) preBind(exp syntax.Exp, sweep, returnBinding bool) {
 				self.tname = parentBinding.tname
 				self.sweep = parentBinding.sweep
 				self.sweepRootId = parentBinding.sweepRootId
+				self.split = parentBinding.split
 				self.waiting = parentBinding.waiting
 				self.mode = parentBinding.mode
 				self.parentNode = parentBinding.parentNode
@@ -68,14 +73,22 @@ func (self *Binding) preBind(exp syntax.Exp, sweep, returnBinding bool) {
 			}
 			self.valexp = "self." + valueExp.Id
 		} else if valueExp.Kind == syntax.KindCall {
-			if returnBinding {
-				self.parentNode = self.node.subnodes[valueExp.Id]
-				self.boundNode, self.output, self.mode, self.value = self.node.findBoundNode(
-					valueExp.Id, valueExp.OutputId, "reference", nil)
-			} else {
-				self.parentNode = self.node.parent.getNode().subnodes[valueExp.Id]
-				self.boundNode, self.output, self.mode, self.value = self.node.parent.getNode().findBoundNode(
-					valueExp.Id, valueExp.OutputId, "reference", nil)
+			scope := self.node
+			if !returnBinding {
+				scope = self.node.parent.getNode()
+			}
+			self.parentNode = scope.subnodes[valueExp.Id]
+			self.boundNode, self.output, self.mode, self.value = scope.findBoundNode(
+				valueExp.Id, valueExp.OutputId, "reference", nil)
+			if scope.mapped {
+				// Within a mapped pipeline, the outputs of stages are
+				// collected into arrays with one element for each run.
+				self.split = true
+				if sub := self.parentNode.getNode(); sub.kind == "pipeline" {
+					if ret := sub.retbindings[valueExp.OutputId]; ret != nil {
+						self.split = ret.split
+					}
+				}
 			}
 			if valueExp.OutputId == "default" {
 				self.valexp = valueExp.Id
@@ -101,9 +114,14 @@ func (self *Binding) preBind(exp syntax.Exp, sweep, returnBinding bool) {
 				if b.mode != "value" {
 					useValue = false
 				}
+				// In a mapped pipeline, an array holding per-element
+				// values is split element-wise.
+				if b.split {
+					self.split = true
+				}
 				valueBindings = append(valueBindings, b)
 			}
-			if !useValue {
+			if !useValue || self.split {
 				self.mode = "array"
 				self.parentNode = self.node
 				self.boundNode = self.node
@@ -127,6 +145,7 @@ func newBinding(node *Node, bindStm *syntax.BindStm, returnBinding bool) *Bindin
 	self.sweepRootId = bindStm.Id
 	self.waiting = false
 	self.preBind(bindStm.Exp, bindStm.Sweep, returnBinding)
+	self.split = self.split || bindStm.Split
 	return self
 }
 
@@ -202,6 +221,7 @@ func (self *Binding) serializeState(argPermute map[string]interface{}) *BindingI
 		Output:      self.output,
 		Sweep:       self.sweep,
 		SweepRootId: self.sweepRootId,
+		Split:       self.split,
 		Node:        node,
 		MatchedFork: matchedFork,
 		Value:       self.resolve(argPermute),
@@ -209,6 +229,49 @@ func (self *Binding) serializeState(argPermute map[string]interface{}) *BindingI
 	}
 }
 
+// Get the element for the i'th run of a mapped call from the resolved value
+// of a split binding, where the call runs length times.  Arrays holding
+// per-element values are split element-wise.
+func (self *Binding) element(value interface{}, i, length int,
+	fqname string) (interface{}, error) {
+	if self.mode == "array" {
+		inner := self.value.([]*Binding)
+		vals, _ := value.([]interface{})
+		elementWise := false
+		for _, binding := range inner {
+			elementWise = elementWise || binding.split
+		}
+		if elementWise && len(vals) == len(inner) {
+			result := make([]interface{}, len(inner))
+			for j, binding := range inner {
+				if !binding.split {
+					result[j] = vals[j]
+				} else if elem, err := binding.element(
+					vals[j], i, length, fqname); err != nil {
+					return nil, err
+				} else {
+					result[j] = elem
+				}
+			}
+			return result, nil
+		}
+	}
+	switch val := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		if len(val) != length {
+			return nil, fmt.Errorf(
+				"Split parameter '%s' of mapped call %s has %d elements, but other split parameters have %d.",
+				self.id, fqname, len(val), length)
+		}
+		return val[i], nil
+	}
+	return nil, fmt.Errorf(
+		"Split parameter '%s' of mapped call %s was not an array.",
+		self.id, fqname)
+}
+
 func resolveBindings(bindings map[string]*Binding, argPermute map[string]interface{}) map[string]interface{} {
 	resolvedBindings := map[string]interface{}{}
 	for id, binding := range bindings {
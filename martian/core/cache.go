@@ -0,0 +1,396 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Content-addressed caching of stage results across pipestances.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Information about the cache entry which satisfied a fork, written to the
+// fork's _cached metadata file.
+type CacheInfo struct {
+	Key    string `json:"key"`
+	Origin string `json:"origin"`
+}
+
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// Computes and remembers hashes of file contents.
+type fileHasher struct {
+	mutex  sync.Mutex
+	hashes map[string]fileHash
+	dirs   map[string]string
+}
+
+func newFileHasher() *fileHasher {
+	return &fileHasher{
+		hashes: make(map[string]fileHash),
+		dirs:   make(map[string]string),
+	}
+}
+
+// A content-addressed cache of stage results, which may be shared between
+// pipestances on the same filesystem.
+//
+// Entries are keyed by a hash of the stage code, the resolved arguments, and
+// the contents of any files referenced by the arguments, so that a stage
+// which consumes the same data produced by a different pipestance still finds
+// its entry.  Each entry is a directory holding the stage outputs and hard
+// links to the output files, so it remains valid after the pipestance which
+// created it is removed.
+type StageCache struct {
+	*fileHasher
+	path string
+}
+
+func NewStageCache(p string) *StageCache {
+	return &StageCache{
+		fileHasher: newFileHasher(),
+		path:       p,
+	}
+}
+
+func (self *StageCache) entryPath(key string) string {
+	return path.Join(self.path, key[:2], key)
+}
+
+// Apply f to every string in a value deserialized from json, returning a
+// copy of the value with the strings replaced.
+func mapStrings(val interface{}, f func(string) (string, error)) (interface{}, error) {
+	switch val := val.(type) {
+	case string:
+		return f(val)
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, v := range val {
+			var err error
+			if result[i], err = mapStrings(v, f); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			var err error
+			if result[k], err = mapStrings(v, f); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return val, nil
+	}
+}
+
+// Hash the contents of a file.  Hashes are remembered for as long as the
+// file's size and modification time are unchanged.
+func (self *fileHasher) hashFile(p string, info os.FileInfo) (string, error) {
+	self.mutex.Lock()
+	cached, ok := self.hashes[p]
+	self.mutex.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	self.mutex.Lock()
+	self.hashes[p] = fileHash{info.Size(), info.ModTime(), hash}
+	self.mutex.Unlock()
+	return hash, nil
+}
+
+// Hash the contents of a file, or of all of the files in a directory.
+//
+// For stage code, compiled python files are ignored, and directory hashes
+// are computed only once per process.
+func (self *fileHasher) hashPath(p string, code bool) (string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return self.hashFile(p, info)
+	}
+	if code {
+		self.mutex.Lock()
+		hash, ok := self.dirs[p]
+		self.mutex.Unlock()
+		if ok {
+			return hash, nil
+		}
+	}
+	h := sha256.New()
+	if err := filepath.Walk(p, func(fn string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(p, fn)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if code && info.Name() == "__pycache__" {
+				return filepath.SkipDir
+			}
+			fmt.Fprintf(h, "d %s\n", rel)
+			return nil
+		} else if code && strings.HasSuffix(fn, ".pyc") {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(fn); err != nil || !target.Mode().IsRegular() {
+				dest, _ := os.Readlink(fn)
+				fmt.Fprintf(h, "l %s %s\n", rel, dest)
+				return nil
+			} else {
+				info = target
+			}
+		}
+		hash, err := self.hashFile(fn, info)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "f %s %s\n", rel, hash)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	if code {
+		self.mutex.Lock()
+		self.dirs[p] = hash
+		self.mutex.Unlock()
+	}
+	return hash, nil
+}
+
+// Replace absolute paths to existing files with a hash of their content.
+func (self *StageCache) canonicalArg(s string) (string, error) {
+	if !filepath.IsAbs(s) {
+		return s, nil
+	} else if _, err := os.Stat(s); err != nil {
+		return s, nil
+	}
+	hash, err := self.hashPath(s, false)
+	if err != nil {
+		return s, err
+	}
+	return "sha256:" + hash, nil
+}
+
+// Compute the cache key for a fork of a stage with the given resolved
+// argument bindings.
+func (self *StageCache) forkKey(fork *Fork, bindings map[string]interface{}) (string, error) {
+	code, err := self.codeHash(fork.node)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "code %s\n", code)
+	args, err := mapStrings(map[string]interface{}(bindings), self.canonicalArg)
+	if err != nil {
+		return "", err
+	}
+	if b, err := json.Marshal(args); err != nil {
+		return "", err
+	} else {
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Recreate a file or directory tree at dest using hard links, falling back
+// on symlinks if the source is on a different filesystem.
+func linkTree(src, dest string) error {
+	if err := util.MkdirAll(path.Dir(dest)); err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(fn string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, fn)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dest, rel)
+		if info.IsDir() {
+			return util.Mkdir(target)
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(fn)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		} else if err := os.Link(fn, target); err != nil {
+			return os.Symlink(fn, target)
+		}
+		return nil
+	})
+}
+
+// Save the outputs of a completed fork.  Files referenced by the outputs
+// which are inside root are linked into the cache entry.
+func (self *StageCache) store(key, root string, outs interface{}) error {
+	entry := self.entryPath(key)
+	if _, err := os.Stat(entry); err == nil {
+		return nil
+	}
+	if err := util.MkdirAll(path.Dir(entry)); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(path.Dir(entry), "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	files := path.Join(entry, "files")
+	outs, err = mapStrings(outs, func(s string) (string, error) {
+		rel, err := filepath.Rel(root, s)
+		if !filepath.IsAbs(s) || err != nil || strings.HasPrefix(rel, "..") {
+			return s, nil
+		}
+		// The stage may have declared a file which it did not create.
+		if _, err := os.Lstat(s); err == nil {
+			if err := linkTree(s, path.Join(tmp, "files", rel)); err != nil {
+				return s, err
+			}
+		}
+		return path.Join(files, rel), nil
+	})
+	if err != nil {
+		return err
+	}
+	if b, err := json.MarshalIndent(outs, "", "    "); err != nil {
+		return err
+	} else if err := ioutil.WriteFile(
+		path.Join(tmp, OutsFile.FileName()), b, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(tmp, "_origin"),
+		[]byte(root), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, entry); err != nil {
+		// Another pipestance may have stored the same entry first.
+		if _, serr := os.Stat(entry); serr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load the outputs for a cache entry, linking any files it contains into
+// filesPath.  Returns an error satisfying os.IsNotExist if there is no entry
+// for the key.
+func (self *StageCache) restore(key, filesPath string) (interface{}, *CacheInfo, error) {
+	entry := self.entryPath(key)
+	data, err := ioutil.ReadFile(path.Join(entry, OutsFile.FileName()))
+	if err != nil {
+		return nil, nil, err
+	}
+	var outs interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&outs); err != nil {
+		return nil, nil, err
+	}
+	info := &CacheInfo{Key: key}
+	if origin, err := ioutil.ReadFile(path.Join(entry, "_origin")); err == nil {
+		info.Origin = string(origin)
+	}
+	files := path.Join(entry, "files")
+	outs, err = mapStrings(outs, func(s string) (string, error) {
+		rel, err := filepath.Rel(files, s)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return s, nil
+		}
+		dest := path.Join(filesPath, rel)
+		if _, err := os.Lstat(s); err == nil {
+			if _, err := os.Lstat(dest); err != nil {
+				if err := linkTree(s, dest); err != nil {
+					return s, err
+				}
+			}
+		}
+		return dest, nil
+	})
+	return outs, info, err
+}
+
+// Satisfy the fork from the stage cache, if there is an entry for it.
+// Returns true if the fork's outputs were restored.
+func (self *Fork) restoreFromCache(bindings map[string]interface{}) bool {
+	cache := self.node.rt.cache
+	if cache == nil || self.node.preflight {
+		return false
+	}
+	key, err := cache.forkKey(self, bindings)
+	if err != nil {
+		util.LogError(err, "cache", "Could not compute cache key for %s", self.fqname)
+		return false
+	}
+	self.cacheKey = key
+	outs, info, err := cache.restore(key, self.metadata.curFilesPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			util.LogError(err, "cache", "Could not restore %s from the cache", self.fqname)
+		}
+		return false
+	}
+	self.metadata.Write(OutsFile, outs)
+	self.metadata.Write(CachedFile, info)
+	self.metadata.WriteTime(CompleteFile)
+	self.lastPrint = time.Now()
+	util.PrintInfo("runtime", "(cached)          %s: reusing results from %s",
+		self.fqname, info.Origin)
+	return true
+}
+
+// Save the outputs of a completed fork in the stage cache.
+func (self *Fork) storeInCache(outs interface{}) {
+	cache := self.node.rt.cache
+	if cache == nil || self.node.preflight || self.metadata.exists(CachedFile) {
+		return
+	}
+	if self.cacheKey == "" {
+		key, err := cache.forkKey(self,
+			resolveBindings(self.node.argbindings, self.argPermute))
+		if err != nil {
+			util.LogError(err, "cache", "Could not compute cache key for %s", self.fqname)
+			return
+		}
+		self.cacheKey = key
+	}
+	if err := cache.store(self.cacheKey, self.path, outs); err != nil {
+		util.LogError(err, "cache", "Could not cache results for %s", self.fqname)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+func writeTestFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStageCacheKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStageCacheKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	code := path.Join(dir, "stages", "sort")
+	writeTestFile(t, path.Join(code, "__init__.py"), "def main(args, outs): pass\n")
+	writeTestFile(t, path.Join(code, "__init__.pyc"), "compiled")
+	a := path.Join(dir, "ps1", "files", "reads.bam")
+	b := path.Join(dir, "ps2", "files", "reads.bam")
+	writeTestFile(t, a, "reads")
+	writeTestFile(t, b, "reads")
+	fork := &Fork{node: &Node{
+		callableId:    "SORT",
+		stagecodeCmd:  code,
+		stagecodeLang: syntax.PythonStage,
+		callable: &syntax.Stage{
+			Id:        "SORT",
+			OutParams: &syntax.Params{},
+		},
+	}}
+	keyFor := func(cache *StageCache, reads string) string {
+		t.Helper()
+		key, err := cache.forkKey(fork, map[string]interface{}{
+			"reads": []interface{}{reads},
+			"count": json.Number("1"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	cache := NewStageCache(path.Join(dir, "cache"))
+	key := keyFor(cache, a)
+	if other := keyFor(cache, b); other != key {
+		t.Errorf("Expected inputs with the same content to share a key.")
+	}
+	writeTestFile(t, b, "other reads")
+	if other := keyFor(cache, b); other == key {
+		t.Errorf("Expected inputs with different content to change the key.")
+	}
+	writeTestFile(t, path.Join(code, "__init__.pyc"), "recompiled")
+	if other := keyFor(NewStageCache(cache.path), a); other != key {
+		t.Errorf("Expected compiled python files to be ignored.")
+	}
+	writeTestFile(t, path.Join(code, "__init__.py"), "def main(args, outs): return\n")
+	if other := keyFor(NewStageCache(cache.path), a); other == key {
+		t.Errorf("Expected stage code changes to change the key.")
+	}
+}
+
+func TestStageCacheStoreRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStageCacheStoreRestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := NewStageCache(path.Join(dir, "cache"))
+	key := "0123456789abcdef"
+	if _, _, err := cache.restore(key, dir); !os.IsNotExist(err) {
+		t.Errorf("Expected a cache miss, got %v", err)
+	}
+
+	root := path.Join(dir, "ps1", "SORT", "fork0")
+	writeTestFile(t, path.Join(root, "join", "files", "sorted.bam"), "sorted")
+	writeTestFile(t, path.Join(root, "join", "files", "index", "a.bai"), "index")
+	outs := map[string]interface{}{
+		"sorted":  path.Join(root, "join", "files", "sorted.bam"),
+		"index":   path.Join(root, "join", "files", "index"),
+		"missing": path.Join(root, "join", "files", "missing.txt"),
+		"outside": path.Join(dir, "reference.fa"),
+		"count":   json.Number("3"),
+	}
+	if err := cache.store(key, root, outs); err != nil {
+		t.Fatal(err)
+	}
+	// The entry must not depend on the original pipestance.
+	if err := os.RemoveAll(path.Join(dir, "ps1")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := path.Join(dir, "ps2", "SORT", "fork0", "files")
+	restored, info, err := cache.restore(key, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != key || info.Origin != root {
+		t.Errorf("Incorrect cache info %v", info)
+	}
+	m := restored.(map[string]interface{})
+	if s := m["sorted"]; s != path.Join(files, "join", "files", "sorted.bam") {
+		t.Errorf("Incorrect restored path %v", s)
+	} else if b, err := ioutil.ReadFile(s.(string)); err != nil {
+		t.Error(err)
+	} else if string(b) != "sorted" {
+		t.Errorf("Incorrect restored content %q", b)
+	}
+	if b, err := ioutil.ReadFile(path.Join(
+		m["index"].(string), "a.bai")); err != nil {
+		t.Error(err)
+	} else if string(b) != "index" {
+		t.Errorf("Incorrect restored content %q", b)
+	}
+	if s := m["missing"]; s != path.Join(files, "join", "files", "missing.txt") {
+		t.Errorf("Incorrect restored path %v", s)
+	}
+	if s := m["outside"]; s != path.Join(dir, "reference.fa") {
+		t.Errorf("Expected paths outside the fork to be unchanged, got %v", s)
+	}
+	if c := m["count"]; c != json.Number("3") {
+		t.Errorf("Incorrect restored value %v", c)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Automatic escalation of memory reservations for jobs which ran out of
+// memory.
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The factor by which a job's memory reservation is multiplied each time it
+// runs out of memory.
+const memEscalationFactor = 2
+
+// Errors which indicate that a job ran out of memory, either because mrjob
+// or the cluster killed it for exceeding its reservation, or because an
+// allocation failed.
+var memoryErrorRegexps = []*regexp.Regexp{
+	regexp.MustCompile("exceeded its memory quota"),
+	regexp.MustCompile("^MemoryError"),
+	regexp.MustCompile("Cannot allocate memory"),
+	regexp.MustCompile("std::bad_alloc"),
+	regexp.MustCompile("(?i)out of memory"),
+	regexp.MustCompile("TERM_MEMLIMIT"),
+	regexp.MustCompile("(?i)exceeded (?:job )?memory limit"),
+	regexp.MustCompile("(?i)oom[-_ ]kill"),
+}
+
+// Get the resources for the chunk or join job with the given metadata, or
+// nil if it is not one of this fork's chunk or join jobs.
+func (self *Fork) jobResources(metadata *Metadata) *JobResources {
+	if metadata == self.join_metadata {
+		if self.stageDefs != nil {
+			return self.stageDefs.JoinDef
+		}
+		return nil
+	}
+	for _, chunk := range self.chunks {
+		if chunk.metadata == metadata && chunk.chunkDef != nil {
+			return chunk.chunkDef.Resources
+		}
+	}
+	return nil
+}
+
+// If a chunk or join job failed because it ran out of memory, reset it to
+// run again with a larger memory reservation, up to the ceiling given by
+// the --mem-escalation option.  Returns true if the job was reset.
+func (self *Fork) escalateMemory(metadata *Metadata, errlog string) bool {
+	ceiling := self.node.rt.Config.MaxEscalatedMemGB
+	if ceiling <= 0 || !errorMatches(errlog, memoryErrorRegexps) {
+		return false
+	}
+	jobDef := self.jobResources(metadata)
+	if jobDef == nil {
+		return false
+	}
+	var jobInfo JobInfo
+	if err := metadata.ReadInto(JobInfoFile, &jobInfo); err != nil ||
+		jobInfo.MemGB <= 0 || jobInfo.MemGB >= ceiling ||
+		jobDef.escalatedMemGB > jobInfo.MemGB {
+		// If the job ran with less than the escalated reservation, the
+		// job manager could not provide any more.
+		return false
+	}
+	memGB := jobInfo.MemGB * memEscalationFactor
+	if memGB > ceiling {
+		memGB = ceiling
+	}
+	attempts := append(self.getAttempts(), JobAttempt{
+		Job:            metadata.fqname,
+		Time:           util.Timestamp(),
+		Error:          errlog,
+		EscalatedMemGB: memGB,
+	})
+	self.metadata.Write(AttemptsFile, attempts)
+	util.PrintInfo("runtime", "(escalate)        %s: ran out of memory with %d GB, retrying with %d GB",
+		metadata.fqname, jobInfo.MemGB, memGB)
+	if err := metadata.checkedReset(); err != nil {
+		util.LogError(err, "runtime", "Could not reset %s for retry",
+			metadata.fqname)
+		return false
+	}
+	if jobDef.memGBEscalatedFrom == 0 {
+		if jobInfo.MemGBEscalatedFrom != 0 {
+			jobDef.memGBEscalatedFrom = jobInfo.MemGBEscalatedFrom
+		} else {
+			jobDef.memGBEscalatedFrom = jobInfo.MemGB
+		}
+	}
+	jobDef.escalatedMemGB = memGB
+	self.setHasRun(metadata, false)
+	self.lastPrint = time.Now()
+	return true
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEscalateMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestEscalateMemory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overrides, err := ReadOverrides("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &Node{
+		rt: &Runtime{
+			Config:    &RuntimeOptions{MaxEscalatedMemGB: 12},
+			overrides: overrides,
+		},
+		fqname: "ID.test.SORT",
+	}
+	fork := &Fork{
+		node:     node,
+		fqname:   "ID.test.SORT.fork0",
+		metadata: NewMetadata("ID.test.SORT.fork0", path.Join(dir, "fork0")),
+	}
+	chunk := &Chunk{
+		fork:       fork,
+		fqname:     "ID.test.SORT.fork0.chnk0",
+		metadata:   NewMetadata("ID.test.SORT.fork0.chnk0", path.Join(dir, "fork0", "chnk0")),
+		chunkDef:   &ChunkDef{Resources: &JobResources{}},
+		hasBeenRun: true,
+	}
+	fork.chunks = []*Chunk{chunk}
+	for _, metadata := range []*Metadata{fork.metadata, chunk.metadata} {
+		if err := metadata.mkdirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const oom = "Stage exceeded its memory quota (using 5.0, allowed 4G)"
+
+	chunk.metadata.Write(JobInfoFile, &JobInfo{Name: chunk.fqname, MemGB: 4})
+	if fork.escalateMemory(chunk.metadata, "ValueError: bad input") {
+		t.Error("Expected other errors not to be escalated.")
+	}
+	if !fork.escalateMemory(chunk.metadata, oom) {
+		t.Fatal("Expected the chunk to be escalated.")
+	}
+	res := chunk.chunkDef.Resources
+	if res.escalatedMemGB != 8 || res.memGBEscalatedFrom != 4 {
+		t.Errorf("Expected escalation from 4 to 8 GB, got %d to %d",
+			res.memGBEscalatedFrom, res.escalatedMemGB)
+	}
+	if chunk.hasBeenRun {
+		t.Error("Expected the chunk to be allowed to run again.")
+	}
+	if attempts := fork.getAttempts(); len(attempts) != 1 ||
+		attempts[0].EscalatedMemGB != 8 {
+		t.Errorf("Incorrect attempts %v", attempts)
+	}
+
+	// The next escalation is limited by the ceiling.
+	chunk.metadata.Write(JobInfoFile, &JobInfo{
+		Name:               chunk.fqname,
+		MemGB:              8,
+		MemGBEscalatedFrom: 4,
+	})
+	if !fork.escalateMemory(chunk.metadata, oom) {
+		t.Fatal("Expected the chunk to be escalated again.")
+	}
+	if res.escalatedMemGB != 12 || res.memGBEscalatedFrom != 4 {
+		t.Errorf("Expected escalation from 4 to 12 GB, got %d to %d",
+			res.memGBEscalatedFrom, res.escalatedMemGB)
+	}
+
+	// Once at the ceiling, the job fails.
+	chunk.metadata.Write(JobInfoFile, &JobInfo{
+		Name:               chunk.fqname,
+		MemGB:              12,
+		MemGBEscalatedFrom: 4,
+	})
+	if fork.escalateMemory(chunk.metadata, oom) {
+		t.Error("Expected no escalation beyond the ceiling.")
+	}
+
+	perf := reduceJobInfo(&JobInfo{MemGB: 12, MemGBEscalatedFrom: 4}, nil, 1)
+	if perf.EscalatedJobs != 1 || perf.EscalatedMemGB != 12 {
+		t.Errorf("Expected the escalation in the perf info, got %d jobs, %d GB",
+			perf.EscalatedJobs, perf.EscalatedMemGB)
+	}
+}
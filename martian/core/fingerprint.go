@@ -0,0 +1,209 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Detection of stages whose code or inputs changed since they ran.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// Identifies the stage code and the resolved argument bindings with which a
+// fork ran.  Written to the fork's _fingerprint metadata file.
+type Fingerprint struct {
+	Code     string `json:"code"`
+	Bindings string `json:"bindings"`
+}
+
+func writeParamSignature(w io.Writer, mode string, params *syntax.Params) {
+	if params == nil {
+		return
+	}
+	for _, param := range params.List {
+		fmt.Fprintf(w, "%s %s %s %d %s\n", mode, param.GetId(),
+			param.GetTname(), param.GetArrayDim(), param.GetOutName())
+	}
+}
+
+// Hash the stage code and declaration for a node.
+func (self *fileHasher) codeHash(node *Node) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "stage %s\n", node.callableId)
+	cmd := strings.Split(node.stagecodeCmd, " ")
+	if code, err := self.hashPath(cmd[0], true); err != nil {
+		return "", err
+	} else {
+		fmt.Fprintf(h, "code %s %s %s\n",
+			node.stagecodeLang, code, strings.Join(cmd[1:], " "))
+	}
+	if node.mapped {
+		fmt.Fprintln(h, "mapped")
+	}
+	if stage, ok := node.callable.(*syntax.Stage); ok {
+		writeParamSignature(h, "in", stage.InParams)
+		writeParamSignature(h, "out", stage.OutParams)
+		if stage.Split {
+			writeParamSignature(h, "chunk in", stage.ChunkIns)
+			writeParamSignature(h, "chunk out", stage.ChunkOuts)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Compute the fingerprint for this fork with the given resolved bindings.
+func (self *Fork) fingerprint(bindings map[string]interface{}) (*Fingerprint, error) {
+	code, err := self.node.rt.hasher.codeHash(self.node)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(bindings)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return &Fingerprint{
+		Code:     code,
+		Bindings: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (self *Fork) writeFingerprint(bindings map[string]interface{}) {
+	if fp, err := self.fingerprint(bindings); err != nil {
+		util.LogError(err, "runtime", "Could not compute fingerprint for %s", self.fqname)
+	} else {
+		self.metadata.Write(FingerprintFile, fp)
+	}
+}
+
+// If the fork completed with a different fingerprint than it would have now,
+// returns a description of what changed.  Otherwise returns an empty string.
+func (self *Fork) changed() string {
+	if state, _ := self.metadata.getState(); state != Complete ||
+		!self.metadata.exists(FingerprintFile) {
+		return ""
+	}
+	var old Fingerprint
+	if err := self.metadata.ReadInto(FingerprintFile, &old); err != nil {
+		return ""
+	}
+	fp, err := self.fingerprint(resolveBindings(self.node.argbindings, self.argPermute))
+	if err != nil {
+		// If the stage code cannot be found, the stage will fail
+		// when it is next run anyway.
+		return ""
+	}
+	if fp.Code != old.Code {
+		return "stage code changed"
+	} else if fp.Bindings != old.Bindings {
+		return "bindings changed"
+	}
+	return ""
+}
+
+// Returns true if volatile data removal deleted any files from this node.
+func (self *Node) hadFilesRemoved() bool {
+	for _, fork := range self.forks {
+		if report, ok := fork.getVdrKillReport(); ok && report.Count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove all results for this node, regardless of its state, so that it will
+// run again from the beginning.
+func (self *Node) invalidate() error {
+	for _, fork := range self.forks {
+		if err := os.RemoveAll(fork.path); err != nil {
+			return err
+		}
+		fork.reset()
+		fork.cacheKey = ""
+	}
+	self.removeJournalFiles()
+	if err := self.mkdirs(); err != nil {
+		return err
+	}
+	self.loadMetadata()
+	return nil
+}
+
+// Reset stages which completed with different stage code or argument
+// bindings than they would run with now, along with everything downstream
+// of them and the pipelines which contain them.
+func (self *Pipestance) ResetChangedNodes() error {
+	if self.readOnly() {
+		return &RuntimeError{"Pipestance is in read only mode."}
+	}
+	reasons := make(map[*Node]string)
+	var queue []*Node
+	for _, node := range self.allNodes() {
+		for _, fork := range node.forks {
+			if reason := fork.changed(); reason != "" {
+				reasons[node] = reason
+				queue = append(queue, node)
+				break
+			}
+		}
+	}
+	if len(queue) == 0 {
+		return nil
+	}
+	// Everything downstream of a changed stage must run again, and so must
+	// the pipelines containing it, even if they do not return its outputs.
+	for i := 0; i < len(queue); i++ {
+		for _, post := range queue[i].postnodes {
+			if node := post.getNode(); reasons[node] == "" {
+				reasons[node] = "upstream stage " + queue[i].fqname + " changed"
+				queue = append(queue, node)
+			}
+		}
+		if queue[i].parent != nil {
+			if node := queue[i].parent.getNode(); node != queue[i] && reasons[node] == "" {
+				reasons[node] = "call " + queue[i].fqname + " changed"
+				queue = append(queue, node)
+			}
+		}
+	}
+	// So must anything upstream whose files were already removed.
+	for i := 0; i < len(queue); i++ {
+		if queue[i].kind != "stage" {
+			continue
+		}
+		for _, pre := range queue[i].prenodes {
+			if node := pre.getNode(); reasons[node] == "" && node.hadFilesRemoved() {
+				reasons[node] = "files needed by " + queue[i].fqname + " were removed"
+				queue = append(queue, node)
+			}
+		}
+	}
+	for _, node := range self.allNodes() {
+		if reason := reasons[node]; reason != "" {
+			util.PrintInfo("runtime", "(reset)           %s: %s", node.fqname, reason)
+			if err := node.invalidate(); err != nil {
+				return err
+			}
+		}
+	}
+	if reasons[self.node] != "" {
+		// Outputs moved to the top-level outs directory are stale.
+		if err := os.RemoveAll(path.Join(
+			self.node.parent.getNode().path, "outs")); err != nil {
+			return err
+		}
+	}
+	for _, node := range self.allNodes() {
+		node.state = node.getState()
+	}
+	return nil
+}
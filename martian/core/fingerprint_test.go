@@ -0,0 +1,140 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+func TestForkChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestForkChanged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	code := path.Join(dir, "stages", "sort")
+	writeTestFile(t, path.Join(code, "__init__.py"), "def main(args, outs): pass\n")
+	count := &Binding{id: "count", mode: "value", value: "1"}
+	node := &Node{
+		rt:            &Runtime{hasher: newFileHasher()},
+		callableId:    "SORT",
+		stagecodeCmd:  code,
+		stagecodeLang: syntax.PythonStage,
+		callable:      &syntax.Stage{Id: "SORT"},
+		argbindings:   map[string]*Binding{"count": count},
+	}
+	fork := &Fork{
+		node:       node,
+		fqname:     "ID.test.SORT.fork0",
+		metadata:   NewMetadata("ID.test.SORT.fork0", path.Join(dir, "fork0")),
+		argPermute: map[string]interface{}{},
+	}
+	if err := fork.metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	fork.writeFingerprint(resolveBindings(node.argbindings, fork.argPermute))
+	if reason := fork.changed(); reason != "" {
+		t.Errorf("Incomplete forks should not be checked, got %q", reason)
+	}
+	fork.metadata.WriteTime(CompleteFile)
+	if reason := fork.changed(); reason != "" {
+		t.Errorf("Expected no change, got %q", reason)
+	}
+	count.value = "2"
+	if reason := fork.changed(); reason != "bindings changed" {
+		t.Errorf("Expected bindings change, got %q", reason)
+	}
+	count.value = "1"
+	writeTestFile(t, path.Join(code, "__init__.py"), "def main(args, outs): return\n")
+	// Stage code hashes are only computed once per process.
+	node.rt.hasher = newFileHasher()
+	if reason := fork.changed(); reason != "stage code changed" {
+		t.Errorf("Expected stage code change, got %q", reason)
+	}
+}
+
+func TestResetChangedNodesUnreturned(t *testing.T) {
+	src := `
+stage SORT(
+    in  int count,
+    out int sorted,
+    src py  "stages/sort",
+)
+
+stage CHECK(
+    in  int sorted,
+    out int checked,
+    src py  "stages/check",
+)
+
+pipeline SORT_ALL(
+    in  int count,
+    out int sorted,
+)
+{
+    call SORT(
+        count = self.count,
+    )
+
+    call CHECK(
+        sorted = SORT.sorted,
+    )
+
+    return (
+        sorted = SORT.sorted,
+    )
+}
+
+call SORT_ALL(
+    count = 1,
+)
+`
+	dir := makeTestPipelineDir(t, src)
+	defer os.RemoveAll(dir)
+	run := func(metadata *Metadata, shellName string) {
+		completeTestJob(metadata, map[string]interface{}{
+			"sorted":  1,
+			"checked": 1,
+		})
+	}
+	rt, _ := newTestRuntime(DefaultRuntimeOptions(), run)
+	pipestance := invokeTestPipeline(t, rt, dir, src)
+	if state := runTestPipestance(t, pipestance); state != Complete {
+		t.Fatalf("Expected the pipestance to complete, got %v", state)
+	}
+	pipestance.Unlock()
+
+	// CHECK's outputs are not returned by the pipeline, but the pipeline
+	// is not complete until CHECK runs again.
+	writeTestFile(t, path.Join(dir, "stages", "check", "__init__.py"),
+		"def main(args, outs): return\n")
+	rt, jobManager := newTestRuntime(DefaultRuntimeOptions(), run)
+	pipestance, err := rt.ReattachToPipestance("test", path.Join(dir, "test"),
+		src, []string{dir}, "", nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipestance.Unlock()
+	pipestance.LoadMetadata()
+	if node := pipestance.node.find("ID.test.SORT_ALL"); node == nil {
+		t.Fatal("No SORT_ALL node.")
+	} else if state := node.getState(); state == Complete {
+		t.Error("Expected the pipeline to be reset.")
+	}
+	if state := runTestPipestance(t, pipestance); state != Complete {
+		t.Fatalf("Expected the pipestance to complete, got %v", state)
+	}
+	if jobManager.runCount("ID.test.SORT_ALL.CHECK.fork0.chnk0.main") != 1 {
+		t.Errorf("Expected the changed stage to run again, ran %v",
+			jobManager.jobs)
+	}
+	if jobManager.runCount("ID.test.SORT_ALL.SORT.fork0.chnk0.main") != 0 {
+		t.Errorf("Expected the unchanged stage not to run again, ran %v",
+			jobManager.jobs)
+	}
+}
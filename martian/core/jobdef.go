@@ -18,6 +18,15 @@ type JobResources struct {
 	Threads int    `json:"__threads,omitempty"`
 	MemGB   int    `json:"__mem_gb,omitempty"`
 	Special string `json:"__special,omitempty"`
+
+	// The wall clock time limit for each job, in seconds.  This comes from
+	// the stage declaration and is not passed to stage code.
+	Timeout int `json:"-"`
+
+	// If the job ran out of memory, the larger reservation to use when it
+	// runs again, and the reservation with which it originally ran.
+	escalatedMemGB     int
+	memGBEscalatedFrom int
 }
 
 func (self *JobResources) ToMap() ArgumentMap {
@@ -17,12 +17,17 @@ type JobInfo struct {
 	WallClockInfo *WallClockInfo    `json:"wallclock,omitempty"`
 	Threads       int               `json:"threads,omitempty"`
 	MemGB         int               `json:"memGB,omitempty"`
+	Timeout       int               `json:"timeout,omitempty"`
 	ProfileMode   ProfileMode       `json:"profile_mode,omitempty"`
 	Stackvars     string            `json:"stackvars_flag,omitempty"`
 	Monitor       string            `json:"monitor_flag,omitempty"`
 	Invocation    *InvocationData   `json:"invocation,omitempty"`
 	Version       *VersionInfo      `json:"version,omitempty"`
 	ClusterEnv    map[string]string `json:"sge,omitempty"`
+
+	// If the job's memory reservation was escalated after running out of
+	// memory, the reservation it originally ran with.
+	MemGBEscalatedFrom int `json:"memGB_escalated_from,omitempty"`
 }
 
 type PythonInfo struct {
@@ -7,6 +7,7 @@ package core
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -53,7 +55,8 @@ func max(a, b int) int {
 // Job managers
 //
 type JobManager interface {
-	execJob(string, []string, map[string]string, *Metadata, int, int, string, string, string, bool)
+	execJob(string, []string, map[string]string, *Metadata, int, int, string,
+		time.Duration, string, string, bool)
 	endJob(*Metadata)
 
 	// Given a list of candidate job IDs, returns a list of jobIds which may be
@@ -323,7 +326,8 @@ func (self *LocalJobManager) queueCheckGrace() time.Duration {
 
 func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	fqname string, retries int, waitTime int, localpreflight bool) {
+	timeout time.Duration, fqname string, retries int, waitTime int,
+	localpreflight bool) {
 
 	time.Sleep(time.Second * time.Duration(waitTime))
 	go func() {
@@ -435,7 +439,22 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 			return err
 		}(metadata, cmd)
 		if err == nil {
-			err = cmd.Wait()
+			if timeout > 0 {
+				// Stages run through mrjob enforce their own time limit,
+				// but exec stages do not.
+				var timedOut int32
+				timer := time.AfterFunc(timeout+killTimeoutGrace, func() {
+					atomic.StoreInt32(&timedOut, 1)
+					cmd.Process.Kill()
+				})
+				err = cmd.Wait()
+				timer.Stop()
+				if atomic.LoadInt32(&timedOut) != 0 {
+					err = errors.New(TimeoutMessage(timeout))
+				}
+			} else {
+				err = cmd.Wait()
+			}
 		}
 
 		// CentOS < 5.5 workaround
@@ -460,8 +479,8 @@ func (self *LocalJobManager) Enqueue(shellCmd string, argv []string,
 				}
 			} else {
 				util.LogInfo("jobmngr", "Job failed: %s. Retrying job %s in %d seconds", err.Error(), fqname, waitTime)
-				self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, retries,
-					waitTime, localpreflight)
+				self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, timeout,
+					fqname, retries, waitTime, localpreflight)
 			}
 		}
 
@@ -498,8 +517,10 @@ func (self *LocalJobManager) GetMaxMemGB() int {
 
 func (self *LocalJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, preflight bool) {
-	self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, fqname, 0, 0, preflight)
+	special string, timeout time.Duration, fqname string, shellName string,
+	preflight bool) {
+	self.Enqueue(shellCmd, argv, envs, metadata, threads, memGB, timeout,
+		fqname, 0, 0, preflight)
 }
 
 func (self *LocalJobManager) endJob(*Metadata) {}
@@ -604,11 +625,13 @@ func (self *RemoteJobManager) GetSystemReqs(threads int, memGB int) (int, int) {
 
 func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 	envs map[string]string, metadata *Metadata, threads int, memGB int,
-	special string, fqname string, shellName string, localpreflight bool) {
+	special string, timeout time.Duration, fqname string, shellName string,
+	localpreflight bool) {
 
 	// no limit, send the job
 	if self.maxJobs <= 0 {
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName)
+		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special,
+			timeout, fqname, shellName)
 		return
 	}
 
@@ -625,7 +648,8 @@ func (self *RemoteJobManager) execJob(shellCmd string, argv []string,
 		if self.debug {
 			util.LogInfo("jobmngr", "Job sent: %s", fqname)
 		}
-		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname, shellName)
+		self.sendJob(shellCmd, argv, envs, metadata, threads, memGB, special,
+			timeout, fqname, shellName)
 	}()
 }
 
@@ -650,7 +674,8 @@ func threadEnvs(self JobManager, threads int, envs map[string]string) map[string
 }
 
 func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[string]string,
-	metadata *Metadata, threads int, memGB int, special string, fqname string, shellName string) {
+	metadata *Metadata, threads int, memGB int, special string,
+	timeout time.Duration, fqname string, shellName string) {
 
 	if self.jobFreqMillis > 0 {
 		<-(self.limiter.C)
@@ -685,6 +710,7 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 				"__RESOURCES__", resources, 1)
 		}
 	}
+	walltime, walltimeMinutes := clusterTimeout(timeout)
 
 	argv = append(
 		util.FormatEnv(threadEnvs(self, threads, envs)),
@@ -708,6 +734,8 @@ func (self *RemoteJobManager) sendJob(shellCmd string, argv []string, envs map[s
 		"MEM_B_PER_THREAD":  fmt.Sprintf("%d", memGBPerThread*1024*1024*1024),
 		"ACCOUNT":           os.Getenv("MRO_ACCOUNT"),
 		"RESOURCES":         mappedJobResourcesOpt,
+		"TIMEOUT":           walltime,
+		"TIMEOUT_MIN":       walltimeMinutes,
 	}
 
 	// Replace template annotations with actual values
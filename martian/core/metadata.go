@@ -27,38 +27,41 @@ type MetadataFileName string
 
 const AnyFile MetadataFileName = "*"
 const (
-	AlarmFile      MetadataFileName = "alarm"
-	ArgsFile       MetadataFileName = "args"
-	Assert         MetadataFileName = "assert"
-	ChunkDefsFile  MetadataFileName = "chunk_defs"
-	ChunkOutsFile  MetadataFileName = "chunk_outs"
-	CompleteFile   MetadataFileName = "complete"
-	Errors         MetadataFileName = "errors"
-	FinalState     MetadataFileName = "finalstate"
-	Heartbeat      MetadataFileName = "heartbeat"
-	InvocationFile MetadataFileName = "invocation"
-	JobId          MetadataFileName = "jobid"
-	JobInfoFile    MetadataFileName = "jobinfo"
-	JobModeFile    MetadataFileName = "jobmode"
-	Lock           MetadataFileName = "lock"
-	LogFile        MetadataFileName = "log"
-	MetadataZip    MetadataFileName = "metadata.zip"
-	MroSourceFile  MetadataFileName = "mrosource"
-	OutsFile       MetadataFileName = "outs"
-	Perf           MetadataFileName = "perf"
-	ProgressFile   MetadataFileName = "progress"
-	QueuedLocally  MetadataFileName = "queued_locally"
-	Stackvars      MetadataFileName = "stackvars"
-	StageDefsFile  MetadataFileName = "stage_defs"
-	StdErr         MetadataFileName = "stderr"
-	StdOut         MetadataFileName = "stdout"
-	TagsFile       MetadataFileName = "tags"
-	TimestampFile  MetadataFileName = "timestamp"
-	UiPort         MetadataFileName = "uiport"
-	UuidFile       MetadataFileName = "uuid"
-	VdrKill        MetadataFileName = "vdrkill"
-	VersionsFile   MetadataFileName = "versions"
-	DisabledFile   MetadataFileName = "disabled"
+	AlarmFile       MetadataFileName = "alarm"
+	ArgsFile        MetadataFileName = "args"
+	Assert          MetadataFileName = "assert"
+	AttemptsFile    MetadataFileName = "attempts"
+	CachedFile      MetadataFileName = "cached"
+	ChunkDefsFile   MetadataFileName = "chunk_defs"
+	ChunkOutsFile   MetadataFileName = "chunk_outs"
+	CompleteFile    MetadataFileName = "complete"
+	Errors          MetadataFileName = "errors"
+	FinalState      MetadataFileName = "finalstate"
+	FingerprintFile MetadataFileName = "fingerprint"
+	Heartbeat       MetadataFileName = "heartbeat"
+	InvocationFile  MetadataFileName = "invocation"
+	JobId           MetadataFileName = "jobid"
+	JobInfoFile     MetadataFileName = "jobinfo"
+	JobModeFile     MetadataFileName = "jobmode"
+	Lock            MetadataFileName = "lock"
+	LogFile         MetadataFileName = "log"
+	MetadataZip     MetadataFileName = "metadata.zip"
+	MroSourceFile   MetadataFileName = "mrosource"
+	OutsFile        MetadataFileName = "outs"
+	Perf            MetadataFileName = "perf"
+	ProgressFile    MetadataFileName = "progress"
+	QueuedLocally   MetadataFileName = "queued_locally"
+	Stackvars       MetadataFileName = "stackvars"
+	StageDefsFile   MetadataFileName = "stage_defs"
+	StdErr          MetadataFileName = "stderr"
+	StdOut          MetadataFileName = "stdout"
+	TagsFile        MetadataFileName = "tags"
+	TimestampFile   MetadataFileName = "timestamp"
+	UiPort          MetadataFileName = "uiport"
+	UuidFile        MetadataFileName = "uuid"
+	VdrKill         MetadataFileName = "vdrkill"
+	VersionsFile    MetadataFileName = "versions"
+	DisabledFile    MetadataFileName = "disabled"
 )
 
 const MetadataFilePrefix string = "_"
@@ -136,6 +139,11 @@ type Metadata struct {
 	mutex         sync.Mutex
 	uniquifier    string
 
+	// If non-zero, the time limit for the running job, and the time after
+	// which it is considered to have exceeded that limit.
+	timeout  time.Duration
+	deadline time.Time
+
 	// A prefix to attach when writing journal file name.
 	// Empty for chunks, or SplitPrefix or JoinPrefix.
 	journalPrefix string
@@ -626,6 +634,8 @@ func (self *Metadata) clearReadCache() {
 
 func (self *Metadata) resetHeartbeat() {
 	self.lastHeartbeat = time.Time{}
+	self.timeout = 0
+	self.deadline = time.Time{}
 }
 
 // After a metadata refresh scan has completed, this is called.  If
@@ -788,11 +798,16 @@ func (self *Metadata) restartLocal() error {
 
 func (self *Metadata) checkHeartbeat() {
 	if state, _ := self.getState(); state == Running {
+		if self.lastHeartbeat.IsZero() {
+			self.timeout, self.deadline = self.timeoutDeadline()
+		}
 		if self.lastHeartbeat.IsZero() || self.exists(Heartbeat) {
 			self.uncache(Heartbeat)
 			self.lastHeartbeat = time.Now()
 		}
-		if self.lastRefresh.Sub(self.lastHeartbeat) > time.Minute*heartbeatTimeout {
+		if !self.deadline.IsZero() && self.lastRefresh.After(self.deadline) {
+			self.WriteRaw(Errors, TimeoutMessage(self.timeout))
+		} else if self.lastRefresh.Sub(self.lastHeartbeat) > time.Minute*heartbeatTimeout {
 			self.WriteRaw("errors", fmt.Sprintf(
 				"%s: No heartbeat detected for %d minutes. Assuming job has failed. This may be "+
 					"due to a user manually terminating the job, or the operating system or cluster "+
@@ -57,6 +57,9 @@ type Node struct {
 	metadata           *Metadata
 	callable           syntax.Callable
 	resources          *JobResources
+	threadsExp         syntax.ResourceExp
+	memGBExp           syntax.ResourceExp
+	retryPolicy        *RetryPolicy
 	argbindings        map[string]*Binding
 	argbindingList     []*Binding // for stable ordering
 	retbindings        map[string]*Binding
@@ -72,6 +75,8 @@ type Node struct {
 	volatile           bool
 	local              bool
 	preflight          bool
+	mapped             bool
+	mapRoot            *Node // the mapped call this node runs within, if any
 	disabled           []*Binding
 	modBindingList     []*Binding
 	stagecodeLang      syntax.StageCodeType
@@ -153,6 +158,13 @@ func NewNode(parent Nodable, kind string, callStm *syntax.CallStm, callables *sy
 	self.metadata = NewMetadata(self.fqname, self.path)
 	self.volatile = callStm.Modifiers.Volatile
 	self.preflight = callStm.Modifiers.Preflight
+	// Every call within a mapped pipeline is mapped over the same elements.
+	if callStm.Modifiers.Mapped {
+		self.mapRoot = self
+	} else {
+		self.mapRoot = parent.getNode().mapRoot
+	}
+	self.mapped = self.mapRoot != nil
 	if self.preflight || !self.rt.Config.NeverLocal {
 		self.local = callStm.Modifiers.Local
 	}
@@ -173,16 +185,54 @@ func NewNode(parent Nodable, kind string, callStm *syntax.CallStm, callables *sy
 		self.argbindings[id] = binding
 		self.argbindingList = append(self.argbindingList, binding)
 	}
-	self.disabled = parent.getNode().disabled
+	// Parameters which were not bound in the call use their default values.
+	for _, param := range self.callable.GetInParams().List {
+		if def := param.GetDefault(); def != nil && self.argbindings[param.GetId()] == nil {
+			binding := NewBinding(self, &syntax.BindStm{
+				Id:    param.GetId(),
+				Exp:   def,
+				Tname: param.GetTname(),
+			})
+			self.argbindings[param.GetId()] = binding
+			self.argbindingList = append(self.argbindingList, binding)
+		}
+	}
+	// Copy the parent's bindings so that appending to them does not clobber
+	// those of sibling nodes.
+	self.disabled = append([]*Binding(nil), parent.getNode().disabled...)
 	if callStm.Modifiers.Bindings != nil {
 		if disabled := callStm.Modifiers.Bindings.Table["disabled"]; disabled != nil {
-			binding := NewBinding(self, disabled)
-			self.disabled = append(self.disabled, binding)
+			// The node is disabled if any of the bindings is true, so a
+			// disjunction becomes one binding per reference.
+			if disj, ok := disabled.Exp.(*syntax.OrExp); ok {
+				for _, ref := range disj.Refs {
+					binding := NewBinding(self, &syntax.BindStm{
+						Node:  disabled.Node,
+						Id:    disabled.Id,
+						Exp:   ref,
+						Tname: disabled.Tname,
+					})
+					self.disabled = append(self.disabled, binding)
+				}
+			} else {
+				binding := NewBinding(self, disabled)
+				self.disabled = append(self.disabled, binding)
+			}
 		}
 		// Any future bindable modifiers here.
 	}
 	self.modBindingList = self.disabled
-	self.attachBindings(append(self.argbindingList, self.modBindingList...))
+	bindingList := append(self.argbindingList, self.modBindingList...)
+	if self.mapRoot != nil && self.mapRoot != self {
+		// The number of elements is not known until the split arguments
+		// of the mapped call are available.
+		for _, binding := range self.mapRoot.argbindingList {
+			if binding.split {
+				bindingList = append(bindingList, binding)
+			}
+		}
+	}
+	self.attachBindings(bindingList)
 
 	// Do not set state = getState here, or else nodes will wrongly report
 	// complete before the first refreshMetadata call
@@ -559,12 +609,7 @@ func (self *Node) reset() error {
 			util.PrintInfo("runtime", "Cannot reset the stage because its folder contents could not be deleted.\n\nPlease resolve this error in order to continue running the pipeline:")
 			return err
 		}
-		// Remove all related files from journal directory.
-		if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
-			for _, file := range files {
-				os.Remove(file)
-			}
-		}
+		self.removeJournalFiles()
 
 		// Clear chunks in the forks so they can be rebuilt on split.
 		for _, fork := range self.forks {
@@ -588,6 +633,15 @@ func (self *Node) reset() error {
 	return nil
 }
 
+// Remove all related files from journal directory.
+func (self *Node) removeJournalFiles() {
+	if files, err := filepath.Glob(path.Join(self.journalPath, self.fqname+"*")); err == nil {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+}
+
 func (self *Node) restartLocallyQueuedJobs() error {
 	if self.rt.Config.FullStageReset {
 		// If entire stages got blown away then this isn't needed.
@@ -702,14 +756,7 @@ func (self *Node) isErrorTransient() (bool, string) {
 		}
 		if metadata.exists(Errors) {
 			errlog := metadata.readRaw(Errors)
-			for _, line := range strings.Split(errlog, "\n") {
-				for _, re := range passRegexp {
-					if re.MatchString(line) {
-						return true, errlog
-					}
-				}
-			}
-			return false, errlog
+			return errorMatches(errlog, passRegexp), errlog
 		}
 	}
 	return true, ""
@@ -880,7 +927,8 @@ func (self *Node) serializePerf() *NodePerfInfo {
 //=============================================================================
 // Job Runners
 //=============================================================================
-func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int, string) {
+func (self *Node) getJobReqs(jobDef *JobResources, stageType string,
+	args map[string]interface{}) (int, int, string) {
 	threads := 0
 	memGB := 0
 	special := ""
@@ -891,6 +939,26 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 		special = self.resources.Special
 	}
 
+	// Evaluate resource expressions over the stage inputs.
+	if self.threadsExp != nil && args != nil {
+		if v, err := self.threadsExp.Eval(args); err != nil {
+			util.PrintInfo("runtime",
+				"Could not evaluate %s threads for %s: %v",
+				stageType, self.fqname, err)
+		} else {
+			threads = int(math.Ceil(v))
+		}
+	}
+	if self.memGBExp != nil && args != nil {
+		if v, err := self.memGBExp.Eval(args); err != nil {
+			util.PrintInfo("runtime",
+				"Could not evaluate %s mem_gb for %s: %v",
+				stageType, self.fqname, err)
+		} else {
+			memGB = int(math.Ceil(v))
+		}
+	}
+
 	// Get values passed from the stage code
 	if jobDef != nil {
 		if jobDef.Threads != 0 {
@@ -927,6 +995,11 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 			self.fqname, stageType, overrideMem)
 	}
 
+	// A larger reservation after running out of memory takes precedence.
+	if jobDef != nil && jobDef.escalatedMemGB > memGB {
+		memGB = jobDef.escalatedMemGB
+	}
+
 	if self.local {
 		threads, memGB = self.rt.LocalJobManager.GetSystemReqs(threads, memGB)
 	} else {
@@ -937,9 +1010,10 @@ func (self *Node) getJobReqs(jobDef *JobResources, stageType string) (int, int,
 	return threads, memGB, special
 }
 
-func (self *Node) setJobReqs(jobDef *JobResources, stageType string) (int, int, string) {
+func (self *Node) setJobReqs(jobDef *JobResources, stageType string,
+	args map[string]interface{}) (int, int, string) {
 	// Get values and possibly modify them
-	threads, memGB, special := self.getJobReqs(jobDef, stageType)
+	threads, memGB, special := self.getJobReqs(jobDef, stageType, args)
 
 	// Write modified values back
 	if jobDef != nil {
@@ -950,33 +1024,38 @@ func (self *Node) setJobReqs(jobDef *JobResources, stageType string) (int, int,
 	return threads, memGB, special
 }
 
-func (self *Node) setSplitJobReqs() (int, int, string) {
-	return self.setJobReqs(nil, STAGE_TYPE_SPLIT)
+func (self *Node) setSplitJobReqs(args map[string]interface{}) (int, int, string) {
+	return self.setJobReqs(nil, STAGE_TYPE_SPLIT, args)
 }
 
-func (self *Node) setChunkJobReqs(jobDef *JobResources) (int, int, string) {
-	return self.setJobReqs(jobDef, STAGE_TYPE_CHUNK)
+func (self *Node) setChunkJobReqs(jobDef *JobResources,
+	args map[string]interface{}) (int, int, string) {
+	return self.setJobReqs(jobDef, STAGE_TYPE_CHUNK, args)
 }
 
-func (self *Node) setJoinJobReqs(jobDef *JobResources) (int, int, string) {
-	return self.setJobReqs(jobDef, STAGE_TYPE_JOIN)
+func (self *Node) setJoinJobReqs(jobDef *JobResources,
+	args map[string]interface{}) (int, int, string) {
+	return self.setJobReqs(jobDef, STAGE_TYPE_JOIN, args)
 }
 
-func (self *Node) runSplit(fqname string, metadata *Metadata) {
-	threads, memGB, special := self.setSplitJobReqs()
-	self.runJob("split", fqname, metadata, threads, memGB, special)
+func (self *Node) runSplit(fqname string, metadata *Metadata,
+	args map[string]interface{}) {
+	threads, memGB, special := self.setSplitJobReqs(args)
+	self.runJob("split", fqname, metadata, threads, memGB, special, 0)
 }
 
-func (self *Node) runJoin(fqname string, metadata *Metadata, threads int, memGB int, special string) {
-	self.runJob("join", fqname, metadata, threads, memGB, special)
+func (self *Node) runJoin(fqname string, metadata *Metadata, threads int, memGB int, special string,
+	memGBEscalatedFrom int) {
+	self.runJob("join", fqname, metadata, threads, memGB, special, memGBEscalatedFrom)
 }
 
-func (self *Node) runChunk(fqname string, metadata *Metadata, threads int, memGB int, special string) {
-	self.runJob("main", fqname, metadata, threads, memGB, special)
+func (self *Node) runChunk(fqname string, metadata *Metadata, threads int, memGB int, special string,
+	memGBEscalatedFrom int) {
+	self.runJob("main", fqname, metadata, threads, memGB, special, memGBEscalatedFrom)
 }
 
 func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
-	threads int, memGB int, special string) {
+	threads int, memGB int, special string, memGBEscalatedFrom int) {
 
 	// Configure local variable dumping.
 	stackVars := "disable"
@@ -1035,6 +1114,11 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 		jobMode = "local"
 		jobManager = self.rt.LocalJobManager
 	}
+	stageType := STAGE_TYPE_CHUNK
+	if shellName == STAGE_TYPE_SPLIT || shellName == STAGE_TYPE_JOIN {
+		stageType = shellName
+	}
+	timeout := self.getJobTimeout(stageType)
 	jobModeLabel := strings.Replace(jobMode, ".template", "", -1)
 	padding := strings.Repeat(" ", int(math.Max(0, float64(10-len(path.Base(jobModeLabel))))))
 	msg := fmt.Sprintf("(run:%s) %s %s.%s", path.Base(jobModeLabel), padding, fqname, shellName)
@@ -1053,13 +1137,16 @@ func (self *Node) runJob(shellName string, fqname string, metadata *Metadata,
 			Type:        jobMode,
 			Threads:     threads,
 			MemGB:       memGB,
+			Timeout:     timeout,
 			ProfileMode: self.rt.Config.ProfileMode,
 			Stackvars:   stackVars,
 			Monitor:     monitor,
 			Invocation:  self.invocation,
 			Version:     version,
+
+			MemGBEscalatedFrom: memGBEscalatedFrom,
 		})
 	}()
-	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, special, fqname,
-		shellName, self.preflight && self.local)
+	jobManager.execJob(shellCmd, argv, envs, metadata, threads, memGB, special,
+		time.Duration(timeout)*time.Second, fqname, shellName, self.preflight && self.local)
 }
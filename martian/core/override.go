@@ -30,6 +30,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"regexp"
 
 	"github.com/martian-lang/martian/martian/util"
 )
@@ -63,12 +64,18 @@ type PipestanceOverrides struct {
 // all JSON numeric types look like Float64s when we stick them in an interface.
 var LegalOverrideTypes map[string]reflect.Kind = map[string]reflect.Kind{
 	"force_volatile": reflect.Bool,
+	"retries":        reflect.Float64,
+	"retry_backoff":  reflect.Float64,
+	"retry_on":       reflect.String,
 	"join.threads":   reflect.Float64,
 	"join.mem_gb":    reflect.Float64,
+	"join.timeout":   reflect.Float64,
 	"chunk.threads":  reflect.Float64,
 	"chunk.mem_gb":   reflect.Float64,
+	"chunk.timeout":  reflect.Float64,
 	"split.threads":  reflect.Float64,
 	"split.mem_gb":   reflect.Float64,
+	"split.timeout":  reflect.Float64,
 }
 
 // Read the overrides file and produce a pipestance overrides object.
@@ -116,6 +123,12 @@ func ReadOverrides(path string) (*PipestanceOverrides, error) {
 			if reflect.ValueOf(data).Kind() != val_kind {
 				return nil, fmt.Errorf("%v (%v) is the wrong type. Expected type is %v", override_key, data, val_kind)
 			}
+
+			if override_key == "retry_on" {
+				if _, err := regexp.Compile(data.(string)); err != nil {
+					return nil, fmt.Errorf("%v (%v) is not a valid regular expression: %v", override_key, data, err)
+				}
+			}
 		}
 	}
 
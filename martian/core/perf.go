@@ -146,6 +146,11 @@ type PerfInfo struct {
 	// For node aggregates, it's the deviation between child nodes.
 	InBytesDev  float64 `json:"in_bytes_dev"`
 	OutBytesDev float64 `json:"out_bytes_dev"`
+
+	// The number of jobs whose memory reservation was escalated after they
+	// ran out of memory, and the largest escalated reservation.
+	EscalatedJobs  int `json:"mem_escalated_jobs,omitempty"`
+	EscalatedMemGB int `json:"mem_escalated_gb,omitempty"`
 }
 
 type PerfInfoByStart []*PerfInfo
@@ -246,6 +251,11 @@ func reduceJobInfo(jobInfo *JobInfo, outputPaths []string, numThreads int) *Perf
 		perfInfo.OutBytesDev = jobInfo.IoStats.RateDev.Write.BlockBytes
 	}
 
+	if jobInfo.MemGBEscalatedFrom != 0 {
+		perfInfo.EscalatedJobs = 1
+		perfInfo.EscalatedMemGB = jobInfo.MemGB
+	}
+
 	perfInfo.OutputFiles, perfInfo.OutputBytes = util.GetDirectorySize(outputPaths)
 	perfInfo.TotalFiles = perfInfo.OutputFiles
 	perfInfo.TotalBytes = perfInfo.OutputBytes
@@ -290,6 +300,8 @@ func ComputeStats(perfInfos []*PerfInfo, outputPaths []string, vdrKillReport *VD
 		aggPerfInfo.OutputBytes += perfInfo.OutputBytes
 		aggPerfInfo.UserTime += perfInfo.UserTime
 		aggPerfInfo.SystemTime += perfInfo.SystemTime
+		aggPerfInfo.EscalatedJobs += perfInfo.EscalatedJobs
+		aggPerfInfo.EscalatedMemGB = max(aggPerfInfo.EscalatedMemGB, perfInfo.EscalatedMemGB)
 
 		if perfInfo.Duration > 0 {
 			// Accumulate sum^2 bytes here.  Convert to deviation at the end.
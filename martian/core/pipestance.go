@@ -14,6 +14,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -58,8 +59,20 @@ func NewStagestance(parent Nodable, callStm *syntax.CallStm, callables *syntax.C
 			Threads: stage.Resources.Threads,
 			MemGB:   stage.Resources.MemGB,
 			Special: stage.Resources.Special,
+			Timeout: stage.Resources.Timeout,
+		}
+		self.node.threadsExp = stage.Resources.ThreadExp
+		self.node.memGBExp = stage.Resources.MemExp
+		self.node.retryPolicy = &RetryPolicy{
+			Retries: stage.Resources.Retries,
+			Backoff: time.Duration(stage.Resources.Backoff) * time.Second,
+		}
+		if stage.Resources.RetryOn != "" {
+			// The pattern was checked when the stage was compiled.
+			self.node.retryPolicy.RetryOn = regexp.MustCompile(stage.Resources.RetryOn)
 		}
 	}
+	self.node.applyRetryModifiers(callStm.Modifiers)
 	self.node.buildForks(self.node.argbindingList)
 	return self, nil
 }
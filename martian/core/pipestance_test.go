@@ -0,0 +1,201 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Helpers for running pipestances in tests, with jobs run in-process.
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// A job manager which runs jobs by calling a function, rather than by
+// launching stage code.  Like a real job manager, jobs do not finish until
+// after the step which started them, so failed jobs may be retried.
+type testJobManager struct {
+	// Runs the given phase (split, main or join) of the job with the given
+	// metadata.  It must write the job's outputs and completion state.
+	run func(metadata *Metadata, shellName string)
+
+	// The jobs which were run, in order.
+	jobs []string
+
+	// Jobs which were started but have not yet run.
+	pending []func()
+}
+
+func (self *testJobManager) execJob(shellCmd string, argv []string,
+	envs map[string]string, metadata *Metadata, threads int, memGB int,
+	special string, timeout time.Duration, fqname string, shellName string,
+	preflight bool) {
+	self.jobs = append(self.jobs, fqname+"."+shellName)
+	self.pending = append(self.pending, func() {
+		self.run(metadata, shellName)
+	})
+}
+
+// Run the jobs which were started since the last call.
+func (self *testJobManager) runPending() {
+	pending := self.pending
+	self.pending = nil
+	for _, run := range pending {
+		run()
+	}
+}
+
+// Get the number of times the job with the given name was run.
+func (self *testJobManager) runCount(name string) int {
+	count := 0
+	for _, job := range self.jobs {
+		if job == name {
+			count++
+		}
+	}
+	return count
+}
+
+func (self *testJobManager) endJob(*Metadata) {}
+
+func (self *testJobManager) checkQueue(ids []string) ([]string, string) {
+	return ids, ""
+}
+
+func (self *testJobManager) hasQueueCheck() bool               { return false }
+func (self *testJobManager) queueCheckGrace() time.Duration    { return 0 }
+func (self *testJobManager) refreshResources(bool) error       { return nil }
+func (self *testJobManager) GetSystemReqs(t, m int) (int, int) { return t, m }
+func (self *testJobManager) GetMaxCores() int                  { return 1 }
+func (self *testJobManager) GetMaxMemGB() int                  { return 1 }
+func (self *testJobManager) GetSettings() *JobManagerSettings  { return new(JobManagerSettings) }
+
+// Get the arguments of a job run by a testJobManager.
+func testJobArgs(metadata *Metadata) map[string]interface{} {
+	args, _ := metadata.read(ArgsFile).(map[string]interface{})
+	return args
+}
+
+// Complete a job run by a testJobManager with the given outputs.
+func completeTestJob(metadata *Metadata, outs map[string]interface{}) {
+	if all, ok := metadata.read(OutsFile).(map[string]interface{}); ok {
+		for k, v := range outs {
+			all[k] = v
+		}
+		outs = all
+	}
+	metadata.Write(OutsFile, outs)
+	metadata.WriteTime(CompleteFile)
+}
+
+// Fail a job run by a testJobManager with the given error.
+func failTestJob(metadata *Metadata, message string) {
+	metadata.WriteRaw(Errors, message)
+}
+
+// Set up a temporary directory holding stage code for every stage in the
+// given MRO source.  The caller must remove the directory.
+func makeTestPipelineDir(t *testing.T, src string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "martian-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, ast, err := syntax.ParseSource(src, "pipeline.mro", nil, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	for _, stage := range ast.Stages {
+		if err := os.MkdirAll(path.Join(dir, stage.Src.Path), 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Create a runtime which runs jobs with the given function.  Unlike
+// RuntimeOptions.NewRuntime, this does not need the job manager
+// configuration files.
+func newTestRuntime(config RuntimeOptions,
+	run func(metadata *Metadata, shellName string)) (*Runtime, *testJobManager) {
+	jobManager := &testJobManager{run: run}
+	rt := &Runtime{
+		Config:          &config,
+		MroCache:        NewMroCache(),
+		JobManager:      jobManager,
+		LocalJobManager: jobManager,
+		overrides:       config.Overrides,
+	}
+	if rt.overrides == nil {
+		rt.overrides, _ = ReadOverrides("")
+	}
+	if config.CacheDir != "" {
+		rt.cache = NewStageCache(config.CacheDir)
+		rt.hasher = rt.cache.fileHasher
+	} else {
+		rt.hasher = newFileHasher()
+	}
+	return rt, jobManager
+}
+
+// Pipestances register for signals when they are locked.
+var setupTestSignals sync.Once
+
+// Invoke the pipeline called by the given MRO source in the given directory,
+// which must have been set up by makeTestPipelineDir.
+func invokeTestPipeline(t *testing.T, rt *Runtime, dir, src string) *Pipestance {
+	t.Helper()
+	setupTestSignals.Do(util.SetupSignalHandlers)
+	pipestance, err := rt.InvokePipeline(src, path.Join(dir, "pipeline.mro"),
+		"test", path.Join(dir, "test"), []string{dir}, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipestance.LoadMetadata()
+	return pipestance
+}
+
+// Step the pipestance until it completes or fails, the way mrp does, and
+// return its final state.
+func runTestPipestance(t *testing.T, pipestance *Pipestance) MetadataState {
+	t.Helper()
+	jobManager, _ := pipestance.node.rt.JobManager.(*testJobManager)
+	for i := 0; i < 100; i++ {
+		if jobManager != nil {
+			jobManager.runPending()
+		}
+		pipestance.RefreshState()
+		switch state := pipestance.GetState(); state {
+		case Failed:
+			if _, _, _, log, _, _ := pipestance.GetFatalError(); log != "" {
+				t.Log(log)
+			}
+			return state
+		case Complete, DisabledState:
+			return state
+		}
+		pipestance.StepNodes()
+	}
+	t.Fatal("Pipestance did not finish.")
+	return Failed
+}
+
+// Get the outputs of the first fork of the node with the given fully
+// qualified name.
+func testNodeOuts(t *testing.T, pipestance *Pipestance,
+	fqname string) map[string]interface{} {
+	t.Helper()
+	node := pipestance.node.find(fqname)
+	if node == nil {
+		t.Fatalf("No node %s", fqname)
+	}
+	outs, _ := node.forks[0].metadata.read(OutsFile).(map[string]interface{})
+	return outs
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// In-place retries of failed jobs, according to per-stage retry policies.
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/martian-lang/martian/martian/syntax"
+	"github.com/martian-lang/martian/martian/util"
+)
+
+// The longest delay before retrying a failed job, regardless of backoff.
+const maxRetryBackoff = time.Hour
+
+// Describes how failed jobs for a stage are retried in place, without
+// restarting the rest of the pipestance.
+type RetryPolicy struct {
+	// The number of times each job may be retried.
+	Retries int
+
+	// The delay before the first retry.  The delay doubles with each
+	// subsequent attempt.
+	Backoff time.Duration
+
+	// Errors which may be retried, in addition to those in retry.json.
+	RetryOn *regexp.Regexp
+}
+
+// A failed attempt to run a job, recorded in the fork's _attempts file.
+type JobAttempt struct {
+	Job     string `json:"job"`
+	Attempt int    `json:"attempt,omitempty"`
+	Time    string `json:"time"`
+	Error   string `json:"error"`
+
+	// If the job ran out of memory, the larger reservation with which it
+	// was run again.  Such attempts do not count against the retry policy.
+	EscalatedMemGB int `json:"escalated_memGB,omitempty"`
+}
+
+// Returns true if any line of the error log matches any of the expressions.
+func errorMatches(errlog string, regexps []*regexp.Regexp) bool {
+	for _, line := range strings.Split(errlog, "\n") {
+		for _, re := range regexps {
+			if re.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if a job which failed with the given error may be retried.
+func (self *RetryPolicy) isTransient(errlog string) bool {
+	regexps, _ := getRetryRegexps()
+	if self.RetryOn != nil {
+		regexps = append(regexps, self.RetryOn)
+	}
+	return errorMatches(errlog, regexps)
+}
+
+// Get the delay before the given retry attempt, counting from 1.
+func (self *RetryPolicy) delay(attempt int) time.Duration {
+	d := self.Backoff
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return d
+}
+
+// Apply the retry settings given in the modifiers of the call, which take
+// precedence over those in the stage declaration.
+func (self *Node) applyRetryModifiers(mods *syntax.Modifiers) {
+	if mods == nil || mods.Bindings == nil {
+		return
+	}
+	var policy RetryPolicy
+	if self.retryPolicy != nil {
+		policy = *self.retryPolicy
+	}
+	found := false
+	if binding := mods.Bindings.Table["retries"]; binding != nil {
+		policy.Retries = int(binding.Exp.ToInterface().(int64))
+		found = true
+	}
+	if binding := mods.Bindings.Table["retry_backoff"]; binding != nil {
+		policy.Backoff = time.Duration(binding.Exp.ToInterface().(int64)) * time.Second
+		found = true
+	}
+	if binding := mods.Bindings.Table["retry_on"]; binding != nil {
+		// The pattern was checked when the call was compiled.
+		policy.RetryOn = regexp.MustCompile(binding.Exp.ToInterface().(string))
+		found = true
+	}
+	if found {
+		self.retryPolicy = &policy
+	}
+}
+
+// Get the retry policy for the stage, with any overrides applied.
+func (self *Node) getRetryPolicy() *RetryPolicy {
+	var policy RetryPolicy
+	if self.retryPolicy != nil {
+		policy = *self.retryPolicy
+	}
+	if v, ok := self.rt.overrides.GetOverride(self, "retries",
+		float64(policy.Retries)).(float64); ok {
+		policy.Retries = int(v)
+	}
+	if v, ok := self.rt.overrides.GetOverride(self, "retry_backoff",
+		policy.Backoff.Seconds()).(float64); ok {
+		policy.Backoff = time.Duration(v * float64(time.Second))
+	}
+	if v, ok := self.rt.overrides.GetOverride(self, "retry_on",
+		nil).(string); ok {
+		// The pattern was checked when the overrides were loaded.
+		policy.RetryOn = regexp.MustCompile(v)
+	}
+	return &policy
+}
+
+// Get the failed attempts recorded for jobs in this fork.
+func (self *Fork) getAttempts() []JobAttempt {
+	var attempts []JobAttempt
+	if self.metadata.exists(AttemptsFile) {
+		if err := self.metadata.ReadInto(AttemptsFile, &attempts); err != nil {
+			util.LogError(err, "runtime", "Could not read retry attempts for %s",
+				self.fqname)
+		}
+	}
+	return attempts
+}
+
+// Set whether the job for the given metadata has been run, which prevents it
+// from being run again.
+func (self *Fork) setHasRun(metadata *Metadata, hasRun bool) {
+	switch metadata {
+	case self.split_metadata:
+		self.split_has_run = hasRun
+	case self.join_metadata:
+		self.join_has_run = hasRun
+	default:
+		for _, chunk := range self.chunks {
+			if chunk.metadata == metadata {
+				chunk.hasBeenRun = hasRun
+			}
+		}
+	}
+}
+
+// Retry failed split, chunk or join jobs for this fork in place, if the
+// stage's retry policy allows it.  Jobs which are retried are reset
+// immediately, so that the stage does not appear to have failed, but are not
+// run again until their backoff delay has passed.
+func (self *Fork) retryFailedJobs() {
+	for metadata, at := range self.pendingRetries {
+		if !time.Now().Before(at) {
+			delete(self.pendingRetries, metadata)
+			self.setHasRun(metadata, false)
+		}
+	}
+	jobs := make([]*Metadata, 0, len(self.chunks)+2)
+	jobs = append(jobs, self.split_metadata)
+	for _, chunk := range self.chunks {
+		jobs = append(jobs, chunk.metadata)
+	}
+	jobs = append(jobs, self.join_metadata)
+	var policy *RetryPolicy
+	for _, metadata := range jobs {
+		if state, _ := metadata.getState(); state != Failed ||
+			metadata.exists(Assert) {
+			continue
+		}
+		errlog := metadata.readRaw(Errors)
+		if self.escalateMemory(metadata, errlog) {
+			continue
+		}
+		if policy == nil {
+			policy = self.node.getRetryPolicy()
+		}
+		if policy.Retries <= 0 || !policy.isTransient(errlog) {
+			continue
+		}
+		attempts := self.getAttempts()
+		attempt := 1
+		for _, a := range attempts {
+			if a.Job == metadata.fqname && a.EscalatedMemGB == 0 {
+				attempt++
+			}
+		}
+		if attempt > policy.Retries {
+			continue
+		}
+		attempts = append(attempts, JobAttempt{
+			Job:     metadata.fqname,
+			Attempt: attempt,
+			Time:    util.Timestamp(),
+			Error:   errlog,
+		})
+		self.metadata.Write(AttemptsFile, attempts)
+		delay := policy.delay(attempt)
+		util.PrintInfo("runtime", "(retry)           %s: attempt %d of %d in %v",
+			metadata.fqname, attempt, policy.Retries, delay)
+		if err := metadata.checkedReset(); err != nil {
+			util.LogError(err, "runtime", "Could not reset %s for retry",
+				metadata.fqname)
+			continue
+		}
+		if self.pendingRetries == nil {
+			self.pendingRetries = make(map[*Metadata]time.Time)
+		}
+		self.pendingRetries[metadata] = time.Now().Add(delay)
+		self.setHasRun(metadata, true)
+		self.lastPrint = time.Now()
+	}
+}
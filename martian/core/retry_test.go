@@ -0,0 +1,181 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Retries: 10, Backoff: 30 * time.Second}
+	for attempt, expect := range []time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		9: maxRetryBackoff,
+	} {
+		if expect == 0 {
+			continue
+		}
+		if d := policy.delay(attempt); d != expect {
+			t.Errorf("Expected delay %v for attempt %d, got %v", expect, attempt, d)
+		}
+	}
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGetRetryPolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overridesFile := path.Join(dir, "overrides.json")
+	writeTestFile(t, overridesFile,
+		`{"SORT": {"retries": 4, "retry_on": "^IOError: "}}`)
+	overrides, err := ReadOverrides(overridesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &Node{
+		rt:          &Runtime{Config: &RuntimeOptions{}, overrides: overrides},
+		fqname:      "ID.test.SORT",
+		retryPolicy: &RetryPolicy{Retries: 1, Backoff: time.Minute},
+	}
+	policy := node.getRetryPolicy()
+	if policy.Retries != 4 || policy.Backoff != time.Minute {
+		t.Errorf("Incorrect retry policy %v", policy)
+	}
+	if !policy.isTransient("Traceback:\nIOError: disk went away") {
+		t.Errorf("Expected the overridden pattern to be retried.")
+	}
+	if policy.isTransient("ValueError: bad input") {
+		t.Errorf("Expected other errors not to be retried.")
+	}
+
+	writeTestFile(t, overridesFile, `{"SORT": {"retry_on": "(unclosed"}}`)
+	if _, err := ReadOverrides(overridesFile); err == nil {
+		t.Errorf("Expected an invalid pattern to be rejected.")
+	}
+}
+
+func TestRetryFailedJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRetryFailedJobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overrides, err := ReadOverrides("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &Node{
+		rt:          &Runtime{Config: &RuntimeOptions{}, overrides: overrides},
+		fqname:      "ID.test.SORT",
+		retryPolicy: &RetryPolicy{Retries: 1},
+	}
+	fork := &Fork{
+		node:           node,
+		fqname:         "ID.test.SORT.fork0",
+		metadata:       NewMetadata("ID.test.SORT.fork0", path.Join(dir, "fork0")),
+		split_metadata: NewMetadata("ID.test.SORT.fork0.split", path.Join(dir, "fork0", "split")),
+		join_metadata:  NewMetadata("ID.test.SORT.fork0.join", path.Join(dir, "fork0", "join")),
+	}
+	chunk := &Chunk{
+		fork:       fork,
+		fqname:     "ID.test.SORT.fork0.chnk0",
+		metadata:   NewMetadata("ID.test.SORT.fork0.chnk0", path.Join(dir, "fork0", "chnk0")),
+		hasBeenRun: true,
+	}
+	fork.chunks = []*Chunk{chunk}
+	for _, metadata := range []*Metadata{fork.metadata,
+		fork.split_metadata, fork.join_metadata, chunk.metadata} {
+		if err := metadata.mkdirs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunk.metadata.WriteRaw(Errors, "signal: killed")
+	fork.retryFailedJobs()
+	if state, _ := chunk.metadata.getState(); state == Failed {
+		t.Fatal("Expected the failed chunk to be reset.")
+	}
+	// Without a backoff, the chunk may run again on the next step.
+	fork.retryFailedJobs()
+	if chunk.hasBeenRun {
+		t.Error("Expected the chunk to be allowed to run again.")
+	}
+	attempts := fork.getAttempts()
+	if len(attempts) != 1 || attempts[0].Job != chunk.fqname ||
+		attempts[0].Attempt != 1 || attempts[0].Error != "signal: killed" {
+		t.Errorf("Incorrect attempts %v", attempts)
+	}
+
+	// Retries are exhausted.
+	chunk.metadata.WriteRaw(Errors, "signal: killed")
+	fork.retryFailedJobs()
+	if state, _ := chunk.metadata.getState(); state != Failed {
+		t.Error("Expected the chunk to stay failed after its last retry.")
+	}
+
+	// Errors which are not transient are not retried.
+	node.retryPolicy.Retries = 5
+	chunk.metadata.WriteRaw(Errors, "ValueError: bad input")
+	fork.retryFailedJobs()
+	if state, _ := chunk.metadata.getState(); state != Failed {
+		t.Error("Expected the chunk to stay failed.")
+	}
+}
+
+func TestCallRetryPolicy(t *testing.T) {
+	src := `
+stage SORT(
+    in  int count,
+    out int sorted,
+    src py  "stages/sort",
+) using (
+    retries       = 5,
+    retry_backoff = 60,
+    retry_on      = "^flaky: ",
+)
+
+pipeline SORT_ALL(
+    in  int count,
+    out int sorted,
+)
+{
+    call SORT(
+        count = self.count,
+    ) using (
+        retries       = 1,
+        retry_backoff = 0,
+    )
+
+    return (
+        sorted = SORT.sorted,
+    )
+}
+
+call SORT_ALL(
+    count = 1,
+)
+`
+	dir := makeTestPipelineDir(t, src)
+	defer os.RemoveAll(dir)
+	rt, jobManager := newTestRuntime(DefaultRuntimeOptions(), func(metadata *Metadata, shellName string) {
+		failTestJob(metadata, "flaky: try again")
+	})
+	pipestance := invokeTestPipeline(t, rt, dir, src)
+	defer pipestance.Unlock()
+	if state := runTestPipestance(t, pipestance); state != Failed {
+		t.Fatalf("Expected the pipestance to fail, got %v", state)
+	}
+	// The call's retry settings take precedence over the stage's, but the
+	// stage's pattern still applies.
+	if n := jobManager.runCount("ID.test.SORT_ALL.SORT.fork0.chnk0.main"); n != 2 {
+		t.Errorf("Expected the job to run twice, ran %d times", n)
+	}
+}
@@ -165,6 +165,14 @@ type RuntimeOptions struct {
 	Overrides       *PipestanceOverrides
 	LimitLoadavg    bool
 	NeverLocal      bool
+
+	// If set, the directory in which to look up and store the results of
+	// stage runs, for reuse by identical runs in other pipestances.
+	CacheDir string
+
+	// If non-zero, jobs which run out of memory are run again with a larger
+	// memory reservation, up to this many GB.
+	MaxEscalatedMemGB int
 }
 
 func DefaultRuntimeOptions() RuntimeOptions {
@@ -246,6 +254,13 @@ func (config *RuntimeOptions) ToFlags() []string {
 	if config.NeverLocal {
 		flags = append(flags, "--never-local")
 	}
+	if config.CacheDir != "" {
+		flags = append(flags, "--cache="+config.CacheDir)
+	}
+	if config.MaxEscalatedMemGB != 0 {
+		flags = append(flags, fmt.Sprintf("--mem-escalation=%d",
+			config.MaxEscalatedMemGB))
+	}
 	return flags
 }
 
@@ -259,6 +274,8 @@ type Runtime struct {
 	JobManager      JobManager
 	LocalJobManager JobManager
 	overrides       *PipestanceOverrides
+	cache           *StageCache
+	hasher          *fileHasher
 }
 
 // Deprecated: use RuntimeConfig.NewRuntime() instead
@@ -322,6 +339,12 @@ func (c *RuntimeOptions) NewRuntime() *Runtime {
 	} else {
 		self.overrides = c.Overrides
 	}
+	if c.CacheDir != "" {
+		self.cache = NewStageCache(c.CacheDir)
+		self.hasher = self.cache.fileHasher
+	} else {
+		self.hasher = newFileHasher()
+	}
 
 	return self
 }
@@ -361,8 +384,8 @@ func (self *Runtime) instantiatePipeline(src string, srcPath string, psid string
 		return "", nil, &RuntimeError{"cannot start a pipeline without a call statement"}
 	}
 	// Make sure it's a pipeline we're calling.
-	if pipeline := ast.Callables.Table[ast.Call.Id]; pipeline == nil {
-		return "", nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared pipeline", ast.Call.Id)}
+	if pipeline := ast.Callables.Table[ast.Call.DecId]; pipeline == nil {
+		return "", nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared pipeline", ast.Call.DecId)}
 	}
 
 	invocationData, _ := BuildDataForAst(incpaths, ast)
@@ -499,6 +522,11 @@ func (self *Runtime) reattachToPipestance(psid string, pipestancePath string, sr
 			pipestance.Unlock()
 			return nil, err
 		}
+		// Rerun anything whose stage code or inputs changed.
+		if err = pipestance.ResetChangedNodes(); err != nil {
+			pipestance.Unlock()
+			return nil, err
+		}
 	}
 
 	return pipestance, nil
@@ -527,8 +555,8 @@ func (self *Runtime) InvokeStage(src string, srcPath string, ssid string,
 		return nil, &RuntimeError{"cannot start a stage without a call statement"}
 	}
 	// Make sure it's a stage we're calling.
-	if _, ok := ast.Callables.Table[ast.Call.Id].(*syntax.Stage); !ok {
-		return nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared stage", ast.Call.Id)}
+	if _, ok := ast.Callables.Table[ast.Call.DecId].(*syntax.Stage); !ok {
+		return nil, &RuntimeError{fmt.Sprintf("'%s' is not a declared stage", ast.Call.DecId)}
 	}
 
 	invocationData, _ := BuildDataForAst(incpaths, ast)
@@ -741,9 +769,13 @@ func BuildCallSource(incpaths []string,
 		includes = append(includes, fmt.Sprintf("@include \"%s\"", incpath))
 	}
 	// Loop over the pipeline's in params and print a binding
-	// whether the args bag has a value for it not.
+	// whether the args bag has a value for it not, unless the
+	// parameter has a default value to fall back on.
 	lines := []string{}
 	for _, param := range callable.GetInParams().List {
+		if _, ok := args[param.GetId()]; !ok && param.GetDefault() != nil {
+			continue
+		}
 		valstr := buildVal(param, args[param.GetId()])
 
 		for _, id := range sweepargs {
@@ -781,7 +813,7 @@ func BuildDataForAst(incpaths []string, ast *syntax.Ast) (*InvocationData, error
 		}
 	}
 	return &InvocationData{
-		Call:         ast.Call.Id,
+		Call:         ast.Call.DecId,
 		Args:         args,
 		SweepArgs:    sweepargs,
 		IncludePaths: incpaths,
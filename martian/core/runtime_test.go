@@ -7,10 +7,12 @@
 package core
 
 import (
-	_ "encoding/json"
+	"encoding/json"
 	_ "fmt"
+	"github.com/martian-lang/martian/martian/syntax"
 	"github.com/martian-lang/martian/martian/util"
-	_ "testing"
+	"reflect"
+	"testing"
 )
 
 func MockRuntime() *Runtime {
@@ -69,3 +71,40 @@ func ExampleBuildCallSource() {
 	// )
 }
 */
+
+// Strings from arbitrary JSON input must produce valid MRO source.
+func TestBuildCallSourceEscapes(t *testing.T) {
+	decl := `
+stage ECHO(
+    in  string message,
+    in  map    extra,
+    out string echoed,
+    src py     "stages/echo",
+)
+`
+	_, _, ast, err := syntax.ParseSource(decl, "echo.mro", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"message": "a \"quoted\"\tmulti-line\nstring <&>",
+		"extra": {"key\n": "é\\"}
+	}`), &args); err != nil {
+		t.Fatal(err)
+	}
+	src, err := BuildCallSource(nil, "ECHO", args, nil,
+		ast.Callables.Table["ECHO"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, callAst, err := syntax.ParseSource(decl+src, "call.mro", nil, false)
+	if err != nil {
+		t.Fatalf("Generated source did not parse: %v\n%s", err, src)
+	}
+	for id, expect := range args {
+		if v := callAst.Call.Bindings.Table[id].Exp.ToInterface(); !reflect.DeepEqual(v, expect) {
+			t.Errorf("Expected %s = %q, got %q", id, expect, v)
+		}
+	}
+}
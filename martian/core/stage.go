@@ -93,7 +93,7 @@ func NewChunk(fork *Fork, index int,
 		}
 	}
 	self.hasBeenRun = false
-	if !self.fork.Split() {
+	if !self.fork.Split() && !self.fork.node.mapped {
 		// If we're not splitting, just set the sole chunk's filesPath
 		// to the filesPath of the parent fork, to save a pseudo-join copy.
 		self.metadata.finalFilePath = self.fork.metadata.finalFilePath
@@ -219,11 +219,12 @@ func (self *Chunk) step(bindings map[string]interface{}) {
 	if self.chunkDef.Resources == nil {
 		self.chunkDef.Resources = &JobResources{}
 	}
-	threads, memGB, special := self.fork.node.setChunkJobReqs(self.chunkDef.Resources)
-
 	// Resolve input argument bindings and merge in the chunk defs.
 	resolvedBindings := self.chunkDef.Merge(bindings)
 
+	threads, memGB, special := self.fork.node.setChunkJobReqs(
+		self.chunkDef.Resources, resolvedBindings.Args)
+
 	// Write out input and ouput args for the chunk.
 	self.metadata.Write(ArgsFile, resolvedBindings)
 	outs := makeOutArgs(self.fork.OutParams(), self.metadata.curFilesPath, false)
@@ -237,7 +238,8 @@ func (self *Chunk) step(bindings map[string]interface{}) {
 
 	// Run the chunk.
 	self.fork.lastPrint = time.Now()
-	self.fork.node.runChunk(self.fqname, self.metadata, threads, memGB, special)
+	self.fork.node.runChunk(self.fqname, self.metadata, threads, memGB, special,
+		self.chunkDef.Resources.memGBEscalatedFrom)
 }
 
 func (self *Chunk) serializeState() *ChunkInfo {
@@ -250,7 +252,11 @@ func (self *Chunk) serializeState() *ChunkInfo {
 }
 
 func (self *Chunk) serializePerf() *ChunkPerfInfo {
-	numThreads, _, _ := self.fork.node.getJobReqs(self.chunkDef.Resources, STAGE_TYPE_CHUNK)
+	var args map[string]interface{}
+	if bindings := self.fork.threadsArgs(); bindings != nil {
+		args = self.chunkDef.Merge(bindings).Args
+	}
+	numThreads, _, _ := self.fork.node.getJobReqs(self.chunkDef.Resources, STAGE_TYPE_CHUNK, args)
 	stats := self.metadata.serializePerf(numThreads)
 	return &ChunkPerfInfo{
 		Index:      self.index,
@@ -288,6 +294,10 @@ type Fork struct {
 	perfCache      *ForkPerfCache
 	lastPrint      time.Time
 	metadatasCache []*Metadata // cache for collectMetadata
+	cacheKey       string      // key for the stage cache, if enabled
+
+	// Jobs which were reset for retry, and when they may run again.
+	pendingRetries map[*Metadata]time.Time
 }
 
 // Exportable information from a Fork object.
@@ -381,6 +391,7 @@ func (self *Fork) reset() {
 	self.metadatasCache = nil
 	self.split_has_run = false
 	self.join_has_run = false
+	self.pendingRetries = nil
 	self.split_metadata.notRunningSince = time.Time{}
 	self.split_metadata.lastRefresh = time.Time{}
 	self.join_metadata.notRunningSince = time.Time{}
@@ -647,6 +658,7 @@ func (self *Fork) printState(state MetadataState) {
 
 func (self *Fork) step() {
 	if self.node.kind == "stage" {
+		self.retryFailedJobs()
 		state := self.getState()
 		if !state.IsRunning() && !state.IsQueued() && state != DisabledState {
 			self.printState(state)
@@ -669,14 +681,26 @@ func (self *Fork) step() {
 				return
 			}
 			self.writeInvocation()
+			self.writeFingerprint(getBindings())
+			if self.restoreFromCache(getBindings()) {
+				return
+			}
 			self.split_metadata.Write(ArgsFile, getBindings())
 			if self.Split() {
 				if !self.split_has_run {
 					self.split_has_run = true
 					self.lastPrint = time.Now()
-					self.node.runSplit(self.fqname, self.split_metadata)
+					self.node.runSplit(self.fqname, self.split_metadata, getBindings())
 				}
 			} else {
+				if self.node.mapped {
+					if defs, err := self.mapStageDefs(getBindings()); err != nil {
+						self.split_metadata.WriteRaw(Errors, err.Error())
+						return
+					} else {
+						self.stageDefs = defs
+					}
+				}
 				self.split_metadata.Write(StageDefsFile, self.stageDefs)
 				self.split_metadata.WriteTime(CompleteFile)
 				state = Complete.Prefixed(SplitPrefix)
@@ -740,7 +764,8 @@ func (self *Fork) step() {
 			if self.stageDefs.JoinDef == nil {
 				self.stageDefs.JoinDef = &JobResources{}
 			}
-			threads, memGB, special := self.node.setJoinJobReqs(self.stageDefs.JoinDef)
+			threads, memGB, special := self.node.setJoinJobReqs(
+				self.stageDefs.JoinDef, getBindings())
 			resolvedBindings := ChunkDef{
 				Resources: self.stageDefs.JoinDef,
 				Args:      MakeArgumentMap(getBindings()),
@@ -763,8 +788,17 @@ func (self *Fork) step() {
 				if !self.join_has_run {
 					self.join_has_run = true
 					self.lastPrint = time.Now()
-					self.node.runJoin(self.fqname, self.join_metadata, threads, memGB, special)
+					self.node.runJoin(self.fqname, self.join_metadata, threads, memGB, special,
+						self.stageDefs.JoinDef.memGBEscalatedFrom)
+				}
+			} else if self.node.mapped {
+				outs, ok := self.collectMappedOuts()
+				if !ok {
+					return
 				}
+				self.join_metadata.Write(OutsFile, outs)
+				self.join_metadata.WriteTime(CompleteFile)
+				state = Complete.Prefixed(JoinPrefix)
 			} else {
 				self.join_metadata.Write(OutsFile, self.chunks[0].metadata.read(OutsFile))
 				self.join_metadata.WriteTime(CompleteFile)
@@ -775,11 +809,17 @@ func (self *Fork) step() {
 			self.node.rt.JobManager.endJob(self.join_metadata)
 			joinOut := self.join_metadata.read(OutsFile)
 			self.metadata.Write(OutsFile, joinOut)
-			if ok, msg := self.verifyOutput(joinOut); ok {
+			ok, msg := true, ""
+			if !self.node.mapped {
+				// Outputs of mapped calls were verified for each chunk.
+				ok, msg = self.verifyOutput(joinOut)
+			}
+			if ok {
 				if msg != "" {
 					self.metadata.AppendAlarm(msg)
 				}
 				self.metadata.WriteTime(CompleteFile)
+				self.storeInCache(joinOut)
 				// Print alerts
 				if alarms := self.getAlarms(); len(alarms) > 0 {
 					self.lastPrint = time.Now()
@@ -802,7 +842,12 @@ func (self *Fork) step() {
 		self.writeInvocation()
 		outs := resolveBindings(self.node.retbindings, self.argPermute)
 		self.metadata.Write(OutsFile, outs)
-		if ok, msg := self.verifyOutput(outs); ok {
+		ok, msg := true, ""
+		if !self.node.mapped {
+			// Outputs of mapped calls were verified for each chunk.
+			ok, msg = self.verifyOutput(outs)
+		}
+		if ok {
 			if msg != "" {
 				self.metadata.AppendAlarm(msg)
 			}
@@ -813,6 +858,104 @@ func (self *Fork) step() {
 	}
 }
 
+// Get the number of elements over which the fork's mapped call runs, given
+// the fork's resolved bindings.  All split arguments of the call must be
+// arrays of the same length.
+func (self *Fork) mapLength(bindings map[string]interface{}) (int, error) {
+	root := self.node.mapRoot
+	length := -1
+	for _, param := range root.callable.GetInParams().List {
+		id := param.GetId()
+		binding := root.argbindings[id]
+		if binding == nil || !binding.split {
+			continue
+		}
+		value := bindings[id]
+		if root != self.node {
+			// Within a mapped pipeline, the length comes from the pipeline.
+			value = binding.resolve(self.argPermute)
+		}
+		n := 0
+		switch val := value.(type) {
+		case nil:
+		case []interface{}:
+			n = len(val)
+		default:
+			return 0, fmt.Errorf(
+				"Split parameter '%s' of mapped call %s was not an array.",
+				id, root.fqname)
+		}
+		if length >= 0 && n != length {
+			return 0, fmt.Errorf(
+				"Split parameter '%s' of mapped call %s has %d elements, but other split parameters have %d.",
+				id, root.fqname, n, length)
+		}
+		length = n
+	}
+	if length < 0 {
+		length = 0
+	}
+	return length, nil
+}
+
+// Build one chunk definition for each element of the split arguments of a
+// mapped call.  Within a mapped pipeline, arguments bound to the outputs of
+// other calls in the pipeline are split as well.
+func (self *Fork) mapStageDefs(bindings map[string]interface{}) (*StageDefs, error) {
+	length, err := self.mapLength(bindings)
+	if err != nil {
+		return nil, err
+	}
+	defs := &StageDefs{ChunkDefs: make([]*ChunkDef, 0, length)}
+	for i := 0; i < length; i++ {
+		args := make(ArgumentMap)
+		for _, param := range self.node.callable.GetInParams().List {
+			id := param.GetId()
+			binding := self.node.argbindings[id]
+			if binding == nil || !binding.split {
+				continue
+			}
+			elem, err := binding.element(bindings[id], i, length, self.node.fqname)
+			if err != nil {
+				return nil, err
+			}
+			args[id] = elem
+		}
+		defs.ChunkDefs = append(defs.ChunkDefs, &ChunkDef{Args: args})
+	}
+	return defs, nil
+}
+
+// Collect the outputs of each chunk of a mapped call into arrays, in chunk
+// order.  Returns false if any chunk produced invalid outputs.
+func (self *Fork) collectMappedOuts() (map[string]interface{}, bool) {
+	outParams := self.OutParams()
+	collected := make(map[string][]interface{}, len(outParams.List))
+	for _, param := range outParams.List {
+		collected[param.GetId()] = make([]interface{}, 0, len(self.chunks))
+	}
+	ok := true
+	for _, chunk := range self.chunks {
+		outs := chunk.metadata.read(OutsFile)
+		if valid, msg := self.verifyOutput(outs); !valid {
+			chunk.metadata.WriteRaw(Errors, msg)
+			ok = false
+			continue
+		} else if msg != "" {
+			chunk.metadata.AppendAlarm(msg)
+		}
+		outsMap, _ := outs.(map[string]interface{})
+		for id, vals := range collected {
+			collected[id] = append(vals, outsMap[id])
+		}
+	}
+	result := make(map[string]interface{}, len(collected))
+	for id, vals := range collected {
+		result[id] = vals
+	}
+	return result, ok
+}
+
 func (self *Fork) printUpdateIfNeeded() {
 	if time.Since(self.lastPrint) > forkPrintInterval {
 		if state := self.getState(); state.IsRunning() {
@@ -1067,6 +1210,15 @@ func (self *Fork) getStages() []*StagePerfInfo {
 	return stages
 }
 
+// Get the arguments over which the stage's threads expression is evaluated,
+// or nil if it does not have one.
+func (self *Fork) threadsArgs() map[string]interface{} {
+	if self.node.threadsExp == nil {
+		return nil
+	}
+	return resolveBindings(self.node.argbindings, self.argPermute)
+}
+
 func (self *Fork) serializePerf() (*ForkPerfInfo, *VDRKillReport) {
 	if self.perfCache != nil {
 		// Use cached performance information if it exists.
@@ -1089,13 +1241,14 @@ func (self *Fork) serializePerf() (*ForkPerfInfo, *VDRKillReport) {
 		}
 	}
 
-	numThreads, _, _ := self.node.getJobReqs(nil, STAGE_TYPE_SPLIT)
+	args := self.threadsArgs()
+	numThreads, _, _ := self.node.getJobReqs(nil, STAGE_TYPE_SPLIT, args)
 	splitStats := self.split_metadata.serializePerf(numThreads)
 	if splitStats != nil {
 		stats = append(stats, splitStats)
 	}
 
-	numThreads, _, _ = self.node.getJobReqs(self.stageDefs.JoinDef, STAGE_TYPE_JOIN)
+	numThreads, _, _ = self.node.getJobReqs(self.stageDefs.JoinDef, STAGE_TYPE_JOIN, args)
 	joinStats := self.join_metadata.serializePerf(numThreads)
 	if joinStats != nil {
 		stats = append(stats, joinStats)
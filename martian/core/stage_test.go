@@ -0,0 +1,272 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/martian-lang/martian/martian/syntax"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func makeMappedFork(split ...string) *Fork {
+	params := &syntax.Params{Table: make(map[string]syntax.Param)}
+	node := &Node{
+		fqname:      "ID.test.ALIGN",
+		mapped:      true,
+		argbindings: make(map[string]*Binding),
+	}
+	for _, id := range []string{"sample", "lane", "reference"} {
+		param := &syntax.InParam{Id: id, Tname: "string"}
+		params.List = append(params.List, param)
+		params.Table[id] = param
+		node.argbindings[id] = &Binding{id: id}
+	}
+	for _, id := range split {
+		node.argbindings[id].split = true
+	}
+	node.callable = &syntax.Stage{InParams: params}
+	node.mapRoot = node
+	return &Fork{node: node}
+}
+
+func TestMapStageDefs(t *testing.T) {
+	fork := makeMappedFork("sample", "lane")
+	defs, err := fork.mapStageDefs(map[string]interface{}{
+		"sample":    []interface{}{"a", "b"},
+		"lane":      []interface{}{"1", "2"},
+		"reference": "hg19",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*ChunkDef{
+		&ChunkDef{Args: ArgumentMap{"sample": "a", "lane": "1"}},
+		&ChunkDef{Args: ArgumentMap{"sample": "b", "lane": "2"}},
+	}
+	if !reflect.DeepEqual(defs.ChunkDefs, expect) {
+		t.Errorf("Expected %v, got %v", expect, defs.ChunkDefs)
+	}
+}
+
+func TestMapStageDefsEmpty(t *testing.T) {
+	fork := makeMappedFork("sample")
+	if defs, err := fork.mapStageDefs(map[string]interface{}{
+		"sample":    nil,
+		"lane":      "1",
+		"reference": "hg19",
+	}); err != nil {
+		t.Error(err)
+	} else if len(defs.ChunkDefs) != 0 {
+		t.Errorf("Expected no chunks, got %d", len(defs.ChunkDefs))
+	}
+}
+
+func TestMapStageDefsMismatch(t *testing.T) {
+	fork := makeMappedFork("sample", "lane")
+	if _, err := fork.mapStageDefs(map[string]interface{}{
+		"sample":    []interface{}{"a", "b"},
+		"lane":      []interface{}{"1"},
+		"reference": "hg19",
+	}); err == nil {
+		t.Error("Expected an error for mismatched split lengths.")
+	}
+	if _, err := fork.mapStageDefs(map[string]interface{}{
+		"sample":    "a",
+		"lane":      []interface{}{"1"},
+		"reference": "hg19",
+	}); err == nil {
+		t.Error("Expected an error for a non-array split argument.")
+	}
+}
+
+// Get a number from a job argument.
+func testNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return 0
+}
+
+func TestMapPipeline(t *testing.T) {
+	src := `
+stage ALIGN(
+    in  string sample,
+    in  string reference,
+    out int    reads,
+    src py     "stages/align",
+)
+
+stage DOUBLE(
+    in  int    value,
+    in  string sample,
+    out int    doubled,
+    src py     "stages/double",
+)
+
+stage SUM(
+    in  int[] values,
+    out int   total,
+    src py    "stages/sum",
+)
+
+pipeline ALIGN_ONE(
+    in  string sample,
+    in  string reference,
+    out int    reads,
+    out int    doubled,
+    out string sample,
+)
+{
+    call ALIGN(
+        sample    = self.sample,
+        reference = self.reference,
+    )
+
+    call DOUBLE(
+        value  = ALIGN.reads,
+        sample = self.sample,
+    )
+
+    return (
+        reads   = ALIGN.reads,
+        doubled = DOUBLE.doubled,
+        sample  = self.sample,
+    )
+}
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int[]    reads,
+    out int[]    doubled,
+    out string[] sample,
+    out int      total,
+)
+{
+    map call ALIGN_ONE(
+        sample    = split self.samples,
+        reference = "hg19",
+    )
+
+    call SUM(
+        values = ALIGN_ONE.doubled,
+    )
+
+    return (
+        reads   = ALIGN_ONE.reads,
+        doubled = ALIGN_ONE.doubled,
+        sample  = ALIGN_ONE.sample,
+        total   = SUM.total,
+    )
+}
+
+call ALIGN_ALL(
+    samples = ["a", "bb", "ccc"],
+)
+`
+	dir := makeTestPipelineDir(t, src)
+	defer os.RemoveAll(dir)
+	rt, _ := newTestRuntime(DefaultRuntimeOptions(), func(metadata *Metadata, shellName string) {
+		args := testJobArgs(metadata)
+		switch {
+		case strings.Contains(metadata.fqname, ".ALIGN."):
+			if args["reference"] != "hg19" {
+				failTestJob(metadata, fmt.Sprintf("bad reference %v", args["reference"]))
+				return
+			}
+			sample, _ := args["sample"].(string)
+			completeTestJob(metadata, map[string]interface{}{"reads": len(sample)})
+		case strings.Contains(metadata.fqname, ".DOUBLE."):
+			value := testNumber(args["value"])
+			if sample, _ := args["sample"].(string); len(sample) != int(value) {
+				failTestJob(metadata, fmt.Sprintf("value %v for sample %v", value, sample))
+				return
+			}
+			completeTestJob(metadata, map[string]interface{}{"doubled": 2 * value})
+		case strings.Contains(metadata.fqname, ".SUM."):
+			total := 0.0
+			values, _ := args["values"].([]interface{})
+			for _, v := range values {
+				total += testNumber(v)
+			}
+			completeTestJob(metadata, map[string]interface{}{"total": total})
+		}
+	})
+	pipestance := invokeTestPipeline(t, rt, dir, src)
+	if state := runTestPipestance(t, pipestance); state != Complete {
+		t.Fatalf("Expected the pipestance to complete, got %v", state)
+	}
+	outs, _ := json.Marshal(testNodeOuts(t, pipestance, "ID.test.ALIGN_ALL"))
+	expect := `{"doubled":[2,4,6],"reads":[1,2,3],"sample":["a","bb","ccc"],"total":12}`
+	if string(outs) != expect {
+		t.Errorf("Expected outputs %s, got %s", expect, outs)
+	}
+}
+
+func TestSerializePerfThreadsExp(t *testing.T) {
+	src := `
+stage COUNT(
+    in  int[] reads,
+    out int   count,
+    src py    "stages/count",
+) using (
+    threads = min(len(self.reads), 4),
+)
+
+pipeline COUNT_READS(
+    in  int[] reads,
+    out int   count,
+)
+{
+    call COUNT(
+        reads = self.reads,
+    )
+
+    return (
+        count = COUNT.count,
+    )
+}
+
+call COUNT_READS(
+    reads = [1, 2, 3],
+)
+`
+	dir := makeTestPipelineDir(t, src)
+	defer os.RemoveAll(dir)
+	rt, _ := newTestRuntime(DefaultRuntimeOptions(), func(metadata *Metadata, shellName string) {
+		metadata.Write(JobInfoFile, &JobInfo{Name: metadata.fqname})
+		completeTestJob(metadata, map[string]interface{}{"count": 3})
+	})
+	pipestance := invokeTestPipeline(t, rt, dir, src)
+	if state := runTestPipestance(t, pipestance); state != Complete {
+		t.Fatalf("Expected the pipestance to complete, got %v", state)
+	}
+
+	// Reattach, as mrstat would, so that the chunk's resources are not
+	// left over from running it.
+	pipestance, err := rt.ReattachToPipestance("test", path.Join(dir, "test"),
+		src, []string{dir}, "", nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipestance.LoadMetadata()
+	node := pipestance.node.find("ID.test.COUNT_READS.COUNT")
+	if node == nil {
+		t.Fatal("No COUNT node.")
+	}
+	perf, _ := node.forks[0].serializePerf()
+	if len(perf.Chunks) != 1 || perf.Chunks[0].ChunkStats == nil {
+		t.Fatal("Expected perf info for one chunk.")
+	}
+	if threads := perf.Chunks[0].ChunkStats.NumThreads; threads != 3 {
+		t.Errorf("Expected 3 threads, got %d", threads)
+	}
+}
@@ -7,10 +7,14 @@ package core
 //
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/martian-lang/martian/martian/syntax"
 	"github.com/martian-lang/martian/martian/util"
 )
 
@@ -18,11 +22,18 @@ import (
 // Volatile Disk Recovery
 //
 type VDRKillReport struct {
-	Count     uint     `json:"count"`
-	Size      uint64   `json:"size"`
-	Timestamp string   `json:"timestamp"`
-	Paths     []string `json:"paths"`
-	Errors    []string `json:"errors"`
+	Count     uint           `json:"count"`
+	Size      uint64         `json:"size"`
+	Timestamp string         `json:"timestamp"`
+	Paths     []string       `json:"paths"`
+	Errors    []string       `json:"errors"`
+	Retained  []*VDRRetained `json:"retained,omitempty"`
+}
+
+// A path which was exempted from volatile data removal.
+type VDRRetained struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
 }
 
 type VDRByTimestamp []*VDRKillReport
@@ -46,6 +57,7 @@ func mergeVDRKillReports(killReports []*VDRKillReport) *VDRKillReport {
 		allKillReport.Count += killReport.Count
 		allKillReport.Errors = append(allKillReport.Errors, killReport.Errors...)
 		allKillReport.Paths = append(allKillReport.Paths, killReport.Paths...)
+		allKillReport.Retained = append(allKillReport.Retained, killReport.Retained...)
 	}
 	sort.Sort(VDRByTimestamp(killReports))
 	if len(killReports) > 0 {
@@ -76,19 +88,27 @@ func (self *Fork) vdrKill() *VDRKillReport {
 			killPaths = append(killPaths, paths...)
 		}
 	}
-	// If the node splits, kill chunk-level files.
+	// If the node splits or is mapped, kill chunk-level files.
 	// Must check for split here, otherwise we'll end up deleting
 	// output files of non-volatile nodes because single-chunk nodes
 	// get their output redirected to the one chunk's files path.
-	if self.Split() && self.node.rt.overrides.GetOverride(self.node, "force_volatile", true).(bool) {
+	if (self.Split() || self.node.mapped) && self.node.rt.overrides.GetOverride(self.node, "force_volatile", true).(bool) {
 		for _, chunk := range self.chunks {
 			if paths, err := chunk.metadata.enumerateFiles(); err == nil {
 				killPaths = append(killPaths, paths...)
 			}
 		}
 	}
-	// Actually delete the paths.
+	// Actually delete the paths, except those holding retained outputs.
+	retained := self.retainedPaths()
 	for _, p := range killPaths {
+		if reason, ok := isRetained(p, retained); ok {
+			killReport.Retained = append(killReport.Retained, &VDRRetained{
+				Path:   p,
+				Reason: reason,
+			})
+			continue
+		}
 		util.Walk(p, func(_ string, info os.FileInfo, err error) error {
 			if err == nil {
 				killReport.Size += uint64(info.Size())
@@ -107,6 +127,67 @@ func (self *Fork) vdrKill() *VDRKillReport {
 	return killReport
 }
 
+// Get the file paths in the outputs which the stage declares as retained,
+// mapped to the reason they are retained.
+func (self *Fork) retainedPaths() map[string]string {
+	stage, ok := self.node.callable.(*syntax.Stage)
+	if !ok || stage.Retain == nil || len(stage.Retain.Params) == 0 {
+		return nil
+	}
+	outs, ok := self.metadata.read(OutsFile).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	paths := make(map[string]string)
+	for _, param := range stage.Retain.Params {
+		reason := fmt.Sprintf("output '%s' is retained by stage %s",
+			param.Id, stage.Id)
+		for _, p := range outputPaths(outs[param.Id]) {
+			paths[filepath.Clean(p)] = reason
+		}
+	}
+	return paths
+}
+
+// Get all of the strings in an output value which might be file names.
+func outputPaths(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var paths []string
+		for _, elem := range v {
+			paths = append(paths, outputPaths(elem)...)
+		}
+		return paths
+	case map[string]interface{}:
+		var paths []string
+		for _, elem := range v {
+			paths = append(paths, outputPaths(elem)...)
+		}
+		return paths
+	}
+	return nil
+}
+
+// Returns the reason for retaining the given path if it is, or contains, a
+// retained path.
+func isRetained(p string, retained map[string]string) (string, bool) {
+	p = filepath.Clean(p)
+	if reason, ok := retained[p]; ok {
+		return reason, true
+	}
+	prefix := p + string(filepath.Separator)
+	for r, reason := range retained {
+		if strings.HasPrefix(r, prefix) {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
 /* Is self or any of its ancestors symlinked? */
 func (self *Node) vdrCheckSymlink() (string, error) {
 
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/martian-lang/martian/martian/syntax"
+)
+
+func TestVdrKillRetain(t *testing.T) {
+	root, err := ioutil.TempDir("", "vdrretain")
+	if err != nil {
+		t.Fatal("Failed to create tempdir:", err)
+	}
+	defer os.RemoveAll(root)
+
+	overrides, _ := ReadOverrides("")
+	node := &Node{
+		fqname:   "ID.test.QC",
+		volatile: true,
+		rt: &Runtime{
+			Config:    &RuntimeOptions{VdrMode: "rolling"},
+			overrides: overrides,
+		},
+		callable: &syntax.Stage{
+			Id: "QC",
+			Retain: &syntax.RetainParams{
+				Params: []*syntax.RetainParam{{Id: "summary"}},
+			},
+		},
+	}
+	metadata := NewMetadata(node.fqname, root)
+	fork := &Fork{
+		node:           node,
+		metadata:       metadata,
+		split_metadata: NewMetadata(node.fqname, path.Join(root, "split")),
+		join_metadata:  NewMetadata(node.fqname, path.Join(root, "join")),
+	}
+	if err := metadata.mkdirs(); err != nil {
+		t.Fatal(err)
+	}
+	summary := path.Join(metadata.FilesPath(), "summary.json")
+	reads := path.Join(metadata.FilesPath(), "reads.bam")
+	for _, p := range []string{summary, reads} {
+		if err := ioutil.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadata.Write(OutsFile, map[string]interface{}{
+		"summary": summary,
+		"reads":   reads,
+	})
+
+	report := fork.vdrKill()
+	if _, err := os.Stat(summary); err != nil {
+		t.Error("Expected retained output to survive:", err)
+	}
+	if _, err := os.Stat(reads); !os.IsNotExist(err) {
+		t.Error("Expected volatile output to be removed.")
+	}
+	if report.Count != 1 || len(report.Paths) != 1 || report.Paths[0] != reads {
+		t.Errorf("Incorrect kill report paths %v", report.Paths)
+	}
+	if len(report.Retained) != 1 {
+		t.Fatalf("Expected 1 retained path, got %d", len(report.Retained))
+	} else if r := report.Retained[0]; r.Path != summary ||
+		r.Reason != "output 'summary' is retained by stage QC" {
+		t.Errorf("Incorrect retained path %s: %s", r.Path, r.Reason)
+	}
+}
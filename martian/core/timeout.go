@@ -0,0 +1,96 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+// Enforcement of per-stage wall clock time limits.
+//
+// Stages run through mrjob are killed by mrjob when they exceed their limit,
+// in every job mode.  Exec stages are killed by the job manager in local
+// mode.  In cluster mode, the limit is given to the job template as
+// __MRO_TIMEOUT__ (hours:minutes:seconds) and __MRO_TIMEOUT_MIN__ (whole
+// minutes), so exec stages are only killed if the template passes it on to
+// the cluster.  In every mode, mrp declares a job which is still running
+// well after its limit to have failed.
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+const (
+	// How long the job manager or cluster waits after a job's timeout
+	// before killing it, to give mrjob the chance to do so first.
+	killTimeoutGrace = time.Minute
+
+	// How long mrp waits after a job's timeout before assuming that nothing
+	// killed it and declaring it failed.
+	timeoutGrace = 5 * time.Minute
+)
+
+// Returns the message written to _errors for a job which was killed for
+// exceeding its time limit.  The message always begins with "timeout: ",
+// so timed out jobs can be retried automatically by adding "^timeout: " to
+// the retry_on list in retry.json.
+func TimeoutMessage(timeout time.Duration) string {
+	return fmt.Sprintf("timeout: job exceeded its time limit of %v", timeout)
+}
+
+// Returns the time limit to give the cluster for a job with the given
+// timeout, formatted as hours:minutes:seconds and as whole minutes, or empty
+// strings if the job has no limit.
+func clusterTimeout(timeout time.Duration) (string, string) {
+	if timeout <= 0 {
+		return "", ""
+	}
+	limit := timeout + killTimeoutGrace
+	seconds := int64((limit + time.Second - 1) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d",
+			seconds/3600, seconds/60%60, seconds%60),
+		strconv.FormatInt((seconds+59)/60, 10)
+}
+
+// Get the time limit for a job of the given stage type, in seconds, or 0 if
+// the job has no limit.
+func (self *Node) getJobTimeout(stageType string) int {
+	timeout := 0
+	if self.resources != nil {
+		timeout = self.resources.Timeout
+	}
+	override := self.rt.overrides.GetOverride(self,
+		fmt.Sprintf("%s.timeout", stageType),
+		float64(timeout))
+	if overrideFloat, ok := override.(float64); ok {
+		timeout = int(overrideFloat)
+	} else {
+		util.PrintInfo("runtime",
+			"Invalid value for %s %s.timeout: %v",
+			self.fqname, stageType, override)
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// Get the time limit for the running job, and the time after which mrp
+// should consider the job to have exceeded it, or zero values if the job has
+// no limit.
+func (self *Metadata) timeoutDeadline() (time.Duration, time.Time) {
+	var jobInfo JobInfo
+	if err := self.ReadInto(JobInfoFile, &jobInfo); err != nil ||
+		jobInfo.Timeout <= 0 {
+		return 0, time.Time{}
+	}
+	timeout := time.Duration(jobInfo.Timeout) * time.Second
+	start := time.Now()
+	if jobInfo.WallClockInfo != nil {
+		if t, err := time.ParseInLocation(util.TIMEFMT,
+			jobInfo.WallClockInfo.Start, time.Local); err == nil {
+			start = t
+		}
+	}
+	return timeout, start.Add(timeout + timeoutGrace)
+}
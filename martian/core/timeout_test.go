@@ -0,0 +1,87 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func TestGetJobTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGetJobTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	overridesFile := path.Join(dir, "overrides.json")
+	writeTestFile(t, overridesFile, `{"SORT": {"chunk.timeout": 60}}`)
+	overrides, err := ReadOverrides(overridesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &Node{
+		rt:        &Runtime{overrides: overrides},
+		fqname:    "ID.test.SORT",
+		resources: &JobResources{Timeout: 3600},
+	}
+	if timeout := node.getJobTimeout(STAGE_TYPE_SPLIT); timeout != 3600 {
+		t.Errorf("Expected the declared split timeout, got %d", timeout)
+	}
+	if timeout := node.getJobTimeout(STAGE_TYPE_CHUNK); timeout != 60 {
+		t.Errorf("Expected the overridden chunk timeout, got %d", timeout)
+	}
+	node.resources = nil
+	if timeout := node.getJobTimeout(STAGE_TYPE_JOIN); timeout != 0 {
+		t.Errorf("Expected no join timeout, got %d", timeout)
+	}
+}
+
+func TestTimeoutDeadline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestTimeoutDeadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := NewMetadata("ID.test.SORT.fork0.chnk0", dir)
+	metadata.Write(JobInfoFile, &JobInfo{Name: metadata.fqname})
+	if timeout, deadline := metadata.timeoutDeadline(); timeout != 0 || !deadline.IsZero() {
+		t.Errorf("Expected no deadline, got %v", deadline)
+	}
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	metadata.Write(JobInfoFile, &JobInfo{
+		Name:    metadata.fqname,
+		Timeout: 1800,
+		WallClockInfo: &WallClockInfo{
+			Start: start.Format(util.TIMEFMT),
+		},
+	})
+	timeout, deadline := metadata.timeoutDeadline()
+	if timeout != 30*time.Minute {
+		t.Errorf("Expected a 30 minute timeout, got %v", timeout)
+	}
+	if expect := start.Add(timeout + timeoutGrace); !deadline.Equal(expect) {
+		t.Errorf("Expected deadline %v, got %v", expect, deadline)
+	}
+	if msg := TimeoutMessage(timeout); !regexp.MustCompile(
+		"^timeout: ").MatchString(msg) {
+		t.Errorf("Timeout message %q cannot be matched for retry.", msg)
+	}
+}
+
+func TestClusterTimeout(t *testing.T) {
+	if walltime, minutes := clusterTimeout(0); walltime != "" || minutes != "" {
+		t.Errorf("Expected no cluster limit, got %q, %q", walltime, minutes)
+	}
+	// The cluster limit includes the grace period for mrjob to kill the job.
+	if walltime, minutes := clusterTimeout(
+		26*time.Hour + 5*time.Second); walltime != "26:01:05" || minutes != "1562" {
+		t.Errorf("Expected 26:01:05 or 1562 minutes, got %q, %q",
+			walltime, minutes)
+	}
+}
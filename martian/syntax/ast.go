@@ -14,7 +14,17 @@ type StageLanguage string
 
 type (
 	AstNode struct {
-		Loc          int
+		// The line and column of the start of the token which
+		// identifies the node.  Columns are 1-based byte offsets within
+		// the line, or 0 if unknown.
+		Loc int
+		Col int
+
+		// The line and column just past the end of the last token of the
+		// node, e.g. the closing paren of a stage declaration.
+		EndLoc int
+		EndCol int
+
 		Fname        string
 		IncludeStack []string
 		Comments     []string
@@ -46,6 +56,14 @@ type (
 		Id   string
 	}
 
+	// A struct type is a named record whose members are declared the
+	// same way as input parameters.  Values are represented as maps.
+	StructType struct {
+		Node    AstNode
+		Id      string
+		Members *Params
+	}
+
 	Dec interface {
 		AstNodable
 		getDec()
@@ -65,10 +83,77 @@ type (
 		ThreadNode  *AstNode
 		MemNode     *AstNode
 		SpecialNode *AstNode
+		TimeoutNode *AstNode
+		RetriesNode *AstNode
+		BackoffNode *AstNode
+		RetryOnNode *AstNode
 
 		Threads int
 		MemGB   int
 		Special string
+
+		// The wall clock time limit for each job of the stage, in seconds.
+		Timeout int
+
+		// The number of times a failed job of the stage may be retried, the
+		// delay in seconds before the first retry, and a regular expression
+		// matching errors which may be retried in addition to those in
+		// retry.json.
+		Retries int
+		Backoff int
+		RetryOn string
+
+		// Expressions over the stage inputs, if the thread or memory
+		// requirements are not constant.
+		ThreadExp ResourceExp `json:",omitempty"`
+		MemExp    ResourceExp `json:",omitempty"`
+	}
+
+	// An expression for a resource requirement, which is evaluated when a
+	// job is launched from the values of the stage's inputs.
+	ResourceExp interface {
+		AstNodable
+		Eval(args map[string]interface{}) (float64, error)
+		compile(global *Ast, stage *Stage) error
+		format() string
+	}
+
+	// A numeric literal in a resource expression.
+	ResourceNum struct {
+		Node  AstNode
+		Value float64
+	}
+
+	// A reference to a stage input in a resource expression.
+	ResourceRef struct {
+		Node AstNode
+		Id   string
+	}
+
+	// A call to a builtin function in a resource expression.
+	ResourceFunc struct {
+		Node AstNode
+		Name string
+		Args []ResourceExp
+	}
+
+	// An arithmetic operation in a resource expression.
+	ResourceBinExp struct {
+		Node  AstNode
+		Op    string
+		Left  ResourceExp
+		Right ResourceExp
+	}
+
+	// The set of stage outputs which are exempt from volatile data removal.
+	RetainParams struct {
+		Node   AstNode
+		Params []*RetainParam
+	}
+
+	RetainParam struct {
+		Node AstNode
+		Id   string
 	}
 
 	paramsTuple struct {
@@ -87,6 +172,7 @@ type (
 		ChunkOuts *Params
 		Split     bool
 		Resources *Resources
+		Retain    *RetainParams
 	}
 
 	Pipeline struct {
@@ -117,8 +203,11 @@ type (
 		GetId() string
 		GetHelp() string
 		GetOutName() string
+		GetDefault() Exp
 		IsFile() bool
 		setIsFile(bool)
+		GetStructType() *StructType
+		setStructType(*StructType)
 	}
 
 	InParam struct {
@@ -127,7 +216,9 @@ type (
 		ArrayDim int
 		Id       string
 		Help     string
+		Default  Exp `json:",omitempty"`
 		Isfile   bool
+		Struct   *StructType `json:"-"`
 	}
 
 	OutParam struct {
@@ -138,6 +229,7 @@ type (
 		Help     string
 		OutName  string
 		Isfile   bool
+		Struct   *StructType `json:"-"`
 	}
 
 	SrcParam struct {
@@ -152,6 +244,7 @@ type (
 		Id    string
 		Exp   Exp
 		Sweep bool
+		Split bool
 		Tname string
 	}
 
@@ -165,6 +258,7 @@ type (
 		Local     bool
 		Preflight bool
 		Volatile  bool
+		Mapped    bool
 		Bindings  *BindStms
 	}
 
@@ -205,6 +299,13 @@ type (
 		OutputId string
 	}
 
+	// A disjunction of references, e.g. `self.skip or STAGE.no_data`.
+	OrExp struct {
+		Node AstNode
+		Kind ExpKind
+		Refs []*RefExp
+	}
+
 	// Preprocessor variables aren't, strictly speaking, part of the
 	// AST.  They're stripped before parsing, except when formatting code.
 	preprocessorDirective struct {
@@ -217,19 +318,50 @@ type (
 	commentBlock struct {
 		Loc   int
 		Value string
+
+		// Set if the comment followed code on the same line.
+		Trailing bool
+	}
+
+	// An @include or @import directive in the top-level file, with the
+	// declarations it contributed and which of those were referenced from
+	// outside of the included file.
+	IncludeUsage struct {
+		// The location of the directive.
+		Node AstNode
+
+		// The file which was included.
+		Fname string
+
+		// The callables, file types and struct types declared in the
+		// included file, or in files which it included in turn.
+		Callables   []string
+		UserTypes   []string
+		StructTypes []string
+
+		// The contributed names which were referenced.
+		Used map[string]bool
 	}
 
 	Ast struct {
-		UserTypes     []*UserType
-		UserTypeTable map[string]*UserType
-		TypeTable     map[string]Type
-		Stages        []*Stage
-		Pipelines     []*Pipeline
-		Callables     *Callables
-		Call          *CallStm
-		Errors        []error
-		preprocess    []*preprocessorDirective
-		comments      []*commentBlock
+		UserTypes       []*UserType
+		UserTypeTable   map[string]*UserType
+		StructTypes     []*StructType
+		StructTypeTable map[string]*StructType
+		TypeTable       map[string]Type
+		Stages          []*Stage
+		Pipelines       []*Pipeline
+		Callables       *Callables
+		Call            *CallStm
+		Errors          []error
+		Includes        []*IncludeUsage
+		preprocess      []*preprocessorDirective
+		comments        []*commentBlock
+
+		// Declarations which had syntax errors, and where they were
+		// declared.  References to them are not checked, since they would
+		// only report the same error again.
+		failedDecs map[string]AstNode
 	}
 )
 
@@ -243,12 +375,15 @@ const (
 	KindNull           = "null"
 	KindSelf           = "self" // reference
 	KindCall           = "call" // reference
+	KindOr             = "or"   // disjunction of references
 )
 
 func NewAst(decs []Dec, call *CallStm) *Ast {
 	self := &Ast{}
 	self.UserTypes = []*UserType{}
 	self.UserTypeTable = map[string]*UserType{}
+	self.StructTypes = []*StructType{}
+	self.StructTypeTable = map[string]*StructType{}
 	self.TypeTable = map[string]Type{}
 	self.Stages = []*Stage{}
 	self.Pipelines = []*Pipeline{}
@@ -260,6 +395,8 @@ func NewAst(decs []Dec, call *CallStm) *Ast {
 		switch dec := dec.(type) {
 		case *UserType:
 			self.UserTypes = append(self.UserTypes, dec)
+		case *StructType:
+			self.StructTypes = append(self.StructTypes, dec)
 		case *Stage:
 			self.Stages = append(self.Stages, dec)
 			self.Callables.List = append(self.Callables.List, dec)
@@ -271,21 +408,57 @@ func NewAst(decs []Dec, call *CallStm) *Ast {
 	return self
 }
 
-func NewAstNode(loc int, locmap []FileLoc) AstNode {
+func NewAstNode(loc tokenLoc, locmap []FileLoc) AstNode {
 	// Process the accumulated comments/whitespace.
 
 	if len(locmap) > 0 {
 		// If there's no newline at the end of the source and the error is in the
 		// node at the end of the file, the loc can be one larger than the size
 		// of the locmap. So cap it so we don't have an array out of bounds.
-		if loc >= len(locmap) {
-			loc = len(locmap) - 1
+		line := loc.line
+		if line >= len(locmap) {
+			line = len(locmap) - 1
+		}
+		return AstNode{
+			Loc:          locmap[line].loc,
+			Col:          loc.col,
+			EndLoc:       locmap[line].loc + loc.endLine - loc.line,
+			EndCol:       loc.endCol,
+			Fname:        locmap[line].fname,
+			IncludeStack: locmap[line].includedFrom,
 		}
-		return AstNode{locmap[loc].loc, locmap[loc].fname, locmap[loc].includedFrom, nil}
 	} else {
 		// locmap will be empty when yaccParse is called from mrf
-		return AstNode{loc, "", nil, nil}
+		return AstNode{
+			Loc:    loc.line,
+			Col:    loc.col,
+			EndLoc: loc.endLine,
+			EndCol: loc.endCol,
+		}
+	}
+}
+
+// Make a node which is identified by the token at loc and which extends
+// through the token at end.  If end is the zero value, the node ends with
+// its identifying token.
+func newAstSpan(loc, end tokenLoc, locmap []FileLoc) AstNode {
+	node := NewAstNode(loc, locmap)
+	if end.endCol > 0 {
+		last := NewAstNode(end, locmap)
+		node.EndLoc = last.EndLoc
+		node.EndCol = last.EndCol
+	}
+	return node
+}
+
+// Get the last of the given token locations which is not the zero value.
+func lastLoc(locs ...tokenLoc) tokenLoc {
+	for i := len(locs) - 1; i >= 0; i-- {
+		if locs[i].endCol > 0 {
+			return locs[i]
+		}
 	}
+	return tokenLoc{}
 }
 
 // Gets the name of the file that defines the node.
@@ -297,6 +470,7 @@ func (s *Ast) inheritComments() bool { return false }
 func (s *Ast) getSubnodes() []AstNodable {
 	subs := make([]AstNodable, 0,
 		1+len(s.UserTypes)+
+			len(s.StructTypes)+
 			len(s.Callables.List)+
 			len(s.preprocess))
 	for _, n := range s.preprocess {
@@ -305,6 +479,9 @@ func (s *Ast) getSubnodes() []AstNodable {
 	for _, n := range s.UserTypes {
 		subs = append(subs, n)
 	}
+	for _, n := range s.StructTypes {
+		subs = append(subs, n)
+	}
 	for _, n := range s.Callables.List {
 		subs = append(subs, n)
 	}
@@ -324,11 +501,13 @@ func (s *preprocessorDirective) inheritComments() bool     { return false }
 
 // Interface whitelist for Dec, Param, Exp, and Stm implementors.
 // Patterned after code in Go's ast.go.
-func (*UserType) getDec() {}
-func (*Stage) getDec()    {}
-func (*Pipeline) getDec() {}
-func (*ValExp) getExp()   {}
-func (*RefExp) getExp()   {}
+func (*UserType) getDec()   {}
+func (*StructType) getDec() {}
+func (*Stage) getDec()      {}
+func (*Pipeline) getDec()   {}
+func (*ValExp) getExp()     {}
+func (*RefExp) getExp()     {}
+func (*OrExp) getExp()      {}
 
 func (s *BuiltinType) GetId() string  { return s.Id }
 func (s *UserType) GetId() string     { return s.Id }
@@ -337,6 +516,17 @@ func (s *UserType) getNode() *AstNode { return &s.Node }
 func (s *UserType) inheritComments() bool     { return false }
 func (s *UserType) getSubnodes() []AstNodable { return nil }
 
+func (s *StructType) GetId() string         { return s.Id }
+func (s *StructType) getNode() *AstNode     { return &s.Node }
+func (s *StructType) inheritComments() bool { return false }
+func (s *StructType) getSubnodes() []AstNodable {
+	subs := make([]AstNodable, 0, len(s.Members.List))
+	for _, n := range s.Members.List {
+		subs = append(subs, n)
+	}
+	return subs
+}
+
 func (s *Stage) GetId() string         { return s.Id }
 func (s *Stage) getNode() *AstNode     { return &s.Node }
 func (s *Stage) GetInParams() *Params  { return s.InParams }
@@ -364,13 +554,16 @@ func (s *Stage) getSubnodes() []AstNodable {
 	if s.Resources != nil {
 		subs = append(subs, s.Resources)
 	}
+	if s.Retain != nil {
+		subs = append(subs, s.Retain)
+	}
 	return subs
 }
 
 func (s *Resources) getNode() *AstNode     { return &s.Node }
 func (s *Resources) inheritComments() bool { return false }
 func (s *Resources) getSubnodes() []AstNodable {
-	subs := make([]AstNodable, 0, 3)
+	subs := make([]AstNodable, 0, 7)
 	if s.ThreadNode != nil {
 		subs = append(subs, s.ThreadNode)
 	}
@@ -380,9 +573,35 @@ func (s *Resources) getSubnodes() []AstNodable {
 	if s.SpecialNode != nil {
 		subs = append(subs, s.SpecialNode)
 	}
+	if s.TimeoutNode != nil {
+		subs = append(subs, s.TimeoutNode)
+	}
+	if s.RetriesNode != nil {
+		subs = append(subs, s.RetriesNode)
+	}
+	if s.BackoffNode != nil {
+		subs = append(subs, s.BackoffNode)
+	}
+	if s.RetryOnNode != nil {
+		subs = append(subs, s.RetryOnNode)
+	}
 	return subs
 }
 
+func (s *RetainParams) getNode() *AstNode     { return &s.Node }
+func (s *RetainParams) inheritComments() bool { return false }
+func (s *RetainParams) getSubnodes() []AstNodable {
+	subs := make([]AstNodable, 0, len(s.Params))
+	for _, n := range s.Params {
+		subs = append(subs, n)
+	}
+	return subs
+}
+
+func (s *RetainParam) getNode() *AstNode         { return &s.Node }
+func (s *RetainParam) inheritComments() bool     { return false }
+func (s *RetainParam) getSubnodes() []AstNodable { return nil }
+
 func (s *Pipeline) GetId() string         { return s.Id }
 func (s *Pipeline) getNode() *AstNode     { return &s.Node }
 func (s *Pipeline) GetInParams() *Params  { return s.InParams }
@@ -424,11 +643,18 @@ func (s *InParam) GetArrayDim() int   { return s.ArrayDim }
 func (s *InParam) GetId() string      { return s.Id }
 func (s *InParam) GetHelp() string    { return s.Help }
 func (s *InParam) GetOutName() string { return "" }
+func (s *InParam) GetDefault() Exp    { return s.Default }
 func (s *InParam) IsFile() bool       { return s.Isfile }
 func (s *InParam) setIsFile(b bool)   { s.Isfile = b }
 
+func (s *InParam) GetStructType() *StructType   { return s.Struct }
+func (s *InParam) setStructType(st *StructType) { s.Struct = st }
+
 func (s *InParam) inheritComments() bool { return false }
 func (s *InParam) getSubnodes() []AstNodable {
+	if s.Default != nil {
+		return []AstNodable{s.Default}
+	}
 	return nil
 }
 
@@ -439,9 +665,13 @@ func (s *OutParam) GetArrayDim() int   { return s.ArrayDim }
 func (s *OutParam) GetId() string      { return s.Id }
 func (s *OutParam) GetHelp() string    { return s.Help }
 func (s *OutParam) GetOutName() string { return s.OutName }
+func (s *OutParam) GetDefault() Exp    { return nil }
 func (s *OutParam) IsFile() bool       { return s.Isfile }
 func (s *OutParam) setIsFile(b bool)   { s.Isfile = b }
 
+func (s *OutParam) GetStructType() *StructType   { return s.Struct }
+func (s *OutParam) setStructType(st *StructType) { s.Struct = st }
+
 func (s *OutParam) inheritComments() bool { return false }
 func (s *OutParam) getSubnodes() []AstNodable {
 	return nil
@@ -501,3 +731,15 @@ func (s *RefExp) inheritComments() bool { return false }
 func (s *RefExp) getSubnodes() []AstNodable {
 	return nil
 }
+
+func (s *OrExp) getNode() *AstNode { return &s.Node }
+func (s *OrExp) getKind() ExpKind  { return s.Kind }
+
+func (s *OrExp) inheritComments() bool { return false }
+func (s *OrExp) getSubnodes() []AstNodable {
+	subs := make([]AstNodable, 0, len(s.Refs))
+	for _, n := range s.Refs {
+		subs = append(subs, n)
+	}
+	return subs
+}
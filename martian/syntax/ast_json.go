@@ -0,0 +1,460 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Versioned JSON representation of compiled MRO ASTs.
+//
+
+package syntax
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The version of the JSON AST schema produced by this package.
+//
+// The version is incremented whenever a field is removed or its meaning
+// changes.  Adding new fields does not change the version, so consumers
+// should ignore fields they do not recognize.
+const AstJsonVersion = 1
+
+type (
+	// The top-level JSON document for a set of compiled MRO files.
+	//
+	// Declarations appear in the order in which they were encountered.  If
+	// several files declare (or include) the same name, the first
+	// declaration is used.
+	JsonAst struct {
+		// Always AstJsonVersion.
+		Version   int             `json:"version"`
+		Filetypes []*JsonFiletype `json:"filetypes"`
+		Structs   []*JsonStruct   `json:"structs"`
+		Stages    []*JsonStage    `json:"stages"`
+		Pipelines []*JsonPipeline `json:"pipelines"`
+
+		// The top-level call of each compiled file which has one.
+		Calls []*JsonCall `json:"calls,omitempty"`
+	}
+
+	// The source location of a node.
+	JsonLoc struct {
+		// The file name, as given in the @include which included it.
+		File string `json:"file"`
+
+		// The 1-based line number within the file.
+		Line int `json:"line"`
+
+		// The 1-based column of the start of the node's identifying token,
+		// and the line and column just past the end of the node, if known.
+		Col     int `json:"col,omitempty"`
+		EndLine int `json:"end_line,omitempty"`
+		EndCol  int `json:"end_col,omitempty"`
+
+		// The include stack, innermost first, as "file:line".
+		IncludedFrom []string `json:"included_from,omitempty"`
+	}
+
+	JsonFiletype struct {
+		Name     string   `json:"name"`
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	JsonStruct struct {
+		Name     string       `json:"name"`
+		Members  []*JsonParam `json:"members"`
+		Loc      JsonLoc      `json:"loc"`
+		Comments []string     `json:"comments,omitempty"`
+	}
+
+	// An input or output parameter, or a struct member.
+	JsonParam struct {
+		Name string `json:"name"`
+
+		// The element type name, e.g. "bam" for an input of type bam[].
+		Type string `json:"type"`
+
+		// The array dimension, e.g. 1 for an input of type bam[].
+		ArrayDim int `json:"array_dim"`
+
+		Help string `json:"help,omitempty"`
+
+		// For outputs, the file name to use for the output in the
+		// pipestance outs directory.
+		OutName string `json:"out_name,omitempty"`
+
+		// For inputs, the default value.
+		Default *JsonExp `json:"default,omitempty"`
+
+		// True if the type is a filetype.
+		IsFile bool `json:"is_file"`
+
+		// The name of the struct, if the type (or, for typed maps, the
+		// element type) is a struct.
+		Struct string `json:"struct,omitempty"`
+
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	JsonSrc struct {
+		// One of "py", "exec" or "comp".
+		Lang string   `json:"lang"`
+		Path string   `json:"path"`
+		Args []string `json:"args,omitempty"`
+	}
+
+	JsonResources struct {
+		Threads int    `json:"threads,omitempty"`
+		MemGB   int    `json:"mem_gb,omitempty"`
+		Special string `json:"special,omitempty"`
+		Timeout int    `json:"timeout,omitempty"`
+		Retries int    `json:"retries,omitempty"`
+		Backoff int    `json:"retry_backoff,omitempty"`
+		RetryOn string `json:"retry_on,omitempty"`
+
+		// Resource expressions, formatted as MRO source, if the
+		// requirement depends on the stage inputs.
+		ThreadsExp string `json:"threads_exp,omitempty"`
+		MemGBExp   string `json:"mem_gb_exp,omitempty"`
+	}
+
+	JsonStage struct {
+		Name    string       `json:"name"`
+		Inputs  []*JsonParam `json:"inputs"`
+		Outputs []*JsonParam `json:"outputs"`
+		Src     *JsonSrc     `json:"src"`
+
+		// True if the stage has a split.  The chunk parameters are only
+		// present for stages which split.
+		Split        bool         `json:"split"`
+		ChunkInputs  []*JsonParam `json:"chunk_inputs,omitempty"`
+		ChunkOutputs []*JsonParam `json:"chunk_outputs,omitempty"`
+
+		Resources *JsonResources `json:"resources,omitempty"`
+
+		// Outputs which are exempt from volatile data removal.
+		Retain []string `json:"retain,omitempty"`
+
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	JsonPipeline struct {
+		Name    string         `json:"name"`
+		Inputs  []*JsonParam   `json:"inputs"`
+		Outputs []*JsonParam   `json:"outputs"`
+		Calls   []*JsonCall    `json:"calls"`
+		Returns []*JsonBinding `json:"returns"`
+
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	JsonCall struct {
+		// The name of the call within its pipeline.
+		Name string `json:"name"`
+
+		// The name of the stage or pipeline being called.
+		Callable string `json:"callable"`
+
+		Mapped    bool `json:"mapped,omitempty"`
+		Local     bool `json:"local,omitempty"`
+		Preflight bool `json:"preflight,omitempty"`
+		Volatile  bool `json:"volatile,omitempty"`
+
+		// Bindings in the call's using clause, e.g. "disabled".
+		Modifiers []*JsonBinding `json:"modifiers,omitempty"`
+
+		Bindings []*JsonBinding `json:"bindings"`
+
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	JsonBinding struct {
+		// The parameter being bound.
+		Name string `json:"name"`
+
+		// The resolved type of the bound value.
+		Type string `json:"type,omitempty"`
+
+		Sweep bool     `json:"sweep,omitempty"`
+		Split bool     `json:"split,omitempty"`
+		Value *JsonExp `json:"value"`
+
+		Loc      JsonLoc  `json:"loc"`
+		Comments []string `json:"comments,omitempty"`
+	}
+
+	// An expression.  The fields which are present depend on the kind.
+	JsonExp struct {
+		// One of "string", "int", "float", "bool", "null", "array",
+		// "map", "self", "call" or "or".
+		Kind string `json:"kind"`
+
+		// For literal kinds, the value.
+		Value interface{} `json:"value,omitempty"`
+
+		// For arrays, the elements.  For "or", the references.
+		Elements []*JsonExp `json:"elements,omitempty"`
+
+		// For maps, the values of each key.
+		Entries map[string]*JsonExp `json:"entries,omitempty"`
+
+		// For "self" references, the input parameter.  For "call"
+		// references, the name of the call.
+		Id string `json:"id,omitempty"`
+
+		// For "call" references, the output of the call.
+		OutputId string `json:"output_id,omitempty"`
+	}
+)
+
+func jsonLoc(node *AstNode) JsonLoc {
+	return JsonLoc{
+		File:         node.Fname,
+		Line:         node.Loc,
+		Col:          node.Col,
+		EndLine:      node.EndLoc,
+		EndCol:       node.EndCol,
+		IncludedFrom: node.IncludeStack,
+	}
+}
+
+func jsonParams(params *Params) []*JsonParam {
+	if params == nil {
+		return nil
+	}
+	result := make([]*JsonParam, 0, len(params.List))
+	for _, param := range params.List {
+		p := &JsonParam{
+			Name:     param.GetId(),
+			Type:     param.GetTname(),
+			ArrayDim: param.GetArrayDim(),
+			Help:     param.GetHelp(),
+			OutName:  param.GetOutName(),
+			IsFile:   param.IsFile(),
+			Loc:      jsonLoc(param.getNode()),
+			Comments: param.getNode().Comments,
+		}
+		if def := param.GetDefault(); def != nil {
+			p.Default = jsonExp(def)
+		}
+		if st := param.GetStructType(); st != nil {
+			p.Struct = st.Id
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func jsonExp(exp Exp) *JsonExp {
+	switch exp := exp.(type) {
+	case *ValExp:
+		result := &JsonExp{Kind: string(exp.Kind)}
+		switch exp.Kind {
+		case KindArray:
+			result.Elements = make([]*JsonExp, 0, len(exp.Value.([]Exp)))
+			for _, elem := range exp.Value.([]Exp) {
+				result.Elements = append(result.Elements, jsonExp(elem))
+			}
+		case KindMap:
+			result.Entries = make(map[string]*JsonExp)
+			if m, ok := exp.Value.(map[string]Exp); ok {
+				for k, v := range m {
+					result.Entries[k] = jsonExp(v)
+				}
+			}
+		default:
+			result.Value = exp.Value
+		}
+		return result
+	case *RefExp:
+		return &JsonExp{
+			Kind:     string(exp.Kind),
+			Id:       exp.Id,
+			OutputId: exp.OutputId,
+		}
+	case *OrExp:
+		result := &JsonExp{Kind: string(exp.Kind)}
+		for _, ref := range exp.Refs {
+			result.Elements = append(result.Elements, jsonExp(ref))
+		}
+		return result
+	}
+	return nil
+}
+
+func jsonBindings(bindings *BindStms) []*JsonBinding {
+	if bindings == nil {
+		return nil
+	}
+	result := make([]*JsonBinding, 0, len(bindings.List))
+	for _, binding := range bindings.List {
+		result = append(result, &JsonBinding{
+			Name:     binding.Id,
+			Type:     binding.Tname,
+			Sweep:    binding.Sweep,
+			Split:    binding.Split,
+			Value:    jsonExp(binding.Exp),
+			Loc:      jsonLoc(&binding.Node),
+			Comments: binding.Node.Comments,
+		})
+	}
+	return result
+}
+
+func jsonCall(call *CallStm) *JsonCall {
+	return &JsonCall{
+		Name:      call.Id,
+		Callable:  call.DecId,
+		Mapped:    call.Modifiers.Mapped,
+		Local:     call.Modifiers.Local,
+		Preflight: call.Modifiers.Preflight,
+		Volatile:  call.Modifiers.Volatile,
+		Modifiers: jsonBindings(call.Modifiers.Bindings),
+		Bindings:  jsonBindings(call.Bindings),
+		Loc:       jsonLoc(&call.Node),
+		Comments:  call.Node.Comments,
+	}
+}
+
+func jsonStage(stage *Stage) *JsonStage {
+	result := &JsonStage{
+		Name:    stage.Id,
+		Inputs:  jsonParams(stage.InParams),
+		Outputs: jsonParams(stage.OutParams),
+		Src: &JsonSrc{
+			Lang: string(stage.Src.Lang),
+			Path: stage.Src.Path,
+			Args: stage.Src.Args,
+		},
+		Split:    stage.Split,
+		Loc:      jsonLoc(&stage.Node),
+		Comments: stage.Node.Comments,
+	}
+	if stage.Split {
+		result.ChunkInputs = jsonParams(stage.ChunkIns)
+		result.ChunkOutputs = jsonParams(stage.ChunkOuts)
+	}
+	if res := stage.Resources; res != nil {
+		result.Resources = &JsonResources{
+			Threads: res.Threads,
+			MemGB:   res.MemGB,
+			Special: res.Special,
+			Timeout: res.Timeout,
+			Retries: res.Retries,
+			Backoff: res.Backoff,
+			RetryOn: res.RetryOn,
+		}
+		if res.ThreadExp != nil {
+			result.Resources.ThreadsExp = res.ThreadExp.format()
+		}
+		if res.MemExp != nil {
+			result.Resources.MemGBExp = res.MemExp.format()
+		}
+	}
+	if stage.Retain != nil {
+		for _, param := range stage.Retain.Params {
+			result.Retain = append(result.Retain, param.Id)
+		}
+	}
+	return result
+}
+
+func jsonPipeline(pipeline *Pipeline) *JsonPipeline {
+	result := &JsonPipeline{
+		Name:     pipeline.Id,
+		Inputs:   jsonParams(pipeline.InParams),
+		Outputs:  jsonParams(pipeline.OutParams),
+		Calls:    make([]*JsonCall, 0, len(pipeline.Calls)),
+		Returns:  jsonBindings(pipeline.Ret.Bindings),
+		Loc:      jsonLoc(&pipeline.Node),
+		Comments: pipeline.Node.Comments,
+	}
+	for _, call := range pipeline.Calls {
+		result.Calls = append(result.Calls, jsonCall(call))
+	}
+	return result
+}
+
+// Get the JSON representation of a set of compiled ASTs.
+func NewJsonAst(asts []*Ast) *JsonAst {
+	result := &JsonAst{
+		Version:   AstJsonVersion,
+		Filetypes: []*JsonFiletype{},
+		Structs:   []*JsonStruct{},
+		Stages:    []*JsonStage{},
+		Pipelines: []*JsonPipeline{},
+	}
+	seen := make(map[string]bool)
+	first := func(kind, id string) bool {
+		key := kind + ":" + id
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+	for _, ast := range asts {
+		for _, t := range ast.UserTypes {
+			if first("filetype", t.Id) {
+				result.Filetypes = append(result.Filetypes, &JsonFiletype{
+					Name:     t.Id,
+					Loc:      jsonLoc(&t.Node),
+					Comments: t.Node.Comments,
+				})
+			}
+		}
+		for _, t := range ast.StructTypes {
+			if first("struct", t.Id) {
+				result.Structs = append(result.Structs, &JsonStruct{
+					Name:     t.Id,
+					Members:  jsonParams(t.Members),
+					Loc:      jsonLoc(&t.Node),
+					Comments: t.Node.Comments,
+				})
+			}
+		}
+		for _, stage := range ast.Stages {
+			if first("callable", stage.Id) {
+				result.Stages = append(result.Stages, jsonStage(stage))
+			}
+		}
+		for _, pipeline := range ast.Pipelines {
+			if first("callable", pipeline.Id) {
+				result.Pipelines = append(result.Pipelines, jsonPipeline(pipeline))
+			}
+		}
+		if ast.Call != nil {
+			result.Calls = append(result.Calls, jsonCall(ast.Call))
+		}
+	}
+	return result
+}
+
+// Dump the versioned JSON representation of a set of compiled ASTs.
+func JsonDumpAsts(asts []*Ast) string {
+	if jsonBytes, err := json.MarshalIndent(NewJsonAst(asts), "", "    "); err == nil {
+		return string(jsonBytes)
+	} else {
+		return fmt.Sprintf("{ error: \"%s\" }", err.Error())
+	}
+}
+
+// Load the JSON representation of a set of ASTs, as produced by
+// JsonDumpAsts.  Returns an error if the document was produced with a
+// different schema version.
+func LoadJsonAst(data []byte) (*JsonAst, error) {
+	var result JsonAst
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if result.Version != AstJsonVersion {
+		return nil, fmt.Errorf(
+			"unsupported AST JSON version %d (expected %d)",
+			result.Version, AstJsonVersion)
+	}
+	return &result, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJsonAst(t *testing.T) {
+	ast := testGood(t, `
+filetype bam;
+
+# Sorts reads.
+stage SORT(
+    in  bam    reads,
+    in  bool   fast    = false,
+    out bam    sorted  "Sorted reads",
+    src py     "stages/sort",
+) using (
+    mem_gb = 4,
+)
+
+pipeline SORT_ALL(
+    in  bam   reads,
+    out bam[] sorted,
+)
+{
+    call SORT(
+        reads = self.reads,
+    ) using (
+        volatile = true,
+    )
+
+    return (
+        sorted = [SORT.sorted],
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	data := JsonDumpAsts([]*Ast{ast})
+	loaded, err := LoadJsonAst([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != AstJsonVersion {
+		t.Errorf("Incorrect version %d", loaded.Version)
+	}
+	if len(loaded.Filetypes) != 1 || loaded.Filetypes[0].Name != "bam" {
+		t.Errorf("Incorrect filetypes %v", loaded.Filetypes)
+	}
+	if len(loaded.Stages) != 1 {
+		t.Fatalf("Expected 1 stage, got %d", len(loaded.Stages))
+	}
+	stage := loaded.Stages[0]
+	if stage.Loc.Line != 5 || stage.Loc.Col != 7 ||
+		stage.Loc.EndLine != 12 || stage.Loc.EndCol != 2 {
+		t.Errorf("Incorrect stage location %v", stage.Loc)
+	}
+	if !reflect.DeepEqual(stage.Comments, []string{"# Sorts reads."}) {
+		t.Errorf("Incorrect stage comments %v", stage.Comments)
+	}
+	if names := []string{
+		stage.Inputs[0].Name, stage.Inputs[1].Name,
+	}; !reflect.DeepEqual(names, []string{"reads", "fast"}) {
+		t.Errorf("Incorrect input order %v", names)
+	}
+	if !stage.Inputs[0].IsFile {
+		t.Error("Expected reads to be a file.")
+	}
+	if def := stage.Inputs[1].Default; def == nil ||
+		def.Kind != "bool" || def.Value != false {
+		t.Errorf("Incorrect default value %v", def)
+	}
+	if stage.Outputs[0].Help != "Sorted reads" {
+		t.Errorf("Incorrect help %q", stage.Outputs[0].Help)
+	}
+	if stage.Resources == nil || stage.Resources.MemGB != 4 {
+		t.Errorf("Incorrect resources %v", stage.Resources)
+	}
+	if len(loaded.Pipelines) != 1 || len(loaded.Pipelines[0].Calls) != 1 {
+		t.Fatalf("Incorrect pipelines %v", loaded.Pipelines)
+	}
+	call := loaded.Pipelines[0].Calls[0]
+	if call.Name != "SORT" || call.Callable != "SORT" || !call.Volatile {
+		t.Errorf("Incorrect call %v", call)
+	}
+	if b := call.Bindings[0]; b.Name != "reads" || b.Type != "bam" {
+		t.Errorf("Incorrect binding %v", b)
+	} else if b.Value.Kind != "self" || b.Value.Id != "reads" {
+		t.Errorf("Incorrect binding value %v", b.Value)
+	}
+	ret := loaded.Pipelines[0].Returns[0]
+	if ret.Value.Kind != "array" || ret.Value.Elements[0].Kind != "call" ||
+		ret.Value.Elements[0].Id != "SORT" ||
+		ret.Value.Elements[0].OutputId != "sorted" {
+		t.Errorf("Incorrect return value %v", ret.Value)
+	}
+}
+
+func TestLoadJsonAstVersion(t *testing.T) {
+	data, _ := json.Marshal(&JsonAst{Version: AstJsonVersion + 1})
+	if _, err := LoadJsonAst(data); err == nil {
+		t.Error("Expected unsupported version to fail.")
+	}
+}
@@ -9,6 +9,7 @@ package syntax
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -34,10 +35,14 @@ type AstError struct {
 	global *Ast
 	Node   *AstNode
 	Msg    string
+
+	// The line of source containing the error, if known.
+	source string
 }
 
 func (self *AstError) Error() string {
-	line := fmt.Sprintf("MRO %s at %s:%d.", self.Msg, self.Node.Fname, self.Node.Loc)
+	line := fmt.Sprintf("MRO %s at %s.", self.Msg, formatLoc(self.Node))
+	line += caret(self.source, self.Node)
 	for _, inc := range self.Node.IncludeStack {
 		line += fmt.Sprintf("\n\tincluded from %s", inc)
 	}
@@ -49,11 +54,35 @@ type ParseError struct {
 	token        string
 	fname        string
 	loc          int
+	col          int
+	endLoc       int
+	endCol       int
 	includeStack []string
+
+	// The line of source containing the error, if known.
+	source string
+}
+
+// The unexpected token.
+func (self *ParseError) Token() string {
+	return self.token
+}
+
+// The location of the unexpected token.
+func (self *ParseError) Node() *AstNode {
+	return &AstNode{
+		Loc:          self.loc,
+		Col:          self.col,
+		EndLoc:       self.endLoc,
+		EndCol:       self.endCol,
+		Fname:        self.fname,
+		IncludeStack: self.includeStack,
+	}
 }
 
 func (self *ParseError) Error() string {
-	line := fmt.Sprintf("MRO ParseError: unexpected token '%s' at %s:%d.", self.token, self.fname, self.loc)
+	line := fmt.Sprintf("MRO ParseError: unexpected token '%s' at %s.", self.token, formatLoc(self.Node()))
+	line += caret(self.source, self.Node())
 	for _, inc := range self.includeStack {
 		line += fmt.Sprintf("\n\tincluded from %s", inc)
 	}
@@ -100,3 +129,106 @@ func (self ErrorList) If() error {
 	}
 	return nil
 }
+
+// Format the location of a node as file:line:column, omitting the column
+// if it is unknown.
+func formatLoc(node *AstNode) string {
+	if node.Col > 0 {
+		return fmt.Sprintf("%s:%d:%d", node.Fname, node.Loc, node.Col)
+	}
+	return fmt.Sprintf("%s:%d", node.Fname, node.Loc)
+}
+
+// Format the given source line with a caret underneath the span of the
+// node, for appending to an error message.
+func caret(source string, node *AstNode) string {
+	if source == "" || node.Col < 1 || node.Col > len(source)+1 {
+		return ""
+	}
+	width := node.EndCol - node.Col
+	if node.EndLoc != node.Loc {
+		// Multi-line tokens are marked through the end of the first line.
+		width = len(source) - node.Col + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+	// Keep tabs in the indentation, so that the caret lines up.
+	indent := []byte(source[:node.Col-1])
+	for i, c := range indent {
+		if c != '\t' {
+			indent[i] = ' '
+		}
+	}
+	return "\n\t" + source + "\n\t" + string(indent) + strings.Repeat("^", width)
+}
+
+// Fill in the source lines for errors from the preprocessed source and
+// location map.
+func attachSource(err error, src string, locmap []FileLoc) {
+	var lines []string
+	find := func(node *AstNode) string {
+		if lines == nil {
+			lines = strings.Split(src, "\n")
+		}
+		// locmap[i] gives the location of line i of the source, 1-based.
+		for i, loc := range locmap {
+			if i > 0 && i <= len(lines) &&
+				loc.fname == node.Fname && loc.loc == node.Loc {
+				return lines[i-1]
+			}
+		}
+		return ""
+	}
+	switch err := err.(type) {
+	case ErrorList:
+		for _, e := range err {
+			attachSource(e, src, locmap)
+		}
+	case *AstError:
+		if err.Node != nil && err.Node.Col > 0 {
+			err.source = find(err.Node)
+		}
+	case *ParseError:
+		err.source = find(err.Node())
+	}
+}
+
+// Get the file, line and column of an error, if it has a location.
+func errorLocation(err error) (string, int, int) {
+	switch err := err.(type) {
+	case *ParseError:
+		return err.fname, err.loc, err.col
+	case *AstError:
+		if err.Node != nil {
+			return err.Node.Fname, err.Node.Loc, err.Node.Col
+		}
+	case *LintWarning:
+		return err.Node.Fname, err.Node.Loc, err.Node.Col
+	}
+	return "", 0, 0
+}
+
+// Returns true if the first error has an earlier location than the second.
+func errorBefore(a, b error) bool {
+	fa, la, ca := errorLocation(a)
+	fb, lb, cb := errorLocation(b)
+	if fa != fb {
+		return fa < fb
+	} else if la != lb {
+		return la < lb
+	}
+	return ca < cb
+}
+
+// Collapse the error list down as for If(), and sort the errors by
+// location.  Errors without a location sort first.
+func (self ErrorList) sorted() error {
+	err := self.If()
+	if list, ok := err.(ErrorList); ok {
+		sort.SliceStable(list, func(i, j int) bool {
+			return errorBefore(list[i], list[j])
+		})
+	}
+	return err
+}
@@ -26,3 +26,7 @@ func (valExp *ValExp) ToInterface() interface{} {
 func (self *RefExp) ToInterface() interface{} {
 	return nil
 }
+
+func (self *OrExp) ToInterface() interface{} {
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -28,13 +29,29 @@ func max(a, b int) int {
 	}
 }
 
+// The default line width beyond which help strings are wrapped.  Wrapping a
+// help string changes its value, so it is off by default.
+const DefaultFormatWidth = 0
+
+// Help strings are not wrapped if there would be less than this much space
+// for them.
+const minHelpWidth = 20
+
 type printer struct {
 	buf      bytes.Buffer
 	comments []*commentBlock
+
+	// The line width beyond which help strings are wrapped, or 0 to never
+	// wrap them.
+	width int
 }
 
 func (self *printer) printComments(loc int, prefix string) {
 	for len(self.comments) > 0 && self.comments[0].Loc <= loc {
+		if self.comments[0].Trailing && self.comments[0].Loc == loc {
+			// This goes at the end of the line, in endLine.
+			return
+		}
 		self.buf.WriteString(prefix)
 		self.buf.WriteString(self.comments[0].Value)
 		self.buf.WriteString(NEWLINE)
@@ -42,6 +59,18 @@ func (self *printer) printComments(loc int, prefix string) {
 	}
 }
 
+// End the line for a node which started on the given source line, keeping
+// the comment which followed it on that line, if any.
+func (self *printer) endLine(loc int) {
+	if len(self.comments) > 0 && self.comments[0].Trailing &&
+		self.comments[0].Loc == loc {
+		self.buf.WriteRune(' ')
+		self.buf.WriteString(self.comments[0].Value)
+		self.comments = self.comments[1:]
+	}
+	self.buf.WriteString(NEWLINE)
+}
+
 func (self *printer) WriteString(s string) {
 	self.buf.WriteString(s)
 }
@@ -80,7 +109,7 @@ func (self *ValExp) format(prefix string) string {
 		return fmt.Sprintf("%g", self.Value)
 	}
 	if self.Kind == KindString {
-		return fmt.Sprintf("\"%s\"", self.Value)
+		return quoteString(self.Value.(string))
 	}
 	if self.Kind == KindMap {
 		bytes, err := json.MarshalIndent(self.ToInterface(), prefix, INDENT)
@@ -132,6 +161,14 @@ func (self *RefExp) format(prefix string) string {
 	return "self." + self.Id
 }
 
+func (self *OrExp) format(prefix string) string {
+	refs := make([]string, 0, len(self.Refs))
+	for _, ref := range self.Refs {
+		refs = append(refs, ref.format(prefix))
+	}
+	return strings.Join(refs, " or ")
+}
+
 //
 // Binding
 //
@@ -145,9 +182,12 @@ func (self *BindStm) format(printer *printer, prefix string, idWidth int) {
 	fmtExp := self.Exp.format(prefix + INDENT)
 	if self.Sweep {
 		fmtExp = fmt.Sprintf("sweep(%s)", strings.Trim(fmtExp, "[]"))
+	} else if self.Split {
+		fmtExp = "split " + fmtExp
 	}
-	printer.Printf("%s%s%s%s = %s,\n", prefix, INDENT,
+	printer.Printf("%s%s%s%s = %s,", prefix, INDENT,
 		self.Id, idPad, fmtExp)
+	printer.endLine(self.Node.Loc)
 }
 
 func (self *BindStms) format(printer *printer, prefix string) {
@@ -166,9 +206,19 @@ func (self *BindStms) format(printer *printer, prefix string) {
 //
 // Parameter
 //
+// The parameter id, followed by its default value if it has one.
+func paramIdString(param Param) string {
+	id := param.GetId()
+	if def := param.GetDefault(); def != nil {
+		id += " = " + def.format(INDENT)
+	}
+	return id
+}
+
 func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, idWidth int, helpWidth int) {
 	printer.printComments(param.getNode().Loc, INDENT)
-	id := param.GetId()
+	lineStart := printer.buf.Len()
+	id := paramIdString(param)
 	if id == "default" {
 		id = ""
 	}
@@ -204,7 +254,12 @@ func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, id
 		if id == "" {
 			printer.Printf("%s ", typePad)
 		}
-		printer.Printf("%s  \"%s\"", idPad, param.GetHelp())
+		printer.Printf("%s  ", idPad)
+		help := printer.formatHelp(param.GetHelp(), printer.buf.Len()-lineStart)
+		printer.WriteString(help)
+		if strings.Contains(help, NEWLINE) {
+			helpPad = ""
+		}
 	}
 
 	// Add outname string if it exists.
@@ -212,9 +267,52 @@ func paramFormat(printer *printer, param Param, modeWidth int, typeWidth int, id
 		if param.GetHelp() == "" {
 			printer.Printf("%s  ", idPad)
 		}
-		printer.Printf("%s  \"%s\"", helpPad, param.GetOutName())
+		printer.Printf("%s  %s", helpPad, quoteString(param.GetOutName()))
+	}
+	printer.WriteString(",")
+	printer.endLine(param.getNode().Loc)
+}
+
+// Quote a help string which starts at the given column.  If it would extend
+// past the printer's width, it is wrapped onto multiple lines, lined up after
+// the opening quote.  Help strings which were wrapped previously are always
+// rewrapped, so that reformatting is stable.  The line breaks become part
+// of the help string, so this is only done if a width was requested.
+func (self *printer) formatHelp(help string, col int) string {
+	quoted := quoteString(help)
+	if self.width <= 0 {
+		return quoted
+	}
+	// Leave room for the quotes and the trailing comma.
+	avail := self.width - col - 3
+	wrapped := strings.Contains(help, "\n ")
+	if !wrapped && (len(quoted) <= avail+2 || avail < minHelpWidth) {
+		return quoted
+	}
+	words := strings.Fields(help)
+	if avail < minHelpWidth {
+		return quoteString(strings.Join(words, " "))
+	}
+	var buf bytes.Buffer
+	buf.WriteRune('"')
+	indent := NEWLINE + strings.Repeat(" ", col+1)
+	lineLen := 0
+	for i, word := range words {
+		word = strings.Trim(quoteString(word), `"`)
+		if i > 0 {
+			if lineLen+1+len(word) > avail {
+				buf.WriteString(indent)
+				lineLen = 0
+			} else {
+				buf.WriteRune(' ')
+				lineLen++
+			}
+		}
+		buf.WriteString(word)
+		lineLen += len(word)
 	}
-	printer.WriteString(",\n")
+	buf.WriteRune('"')
+	return buf.String()
 }
 
 func (self *Params) getWidths() (int, int, int, int) {
@@ -225,8 +323,8 @@ func (self *Params) getWidths() (int, int, int, int) {
 	for _, param := range self.List {
 		modeWidth = max(modeWidth, len(param.getMode()))
 		typeWidth = max(typeWidth, len(param.GetTname())+2*param.GetArrayDim())
-		if len(param.GetId()) < 35 {
-			idWidth = max(idWidth, len(param.GetId()))
+		if id := paramIdString(param); len(id) < 35 {
+			idWidth = max(idWidth, len(id))
 		}
 		if len(param.GetHelp()) < 25 {
 			helpWidth = max(helpWidth, len(param.GetHelp()))
@@ -266,7 +364,8 @@ func (self *Pipeline) format(printer *printer) {
 		self.InParams, self.OutParams,
 	)
 
-	printer.Printf("pipeline %s(\n", self.Id)
+	printer.Printf("pipeline %s(", self.Id)
+	printer.endLine(self.Node.Loc)
 	self.InParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	self.OutParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	printer.WriteString(")\n{")
@@ -276,12 +375,17 @@ func (self *Pipeline) format(printer *printer) {
 	}
 	printer.WriteString(NEWLINE)
 	self.Ret.format(printer)
-	printer.WriteString("}\n")
+	printer.printComments(self.Node.EndLoc, INDENT)
+	printer.WriteString("}")
+	printer.endLine(self.Node.EndLoc)
 }
 
 func (self *CallStm) format(printer *printer, prefix string) {
 	printer.printComments(self.Node.Loc, prefix)
 	printer.WriteString(prefix)
+	if self.Modifiers.Mapped {
+		printer.WriteString("map ")
+	}
 	printer.WriteString("call ")
 	if self.Modifiers.Bindings == nil {
 		if self.Modifiers.Local {
@@ -299,10 +403,11 @@ func (self *CallStm) format(printer *printer, prefix string) {
 		printer.WriteString(" as ")
 		printer.WriteString(self.Id)
 	}
-	printer.WriteString("(\n")
+	printer.WriteString("(")
+	printer.endLine(self.Node.Loc)
 	self.Bindings.format(printer, prefix)
-	printer.WriteString(prefix)
 	if self.Modifiers.Bindings != nil && len(self.Modifiers.Bindings.List) > 0 {
+		printer.WriteString(prefix)
 		printer.WriteString(") using (\n")
 		// Convert unbound-form mods to bound form.
 		// Because we remove elements from the binding table if they're
@@ -346,18 +451,23 @@ func (self *CallStm) format(printer *printer, prefix string) {
 			return self.Modifiers.Bindings.List[i].Id < self.Modifiers.Bindings.List[j].Id
 		})
 		self.Modifiers.Bindings.format(printer, prefix)
-		printer.WriteString(prefix)
 	}
-	printer.WriteString(")\n")
+	printer.printComments(self.Node.EndLoc, prefix+INDENT)
+	printer.WriteString(prefix)
+	printer.WriteString(")")
+	printer.endLine(self.Node.EndLoc)
 }
 
 func (self *ReturnStm) format(printer *printer) {
 	printer.printComments(self.Node.Loc, INDENT)
 	printer.WriteString(INDENT)
-	printer.WriteString("return (\n")
+	printer.WriteString("return (")
+	printer.endLine(self.Node.Loc)
 	self.Bindings.format(printer, INDENT)
+	printer.printComments(self.Node.EndLoc, INDENT+INDENT)
 	printer.WriteString(INDENT)
-	printer.WriteString(")\n")
+	printer.WriteString(")")
+	printer.endLine(self.Node.EndLoc)
 }
 
 //
@@ -371,7 +481,8 @@ func (self *Stage) format(printer *printer) {
 	)
 	modeWidth = max(modeWidth, len("src"))
 
-	printer.Printf("stage %s(\n", self.Id)
+	printer.Printf("stage %s(", self.Id)
+	printer.endLine(self.Node.Loc)
 	self.InParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	self.OutParams.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
 	self.Src.format(printer, modeWidth, typeWidth, idWidth)
@@ -387,44 +498,108 @@ func (self *Stage) format(printer *printer) {
 	if self.Resources != nil {
 		self.Resources.format(printer)
 	}
-	printer.WriteString(")\n")
+	if self.Retain != nil {
+		self.Retain.format(printer)
+	}
+	printer.printComments(self.Node.EndLoc, INDENT)
+	printer.WriteString(")")
+	printer.endLine(self.Node.EndLoc)
 }
 
-func (self *Resources) format(printer *printer) {
+func (self *RetainParams) format(printer *printer) {
 	printer.printComments(self.Node.Loc, INDENT)
-	printer.WriteString(") using (\n")
-	// Pad depending on which arguments are present.
-	// mem_gb  = x,
-	// special = y
-	// threads = y,
-	var memPad string
-	if self.SpecialNode != nil || self.ThreadNode != nil {
-		memPad = " "
+	printer.WriteString(") retain (")
+	printer.endLine(self.Node.Loc)
+	for _, param := range self.Params {
+		printer.printComments(param.Node.Loc, INDENT)
+		printer.WriteString(INDENT)
+		printer.WriteString(param.Id)
+		printer.WriteString(",")
+		printer.endLine(param.Node.Loc)
 	}
+}
+
+func (self *Resources) format(printer *printer) {
+	printer.printComments(self.Node.Loc, INDENT)
+	printer.WriteString(") using (")
+	printer.endLine(self.Node.Loc)
+	type resource struct {
+		node  *AstNode
+		key   string
+		value string
+	}
+	var resources []resource
 	if self.MemNode != nil {
-		printer.printComments(self.MemNode.Loc, INDENT)
-		printer.WriteString(INDENT)
-		printer.Printf("mem_gb%s = %d,\n", memPad, self.MemGB)
+		if self.MemExp != nil {
+			resources = append(resources, resource{
+				self.MemNode, "mem_gb", formatResourceExp(self.MemExp)})
+		} else {
+			resources = append(resources, resource{
+				self.MemNode, "mem_gb", strconv.Itoa(self.MemGB)})
+		}
 	}
 	if self.SpecialNode != nil {
-		printer.printComments(self.SpecialNode.Loc, INDENT)
-		printer.WriteString(INDENT)
-		printer.Printf("special = \"%s\",\n", self.Special)
+		resources = append(resources, resource{
+			self.SpecialNode, "special", quoteString(self.Special)})
 	}
 	if self.ThreadNode != nil {
-		printer.printComments(self.ThreadNode.Loc, INDENT)
+		if self.ThreadExp != nil {
+			resources = append(resources, resource{
+				self.ThreadNode, "threads", formatResourceExp(self.ThreadExp)})
+		} else {
+			resources = append(resources, resource{
+				self.ThreadNode, "threads", strconv.Itoa(self.Threads)})
+		}
+	}
+	if self.TimeoutNode != nil {
+		resources = append(resources, resource{
+			self.TimeoutNode, "timeout", strconv.Itoa(self.Timeout)})
+	}
+	if self.RetriesNode != nil {
+		resources = append(resources, resource{
+			self.RetriesNode, "retries", strconv.Itoa(self.Retries)})
+	}
+	if self.BackoffNode != nil {
+		resources = append(resources, resource{
+			self.BackoffNode, "retry_backoff", strconv.Itoa(self.Backoff)})
+	}
+	if self.RetryOnNode != nil {
+		resources = append(resources, resource{
+			self.RetryOnNode, "retry_on", quoteString(self.RetryOn)})
+	}
+	// Pad the keys so that the values line up.
+	keyWidth := 0
+	for _, res := range resources {
+		if len(res.key) > keyWidth {
+			keyWidth = len(res.key)
+		}
+	}
+	for _, res := range resources {
+		printer.printComments(res.node.Loc, INDENT)
 		printer.WriteString(INDENT)
-		printer.Printf("threads = %d,\n", self.Threads)
+		printer.Printf("%s%s = %s,", res.key,
+			strings.Repeat(" ", keyWidth-len(res.key)), res.value)
+		printer.endLine(res.node.Loc)
+	}
+}
+
+// Format a resource expression.  A lone number is parenthesized, since
+// otherwise it must be a constant integer.
+func formatResourceExp(exp ResourceExp) string {
+	if _, ok := exp.(*ResourceNum); ok {
+		return "(" + exp.format() + ")"
 	}
+	return exp.format()
 }
 
 func (self *SrcParam) format(printer *printer, modeWidth int, typeWidth int, idWidth int) {
 	printer.printComments(self.Node.Loc, INDENT)
 	langPad := strings.Repeat(" ", typeWidth-len(string(self.Lang)))
 	modePad := strings.Repeat(" ", modeWidth-len("src"))
-	printer.Printf("%ssrc%s %v%s \"%s\",\n", INDENT,
+	printer.Printf("%ssrc%s %v%s %s,", INDENT,
 		modePad, self.Lang, langPad,
-		strings.Join(append([]string{self.Path}, self.Args...), " "))
+		quoteString(strings.Join(append([]string{self.Path}, self.Args...), " ")))
+	printer.endLine(self.Node.Loc)
 }
 
 //
@@ -442,93 +617,116 @@ func (self *Callables) format(printer *printer) {
 //
 func (self *UserType) format(printer *printer) {
 	printer.printComments(self.Node.Loc, "")
-	printer.Printf("filetype %s;\n", self.Id)
+	printer.Printf("filetype %s;", self.Id)
+	printer.endLine(self.Node.Loc)
+}
+
+//
+// Struct
+//
+func (self *StructType) format(printer *printer) {
+	printer.printComments(self.Node.Loc, "")
+
+	modeWidth, typeWidth, idWidth, helpWidth := measureParamsWidths(
+		self.Members,
+	)
+
+	printer.Printf("struct %s(", self.Id)
+	printer.endLine(self.Node.Loc)
+	self.Members.format(printer, modeWidth, typeWidth, idWidth, helpWidth)
+	printer.printComments(self.Node.EndLoc, INDENT)
+	printer.WriteString(")")
+	printer.endLine(self.Node.EndLoc)
 }
 
 //
 // AST
 //
-func (self *Ast) format() string {
-	printer := printer{comments: self.comments}
+func (self *Ast) format(width int) string {
+	printer := printer{comments: self.comments, width: width}
 	for _, directive := range self.preprocess {
 		printer.printComments(directive.Node.Loc, "")
 		printer.WriteString(directive.Value)
-		printer.WriteString(NEWLINE)
+		printer.endLine(directive.Node.Loc)
 	}
 	if len(self.preprocess) > 0 && len(self.UserTypes) > 0 {
 		printer.WriteString(NEWLINE)
 	}
+	self.formatDecs(&printer)
+	printer.DumpComments()
+	return printer.String()
+}
+
+// The first line of the source generated by flatten, which marks it as
+// allowed to declare qualified names.
+const flattenedHeader = "# Generated from @imported files. DO NOT EDIT."
+
+// Format the declarations and call, without comments or preprocessor
+// directives.  For an AST with @imports applied, this is a single source
+// with the qualified names of the imported declarations.
+func (self *Ast) flatten() string {
+	var printer printer
+	printer.WriteString(flattenedHeader)
+	printer.WriteString(NEWLINE)
+	self.formatDecs(&printer)
+	return printer.String()
+}
 
+func (self *Ast) formatDecs(printer *printer) {
 	// filetype declarations.
 	for _, filetype := range self.UserTypes {
-		filetype.format(&printer)
+		filetype.format(printer)
+	}
+
+	// struct declarations.
+	for _, structType := range self.StructTypes {
+		printer.WriteString(NEWLINE)
+		structType.format(printer)
 	}
 
 	// callables.
-	self.Callables.format(&printer)
+	self.Callables.format(printer)
 
 	// call.
 	if self.Call != nil {
 		if len(self.Callables.List) > 0 {
 			printer.WriteString(NEWLINE)
 		}
-		self.Call.format(&printer, "")
+		self.Call.format(printer, "")
 	}
-
-	printer.DumpComments()
-	return printer.String()
 }
 
 //
 // Exported API
 //
 func FormatFile(filename string) (string, error) {
+	return FormatFileWidth(filename, DefaultFormatWidth)
+}
+
+// Format an MRO file, wrapping help strings which would extend past the
+// given line width.  If width is 0, help strings are not wrapped.
+func FormatFileWidth(filename string, width int) (string, error) {
 	// Read MRO source file.
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return "", err
 	}
-	return Format(string(data), filename)
+	return FormatWidth(string(data), filename, width)
 }
 
 func Format(src, filename string) (string, error) {
+	return FormatWidth(src, filename, DefaultFormatWidth)
+}
+
+// Format MRO source, wrapping help strings which would extend past the
+// given line width.  If width is 0, help strings are not wrapped.
+func FormatWidth(src, filename string, width int) (string, error) {
 	// Parse and generate the AST.
 	global, mmli := yaccParse(src, []FileLoc{})
 	if mmli != nil { // mmli is an mmLexInfo struct
-		return "", &ParseError{mmli.token, filename, mmli.loc, nil}
+		return "", mmli.errorList(filename).If()
 	}
 
 	// Format the source.
-	return global.format(), nil
-}
-
-func JsonDumpAsts(asts []*Ast) string {
-	type JsonDump struct {
-		UserTypes map[string]*UserType
-		Stages    map[string]*Stage
-		Pipelines map[string]*Pipeline
-	}
-
-	jd := JsonDump{
-		UserTypes: map[string]*UserType{},
-		Stages:    map[string]*Stage{},
-		Pipelines: map[string]*Pipeline{},
-	}
-
-	for _, ast := range asts {
-		for _, t := range ast.UserTypes {
-			jd.UserTypes[t.Id] = t
-		}
-		for _, stage := range ast.Stages {
-			jd.Stages[stage.Id] = stage
-		}
-		for _, pipeline := range ast.Pipelines {
-			jd.Pipelines[pipeline.Id] = pipeline
-		}
-	}
-	if jsonBytes, err := json.MarshalIndent(jd, "", "    "); err == nil {
-		return string(jsonBytes)
-	} else {
-		return fmt.Sprintf("{ error: \"%s\" }", err.Error())
-	}
+	return global.format(width), nil
 }
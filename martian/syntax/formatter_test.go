@@ -8,13 +8,14 @@ package syntax
 
 import (
 	"github.com/stretchr/testify/assert"
+	"reflect"
 	"strings"
 	"testing"
 )
 
 func TestFormatValueExpression(t *testing.T) {
 	ve := ValExp{
-		Node:  AstNode{0, "", nil, nil},
+		Node:  AstNode{},
 		Kind:  "float",
 		Value: 0,
 	}
@@ -65,7 +66,10 @@ func TestFormatValueExpression(t *testing.T) {
 	assert.Equal(t, ve.format(""), "\"blah\"", "Double quote a string.")
 
 	ve.Value = "\"blah\""
-	assert.Equal(t, ve.format(""), "\"\"blah\"\"", "Double quote a double-quoted string.")
+	assert.Equal(t, ve.format(""), `"\"blah\""`, "Escape quotes in a double-quoted string.")
+
+	ve.Value = "tab\tnew\nline"
+	assert.Equal(t, ve.format(""), `"tab\tnew\nline"`, "Escape control characters.")
 
 	//
 	// Format nil ValExps.
@@ -324,3 +328,410 @@ func diffLines(src, formatted string, t *testing.T) {
 		}
 	}
 }
+
+func TestFormatStruct(t *testing.T) {
+	src := `filetype bam;
+
+# A group of reads.
+struct READ_GROUP(
+    in string sample,
+    in int    lane,
+    # The reads.
+    in bam[]  reads   "Aligned reads",
+)
+
+stage ALIGN(
+    in  READ_GROUP[] groups,
+    out READ_GROUP   merged,
+    src py           "stages/align",
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatTypedMap(t *testing.T) {
+	src := `filetype bam;
+
+stage COUNT(
+    in  map<bam>        reads,
+    in  map<int[]>[]    lanes,
+    out map<map<float>> nested,
+    src py              "stages/count",
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatMapCall(t *testing.T) {
+	src := `filetype bam;
+
+stage ALIGN(
+    in  string sample,
+    in  string reference,
+    out bam    aligned,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    in  string   reference,
+    out bam[]    aligned,
+)
+{
+    map call ALIGN(
+        sample    = split self.samples,
+        reference = self.reference,
+    )
+
+    return (
+        aligned = ALIGN.aligned,
+    )
+}
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatDisableOr(t *testing.T) {
+	src := `filetype bam;
+
+stage CHECK(
+    in  bam  reads,
+    out bool no_data,
+    src py   "stages/check",
+)
+
+pipeline CHECK_ALL(
+    in  bam  reads,
+    in  bool skip,
+    out bool no_data,
+)
+{
+    call CHECK(
+        reads = self.reads,
+    )
+
+    call CHECK as CHECK_AGAIN(
+        reads = self.reads,
+    ) using (
+        disabled = self.skip or CHECK.no_data,
+    )
+
+    return (
+        no_data = CHECK_AGAIN.no_data,
+    )
+}
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatDefaultValue(t *testing.T) {
+	src := `filetype bam;
+
+stage ALIGN(
+    in  bam      reads,
+    in  int      threads = 4     "aligner threads",
+    in  string[] flags = ["-a"],
+    out bam      aligned,
+    src py       "stages/align",
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatStringEscapes(t *testing.T) {
+	src := `filetype txt;
+
+stage ECHO(
+    in  string message  "the \"message\" to echo",
+    out string echoed,
+    src py     "stages/echo",
+)
+
+call ECHO(
+    message = "tab\there\ncafé <\\>",
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatImport(t *testing.T) {
+	src := `@import "sort.mro" as sort
+@import "align.mro" (ALIGN, ALIGNED)
+
+pipeline ALIGN_AND_SORT(
+    in  string  sample,
+    out ALIGNED aligned,
+)
+{
+    call ALIGN(
+        sample = self.sample,
+    )
+
+    call sort.SORT_BAM as SORT(
+        input = ALIGN.aligned,
+    )
+
+    return (
+        aligned = SORT.sorted,
+    )
+}
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatRetain(t *testing.T) {
+	src := `filetype json;
+
+stage QC(
+    in  json reads,
+    out json summary,
+    src py   "stages/qc",
+) split using (
+    in  int  index,
+) using (
+    threads = 2,
+) retain (
+    # QC results are small.
+    summary,
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatResourceExpression(t *testing.T) {
+	src := `filetype bam;
+
+stage SORT(
+    in  bam[] reads,
+    in  int   n,
+    out bam   sorted,
+    src py    "stages/sort",
+) using (
+    mem_gb  = (size(self.reads) + 1) * 2 - (self.n - 1),
+    threads = max(self.n / (2 * self.n), 1),
+    timeout = 7200,
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatRetryPolicy(t *testing.T) {
+	src := `filetype bam;
+
+stage SORT(
+    in  bam reads,
+    src py  "stages/sort",
+) using (
+    mem_gb        = 4,
+    retries       = 2,
+    # Doubles with each attempt.
+    retry_backoff = 30,
+    retry_on      = "^IOError: ",
+)
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatCallRetryPolicy(t *testing.T) {
+	src := `filetype bam;
+
+stage SORT(
+    in  bam reads,
+    out bam sorted,
+    src py  "stages/sort",
+)
+
+pipeline SORT_ALL(
+    in  bam reads,
+    out bam sorted,
+)
+{
+    call SORT(
+        reads = self.reads,
+    ) using (
+        retries       = 2,
+        retry_backoff = 30,
+        retry_on      = "^IOError: ",
+    )
+
+    return (
+        sorted = SORT.sorted,
+    )
+}
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatTrailingComments(t *testing.T) {
+	src := `@include "lib.mro" # Declares BAM.
+
+filetype json; # Summaries.
+
+struct PAIR( # Two reads.
+    in bam first,
+    in bam second,
+) # End of PAIR.
+
+stage SORT( # Sorts reads.
+    in  bam  reads    "The reads", # Unsorted.
+    in  int  threads, # How many.
+    out bam  sorted,
+    out json summary,
+    # The source.
+    src py   "stages/sort", # Python.
+) using (
+    mem_gb  = 4, # Per thread.
+    threads = 2,
+) retain (
+    summary, # Small.
+) # End of SORT.
+
+pipeline PIPE(
+    in  bam reads,
+    out bam sorted,
+)
+{
+    call SORT( # The only call.
+        reads   = self.reads, # From the caller.
+        # A literal.
+        threads = 2,
+        # Before the closing paren.
+    ) # End of the call.
+
+    call SORT as SORT2(
+        reads   = SORT.sorted,
+        threads = 1,
+    ) using (
+        volatile = true,
+    ) # End of the call with modifiers.
+
+    return (
+        sorted = SORT2.sorted, # Passed through.
+    ) # End of the return.
+    # Before the closing brace.
+} # End of PIPE.
+`
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatWrapHelp(t *testing.T) {
+	src := `filetype bam;
+
+stage SORT(
+    in  bam reads   "The reads to sort, which may be aligned or unaligned, in any order.", # Comment.
+    out bam sorted  "The sorted reads",
+    src py  "stages/sort",
+)
+`
+	expect := `filetype bam;
+
+stage SORT(
+    in  bam reads   "The reads to sort, which may be aligned or
+                     unaligned, in any order.", # Comment.
+    out bam sorted  "The sorted reads",
+    src py  "stages/sort",
+)
+`
+	if formatted, err := FormatWidth(src, "test", 75); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expect {
+		diffLines(expect, formatted, t)
+	}
+	// Wrapped help strings are stable.
+	if formatted, err := FormatWidth(expect, "test", 75); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != expect {
+		diffLines(expect, formatted, t)
+	}
+	// By default, the help string is not wrapped.
+	if formatted, err := Format(src, "test"); err != nil {
+		t.Errorf("Format error: %v", err)
+	} else if formatted != src {
+		diffLines(src, formatted, t)
+	}
+}
+
+func TestFormatKeepsHelp(t *testing.T) {
+	src := `filetype bam;
+
+stage SORT(
+    in  bam reads "The reads to sort, which may be aligned or unaligned, in any order, and which may be very long.",
+    in  int count "A help string which
+                   was wrapped by hand.",
+    out bam sorted "The sorted reads, in the order given by the sort key, which extends past the line width",
+    src py  "stages/sort",
+)
+`
+	formatted, err := Format(src, "test")
+	if err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	helps := func(src string) []string {
+		t.Helper()
+		ast, err := yaccParse(src, nil)
+		if err != nil {
+			t.Fatalf("%v in\n%s", err.errorList("test"), src)
+		}
+		var result []string
+		for _, stage := range ast.Stages {
+			for _, param := range stage.InParams.List {
+				result = append(result, param.GetHelp())
+			}
+			for _, param := range stage.OutParams.List {
+				result = append(result, param.GetHelp())
+			}
+		}
+		return result
+	}
+	if before, after := helps(src), helps(formatted); !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected help strings\n%q\ngot\n%q", before, after)
+	}
+}
@@ -16,17 +16,13 @@ import (
 	"strings"
 )
 
-func unquote(qs string) string {
-	return strings.Replace(qs, "\"", "", -1)
-}
-
-//line src/martian/syntax/grammar.y:20
+//line src/martian/syntax/grammar.y:16
 type mmSymType struct {
 	yys       int
 	global    *Ast
 	locmap    []FileLoc
 	arr       int
-	loc       int
+	loc       tokenLoc
 	val       string
 	modifiers *Modifiers
 	dec       Dec
@@ -35,6 +31,9 @@ type mmSymType struct {
 	outparam  *OutParam
 	params    *Params
 	res       *Resources
+	retains   *RetainParams
+	resexp    ResourceExp
+	resexps   []ResourceExp
 	par_tuple paramsTuple
 	src       *SrcParam
 	exp       Exp
@@ -61,47 +60,60 @@ const LPAREN = 57355
 const RPAREN = 57356
 const LBRACE = 57357
 const RBRACE = 57358
-const SWEEP = 57359
-const RETURN = 57360
-const SELF = 57361
-const FILETYPE = 57362
-const STAGE = 57363
-const PIPELINE = 57364
-const CALL = 57365
-const SPLIT = 57366
-const USING = 57367
-const LOCAL = 57368
-const PREFLIGHT = 57369
-const VOLATILE = 57370
-const DISABLED = 57371
-const IN = 57372
-const OUT = 57373
-const SRC = 57374
-const AS = 57375
-const THREADS = 57376
-const MEM_GB = 57377
-const SPECIAL = 57378
-const ID = 57379
-const LITSTRING = 57380
-const NUM_FLOAT = 57381
-const NUM_INT = 57382
-const DOT = 57383
-const PY = 57384
-const GO = 57385
-const SH = 57386
-const EXEC = 57387
-const COMPILED = 57388
-const MAP = 57389
-const INT = 57390
-const STRING = 57391
-const FLOAT = 57392
-const PATH = 57393
-const BOOL = 57394
-const TRUE = 57395
-const FALSE = 57396
-const NULL = 57397
-const DEFAULT = 57398
-const PREPROCESS_DIRECTIVE = 57399
+const LANGLE = 57359
+const RANGLE = 57360
+const SWEEP = 57361
+const RETURN = 57362
+const SELF = 57363
+const FILETYPE = 57364
+const STRUCT = 57365
+const STAGE = 57366
+const PIPELINE = 57367
+const CALL = 57368
+const SPLIT = 57369
+const USING = 57370
+const LOCAL = 57371
+const PREFLIGHT = 57372
+const VOLATILE = 57373
+const DISABLED = 57374
+const OR = 57375
+const IN = 57376
+const OUT = 57377
+const SRC = 57378
+const AS = 57379
+const THREADS = 57380
+const MEM_GB = 57381
+const SPECIAL = 57382
+const TIMEOUT = 57383
+const RETRIES = 57384
+const RETRY_BACKOFF = 57385
+const RETRY_ON = 57386
+const RETAIN = 57387
+const ID = 57388
+const LITSTRING = 57389
+const NUM_FLOAT = 57390
+const NUM_INT = 57391
+const DOT = 57392
+const PY = 57393
+const GO = 57394
+const SH = 57395
+const EXEC = 57396
+const COMPILED = 57397
+const MAP = 57398
+const INT = 57399
+const STRING = 57400
+const FLOAT = 57401
+const PATH = 57402
+const BOOL = 57403
+const TRUE = 57404
+const FALSE = 57405
+const NULL = 57406
+const DEFAULT = 57407
+const PREPROCESS_DIRECTIVE = 57408
+const PLUS = 57409
+const MINUS = 57410
+const STAR = 57411
+const SLASH = 57412
 
 var mmToknames = [...]string{
 	"$end",
@@ -120,10 +132,13 @@ var mmToknames = [...]string{
 	"RPAREN",
 	"LBRACE",
 	"RBRACE",
+	"LANGLE",
+	"RANGLE",
 	"SWEEP",
 	"RETURN",
 	"SELF",
 	"FILETYPE",
+	"STRUCT",
 	"STAGE",
 	"PIPELINE",
 	"CALL",
@@ -133,6 +148,7 @@ var mmToknames = [...]string{
 	"PREFLIGHT",
 	"VOLATILE",
 	"DISABLED",
+	"OR",
 	"IN",
 	"OUT",
 	"SRC",
@@ -140,6 +156,11 @@ var mmToknames = [...]string{
 	"THREADS",
 	"MEM_GB",
 	"SPECIAL",
+	"TIMEOUT",
+	"RETRIES",
+	"RETRY_BACKOFF",
+	"RETRY_ON",
+	"RETAIN",
 	"ID",
 	"LITSTRING",
 	"NUM_FLOAT",
@@ -161,214 +182,338 @@ var mmToknames = [...]string{
 	"NULL",
 	"DEFAULT",
 	"PREPROCESS_DIRECTIVE",
+	"PLUS",
+	"MINUS",
+	"STAR",
+	"SLASH",
 }
+
 var mmStatenames = [...]string{}
 
 const mmEofCode = 1
 const mmErrCode = 2
 const mmInitialStackSize = 16
 
-//line src/martian/syntax/grammar.y:454
+//line src/martian/syntax/grammar.y:673
 
 //line yacctab:1
-var mmExca = [...]int{
+var mmExca = [...]int16{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 39,
-	13, 101,
-	33, 101,
-	-2, 60,
-	-1, 40,
-	13, 102,
-	33, 102,
-	-2, 61,
-	-1, 41,
-	13, 103,
-	33, 103,
-	-2, 62,
+	-1, 3,
+	1, 4,
+	-2, 0,
+	-1, 15,
+	1, 1,
+	-2, 0,
+	-1, 55,
+	13, 150,
+	37, 150,
+	50, 150,
+	-2, 96,
+	-1, 56,
+	13, 151,
+	37, 151,
+	50, 151,
+	-2, 97,
+	-1, 57,
+	13, 152,
+	37, 152,
+	50, 152,
+	-2, 98,
 }
 
 const mmPrivate = 57344
 
-const mmLast = 515
-
-var mmAct = [...]int{
-
-	91, 60, 135, 163, 58, 143, 50, 133, 97, 20,
-	4, 34, 35, 13, 15, 75, 118, 112, 108, 38,
-	86, 87, 42, 36, 8, 11, 10, 7, 8, 11,
-	10, 7, 100, 107, 43, 101, 102, 203, 202, 204,
-	180, 128, 176, 165, 49, 162, 190, 62, 148, 59,
-	47, 136, 51, 63, 74, 84, 43, 160, 17, 70,
-	95, 14, 127, 20, 175, 5, 191, 192, 193, 164,
-	48, 201, 145, 138, 164, 20, 94, 145, 150, 52,
-	195, 85, 88, 89, 72, 90, 7, 152, 74, 98,
-	96, 54, 55, 56, 57, 70, 109, 74, 125, 151,
-	142, 74, 124, 157, 146, 123, 122, 141, 129, 130,
-	158, 31, 7, 169, 168, 32, 33, 26, 27, 28,
-	25, 161, 132, 71, 144, 22, 23, 24, 21, 145,
-	171, 147, 140, 188, 200, 172, 29, 30, 6, 31,
-	154, 45, 16, 32, 33, 26, 27, 28, 25, 155,
-	166, 16, 156, 22, 23, 24, 21, 44, 173, 170,
-	37, 199, 177, 198, 29, 30, 178, 93, 67, 66,
-	181, 65, 184, 64, 173, 207, 183, 206, 113, 70,
-	205, 185, 114, 196, 189, 194, 92, 31, 186, 179,
-	197, 32, 33, 26, 27, 28, 25, 8, 11, 10,
-	7, 22, 23, 24, 21, 117, 115, 116, 1, 167,
-	113, 174, 29, 30, 114, 153, 131, 106, 92, 31,
-	86, 87, 119, 32, 33, 26, 27, 28, 25, 105,
-	104, 103, 82, 22, 23, 24, 21, 117, 115, 116,
-	187, 19, 113, 134, 29, 30, 114, 159, 182, 149,
-	92, 31, 86, 87, 119, 32, 33, 26, 27, 28,
-	25, 3, 139, 46, 12, 22, 23, 24, 21, 117,
-	115, 116, 53, 69, 113, 121, 29, 30, 114, 137,
-	110, 111, 92, 31, 86, 87, 119, 32, 33, 26,
-	27, 28, 25, 83, 126, 73, 61, 22, 23, 24,
-	21, 117, 115, 116, 9, 18, 113, 99, 29, 30,
-	114, 2, 0, 0, 92, 31, 86, 87, 119, 32,
-	33, 26, 27, 28, 25, 0, 0, 0, 0, 22,
-	23, 24, 21, 117, 115, 116, 0, 0, 31, 0,
-	29, 30, 32, 33, 26, 27, 28, 25, 86, 87,
-	119, 0, 22, 23, 24, 21, 0, 0, 0, 0,
-	0, 0, 124, 29, 30, 81, 76, 77, 79, 78,
-	80, 31, 0, 0, 0, 32, 33, 26, 27, 28,
-	25, 0, 0, 0, 0, 22, 23, 24, 21, 120,
-	0, 0, 0, 0, 0, 31, 29, 30, 0, 32,
-	33, 26, 27, 28, 25, 0, 0, 0, 0, 22,
-	23, 24, 21, 0, 0, 0, 0, 92, 31, 0,
-	29, 30, 32, 33, 26, 27, 28, 25, 0, 0,
-	0, 0, 22, 23, 24, 21, 68, 0, 0, 0,
-	0, 0, 31, 29, 30, 0, 32, 33, 26, 27,
-	28, 25, 0, 0, 0, 0, 22, 23, 24, 21,
-	0, 0, 0, 0, 0, 31, 0, 29, 30, 32,
-	33, 26, 27, 28, 25, 0, 0, 0, 0, 22,
-	23, 24, 21, 0, 0, 0, 0, 0, 31, 0,
-	29, 30, 32, 33, 39, 40, 41, 25, 0, 0,
-	0, 0, 22, 23, 24, 21, 0, 0, 0, 0,
-	0, 0, 0, 29, 30,
+const mmLast = 1135
+
+var mmAct = [...]int16{
+	125, 88, 304, 189, 227, 81, 69, 195, 159, 285,
+	24, 24, 187, 24, 135, 24, 4, 160, 104, 16,
+	18, 166, 24, 319, 306, 272, 299, 300, 301, 302,
+	301, 302, 52, 41, 42, 119, 120, 63, 43, 44,
+	36, 37, 38, 34, 35, 152, 151, 175, 59, 26,
+	27, 28, 29, 30, 31, 32, 33, 25, 60, 24,
+	87, 68, 295, 202, 294, 39, 40, 82, 83, 70,
+	71, 7, 62, 89, 60, 13, 299, 300, 301, 302,
+	143, 203, 100, 144, 145, 103, 293, 7, 24, 102,
+	296, 60, 84, 128, 247, 9, 10, 14, 12, 7,
+	127, 8, 20, 100, 292, 60, 209, 132, 232, 60,
+	61, 124, 118, 121, 122, 112, 24, 8, 241, 196,
+	197, 13, 65, 180, 244, 23, 45, 161, 46, 8,
+	51, 162, 228, 100, 139, 156, 171, 54, 24, 17,
+	169, 9, 10, 14, 12, 7, 66, 60, 229, 240,
+	226, 190, 182, 183, 176, 174, 172, 198, 129, 60,
+	281, 185, 198, 165, 163, 164, 115, 117, 181, 179,
+	100, 13, 137, 22, 67, 8, 269, 207, 119, 120,
+	167, 115, 192, 149, 206, 5, 198, 199, 228, 113,
+	201, 9, 10, 14, 12, 7, 85, 115, 211, 214,
+	223, 21, 170, 324, 217, 138, 221, 150, 323, 222,
+	115, 218, 236, 210, 224, 230, 87, 237, 235, 238,
+	204, 141, 307, 242, 58, 8, 194, 72, 249, 243,
+	234, 245, 233, 225, 186, 248, 215, 252, 260, 216,
+	238, 251, 74, 75, 76, 77, 100, 134, 101, 53,
+	280, 279, 278, 268, 277, 78, 79, 80, 276, 271,
+	273, 275, 261, 262, 263, 264, 265, 266, 267, 13,
+	274, 131, 96, 95, 47, 288, 288, 284, 291, 94,
+	93, 49, 92, 48, 91, 90, 314, 288, 313, 9,
+	10, 14, 12, 312, 311, 310, 303, 309, 308, 298,
+	288, 288, 288, 288, 297, 282, 270, 320, 288, 315,
+	316, 317, 318, 258, 256, 254, 246, 322, 220, 161,
+	213, 212, 253, 162, 184, 288, 177, 155, 6, 126,
+	41, 42, 19, 154, 325, 43, 44, 36, 37, 38,
+	34, 35, 50, 153, 19, 148, 26, 27, 28, 29,
+	30, 31, 32, 33, 25, 165, 163, 164, 147, 146,
+	136, 130, 39, 40, 161, 239, 255, 219, 162, 1,
+	119, 120, 167, 321, 126, 41, 42, 259, 231, 250,
+	43, 44, 36, 37, 38, 34, 35, 3, 208, 200,
+	15, 26, 27, 28, 29, 30, 31, 32, 33, 25,
+	165, 163, 164, 64, 73, 98, 173, 39, 40, 161,
+	188, 191, 123, 162, 116, 119, 120, 167, 178, 126,
+	41, 42, 114, 86, 11, 43, 44, 36, 37, 38,
+	34, 35, 142, 2, 0, 0, 26, 27, 28, 29,
+	30, 31, 32, 33, 25, 165, 163, 164, 0, 0,
+	0, 0, 39, 40, 0, 161, 0, 0, 0, 162,
+	119, 120, 167, 158, 0, 126, 41, 42, 0, 0,
+	0, 157, 44, 36, 37, 38, 34, 35, 0, 0,
+	0, 0, 26, 27, 28, 29, 30, 31, 32, 33,
+	25, 165, 163, 164, 0, 0, 0, 0, 39, 40,
+	161, 0, 0, 0, 162, 0, 119, 120, 167, 0,
+	126, 41, 42, 0, 0, 0, 43, 44, 36, 37,
+	38, 34, 35, 0, 0, 0, 0, 26, 27, 28,
+	29, 30, 31, 32, 33, 25, 165, 163, 164, 140,
+	0, 0, 0, 39, 40, 0, 0, 0, 0, 0,
+	0, 119, 120, 167, 0, 0, 0, 0, 0, 41,
+	42, 0, 0, 0, 43, 44, 36, 37, 38, 34,
+	35, 0, 0, 0, 0, 26, 27, 28, 29, 30,
+	31, 32, 33, 25, 105, 0, 0, 0, 0, 0,
+	0, 39, 40, 111, 106, 107, 109, 108, 110, 0,
+	0, 0, 0, 0, 41, 42, 0, 0, 0, 43,
+	44, 36, 37, 38, 34, 35, 0, 0, 0, 0,
+	26, 27, 28, 29, 30, 31, 32, 33, 25, 0,
+	0, 0, 0, 0, 0, 0, 39, 40, 111, 106,
+	107, 109, 108, 110, 41, 42, 0, 0, 0, 43,
+	44, 36, 37, 38, 34, 35, 0, 0, 0, 0,
+	26, 27, 28, 29, 30, 31, 32, 33, 25, 0,
+	0, 0, 0, 0, 0, 0, 39, 40, 111, 106,
+	107, 109, 108, 110, 286, 0, 0, 0, 0, 0,
+	0, 0, 287, 41, 42, 0, 0, 0, 43, 44,
+	36, 37, 38, 34, 35, 0, 0, 0, 0, 26,
+	27, 28, 29, 30, 31, 32, 33, 25, 0, 289,
+	305, 286, 0, 0, 0, 39, 40, 0, 0, 287,
+	41, 42, 0, 0, 0, 43, 44, 36, 37, 38,
+	34, 35, 0, 0, 0, 0, 26, 27, 28, 29,
+	30, 31, 32, 33, 25, 0, 289, 290, 286, 0,
+	0, 0, 39, 40, 0, 0, 287, 41, 42, 0,
+	0, 0, 43, 44, 36, 37, 38, 34, 35, 0,
+	0, 0, 0, 26, 27, 28, 29, 30, 31, 32,
+	33, 25, 0, 289, 283, 205, 0, 170, 0, 39,
+	40, 0, 0, 0, 0, 0, 0, 0, 41, 42,
+	0, 0, 0, 43, 44, 36, 37, 38, 34, 35,
+	0, 0, 99, 0, 26, 27, 28, 29, 30, 31,
+	32, 33, 25, 198, 257, 0, 0, 0, 0, 0,
+	39, 40, 41, 42, 0, 0, 0, 43, 44, 36,
+	37, 38, 34, 35, 0, 0, 99, 0, 26, 27,
+	28, 29, 30, 31, 32, 33, 25, 0, 193, 0,
+	0, 0, 0, 0, 39, 40, 41, 42, 0, 0,
+	0, 43, 44, 36, 37, 38, 34, 35, 0, 0,
+	99, 0, 26, 27, 28, 29, 30, 31, 32, 33,
+	25, 0, 168, 0, 0, 0, 0, 0, 39, 40,
+	41, 42, 0, 0, 0, 43, 44, 36, 37, 38,
+	34, 35, 0, 0, 99, 0, 26, 27, 28, 29,
+	30, 31, 32, 33, 25, 0, 133, 0, 0, 0,
+	0, 0, 39, 40, 41, 42, 0, 0, 0, 43,
+	44, 36, 37, 38, 34, 35, 0, 0, 99, 0,
+	26, 27, 28, 29, 30, 31, 32, 33, 25, 0,
+	97, 0, 0, 0, 0, 0, 39, 40, 41, 42,
+	0, 0, 0, 43, 44, 36, 37, 38, 34, 35,
+	0, 0, 0, 0, 26, 27, 28, 29, 30, 31,
+	32, 33, 25, 0, 0, 0, 126, 41, 42, 0,
+	39, 40, 43, 44, 36, 37, 38, 34, 35, 0,
+	0, 0, 0, 26, 27, 28, 29, 30, 31, 32,
+	33, 25, 170, 0, 0, 0, 0, 0, 0, 39,
+	40, 0, 0, 41, 42, 0, 0, 0, 43, 44,
+	36, 37, 38, 34, 35, 0, 0, 0, 0, 26,
+	27, 28, 29, 30, 31, 32, 33, 25, 0, 0,
+	0, 0, 41, 42, 0, 39, 40, 43, 44, 36,
+	37, 38, 34, 35, 0, 0, 0, 0, 26, 27,
+	28, 29, 30, 31, 32, 33, 25, 0, 0, 0,
+	0, 41, 42, 0, 39, 40, 43, 44, 55, 56,
+	57, 34, 35, 0, 0, 0, 0, 26, 27, 28,
+	29, 30, 31, 32, 33, 25, 0, 0, 0, 0,
+	0, 0, 0, 39, 40,
 }
-var mmPact = [...]int{
 
-	8, -1000, 4, 177, 33, -1000, -1000, -1000, 445, -1000,
-	445, 445, 177, 33, -1000, 33, -1000, 147, 468, 15,
+var mmPact = [...]int16{
+	119, -1000, 73, 169, 74, -1000, -1000, -1000, 147, 1050,
+	1050, -1000, 1050, 267, 1050, 169, 74, -1000, 74, -1000,
+	236, 1079, -1000, 41, -1000, -1000, -1000, -1000, -1000, -1000,
 	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, 144, 128, 33, -1000, 37, -1000,
-	-1000, -1000, -1000, 445, -1000, -1000, 65, -1000, 445, -1000,
-	17, 17, -1000, -1000, 163, 161, 159, 158, 422, 110,
-	70, -1000, 318, 23, -33, -33, -33, 398, -1000, -1000,
-	157, -1000, 45, -1000, 318, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -7, 75, -10, 222, -1000, -1000, 221, 220,
-	208, -8, -23, 263, 375, 63, -1000, 351, 38, 3,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, 445, 445, 207,
-	109, -1000, -1000, 231, 35, -1000, -1000, -1000, -1000, -1000,
-	-1000, 89, 33, 91, 92, 39, 53, 74, 206, -1000,
-	-1000, -1000, 295, 140, -1000, -1000, -1000, 94, 239, 41,
-	33, 108, -1000, 36, 34, -1000, -1000, 200, -1000, -1000,
-	101, 100, -1000, -1000, 121, 199, -1000, 26, -1000, 295,
-	-1000, -1000, -1000, 180, -1000, -1000, 31, -1000, -1000, -1000,
-	17, 167, 179, -1000, -1000, 232, -1000, -1000, 119, -1000,
-	-1000, 175, 32, 17, 66, 174, -1000, 295, -1000, -1000,
-	-1000, 153, 151, 124, 57, -1000, -1000, -1000, -2, -3,
-	1, -1000, 171, 168, 166, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, 97, 59, -1000, -1000, -1000,
+	-1000, 24, 74, -1000, 109, -1000, -1000, -1000, 1079, -1000,
+	1050, -1000, -1000, -1000, 213, -1000, 1050, 55, -1000, 182,
+	26, 26, -1000, -1000, 275, 274, 272, 270, 269, 263,
+	262, 956, 235, -1000, 1050, -1000, -1000, 582, 175, 131,
+	-27, -27, -27, 985, 51, 44, 111, -1000, -1000, 352,
+	261, -1000, 922, 234, -1000, 351, -1000, -1000, -1000, -1000,
+	-1000, 155, 8, 190, -1000, 537, 207, 29, 350, -1000,
+	-1000, 349, 336, 174, -1000, -4, -5, 334, 324, 318,
+	-1000, 444, 888, -1000, -1000, 1021, -1000, 622, 45, -1000,
+	317, 142, 76, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	985, 1050, 1050, -1000, -1000, -1000, 315, 489, 221, -1000,
+	-1000, 398, 135, -1000, -1000, -1000, -1000, -1000, -1000, 854,
+	214, 110, -1000, 61, 74, 206, 786, -1000, 78, 185,
+	312, -1000, -1000, -1000, -1000, 311, 489, 227, -1000, -1000,
+	-1000, 195, 359, -1000, -1000, 309, -1000, 116, -1000, 191,
+	184, 74, 200, 220, -1000, -1000, 141, 139, 63, 219,
+	217, -1000, -1000, -1000, 203, 353, -1000, 102, -1000, 489,
+	-1000, 115, -1000, -1000, -1000, -1000, -1000, 307, -1000, -1000,
+	85, -1000, 215, -1000, -1000, 26, 308, 306, -1000, -1000,
+	358, -1000, -1000, 305, -1000, 820, -1000, -1000, 304, -1000,
+	224, 26, 162, 297, -1000, 489, -1000, -1000, -1000, 11,
+	-1000, 260, 251, 248, 244, 242, 241, 240, 146, -1000,
+	-1000, -1000, -1000, 296, 745, 708, 57, 37, 15, 13,
+	43, -1000, -1000, 295, 290, -41, 671, -26, 209, -1000,
+	289, 288, 286, 285, 284, 279, 277, -1000, -1000, 671,
+	671, 671, 671, 9, -1000, -1000, 1050, 671, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -39, -39, -1000, -1000, -1000,
+	-1000, 194, -41, -1000, 671, -41,
 }
-var mmPgo = [...]int{
 
-	0, 311, 0, 232, 15, 5, 307, 3, 305, 8,
-	138, 304, 261, 296, 295, 6, 1, 294, 293, 2,
-	17, 281, 16, 7, 279, 10, 275, 273, 272, 4,
-	263, 262, 249, 248, 208,
+var mmPgo = [...]int16{
+	0, 433, 0, 115, 18, 7, 432, 4, 201, 14,
+	328, 424, 387, 423, 422, 6, 1, 418, 414, 3,
+	17, 8, 21, 412, 12, 411, 16, 406, 405, 404,
+	5, 403, 389, 388, 379, 378, 377, 9, 2, 373,
+	369,
 }
-var mmR1 = [...]int{
-
-	0, 34, 34, 34, 34, 34, 34, 1, 1, 12,
-	12, 10, 10, 10, 11, 32, 32, 33, 33, 33,
-	33, 3, 3, 9, 9, 15, 15, 13, 13, 16,
-	16, 14, 14, 14, 14, 14, 14, 18, 5, 7,
-	4, 4, 4, 4, 4, 4, 4, 6, 6, 6,
-	17, 17, 17, 31, 26, 26, 25, 25, 25, 8,
-	8, 8, 8, 30, 30, 28, 28, 28, 28, 29,
-	29, 27, 27, 27, 23, 23, 24, 24, 19, 19,
-	21, 21, 21, 21, 21, 21, 21, 21, 21, 21,
-	21, 22, 22, 20, 20, 20, 2, 2, 2, 2,
+
+var mmR1 = [...]int8{
+	0, 40, 40, 40, 40, 40, 40, 1, 1, 12,
+	12, 10, 10, 10, 10, 10, 10, 10, 10, 11,
+	33, 33, 37, 37, 37, 38, 38, 38, 38, 38,
+	38, 38, 39, 39, 35, 35, 36, 36, 34, 34,
+	34, 34, 34, 34, 34, 34, 34, 34, 3, 3,
+	9, 9, 15, 15, 13, 13, 13, 13, 13, 16,
+	16, 14, 14, 14, 14, 14, 14, 14, 18, 5,
+	7, 4, 4, 4, 4, 4, 4, 4, 4, 6,
+	6, 6, 17, 17, 17, 32, 27, 27, 27, 27,
+	26, 26, 26, 26, 26, 8, 8, 8, 8, 31,
+	31, 29, 29, 29, 29, 29, 29, 29, 23, 23,
+	30, 30, 30, 28, 28, 28, 28, 24, 24, 25,
+	25, 19, 19, 21, 21, 21, 21, 21, 21, 21,
+	21, 21, 21, 21, 22, 22, 20, 20, 20, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2,
 }
-var mmR2 = [...]int{
 
+var mmR2 = [...]int8{
 	0, 2, 3, 2, 1, 2, 1, 2, 1, 2,
-	1, 3, 1, 10, 9, 0, 4, 0, 5, 5,
-	5, 3, 1, 0, 3, 0, 2, 6, 5, 0,
-	2, 4, 5, 6, 5, 6, 7, 4, 1, 1,
+	1, 3, 5, 1, 10, 2, 2, 2, 2, 10,
+	0, 4, 1, 1, 1, 3, 3, 3, 3, 3,
+	3, 4, 1, 3, 0, 4, 0, 3, 0, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 3, 1,
+	0, 3, 0, 2, 6, 5, 8, 7, 3, 0,
+	2, 4, 5, 6, 5, 6, 7, 3, 4, 1,
+	1, 1, 1, 1, 1, 1, 1, 5, 1, 1,
+	1, 1, 0, 6, 5, 4, 2, 1, 3, 2,
+	6, 8, 7, 9, 5, 0, 2, 2, 2, 0,
+	2, 4, 4, 4, 4, 4, 4, 4, 1, 3,
+	0, 2, 3, 4, 5, 8, 7, 3, 1, 5,
+	3, 1, 1, 3, 4, 2, 2, 3, 4, 1,
+	1, 1, 1, 1, 1, 1, 3, 1, 3, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	0, 6, 5, 4, 2, 1, 6, 8, 5, 0,
-	2, 2, 2, 0, 2, 4, 4, 4, 4, 0,
-	2, 4, 8, 7, 3, 1, 5, 3, 1, 1,
-	3, 4, 2, 2, 3, 4, 1, 1, 1, 1,
-	1, 1, 1, 3, 1, 3, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1,
 }
-var mmChk = [...]int{
-
-	-1000, -34, -1, -12, -25, 57, -10, 23, 20, -11,
-	22, 21, -12, -25, 57, -25, -10, 25, -8, -3,
-	-2, 37, 34, 35, 36, 29, 26, 27, 28, 45,
-	46, 20, 24, 25, -2, -2, -25, 13, -2, 26,
-	27, 28, 7, 41, 13, 13, -30, 13, 33, -2,
-	-15, -15, 14, -28, 26, 27, 28, 29, -29, -2,
-	-16, -13, 30, -16, 10, 10, 10, 10, 14, -27,
-	-2, 13, 14, -14, 31, -4, 48, 49, 51, 50,
-	52, 47, -3, -18, 32, -22, 53, 54, -22, -22,
-	-20, -2, 19, 10, -29, 15, -4, -9, 14, -6,
-	42, 45, 46, 9, 9, 9, 9, 41, 41, -19,
-	17, -21, -20, 11, 15, 39, 40, 38, -22, 55,
-	14, -26, -25, -9, 11, -2, -17, 24, 38, -2,
-	-2, 9, 13, -23, 12, -19, 16, -24, 38, -31,
-	-25, 18, 9, -5, -2, 38, 12, -5, 9, -32,
-	25, 25, 13, 9, -23, 9, 12, 9, 16, 8,
-	16, 13, 9, -7, 38, 9, -5, 9, 13, 13,
-	-15, 9, 14, -19, 12, 38, 16, -19, -29, 9,
-	9, -7, -33, -15, -16, 14, 9, 8, 14, 9,
-	14, 34, 35, 36, -16, 14, 9, -19, 10, 10,
-	10, 14, 40, 40, 38, 9, 9, 9,
+
+var mmChk = [...]int16{
+	-1000, -40, -1, -12, -26, 66, -10, 26, 56, 22,
+	23, -11, 25, 2, 24, -12, -26, 66, -26, -10,
+	28, -8, 26, -3, -2, 46, 38, 39, 40, 41,
+	42, 43, 44, 45, 32, 33, 29, 30, 31, 54,
+	55, 22, 23, 27, 28, -3, -3, 7, 16, 14,
+	-10, -3, -26, 13, -3, 29, 30, 31, -8, 7,
+	50, 13, 13, 13, -31, 13, 37, -3, -2, -15,
+	-15, -15, 14, -29, 29, 30, 31, 32, 42, 43,
+	44, -30, -2, 13, 37, 14, -13, 34, -16, -16,
+	10, 10, 10, 10, 10, 10, 10, 14, -28, 2,
+	-2, 13, -30, -2, -4, 2, 57, 58, 60, 59,
+	61, 56, -3, 14, -14, 35, -18, 36, -22, 62,
+	63, -22, -22, -23, -20, -2, 21, 49, 49, 47,
+	9, 10, -30, 14, 13, -9, 9, 17, 15, -4,
+	2, 14, -6, 51, 54, 55, 9, 9, 9, 9,
+	33, 50, 50, 9, 9, 9, -19, 27, 19, -21,
+	-20, 11, 15, 48, 49, 47, -22, 64, 14, -30,
+	11, -2, -4, -27, -26, 2, -9, 9, -17, 27,
+	47, -20, -2, -2, 9, -19, 13, -24, 12, -19,
+	16, -25, 47, 14, 12, -5, 9, 10, 47, -9,
+	-32, -26, 2, 20, 14, 9, -5, -2, -33, 28,
+	28, 13, 9, 9, -24, 9, 12, 9, 16, 8,
+	9, -21, 18, 16, 14, 13, 9, -7, 47, 9,
+	-5, -35, 45, 13, 13, -15, 9, 14, -19, 12,
+	47, 16, -19, -5, 9, -30, 9, 9, -7, 13,
+	-34, -15, -16, 14, 9, 8, 9, 14, 9, -36,
+	14, 38, 39, 40, 41, 42, 43, 44, -16, 14,
+	9, -19, 14, -2, 10, 10, 10, 10, 10, 10,
+	10, 14, 9, 49, -38, -37, 13, 21, -2, 48,
+	49, -38, 47, 49, 49, 49, 47, 9, 9, 67,
+	68, 69, 70, -37, -38, 49, 50, 13, 9, 9,
+	9, 9, 9, 9, 9, -37, -37, -37, -37, 14,
+	-2, -39, -37, 14, 9, -37,
 }
-var mmDef = [...]int{
-
-	0, -2, 0, 4, 6, 8, 10, 59, 0, 12,
-	0, 0, 1, 3, 7, 5, 9, 0, 0, 0,
-	22, 96, 97, 98, 99, 100, 101, 102, 103, 104,
-	105, 106, 107, 108, 0, 0, 2, 63, 0, -2,
-	-2, -2, 11, 0, 25, 25, 0, 69, 0, 21,
-	29, 29, 58, 64, 0, 0, 0, 0, 0, 0,
-	0, 26, 0, 0, 0, 0, 0, 0, 56, 70,
-	0, 69, 0, 30, 0, 23, 40, 41, 42, 43,
-	44, 45, 46, 0, 0, 0, 91, 92, 0, 0,
-	0, 94, 0, 0, 0, 0, 23, 0, 50, 0,
-	47, 48, 49, 65, 66, 67, 68, 0, 0, 0,
-	0, 78, 79, 0, 0, 86, 87, 88, 89, 90,
-	57, 0, 55, 0, 0, 0, 15, 0, 0, 93,
-	95, 71, 0, 0, 82, 75, 83, 0, 0, 0,
-	54, 0, 31, 0, 0, 38, 24, 0, 28, 14,
-	0, 0, 25, 37, 0, 0, 80, 0, 84, 0,
-	13, 69, 32, 0, 39, 34, 0, 27, 17, 25,
-	29, 0, 0, 74, 81, 0, 85, 77, 0, 33,
-	35, 0, 0, 29, 0, 0, 73, 0, 53, 36,
-	16, 0, 0, 0, 0, 52, 72, 76, 0, 0,
-	0, 51, 0, 0, 0, 18, 19, 20,
+
+var mmDef = [...]int16{
+	0, -2, 0, -2, 6, 8, 10, 95, 0, 0,
+	0, 13, 0, 0, 0, -2, 3, 7, 5, 9,
+	0, 0, 95, 0, 49, 139, 140, 141, 142, 143,
+	144, 145, 146, 147, 148, 149, 150, 151, 152, 153,
+	154, 155, 156, 157, 158, 0, 0, 15, 16, 17,
+	18, 0, 2, 99, 0, -2, -2, -2, 0, 11,
+	0, 52, 52, 52, 0, 110, 0, 0, 48, 0,
+	59, 59, 94, 100, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 110, 0, 12, 53, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 90, 111, 0,
+	0, 110, 0, 0, 50, 0, 71, 72, 73, 74,
+	75, 76, 78, 0, 60, 0, 0, 0, 0, 134,
+	135, 0, 0, 0, 108, 137, 0, 0, 0, 0,
+	112, 0, 0, 92, 110, 0, 58, 0, 0, 50,
+	0, 82, 0, 79, 80, 81, 101, 102, 103, 104,
+	0, 0, 0, 105, 106, 107, 0, 157, 0, 121,
+	122, 0, 0, 129, 130, 131, 132, 133, 91, 0,
+	0, 0, 50, 0, 87, 0, 0, 67, 20, 0,
+	0, 109, 136, 138, 113, 0, 0, 0, 125, 118,
+	126, 0, 0, 93, 51, 0, 55, 0, 69, 0,
+	0, 86, 0, 0, 89, 61, 0, 0, 34, 0,
+	0, 52, 68, 114, 0, 0, 123, 0, 127, 0,
+	54, 0, 77, 14, 88, 110, 62, 0, 70, 64,
+	0, 19, 0, 38, 52, 59, 0, 0, 117, 124,
+	0, 128, 120, 0, 57, 0, 63, 65, 0, 36,
+	0, 59, 0, 0, 116, 0, 56, 85, 66, 0,
+	21, 0, 0, 0, 0, 0, 0, 0, 0, 84,
+	115, 119, 35, 0, 0, 0, 0, 0, 0, 0,
+	0, 83, 37, 23, 22, 0, 0, 0, 0, 24,
+	23, 22, 0, 0, 0, 0, 0, 39, 40, 0,
+	0, 0, 0, 0, 22, 23, 0, 0, 41, 42,
+	43, 44, 45, 46, 47, 25, 26, 27, 28, 29,
+	30, 0, 32, 31, 0, 33,
 }
-var mmTok1 = [...]int{
 
+var mmTok1 = [...]int8{
 	1,
 }
-var mmTok2 = [...]int{
 
+var mmTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
-	52, 53, 54, 55, 56, 57,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
+	62, 63, 64, 65, 66, 67, 68, 69, 70,
 }
-var mmTok3 = [...]int{
+
+var mmTok3 = [...]int8{
 	0,
 }
 
@@ -450,9 +595,9 @@ func mmErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := mmPact[state]
+	base := int(mmPact[state])
 	for tok := TOKSTART; tok-1 < len(mmToknames); tok++ {
-		if n := base + tok; n >= 0 && n < mmLast && mmChk[mmAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < mmLast && int(mmChk[int(mmAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -462,13 +607,13 @@ func mmErrorMessage(state, lookAhead int) string {
 
 	if mmDef[state] == -2 {
 		i := 0
-		for mmExca[i] != -1 || mmExca[i+1] != state {
+		for mmExca[i] != -1 || int(mmExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; mmExca[i] >= 0; i += 2 {
-			tok := mmExca[i]
+			tok := int(mmExca[i])
 			if tok < TOKSTART || mmExca[i+1] == 0 {
 				continue
 			}
@@ -499,30 +644,30 @@ func mmlex1(lex mmLexer, lval *mmSymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = mmTok1[0]
+		token = int(mmTok1[0])
 		goto out
 	}
 	if char < len(mmTok1) {
-		token = mmTok1[char]
+		token = int(mmTok1[char])
 		goto out
 	}
 	if char >= mmPrivate {
 		if char < mmPrivate+len(mmTok2) {
-			token = mmTok2[char-mmPrivate]
+			token = int(mmTok2[char-mmPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(mmTok3); i += 2 {
-		token = mmTok3[i+0]
+		token = int(mmTok3[i+0])
 		if token == char {
-			token = mmTok3[i+1]
+			token = int(mmTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = mmTok2[1] /* unknown char */
+		token = int(mmTok2[1]) /* unknown char */
 	}
 	if mmDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", mmTokname(token), uint(char))
@@ -577,7 +722,7 @@ mmstack:
 	mmS[mmp].yys = mmstate
 
 mmnewstate:
-	mmn = mmPact[mmstate]
+	mmn = int(mmPact[mmstate])
 	if mmn <= mmFlag {
 		goto mmdefault /* simple state */
 	}
@@ -588,8 +733,8 @@ mmnewstate:
 	if mmn < 0 || mmn >= mmLast {
 		goto mmdefault
 	}
-	mmn = mmAct[mmn]
-	if mmChk[mmn] == mmtoken { /* valid shift */
+	mmn = int(mmAct[mmn])
+	if int(mmChk[mmn]) == mmtoken { /* valid shift */
 		mmrcvr.char = -1
 		mmtoken = -1
 		mmVAL = mmrcvr.lval
@@ -602,7 +747,7 @@ mmnewstate:
 
 mmdefault:
 	/* default state action */
-	mmn = mmDef[mmstate]
+	mmn = int(mmDef[mmstate])
 	if mmn == -2 {
 		if mmrcvr.char < 0 {
 			mmrcvr.char, mmtoken = mmlex1(mmlex, &mmrcvr.lval)
@@ -611,18 +756,18 @@ mmdefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if mmExca[xi+0] == -1 && mmExca[xi+1] == mmstate {
+			if mmExca[xi+0] == -1 && int(mmExca[xi+1]) == mmstate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			mmn = mmExca[xi+0]
+			mmn = int(mmExca[xi+0])
 			if mmn < 0 || mmn == mmtoken {
 				break
 			}
 		}
-		mmn = mmExca[xi+1]
+		mmn = int(mmExca[xi+1])
 		if mmn < 0 {
 			goto ret0
 		}
@@ -644,10 +789,10 @@ mmdefault:
 
 			/* find a state where "error" is a legal shift action */
 			for mmp >= 0 {
-				mmn = mmPact[mmS[mmp].yys] + mmErrCode
+				mmn = int(mmPact[mmS[mmp].yys]) + mmErrCode
 				if mmn >= 0 && mmn < mmLast {
-					mmstate = mmAct[mmn] /* simulate a shift of "error" */
-					if mmChk[mmstate] == mmErrCode {
+					mmstate = int(mmAct[mmn]) /* simulate a shift of "error" */
+					if int(mmChk[mmstate]) == mmErrCode {
 						goto mmstack
 					}
 				}
@@ -683,7 +828,7 @@ mmdefault:
 	mmpt := mmp
 	_ = mmpt // guard against "declared and not used"
 
-	mmp -= mmR2[mmn]
+	mmp -= int(mmR2[mmn])
 	// mmp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if mmp+1 >= len(mmS) {
@@ -694,16 +839,16 @@ mmdefault:
 	mmVAL = mmS[mmp+1]
 
 	/* consult goto table to find next state */
-	mmn = mmR1[mmn]
-	mmg := mmPgo[mmn]
+	mmn = int(mmR1[mmn])
+	mmg := int(mmPgo[mmn])
 	mmj := mmg + mmS[mmp].yys + 1
 
 	if mmj >= mmLast {
-		mmstate = mmAct[mmg]
+		mmstate = int(mmAct[mmg])
 	} else {
-		mmstate = mmAct[mmj]
-		if mmChk[mmstate] != -mmn {
-			mmstate = mmAct[mmg]
+		mmstate = int(mmAct[mmj])
+		if int(mmChk[mmstate]) != -mmn {
+			mmstate = int(mmAct[mmg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -711,7 +856,7 @@ mmdefault:
 
 	case 1:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:83
+//line src/martian/syntax/grammar.y:89
 		{
 			{
 				global := NewAst(mmDollar[2].decs, nil)
@@ -721,7 +866,7 @@ mmdefault:
 		}
 	case 2:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:89
+//line src/martian/syntax/grammar.y:95
 		{
 			{
 				global := NewAst(mmDollar[2].decs, mmDollar[3].call)
@@ -731,7 +876,7 @@ mmdefault:
 		}
 	case 3:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:95
+//line src/martian/syntax/grammar.y:101
 		{
 			{
 				global := NewAst([]Dec{}, mmDollar[2].call)
@@ -741,7 +886,7 @@ mmdefault:
 		}
 	case 4:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:101
+//line src/martian/syntax/grammar.y:107
 		{
 			{
 				global := NewAst(mmDollar[1].decs, nil)
@@ -750,7 +895,7 @@ mmdefault:
 		}
 	case 5:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:106
+//line src/martian/syntax/grammar.y:112
 		{
 			{
 				global := NewAst(mmDollar[1].decs, mmDollar[2].call)
@@ -759,7 +904,7 @@ mmdefault:
 		}
 	case 6:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:111
+//line src/martian/syntax/grammar.y:117
 		{
 			{
 				global := NewAst([]Dec{}, mmDollar[1].call)
@@ -768,7 +913,7 @@ mmdefault:
 		}
 	case 7:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:119
+//line src/martian/syntax/grammar.y:125
 		{
 			{
 				mmVAL.pre_dir = append(mmDollar[1].pre_dir, &preprocessorDirective{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), mmDollar[2].val})
@@ -776,7 +921,7 @@ mmdefault:
 		}
 	case 8:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:121
+//line src/martian/syntax/grammar.y:127
 		{
 			{
 				mmVAL.pre_dir = []*preprocessorDirective{
@@ -789,7 +934,7 @@ mmdefault:
 		}
 	case 9:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:131
+//line src/martian/syntax/grammar.y:137
 		{
 			{
 				mmVAL.decs = append(mmDollar[1].decs, mmDollar[2].dec)
@@ -797,7 +942,7 @@ mmdefault:
 		}
 	case 10:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:133
+//line src/martian/syntax/grammar.y:139
 		{
 			{
 				mmVAL.decs = []Dec{mmDollar[1].dec}
@@ -805,27 +950,69 @@ mmdefault:
 		}
 	case 11:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:138
+//line src/martian/syntax/grammar.y:148
 		{
 			{
-				mmVAL.dec = &UserType{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), mmDollar[2].val}
+				mmVAL.dec = &UserType{newAstSpan(mmDollar[2].loc, mmDollar[3].loc, mmDollar[2].locmap), mmDollar[2].val}
 			}
 		}
-	case 13:
-		mmDollar = mmS[mmpt-10 : mmpt+1]
-		//line src/martian/syntax/grammar.y:141
+	case 12:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:150
 		{
 			{
-				mmVAL.dec = &Pipeline{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), mmDollar[2].val, mmDollar[4].params, mmDollar[5].params, mmDollar[8].calls, &Callables{[]Callable{}, map[string]Callable{}}, mmDollar[9].retstm}
+				mmVAL.dec = &StructType{newAstSpan(mmDollar[2].loc, mmDollar[5].loc, mmDollar[2].locmap), mmDollar[2].val, mmDollar[4].params}
 			}
 		}
 	case 14:
-		mmDollar = mmS[mmpt-9 : mmpt+1]
-		//line src/martian/syntax/grammar.y:146
+		mmDollar = mmS[mmpt-10 : mmpt+1]
+//line src/martian/syntax/grammar.y:153
+		{
+			{
+				mmVAL.dec = &Pipeline{newAstSpan(mmDollar[2].loc, mmDollar[10].loc, mmDollar[2].locmap), mmDollar[2].val, mmDollar[4].params, mmDollar[5].params, mmDollar[8].calls, &Callables{[]Callable{}, map[string]Callable{}}, mmDollar[9].retstm}
+			}
+		}
+	case 15:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+//line src/martian/syntax/grammar.y:155
+		{
+			{
+				mmVAL.dec = nil
+			}
+		}
+	case 16:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+//line src/martian/syntax/grammar.y:157
+		{
+			{
+				mmVAL.dec = nil
+			}
+		}
+	case 17:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+//line src/martian/syntax/grammar.y:159
+		{
+			{
+				mmVAL.dec = nil
+			}
+		}
+	case 18:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+//line src/martian/syntax/grammar.y:161
+		{
+			{
+				mmVAL.dec = mmDollar[2].dec
+			}
+		}
+	case 19:
+		mmDollar = mmS[mmpt-10 : mmpt+1]
+//line src/martian/syntax/grammar.y:166
 		{
 			{
 				mmVAL.dec = &Stage{
-					Node:      NewAstNode(mmDollar[2].loc, mmDollar[2].locmap),
+					Node: newAstSpan(mmDollar[2].loc,
+						lastLoc(mmDollar[7].loc, mmDollar[8].loc, mmDollar[9].loc, mmDollar[10].loc),
+						mmDollar[2].locmap),
 					Id:        mmDollar[2].val,
 					InParams:  mmDollar[4].params,
 					OutParams: mmDollar[5].params,
@@ -834,37 +1021,169 @@ mmdefault:
 					ChunkOuts: mmDollar[8].par_tuple.Outs,
 					Split:     mmDollar[8].par_tuple.Present,
 					Resources: mmDollar[9].res,
+					Retain:    mmDollar[10].retains,
 				}
 			}
 		}
-	case 15:
+	case 20:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:161
+//line src/martian/syntax/grammar.y:187
 		{
 			{
 				mmVAL.res = nil
+				mmVAL.loc = tokenLoc{}
 			}
 		}
-	case 16:
+	case 21:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:163
+//line src/martian/syntax/grammar.y:192
 		{
 			{
-				mmDollar[3].res.Node = NewAstNode(mmDollar[1].loc, mmDollar[1].locmap)
+				mmDollar[3].res.Node = newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap)
 				mmVAL.res = mmDollar[3].res
+				mmVAL.loc = mmDollar[4].loc
 			}
 		}
-	case 17:
+	case 23:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+//line src/martian/syntax/grammar.y:202
+		{
+			{ // Lexer guarantees parseable int strings.
+				i, _ := strconv.ParseInt(mmDollar[1].val, 0, 64)
+				mmVAL.resexp = &ResourceNum{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), float64(i)}
+			}
+		}
+	case 24:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+//line src/martian/syntax/grammar.y:207
+		{
+			{ // Lexer guarantees parseable float strings.
+				f, _ := strconv.ParseFloat(mmDollar[1].val, 64)
+				mmVAL.resexp = &ResourceNum{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), f}
+			}
+		}
+	case 25:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:216
+		{
+			{
+				mmVAL.resexp = &ResourceBinExp{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), "+", mmDollar[1].resexp, mmDollar[3].resexp}
+			}
+		}
+	case 26:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:218
+		{
+			{
+				mmVAL.resexp = &ResourceBinExp{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), "-", mmDollar[1].resexp, mmDollar[3].resexp}
+			}
+		}
+	case 27:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:220
+		{
+			{
+				mmVAL.resexp = &ResourceBinExp{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), "*", mmDollar[1].resexp, mmDollar[3].resexp}
+			}
+		}
+	case 28:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:222
+		{
+			{
+				mmVAL.resexp = &ResourceBinExp{NewAstNode(mmDollar[2].loc, mmDollar[2].locmap), "/", mmDollar[1].resexp, mmDollar[3].resexp}
+			}
+		}
+	case 29:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:224
+		{
+			{
+				mmVAL.resexp = mmDollar[2].resexp
+			}
+		}
+	case 30:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:226
+		{
+			{
+				mmVAL.resexp = &ResourceRef{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[3].val}
+			}
+		}
+	case 31:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+//line src/martian/syntax/grammar.y:228
+		{
+			{
+				mmVAL.resexp = &ResourceFunc{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].resexps}
+			}
+		}
+	case 32:
+		mmDollar = mmS[mmpt-1 : mmpt+1]
+//line src/martian/syntax/grammar.y:233
+		{
+			{
+				mmVAL.resexps = []ResourceExp{mmDollar[1].resexp}
+			}
+		}
+	case 33:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:235
+		{
+			{
+				mmVAL.resexps = append(mmDollar[1].resexps, mmDollar[3].resexp)
+			}
+		}
+	case 34:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+//line src/martian/syntax/grammar.y:240
+		{
+			{
+				mmVAL.retains = nil
+				mmVAL.loc = tokenLoc{}
+			}
+		}
+	case 35:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+//line src/martian/syntax/grammar.y:245
+		{
+			{
+				mmDollar[3].retains.Node = newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap)
+				mmVAL.retains = mmDollar[3].retains
+				mmVAL.loc = mmDollar[4].loc
+			}
+		}
+	case 36:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:171
+//line src/martian/syntax/grammar.y:254
+		{
+			{
+				mmVAL.retains = &RetainParams{}
+			}
+		}
+	case 37:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:256
+		{
+			{
+				mmDollar[1].retains.Params = append(mmDollar[1].retains.Params, &RetainParam{
+					Node: NewAstNode(mmDollar[2].loc, mmDollar[2].locmap),
+					Id:   mmDollar[2].val,
+				})
+				mmVAL.retains = mmDollar[1].retains
+			}
+		}
+	case 38:
+		mmDollar = mmS[mmpt-0 : mmpt+1]
+//line src/martian/syntax/grammar.y:267
 		{
 			{
 				mmVAL.res = &Resources{}
 			}
 		}
-	case 18:
+	case 39:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:173
+//line src/martian/syntax/grammar.y:269
 		{
 			{
 				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
@@ -874,9 +1193,20 @@ mmdefault:
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 19:
+	case 40:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:277
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.ThreadNode = &n
+				mmDollar[1].res.ThreadExp = mmDollar[4].resexp
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 41:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:181
+//line src/martian/syntax/grammar.y:284
 		{
 			{
 				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
@@ -886,151 +1216,253 @@ mmdefault:
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 20:
+	case 42:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:292
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.MemNode = &n
+				mmDollar[1].res.MemExp = mmDollar[4].resexp
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 43:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:189
+//line src/martian/syntax/grammar.y:299
 		{
 			{
 				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
 				mmDollar[1].res.SpecialNode = &n
-				mmDollar[1].res.Special = mmDollar[4].val
+				mmDollar[1].res.Special = unquote(mmDollar[4].val)
 				mmVAL.res = mmDollar[1].res
 			}
 		}
-	case 21:
+	case 44:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:306
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.TimeoutNode = &n
+				i, _ := strconv.ParseInt(mmDollar[4].val, 0, 64)
+				mmDollar[1].res.Timeout = int(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 45:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:314
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.RetriesNode = &n
+				i, _ := strconv.ParseInt(mmDollar[4].val, 0, 64)
+				mmDollar[1].res.Retries = int(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 46:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:322
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.BackoffNode = &n
+				i, _ := strconv.ParseInt(mmDollar[4].val, 0, 64)
+				mmDollar[1].res.Backoff = int(i)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 47:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:330
+		{
+			{
+				n := NewAstNode(mmDollar[2].loc, mmDollar[2].locmap)
+				mmDollar[1].res.RetryOnNode = &n
+				mmDollar[1].res.RetryOn = unquote(mmDollar[4].val)
+				mmVAL.res = mmDollar[1].res
+			}
+		}
+	case 48:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:199
+//line src/martian/syntax/grammar.y:340
 		{
 			{
 				mmVAL.val = mmDollar[1].val + mmDollar[2].val + mmDollar[3].val
 			}
 		}
-	case 23:
+	case 50:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:205
+//line src/martian/syntax/grammar.y:346
 		{
 			{
 				mmVAL.arr = 0
 			}
 		}
-	case 24:
+	case 51:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:207
+//line src/martian/syntax/grammar.y:348
 		{
 			{
 				mmVAL.arr += 1
 			}
 		}
-	case 25:
+	case 52:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:212
+//line src/martian/syntax/grammar.y:353
 		{
 			{
 				mmVAL.params = &Params{[]Param{}, map[string]Param{}}
 			}
 		}
-	case 26:
+	case 53:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:214
+//line src/martian/syntax/grammar.y:355
 		{
 			{
-				mmDollar[1].params.List = append(mmDollar[1].params.List, mmDollar[2].inparam)
+				if mmDollar[2].inparam != nil {
+					mmDollar[1].params.List = append(mmDollar[1].params.List, mmDollar[2].inparam)
+				}
 				mmVAL.params = mmDollar[1].params
 			}
 		}
-	case 27:
+	case 54:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line src/martian/syntax/grammar.y:222
+//line src/martian/syntax/grammar.y:366
 		{
 			{
-				mmVAL.inparam = &InParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), false}
+				mmVAL.inparam = &InParam{newAstSpan(mmDollar[1].loc, mmDollar[6].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), nil, false, nil}
 			}
 		}
-	case 28:
+	case 55:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:224
+//line src/martian/syntax/grammar.y:368
 		{
 			{
-				mmVAL.inparam = &InParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, "", false}
+				mmVAL.inparam = &InParam{newAstSpan(mmDollar[1].loc, mmDollar[5].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, "", nil, false, nil}
 			}
 		}
-	case 29:
+	case 56:
+		mmDollar = mmS[mmpt-8 : mmpt+1]
+//line src/martian/syntax/grammar.y:370
+		{
+			{
+				mmVAL.inparam = &InParam{newAstSpan(mmDollar[1].loc, mmDollar[8].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[7].val), mmDollar[6].exp, false, nil}
+			}
+		}
+	case 57:
+		mmDollar = mmS[mmpt-7 : mmpt+1]
+//line src/martian/syntax/grammar.y:372
+		{
+			{
+				mmVAL.inparam = &InParam{newAstSpan(mmDollar[1].loc, mmDollar[7].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, "", mmDollar[6].exp, false, nil}
+			}
+		}
+	case 58:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:374
+		{
+			{
+				mmVAL.inparam = nil
+			}
+		}
+	case 59:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:229
+//line src/martian/syntax/grammar.y:379
 		{
 			{
 				mmVAL.params = &Params{[]Param{}, map[string]Param{}}
 			}
 		}
-	case 30:
+	case 60:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:231
+//line src/martian/syntax/grammar.y:381
 		{
 			{
-				mmDollar[1].params.List = append(mmDollar[1].params.List, mmDollar[2].outparam)
+				if mmDollar[2].outparam != nil {
+					mmDollar[1].params.List = append(mmDollar[1].params.List, mmDollar[2].outparam)
+				}
 				mmVAL.params = mmDollar[1].params
 			}
 		}
-	case 31:
+	case 61:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:239
+//line src/martian/syntax/grammar.y:391
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", "", "", false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", "", "", false, nil}
 			}
 		}
-	case 32:
+	case 62:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:241
+//line src/martian/syntax/grammar.y:393
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", unquote(mmDollar[4].val), "", false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[5].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", unquote(mmDollar[4].val), "", false, nil}
 			}
 		}
-	case 33:
+	case 63:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line src/martian/syntax/grammar.y:243
+//line src/martian/syntax/grammar.y:395
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", unquote(mmDollar[4].val), unquote(mmDollar[5].val), false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[6].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, "default", unquote(mmDollar[4].val), unquote(mmDollar[5].val), false, nil}
 			}
 		}
-	case 34:
+	case 64:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:245
+//line src/martian/syntax/grammar.y:397
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, "", "", false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[5].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, "", "", false, nil}
 			}
 		}
-	case 35:
+	case 65:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line src/martian/syntax/grammar.y:247
+//line src/martian/syntax/grammar.y:399
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), "", false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[6].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), "", false, nil}
 			}
 		}
-	case 36:
+	case 66:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line src/martian/syntax/grammar.y:249
+//line src/martian/syntax/grammar.y:401
 		{
 			{
-				mmVAL.outparam = &OutParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), unquote(mmDollar[6].val), false}
+				mmVAL.outparam = &OutParam{newAstSpan(mmDollar[1].loc, mmDollar[7].loc, mmDollar[1].locmap), mmDollar[2].val, mmDollar[3].arr, mmDollar[4].val, unquote(mmDollar[5].val), unquote(mmDollar[6].val), false, nil}
 			}
 		}
-	case 37:
+	case 67:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:403
+		{
+			{
+				mmVAL.outparam = nil
+			}
+		}
+	case 68:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:254
+//line src/martian/syntax/grammar.y:408
 		{
 			{
 				stagecodeParts := strings.Split(unquote(mmDollar[3].val), " ")
-				mmVAL.src = &SrcParam{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), StageLanguage(mmDollar[2].val), stagecodeParts[0], stagecodeParts[1:]}
+				mmVAL.src = &SrcParam{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), StageLanguage(mmDollar[2].val), stagecodeParts[0], stagecodeParts[1:]}
 			}
 		}
-	case 50:
+	case 77:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:428
+		{
+			{
+				mmVAL.val = mmDollar[1].val + "<" + mmDollar[3].val + strings.Repeat("[]", mmDollar[4].arr) + ">"
+			}
+		}
+	case 82:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:286
+//line src/martian/syntax/grammar.y:442
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{
@@ -1038,345 +1470,425 @@ mmdefault:
 					&Params{[]Param{}, map[string]Param{}},
 					&Params{[]Param{}, map[string]Param{}},
 				}
+				mmVAL.loc = tokenLoc{}
 			}
 		}
-	case 51:
+	case 83:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line src/martian/syntax/grammar.y:294
+//line src/martian/syntax/grammar.y:451
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{true, mmDollar[4].params, mmDollar[5].params}
+				mmVAL.loc = mmDollar[6].loc
 			}
 		}
-	case 52:
+	case 84:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:296
+//line src/martian/syntax/grammar.y:456
 		{
 			{
 				mmVAL.par_tuple = paramsTuple{true, mmDollar[3].params, mmDollar[4].params}
+				mmVAL.loc = mmDollar[5].loc
 			}
 		}
-	case 53:
+	case 85:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:301
+//line src/martian/syntax/grammar.y:464
 		{
 			{
-				mmVAL.retstm = &ReturnStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[3].bindings}
+				mmVAL.retstm = &ReturnStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[3].bindings}
 			}
 		}
-	case 54:
+	case 86:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:306
+//line src/martian/syntax/grammar.y:470
 		{
 			{
 				mmVAL.calls = append(mmDollar[1].calls, mmDollar[2].call)
 			}
 		}
-	case 55:
+	case 87:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:308
+//line src/martian/syntax/grammar.y:472
 		{
 			{
 				mmVAL.calls = []*CallStm{mmDollar[1].call}
 			}
 		}
-	case 56:
+	case 89:
+		mmDollar = mmS[mmpt-2 : mmpt+1]
+//line src/martian/syntax/grammar.y:475
+		{
+			{
+				mmVAL.calls = []*CallStm{}
+			}
+		}
+	case 90:
 		mmDollar = mmS[mmpt-6 : mmpt+1]
-		//line src/martian/syntax/grammar.y:313
+//line src/martian/syntax/grammar.y:480
 		{
 			{
-				mmVAL.call = &CallStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].modifiers, mmDollar[3].val, mmDollar[3].val, mmDollar[5].bindings}
+				mmVAL.call = &CallStm{newAstSpan(mmDollar[1].loc, mmDollar[6].loc, mmDollar[1].locmap), mmDollar[2].modifiers, unqualified(mmDollar[3].val), mmDollar[3].val, mmDollar[5].bindings}
 			}
 		}
-	case 57:
+	case 91:
 		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line src/martian/syntax/grammar.y:315
+//line src/martian/syntax/grammar.y:482
 		{
 			{
-				mmVAL.call = &CallStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[2].modifiers, mmDollar[5].val, mmDollar[3].val, mmDollar[7].bindings}
+				mmVAL.call = &CallStm{newAstSpan(mmDollar[1].loc, mmDollar[8].loc, mmDollar[1].locmap), mmDollar[2].modifiers, mmDollar[5].val, mmDollar[3].val, mmDollar[7].bindings}
 			}
 		}
-	case 58:
+	case 92:
+		mmDollar = mmS[mmpt-7 : mmpt+1]
+//line src/martian/syntax/grammar.y:484
+		{
+			{
+				mmDollar[3].modifiers.Mapped = true
+				mmVAL.call = &CallStm{newAstSpan(mmDollar[1].loc, mmDollar[7].loc, mmDollar[1].locmap), mmDollar[3].modifiers, unqualified(mmDollar[4].val), mmDollar[4].val, mmDollar[6].bindings}
+			}
+		}
+	case 93:
+		mmDollar = mmS[mmpt-9 : mmpt+1]
+//line src/martian/syntax/grammar.y:489
+		{
+			{
+				mmDollar[3].modifiers.Mapped = true
+				mmVAL.call = &CallStm{newAstSpan(mmDollar[1].loc, mmDollar[9].loc, mmDollar[1].locmap), mmDollar[3].modifiers, mmDollar[6].val, mmDollar[4].val, mmDollar[8].bindings}
+			}
+		}
+	case 94:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:317
+//line src/martian/syntax/grammar.y:494
 		{
 			{
 				mmDollar[1].call.Modifiers.Bindings = mmDollar[4].bindings
+				mmDollar[1].call.Node = newAstSpan(mmDollar[1].loc, mmDollar[5].loc, mmDollar[1].locmap)
 				mmVAL.call = mmDollar[1].call
 			}
 		}
-	case 59:
+	case 95:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:325
+//line src/martian/syntax/grammar.y:503
 		{
 			{
 				mmVAL.modifiers = &Modifiers{}
 			}
 		}
-	case 60:
+	case 96:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:327
+//line src/martian/syntax/grammar.y:505
 		{
 			{
 				mmVAL.modifiers.Local = true
 			}
 		}
-	case 61:
+	case 97:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:329
+//line src/martian/syntax/grammar.y:507
 		{
 			{
 				mmVAL.modifiers.Preflight = true
 			}
 		}
-	case 62:
+	case 98:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:331
+//line src/martian/syntax/grammar.y:509
 		{
 			{
 				mmVAL.modifiers.Volatile = true
 			}
 		}
-	case 63:
+	case 99:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:336
+//line src/martian/syntax/grammar.y:514
 		{
 			{
 				mmVAL.bindings = &BindStms{NewAstNode(mmDollar[0].loc, mmDollar[0].locmap), []*BindStm{}, map[string]*BindStm{}}
 			}
 		}
-	case 64:
+	case 100:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:338
+//line src/martian/syntax/grammar.y:516
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 65:
+	case 101:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:346
+//line src/martian/syntax/grammar.y:524
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, false, ""}
 			}
 		}
-	case 66:
+	case 102:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:348
+//line src/martian/syntax/grammar.y:526
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, false, ""}
 			}
 		}
-	case 67:
+	case 103:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:350
+//line src/martian/syntax/grammar.y:528
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, false, ""}
 			}
 		}
-	case 68:
+	case 104:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:352
+//line src/martian/syntax/grammar.y:530
+		{
+			{
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, false, ""}
+			}
+		}
+	case 105:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+//line src/martian/syntax/grammar.y:532
+		{
+			{
+				i, _ := strconv.ParseInt(mmDollar[3].val, 0, 64)
+				exp := &ValExp{Node: NewAstNode(mmDollar[3].loc, mmDollar[3].locmap), Kind: KindInt, Value: i}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, exp, false, false, ""}
+			}
+		}
+	case 106:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+//line src/martian/syntax/grammar.y:538
+		{
+			{
+				i, _ := strconv.ParseInt(mmDollar[3].val, 0, 64)
+				exp := &ValExp{Node: NewAstNode(mmDollar[3].loc, mmDollar[3].locmap), Kind: KindInt, Value: i}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, exp, false, false, ""}
+			}
+		}
+	case 107:
+		mmDollar = mmS[mmpt-4 : mmpt+1]
+//line src/martian/syntax/grammar.y:544
+		{
+			{
+				exp := &ValExp{Node: NewAstNode(mmDollar[3].loc, mmDollar[3].locmap), Kind: KindString, Value: unquote(mmDollar[3].val)}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, exp, false, false, ""}
+			}
+		}
+	case 109:
+		mmDollar = mmS[mmpt-3 : mmpt+1]
+//line src/martian/syntax/grammar.y:552
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, ""}
+				if disj, ok := mmDollar[1].exp.(*OrExp); ok {
+					disj.Refs = append(disj.Refs, mmDollar[3].exp.(*RefExp))
+					mmVAL.exp = disj
+				} else {
+					mmVAL.exp = &OrExp{*mmDollar[1].exp.getNode(), KindOr, []*RefExp{mmDollar[1].exp.(*RefExp), mmDollar[3].exp.(*RefExp)}}
+				}
 			}
 		}
-	case 69:
+	case 110:
 		mmDollar = mmS[mmpt-0 : mmpt+1]
-		//line src/martian/syntax/grammar.y:356
+//line src/martian/syntax/grammar.y:565
 		{
 			{
 				mmVAL.bindings = &BindStms{NewAstNode(mmDollar[0].loc, mmDollar[0].locmap), []*BindStm{}, map[string]*BindStm{}}
 			}
 		}
-	case 70:
+	case 111:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:358
+//line src/martian/syntax/grammar.y:567
 		{
 			{
 				mmDollar[1].bindings.List = append(mmDollar[1].bindings.List, mmDollar[2].binding)
 				mmVAL.bindings = mmDollar[1].bindings
 			}
 		}
-	case 71:
+	case 113:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:366
+//line src/martian/syntax/grammar.y:576
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[3].exp, false, false, ""}
 			}
 		}
-	case 72:
+	case 114:
+		mmDollar = mmS[mmpt-5 : mmpt+1]
+//line src/martian/syntax/grammar.y:578
+		{
+			{
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[5].loc, mmDollar[1].locmap), mmDollar[1].val, mmDollar[4].exp, false, true, ""}
+			}
+		}
+	case 115:
 		mmDollar = mmS[mmpt-8 : mmpt+1]
-		//line src/martian/syntax/grammar.y:368
+//line src/martian/syntax/grammar.y:580
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[5].exps}, true, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[8].loc, mmDollar[1].locmap), mmDollar[1].val, &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[5].exps}, true, false, ""}
 			}
 		}
-	case 73:
+	case 116:
 		mmDollar = mmS[mmpt-7 : mmpt+1]
-		//line src/martian/syntax/grammar.y:370
+//line src/martian/syntax/grammar.y:582
 		{
 			{
-				mmVAL.binding = &BindStm{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), mmDollar[1].val, &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[5].exps}, true, ""}
+				mmVAL.binding = &BindStm{newAstSpan(mmDollar[1].loc, mmDollar[7].loc, mmDollar[1].locmap), mmDollar[1].val, &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[5].exps}, true, false, ""}
 			}
 		}
-	case 74:
+	case 117:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:375
+//line src/martian/syntax/grammar.y:587
 		{
 			{
 				mmVAL.exps = append(mmDollar[1].exps, mmDollar[3].exp)
 			}
 		}
-	case 75:
+	case 118:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:377
+//line src/martian/syntax/grammar.y:589
 		{
 			{
 				mmVAL.exps = []Exp{mmDollar[1].exp}
 			}
 		}
-	case 76:
+	case 119:
 		mmDollar = mmS[mmpt-5 : mmpt+1]
-		//line src/martian/syntax/grammar.y:382
+//line src/martian/syntax/grammar.y:594
 		{
 			{
 				mmDollar[1].kvpairs[unquote(mmDollar[3].val)] = mmDollar[5].exp
 				mmVAL.kvpairs = mmDollar[1].kvpairs
 			}
 		}
-	case 77:
+	case 120:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:387
+//line src/martian/syntax/grammar.y:599
 		{
 			{
 				mmVAL.kvpairs = map[string]Exp{unquote(mmDollar[1].val): mmDollar[3].exp}
 			}
 		}
-	case 80:
+	case 123:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:396
+//line src/martian/syntax/grammar.y:608
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[2].exps}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[3].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[2].exps}
 			}
 		}
-	case 81:
+	case 124:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:398
+//line src/martian/syntax/grammar.y:610
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[2].exps}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), Kind: KindArray, Value: mmDollar[2].exps}
 			}
 		}
-	case 82:
+	case 125:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:400
+//line src/martian/syntax/grammar.y:612
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindArray, Value: []Exp{}}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[2].loc, mmDollar[1].locmap), Kind: KindArray, Value: []Exp{}}
 			}
 		}
-	case 83:
+	case 126:
 		mmDollar = mmS[mmpt-2 : mmpt+1]
-		//line src/martian/syntax/grammar.y:402
+//line src/martian/syntax/grammar.y:614
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindMap, Value: map[string]interface{}{}}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[2].loc, mmDollar[1].locmap), Kind: KindMap, Value: map[string]interface{}{}}
 			}
 		}
-	case 84:
+	case 127:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:404
+//line src/martian/syntax/grammar.y:616
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindMap, Value: mmDollar[2].kvpairs}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[3].loc, mmDollar[1].locmap), Kind: KindMap, Value: mmDollar[2].kvpairs}
 			}
 		}
-	case 85:
+	case 128:
 		mmDollar = mmS[mmpt-4 : mmpt+1]
-		//line src/martian/syntax/grammar.y:406
+//line src/martian/syntax/grammar.y:618
 		{
 			{
-				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindMap, Value: mmDollar[2].kvpairs}
+				mmVAL.exp = &ValExp{Node: newAstSpan(mmDollar[1].loc, mmDollar[4].loc, mmDollar[1].locmap), Kind: KindMap, Value: mmDollar[2].kvpairs}
 			}
 		}
-	case 86:
+	case 129:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:408
+//line src/martian/syntax/grammar.y:620
 		{
 			{ // Lexer guarantees parseable float strings.
 				f, _ := strconv.ParseFloat(mmDollar[1].val, 64)
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindFloat, Value: f}
 			}
 		}
-	case 87:
+	case 130:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:413
+//line src/martian/syntax/grammar.y:625
 		{
 			{ // Lexer guarantees parseable int strings.
 				i, _ := strconv.ParseInt(mmDollar[1].val, 0, 64)
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindInt, Value: i}
 			}
 		}
-	case 88:
+	case 131:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:418
+//line src/martian/syntax/grammar.y:630
 		{
 			{
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindString, Value: unquote(mmDollar[1].val)}
 			}
 		}
-	case 90:
+	case 133:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:421
+//line src/martian/syntax/grammar.y:633
 		{
 			{
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindNull, Value: nil}
 			}
 		}
-	case 91:
+	case 134:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:426
+//line src/martian/syntax/grammar.y:638
 		{
 			{
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindBool, Value: true}
 			}
 		}
-	case 92:
+	case 135:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:428
+//line src/martian/syntax/grammar.y:640
 		{
 			{
 				mmVAL.exp = &ValExp{Node: NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), Kind: KindBool, Value: false}
 			}
 		}
-	case 93:
+	case 136:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:432
+//line src/martian/syntax/grammar.y:644
 		{
 			{
 				mmVAL.exp = &RefExp{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), KindCall, mmDollar[1].val, mmDollar[3].val}
 			}
 		}
-	case 94:
+	case 137:
 		mmDollar = mmS[mmpt-1 : mmpt+1]
-		//line src/martian/syntax/grammar.y:434
+//line src/martian/syntax/grammar.y:646
 		{
 			{
 				mmVAL.exp = &RefExp{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), KindCall, mmDollar[1].val, "default"}
 			}
 		}
-	case 95:
+	case 138:
 		mmDollar = mmS[mmpt-3 : mmpt+1]
-		//line src/martian/syntax/grammar.y:436
+//line src/martian/syntax/grammar.y:648
 		{
 			{
 				mmVAL.exp = &RefExp{NewAstNode(mmDollar[1].loc, mmDollar[1].locmap), KindSelf, mmDollar[3].val, ""}
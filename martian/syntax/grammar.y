@@ -11,17 +11,13 @@ import (
     "strconv"
     "strings"
 )
-
-func unquote(qs string) string {
-    return strings.Replace(qs, "\"", "", -1)
-}
 %}
 
 %union{
     global    *Ast
     locmap    []FileLoc
     arr       int
-    loc       int
+    loc       tokenLoc
     val       string
     modifiers *Modifiers
     dec       Dec
@@ -30,6 +26,9 @@ func unquote(qs string) string {
     outparam  *OutParam
     params    *Params
     res       *Resources
+    retains   *RetainParams
+    resexp    ResourceExp
+    resexps   []ResourceExp
     par_tuple paramsTuple
     src       *SrcParam
     exp       Exp
@@ -54,7 +53,7 @@ func unquote(qs string) string {
 %type <params>    in_param_list out_param_list
 %type <par_tuple> split_param_list
 %type <src>       src_stm
-%type <exp>       exp ref_exp val_exp bool_exp
+%type <exp>       exp ref_exp val_exp bool_exp disabled_exp
 %type <exps>      exp_list
 %type <kvpairs>   kvpair_list
 %type <call>      call_stm
@@ -63,19 +62,26 @@ func unquote(qs string) string {
 %type <bindings>  bind_stm_list modifier_stm_list
 %type <retstm>    return_stm
 %type <res>       resources resource_list
+%type <retains>   retains retain_list
+%type <resexp>    res_exp res_compound
+%type <resexps>   res_exp_list
 
 %token SKIP COMMENT INVALID
 %token SEMICOLON COLON COMMA EQUALS
-%token LBRACKET RBRACKET LPAREN RPAREN LBRACE RBRACE
+%token LBRACKET RBRACKET LPAREN RPAREN LBRACE RBRACE LANGLE RANGLE
 %token SWEEP RETURN SELF
-%token <val> FILETYPE STAGE PIPELINE CALL SPLIT USING
-%token <val> LOCAL PREFLIGHT VOLATILE DISABLED
+%token <val> FILETYPE STRUCT STAGE PIPELINE CALL SPLIT USING
+%token <val> LOCAL PREFLIGHT VOLATILE DISABLED OR
 %token IN OUT SRC AS
-%token <val> THREADS MEM_GB SPECIAL
+%token <val> THREADS MEM_GB SPECIAL TIMEOUT RETRIES RETRY_BACKOFF RETRY_ON RETAIN
 %token <val> ID LITSTRING NUM_FLOAT NUM_INT DOT
 %token <val> PY GO SH EXEC COMPILED
 %token <val> MAP INT STRING FLOAT PATH BOOL TRUE FALSE NULL DEFAULT
 %token <val> PREPROCESS_DIRECTIVE
+%token PLUS MINUS STAR SLASH
+
+%left PLUS MINUS
+%left STAR SLASH
 
 %%
 file
@@ -133,18 +139,34 @@ dec_list
         {{ $$ = []Dec{$1} }}
     ;
 
+// A declaration which fails to parse is skipped through the next semicolon,
+// closing paren or closing brace, or up to the start of the next
+// declaration, so that parsing can continue and report later errors.  The
+// error itself is recorded by the lexer.
 dec
     : FILETYPE id_list SEMICOLON
-        {{ $$ = &UserType{NewAstNode($<loc>2, $<locmap>2), $2} }}
+        {{ $$ = &UserType{newAstSpan($<loc>2, $<loc>3, $<locmap>2), $2} }}
+    | STRUCT id_list LPAREN in_param_list RPAREN
+        {{ $$ = &StructType{newAstSpan($<loc>2, $<loc>5, $<locmap>2), $2, $4} }}
     | stage
-    | PIPELINE id LPAREN in_param_list out_param_list RPAREN LBRACE call_stm_list return_stm RBRACE
-        {{ $$ = &Pipeline{NewAstNode($<loc>2, $<locmap>2), $2, $4, $5, $8, &Callables{[]Callable{}, map[string]Callable{}}, $9} }}
+    | PIPELINE id_list LPAREN in_param_list out_param_list RPAREN LBRACE call_stm_list return_stm RBRACE
+        {{ $$ = &Pipeline{newAstSpan($<loc>2, $<loc>10, $<locmap>2), $2, $4, $5, $8, &Callables{[]Callable{}, map[string]Callable{}}, $9} }}
+    | error SEMICOLON
+        {{ $$ = nil }}
+    | error RBRACE
+        {{ $$ = nil }}
+    | error RPAREN
+        {{ $$ = nil }}
+    | error dec
+        {{ $$ = $2 }}
     ;
 
 stage
-    : STAGE id LPAREN in_param_list out_param_list src_stm RPAREN split_param_list resources
+    : STAGE id_list LPAREN in_param_list out_param_list src_stm RPAREN split_param_list resources retains
         {{ $$ = &Stage{
-                Node: NewAstNode($<loc>2, $<locmap>2),
+                Node: newAstSpan($<loc>2,
+                    lastLoc($<loc>7, $<loc>8, $<loc>9, $<loc>10),
+                    $<locmap>2),
                 Id:  $2,
                 InParams: $4,
                 OutParams: $5,
@@ -153,19 +175,93 @@ stage
                 ChunkOuts: $8.Outs,
                 Split: $8.Present,
                 Resources: $9,
+                Retain: $10,
            } }}
    ;
 
+// The loc of the optional clauses at the end of a stage is that of their
+// closing paren, or the zero value if they are absent, so that the stage can
+// find the end of its declaration.
 resources
     :
-        {{ $$ = nil }}
+        {{
+             $$ = nil
+             $<loc>$ = tokenLoc{}
+         }}
     | USING LPAREN resource_list RPAREN
         {{
-             $3.Node = NewAstNode($<loc>1, $<locmap>1)
+             $3.Node = newAstSpan($<loc>1, $<loc>4, $<locmap>1)
+             $$ = $3
+             $<loc>$ = $<loc>4
+         }}
+    ;
+
+res_exp
+    : res_compound
+    | NUM_INT
+        {{  // Lexer guarantees parseable int strings.
+            i, _ := strconv.ParseInt($1, 0, 64)
+            $$ = &ResourceNum{NewAstNode($<loc>1, $<locmap>1), float64(i)}
+        }}
+    | NUM_FLOAT
+        {{  // Lexer guarantees parseable float strings.
+            f, _ := strconv.ParseFloat($1, 64)
+            $$ = &ResourceNum{NewAstNode($<loc>1, $<locmap>1), f}
+        }}
+    ;
+
+// Resource expressions other than bare numeric constants.
+res_compound
+    : res_exp PLUS res_exp
+        {{ $$ = &ResourceBinExp{NewAstNode($<loc>2, $<locmap>2), "+", $1, $3} }}
+    | res_exp MINUS res_exp
+        {{ $$ = &ResourceBinExp{NewAstNode($<loc>2, $<locmap>2), "-", $1, $3} }}
+    | res_exp STAR res_exp
+        {{ $$ = &ResourceBinExp{NewAstNode($<loc>2, $<locmap>2), "*", $1, $3} }}
+    | res_exp SLASH res_exp
+        {{ $$ = &ResourceBinExp{NewAstNode($<loc>2, $<locmap>2), "/", $1, $3} }}
+    | LPAREN res_exp RPAREN
+        {{ $$ = $2 }}
+    | SELF DOT id
+        {{ $$ = &ResourceRef{NewAstNode($<loc>1, $<locmap>1), $3} }}
+    | id LPAREN res_exp_list RPAREN
+        {{ $$ = &ResourceFunc{NewAstNode($<loc>1, $<locmap>1), $1, $3} }}
+    ;
+
+res_exp_list
+    : res_exp
+        {{ $$ = []ResourceExp{$1} }}
+    | res_exp_list COMMA res_exp
+        {{ $$ = append($1, $3) }}
+    ;
+
+retains
+    :
+        {{
+             $$ = nil
+             $<loc>$ = tokenLoc{}
+         }}
+    | RETAIN LPAREN retain_list RPAREN
+        {{
+             $3.Node = newAstSpan($<loc>1, $<loc>4, $<locmap>1)
              $$ = $3
+             $<loc>$ = $<loc>4
          }}
     ;
 
+retain_list
+    :
+        {{ $$ = &RetainParams{} }}
+    | retain_list id COMMA
+        {{
+            $1.Params = append($1.Params, &RetainParam{
+                Node: NewAstNode($<loc>2, $<locmap>2),
+                Id: $2,
+            })
+            $$ = $1
+        }}
+    ;
+
 resource_list
     :
         {{ $$ = &Resources{} }}
@@ -177,6 +273,13 @@ resource_list
             $1.Threads = int(i)
             $$ = $1
         }}
+    | resource_list THREADS EQUALS res_compound COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.ThreadNode = &n
+            $1.ThreadExp = $4
+            $$ = $1
+        }}
     | resource_list MEM_GB EQUALS NUM_INT COMMA
         {{
             n := NewAstNode($<loc>2, $<locmap>2)
@@ -185,11 +288,49 @@ resource_list
             $1.MemGB = int(i)
             $$ = $1
         }}
+    | resource_list MEM_GB EQUALS res_compound COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.MemNode = &n
+            $1.MemExp = $4
+            $$ = $1
+        }}
     | resource_list SPECIAL EQUALS LITSTRING COMMA
         {{
             n := NewAstNode($<loc>2, $<locmap>2)
             $1.SpecialNode = &n
-            $1.Special = $4
+            $1.Special = unquote($4)
+            $$ = $1
+        }}
+    | resource_list TIMEOUT EQUALS NUM_INT COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.TimeoutNode = &n
+            i, _ := strconv.ParseInt($4, 0, 64)
+            $1.Timeout = int(i)
+            $$ = $1
+        }}
+    | resource_list RETRIES EQUALS NUM_INT COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.RetriesNode = &n
+            i, _ := strconv.ParseInt($4, 0, 64)
+            $1.Retries = int(i)
+            $$ = $1
+        }}
+    | resource_list RETRY_BACKOFF EQUALS NUM_INT COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.BackoffNode = &n
+            i, _ := strconv.ParseInt($4, 0, 64)
+            $1.Backoff = int(i)
+            $$ = $1
+        }}
+    | resource_list RETRY_ON EQUALS LITSTRING COMMA
+        {{
+            n := NewAstNode($<loc>2, $<locmap>2)
+            $1.RetryOnNode = &n
+            $1.RetryOn = unquote($4)
             $$ = $1
         }}
     ;
@@ -212,16 +353,25 @@ in_param_list
         {{ $$ = &Params{[]Param{}, map[string]Param{}} }}
     | in_param_list in_param
         {{
-            $1.List = append($1.List, $2)
+            if $2 != nil {
+                $1.List = append($1.List, $2)
+            }
             $$ = $1
         }}
     ;
 
+// A parameter which fails to parse is skipped through the next comma.
 in_param
     : IN type arr_list id help COMMA
-        {{ $$ = &InParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, $4, unquote($5), false } }}
+        {{ $$ = &InParam{newAstSpan($<loc>1, $<loc>6, $<locmap>1), $2, $3, $4, unquote($5), nil, false, nil } }}
     | IN type arr_list id COMMA
-        {{ $$ = &InParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, $4, "", false } }}
+        {{ $$ = &InParam{newAstSpan($<loc>1, $<loc>5, $<locmap>1), $2, $3, $4, "", nil, false, nil } }}
+    | IN type arr_list id EQUALS val_exp help COMMA
+        {{ $$ = &InParam{newAstSpan($<loc>1, $<loc>8, $<locmap>1), $2, $3, $4, unquote($7), $6, false, nil } }}
+    | IN type arr_list id EQUALS val_exp COMMA
+        {{ $$ = &InParam{newAstSpan($<loc>1, $<loc>7, $<locmap>1), $2, $3, $4, "", $6, false, nil } }}
+    | IN error COMMA
+        {{ $$ = nil }}
     ;
 
 out_param_list
@@ -229,30 +379,34 @@ out_param_list
         {{ $$ = &Params{[]Param{}, map[string]Param{}} }}
     | out_param_list out_param
         {{
-            $1.List = append($1.List, $2)
+            if $2 != nil {
+                $1.List = append($1.List, $2)
+            }
             $$ = $1
         }}
     ;
 
 out_param
     : OUT type arr_list COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, "default", "", "", false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $2, $3, "default", "", "", false, nil } }}
     | OUT type arr_list help COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, "default", unquote($4), "", false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>5, $<locmap>1), $2, $3, "default", unquote($4), "", false, nil } }}
     | OUT type arr_list help outname COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, "default", unquote($4), unquote($5), false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>6, $<locmap>1), $2, $3, "default", unquote($4), unquote($5), false, nil } }}
     | OUT type arr_list id COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, $4, "", "", false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>5, $<locmap>1), $2, $3, $4, "", "", false, nil } }}
     | OUT type arr_list id help COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, $4, unquote($5), "", false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>6, $<locmap>1), $2, $3, $4, unquote($5), "", false, nil } }}
     | OUT type arr_list id help outname COMMA
-        {{ $$ = &OutParam{NewAstNode($<loc>1, $<locmap>1), $2, $3, $4, unquote($5), unquote($6), false } }}
+        {{ $$ = &OutParam{newAstSpan($<loc>1, $<loc>7, $<locmap>1), $2, $3, $4, unquote($5), unquote($6), false, nil } }}
+    | OUT error COMMA
+        {{ $$ = nil }}
     ;
 
 src_stm
     : SRC src_lang LITSTRING COMMA
         {{ stagecodeParts := strings.Split(unquote($3), " ")
-	   $$ = &SrcParam{NewAstNode($<loc>1, $<locmap>1), StageLanguage($2), stagecodeParts[0], stagecodeParts[1:]} }}
+	   $$ = &SrcParam{newAstSpan($<loc>1, $<loc>4, $<locmap>1), StageLanguage($2), stagecodeParts[0], stagecodeParts[1:]} }}
     ;
 
 help
@@ -270,6 +424,8 @@ type
     | FLOAT
     | BOOL
     | MAP
+    | MAP LANGLE type arr_list RANGLE
+        {{ $$ = $1 + "<" + $3 + strings.Repeat("[]", $4) + ">" }}
     | id_list
     ;
 
@@ -289,33 +445,55 @@ split_param_list
                 &Params{[]Param{}, map[string]Param{}},
                 &Params{[]Param{}, map[string]Param{}},
             }
+            $<loc>$ = tokenLoc{}
         }}
     | SPLIT USING LPAREN in_param_list out_param_list RPAREN
-        {{ $$ = paramsTuple{true, $4, $5} }}
+        {{
+            $$ = paramsTuple{true, $4, $5}
+            $<loc>$ = $<loc>6
+        }}
     | SPLIT LPAREN in_param_list out_param_list RPAREN
-        {{ $$ = paramsTuple{true, $3, $4} }}
+        {{
+            $$ = paramsTuple{true, $3, $4}
+            $<loc>$ = $<loc>5
+        }}
     ;
 
 return_stm
     : RETURN LPAREN bind_stm_list RPAREN
-        {{ $$ = &ReturnStm{NewAstNode($<loc>1, $<locmap>1), $3} }}
+        {{ $$ = &ReturnStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $3} }}
     ;
 
+// A call which fails to parse is skipped through the next closing paren.
 call_stm_list
     : call_stm_list call_stm
         {{ $$ = append($1, $2) }}
     | call_stm
         {{ $$ = []*CallStm{$1} }}
+    | call_stm_list error RPAREN
+    | error RPAREN
+        {{ $$ = []*CallStm{} }}
     ;
 
 call_stm
-    : CALL modifiers id LPAREN bind_stm_list RPAREN
-        {{ $$ = &CallStm{NewAstNode($<loc>1, $<locmap>1), $2, $3, $3, $5} }}
-    | CALL modifiers id AS id LPAREN bind_stm_list RPAREN
-        {{ $$ = &CallStm{NewAstNode($<loc>1, $<locmap>1), $2, $5, $3, $7} }}
+    : CALL modifiers id_list LPAREN bind_stm_list RPAREN
+        {{ $$ = &CallStm{newAstSpan($<loc>1, $<loc>6, $<locmap>1), $2, unqualified($3), $3, $5} }}
+    | CALL modifiers id_list AS id LPAREN bind_stm_list RPAREN
+        {{ $$ = &CallStm{newAstSpan($<loc>1, $<loc>8, $<locmap>1), $2, $5, $3, $7} }}
+    | MAP CALL modifiers id_list LPAREN bind_stm_list RPAREN
+        {{
+            $3.Mapped = true
+            $$ = &CallStm{newAstSpan($<loc>1, $<loc>7, $<locmap>1), $3, unqualified($4), $4, $6}
+        }}
+    | MAP CALL modifiers id_list AS id LPAREN bind_stm_list RPAREN
+        {{
+            $3.Mapped = true
+            $$ = &CallStm{newAstSpan($<loc>1, $<loc>9, $<locmap>1), $3, $6, $4, $8}
+        }}
     | call_stm USING LPAREN modifier_stm_list RPAREN
         {{
             $1.Modifiers.Bindings = $4
+            $1.Node = newAstSpan($<loc>1, $<loc>5, $<locmap>1)
             $$ = $1
         }}
     ;
@@ -343,14 +521,45 @@ modifier_stm_list
 
 modifier_stm
     : LOCAL EQUALS bool_exp COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, $3, false, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, $3, false, false, ""} }}
     | PREFLIGHT EQUALS bool_exp COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, $3, false, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, $3, false, false, ""} }}
     | VOLATILE EQUALS bool_exp COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, $3, false, ""} }}
-    | DISABLED EQUALS ref_exp COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, $3, false, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, $3, false, false, ""} }}
+    | DISABLED EQUALS disabled_exp COMMA
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, $3, false, false, ""} }}
+    | RETRIES EQUALS NUM_INT COMMA
+        {{
+            i, _ := strconv.ParseInt($3, 0, 64)
+            exp := &ValExp{Node:NewAstNode($<loc>3, $<locmap>3), Kind: KindInt, Value: i}
+            $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, exp, false, false, ""}
+        }}
+    | RETRY_BACKOFF EQUALS NUM_INT COMMA
+        {{
+            i, _ := strconv.ParseInt($3, 0, 64)
+            exp := &ValExp{Node:NewAstNode($<loc>3, $<locmap>3), Kind: KindInt, Value: i}
+            $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, exp, false, false, ""}
+        }}
+    | RETRY_ON EQUALS LITSTRING COMMA
+        {{
+            exp := &ValExp{Node:NewAstNode($<loc>3, $<locmap>3), Kind: KindString, Value: unquote($3)}
+            $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, exp, false, false, ""}
+        }}
+
+disabled_exp
+    : ref_exp
+    | disabled_exp OR ref_exp
+        {{
+            if disj, ok := $1.(*OrExp); ok {
+                disj.Refs = append(disj.Refs, $3.(*RefExp))
+                $$ = disj
+            } else {
+                $$ = &OrExp{*$1.getNode(), KindOr, []*RefExp{$1.(*RefExp), $3.(*RefExp)}}
+            }
+        }}
+    ;
 
+// A binding which fails to parse is skipped through the next comma.
 bind_stm_list
     :
         {{ $$ = &BindStms{NewAstNode($<loc>0, $<locmap>0), []*BindStm{}, map[string]*BindStm{}} }}
@@ -359,15 +568,18 @@ bind_stm_list
             $1.List = append($1.List, $2)
             $$ = $1
         }}
+    | bind_stm_list error COMMA
     ;
 
 bind_stm
     : id EQUALS exp COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, $3, false, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>4, $<locmap>1), $1, $3, false, false, ""} }}
+    | id EQUALS SPLIT exp COMMA
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>5, $<locmap>1), $1, $4, false, true, ""} }}
     | id EQUALS SWEEP LPAREN exp_list COMMA RPAREN COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $5}, true, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>8, $<locmap>1), $1, &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $5}, true, false, ""} }}
     | id EQUALS SWEEP LPAREN exp_list RPAREN COMMA
-        {{ $$ = &BindStm{NewAstNode($<loc>1, $<locmap>1), $1, &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $5}, true, ""} }}
+        {{ $$ = &BindStm{newAstSpan($<loc>1, $<loc>7, $<locmap>1), $1, &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $5}, true, false, ""} }}
     ;
 
 exp_list
@@ -393,17 +605,17 @@ exp
 
 val_exp
     : LBRACKET exp_list RBRACKET
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $2} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>3, $<locmap>1), Kind: KindArray, Value: $2} }}
     | LBRACKET exp_list COMMA RBRACKET
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: $2} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>4, $<locmap>1), Kind: KindArray, Value: $2} }}
     | LBRACKET RBRACKET
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindArray, Value: []Exp{}} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>2, $<locmap>1), Kind: KindArray, Value: []Exp{}} }}
     | LBRACE RBRACE
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindMap, Value: map[string]interface{}{}} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>2, $<locmap>1), Kind: KindMap, Value: map[string]interface{}{}} }}
     | LBRACE kvpair_list RBRACE
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindMap, Value: $2} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>3, $<locmap>1), Kind: KindMap, Value: $2} }}
     | LBRACE kvpair_list COMMA RBRACE
-        {{ $$ = &ValExp{Node:NewAstNode($<loc>1, $<locmap>1), Kind: KindMap, Value: $2} }}
+        {{ $$ = &ValExp{Node:newAstSpan($<loc>1, $<loc>4, $<locmap>1), Kind: KindMap, Value: $2} }}
     | NUM_FLOAT
         {{  // Lexer guarantees parseable float strings.
             f, _ := strconv.ParseFloat($1, 64)
@@ -441,13 +653,20 @@ id
     | THREADS
     | MEM_GB
     | SPECIAL
+    | TIMEOUT
+    | RETRIES
+    | RETRY_BACKOFF
+    | RETRY_ON
+    | RETAIN
     | DISABLED
+    | OR
     | LOCAL
     | PREFLIGHT
     | VOLATILE
     | EXEC
     | COMPILED
     | FILETYPE
+    | STRUCT
     | SPLIT
     | USING
     ;
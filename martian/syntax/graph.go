@@ -0,0 +1,339 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Static call graphs of pipelines, for documentation.
+
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+type (
+	// The data flow graph of a pipeline.
+	Graph struct {
+		Pipeline string       `json:"pipeline"`
+		Nodes    []*GraphNode `json:"nodes"`
+		Edges    []*GraphEdge `json:"edges"`
+	}
+
+	GraphNode struct {
+		// A unique identifier for the node.  For calls, this is the
+		// partially qualified name, e.g. PIPELINE.SUBPIPELINE.STAGE.
+		// For pipeline inputs and outputs it is in:name or out:name.
+		Id string `json:"id"`
+
+		// The name of the call, input or output.
+		Name string `json:"name"`
+
+		// One of "stage", "pipeline", "input" or "output".
+		Kind string `json:"kind"`
+
+		// For calls, the name of the stage or pipeline being called.
+		Callable string `json:"callable,omitempty"`
+
+		// The id of the pipeline call which contains this node, if the
+		// sub-pipeline was expanded.  Expanded pipeline nodes have no
+		// edges of their own.
+		Parent string `json:"parent,omitempty"`
+	}
+
+	GraphEdge struct {
+		From string `json:"from"`
+
+		// The output of the source call, if the whole output is not used.
+		FromOutput string `json:"from_output,omitempty"`
+
+		To string `json:"to"`
+
+		// The input (or modifier, e.g. disabled) of the destination call.
+		ToInput string `json:"to_input,omitempty"`
+	}
+)
+
+type graphBuilder struct {
+	global   *Ast
+	collapse bool
+	graph    *Graph
+	edges    map[GraphEdge]bool
+}
+
+// The calls of a pipeline being added to the graph.
+type graphScope struct {
+	prefix   string
+	parent   string
+	pipeline *Pipeline
+	calls    map[string]*CallStm
+
+	// The data sources for each input of the pipeline.
+	inputs map[string][]*GraphEdge
+
+	// The data sources for each output of expanded sub-pipeline calls.
+	outputs map[string]map[string][]*GraphEdge
+}
+
+// Build the data flow graph for the named pipeline.  If collapse is true,
+// calls to sub-pipelines are shown as single nodes.  Otherwise the
+// sub-pipeline's calls are included, with their parent set to the
+// sub-pipeline call.
+func (global *Ast) Graph(pipelineId string, collapse bool) (*Graph, error) {
+	pipeline, ok := global.Callables.Table[pipelineId].(*Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a pipeline", pipelineId)
+	}
+	b := graphBuilder{
+		global:   global,
+		collapse: collapse,
+		graph:    &Graph{Pipeline: pipelineId},
+		edges:    make(map[GraphEdge]bool),
+	}
+	scope := b.newScope(pipeline.Id, "", pipeline)
+	for _, param := range pipeline.InParams.List {
+		id := "in:" + param.GetId()
+		b.graph.Nodes = append(b.graph.Nodes, &GraphNode{
+			Id:   id,
+			Name: param.GetId(),
+			Kind: "input",
+		})
+		scope.inputs[param.GetId()] = []*GraphEdge{{From: id}}
+	}
+	b.addCalls(scope)
+	for _, param := range pipeline.OutParams.List {
+		b.graph.Nodes = append(b.graph.Nodes, &GraphNode{
+			Id:   "out:" + param.GetId(),
+			Name: param.GetId(),
+			Kind: "output",
+		})
+	}
+	for _, binding := range pipeline.Ret.Bindings.List {
+		b.addEdges(b.sources(scope, binding.Exp), "out:"+binding.Id, "")
+	}
+	return b.graph, nil
+}
+
+func (b *graphBuilder) newScope(prefix, parent string, pipeline *Pipeline) *graphScope {
+	scope := &graphScope{
+		prefix:   prefix,
+		parent:   parent,
+		pipeline: pipeline,
+		calls:    make(map[string]*CallStm, len(pipeline.Calls)),
+		inputs:   make(map[string][]*GraphEdge),
+		outputs:  make(map[string]map[string][]*GraphEdge),
+	}
+	for _, call := range pipeline.Calls {
+		scope.calls[call.Id] = call
+	}
+	return scope
+}
+
+func (b *graphBuilder) addCalls(scope *graphScope) {
+	for _, call := range scope.pipeline.Calls {
+		callable := b.global.Callables.Table[call.DecId]
+		if _, ok := callable.(*Pipeline); ok && !b.collapse {
+			b.expand(scope, call)
+			continue
+		}
+		id := scope.prefix + "." + call.Id
+		b.graph.Nodes = append(b.graph.Nodes, &GraphNode{
+			Id:       id,
+			Name:     call.Id,
+			Kind:     callable.Type(),
+			Callable: call.DecId,
+			Parent:   scope.parent,
+		})
+		for _, binding := range call.Bindings.List {
+			b.addEdges(b.sources(scope, binding.Exp), id, binding.Id)
+		}
+		if call.Modifiers != nil && call.Modifiers.Bindings != nil {
+			for _, binding := range call.Modifiers.Bindings.List {
+				b.addEdges(b.sources(scope, binding.Exp), id, binding.Id)
+			}
+		}
+	}
+}
+
+// Add the calls of a sub-pipeline to the graph, and get the sources for
+// each of its outputs.
+func (b *graphBuilder) expand(scope *graphScope,
+	call *CallStm) map[string][]*GraphEdge {
+	if outputs := scope.outputs[call.Id]; outputs != nil {
+		return outputs
+	}
+	pipeline := b.global.Callables.Table[call.DecId].(*Pipeline)
+	id := scope.prefix + "." + call.Id
+	b.graph.Nodes = append(b.graph.Nodes, &GraphNode{
+		Id:       id,
+		Name:     call.Id,
+		Kind:     "pipeline",
+		Callable: call.DecId,
+		Parent:   scope.parent,
+	})
+	inner := b.newScope(id, id, pipeline)
+	for _, binding := range call.Bindings.List {
+		inner.inputs[binding.Id] = b.sources(scope, binding.Exp)
+	}
+	outputs := make(map[string][]*GraphEdge, len(pipeline.Ret.Bindings.List))
+	scope.outputs[call.Id] = outputs
+	b.addCalls(inner)
+	for _, binding := range pipeline.Ret.Bindings.List {
+		outputs[binding.Id] = b.sources(inner, binding.Exp)
+	}
+	return outputs
+}
+
+// Get the sources of the data in an expression, as edges with only the From
+// fields set.
+func (b *graphBuilder) sources(scope *graphScope, exp Exp) []*GraphEdge {
+	var result []*GraphEdge
+	forEachRef(exp, func(ref *RefExp) {
+		if ref.Kind == KindSelf {
+			result = append(result, scope.inputs[ref.Id]...)
+			return
+		}
+		call := scope.calls[ref.Id]
+		if call == nil {
+			return
+		}
+		output := ref.OutputId
+		if output == "default" {
+			output = ""
+		}
+		if _, ok := b.global.Callables.Table[call.DecId].(*Pipeline); ok && !b.collapse {
+			outputs := b.expand(scope, call)
+			if output != "" {
+				result = append(result, outputs[output]...)
+			} else {
+				ids := make([]string, 0, len(outputs))
+				for id := range outputs {
+					ids = append(ids, id)
+				}
+				sort.Strings(ids)
+				for _, id := range ids {
+					result = append(result, outputs[id]...)
+				}
+			}
+			return
+		}
+		result = append(result, &GraphEdge{
+			From:       scope.prefix + "." + call.Id,
+			FromOutput: output,
+		})
+	})
+	return result
+}
+
+func (b *graphBuilder) addEdges(sources []*GraphEdge, to, input string) {
+	for _, src := range sources {
+		edge := GraphEdge{
+			From:       src.From,
+			FromOutput: src.FromOutput,
+			To:         to,
+			ToInput:    input,
+		}
+		if !b.edges[edge] {
+			b.edges[edge] = true
+			b.graph.Edges = append(b.graph.Edges, &edge)
+		}
+	}
+}
+
+//
+// Rendering
+//
+
+func (g *Graph) children() map[string][]*GraphNode {
+	children := make(map[string][]*GraphNode)
+	for _, node := range g.Nodes {
+		children[node.Parent] = append(children[node.Parent], node)
+	}
+	return children
+}
+
+func (edge *GraphEdge) label() string {
+	if edge.ToInput != "" {
+		return edge.ToInput
+	}
+	return edge.FromOutput
+}
+
+// Render the graph in graphviz dot format.
+func (g *Graph) Dot() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %q {\n", g.Pipeline)
+	children := g.children()
+	var writeNodes func(parent, indent string)
+	writeNodes = func(parent, indent string) {
+		for _, node := range children[parent] {
+			if len(children[node.Id]) > 0 {
+				fmt.Fprintf(&buf, "%ssubgraph %q {\n", indent, "cluster_"+node.Id)
+				fmt.Fprintf(&buf, "%s    label=%q;\n", indent, node.Name)
+				writeNodes(node.Id, indent+"    ")
+				fmt.Fprintf(&buf, "%s}\n", indent)
+				continue
+			}
+			shape := "box"
+			switch node.Kind {
+			case "input":
+				shape = "invhouse"
+			case "output":
+				shape = "house"
+			case "pipeline":
+				shape = "box3d"
+			}
+			fmt.Fprintf(&buf, "%s%q [label=%q, shape=%s];\n",
+				indent, node.Id, node.Name, shape)
+		}
+	}
+	writeNodes("", "    ")
+	for _, edge := range g.Edges {
+		if label := edge.label(); label != "" {
+			fmt.Fprintf(&buf, "    %q -> %q [label=%q];\n", edge.From, edge.To, label)
+		} else {
+			fmt.Fprintf(&buf, "    %q -> %q;\n", edge.From, edge.To)
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Render the graph as a mermaid flowchart.
+func (g *Graph) Mermaid() string {
+	// Mermaid ids cannot contain dots or colons.
+	ids := make(map[string]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node.Id] = fmt.Sprintf("n%d", i)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+	children := g.children()
+	var writeNodes func(parent, indent string)
+	writeNodes = func(parent, indent string) {
+		for _, node := range children[parent] {
+			id := ids[node.Id]
+			if len(children[node.Id]) > 0 {
+				fmt.Fprintf(&buf, "%ssubgraph %s [%q]\n", indent, id, node.Name)
+				writeNodes(node.Id, indent+"    ")
+				fmt.Fprintf(&buf, "%send\n", indent)
+				continue
+			}
+			switch node.Kind {
+			case "input", "output":
+				fmt.Fprintf(&buf, "%s%s([%q])\n", indent, id, node.Name)
+			case "pipeline":
+				fmt.Fprintf(&buf, "%s%s[[%q]]\n", indent, id, node.Name)
+			default:
+				fmt.Fprintf(&buf, "%s%s[%q]\n", indent, id, node.Name)
+			}
+		}
+	}
+	writeNodes("", "    ")
+	for _, edge := range g.Edges {
+		if label := edge.label(); label != "" {
+			fmt.Fprintf(&buf, "    %s -->|%s| %s\n", ids[edge.From], label, ids[edge.To])
+		} else {
+			fmt.Fprintf(&buf, "    %s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const graphSrc = `
+filetype bam;
+filetype json;
+
+stage SORT(
+    in  bam   reads,
+    out bam   sorted,
+    src py    "stages/sort",
+)
+
+stage COUNT(
+    in  bam   reads,
+    out int   count,
+    src py    "stages/count",
+)
+
+stage REPORT(
+    in  int   count,
+    in  int   min_count,
+    out json  report,
+    src py    "stages/report",
+)
+
+pipeline INNER(
+    in  int   count,
+    in  int   min_count,
+    out json  report,
+)
+{
+    call REPORT(
+        count     = self.count,
+        min_count = self.min_count,
+    )
+
+    return (
+        report = REPORT.report,
+    )
+}
+
+pipeline OUTER(
+    in  bam   reads,
+    in  bool  skip,
+    out json  report,
+)
+{
+    call SORT(
+        reads = self.reads,
+    )
+
+    call COUNT(
+        reads = SORT.sorted,
+    ) using (
+        disabled = self.skip,
+    )
+
+    call INNER(
+        count     = COUNT.count,
+        min_count = 10,
+    )
+
+    return (
+        report = INNER.report,
+    )
+}
+`
+
+func graphEdges(g *Graph) string {
+	var buf bytes.Buffer
+	for _, edge := range g.Edges {
+		buf.WriteString(edge.From)
+		if edge.FromOutput != "" {
+			buf.WriteString("." + edge.FromOutput)
+		}
+		buf.WriteString(" -> " + edge.To)
+		if edge.ToInput != "" {
+			buf.WriteString("." + edge.ToInput)
+		}
+		buf.WriteRune('\n')
+	}
+	return buf.String()
+}
+
+func TestGraph(t *testing.T) {
+	ast := testGood(t, graphSrc)
+	if ast == nil {
+		return
+	}
+	g, err := ast.Graph("OUTER", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `in:reads -> OUTER.SORT.reads
+OUTER.SORT.sorted -> OUTER.COUNT.reads
+in:skip -> OUTER.COUNT.disabled
+OUTER.COUNT.count -> OUTER.INNER.REPORT.count
+OUTER.INNER.REPORT.report -> out:report
+`; graphEdges(g) != expect {
+		t.Errorf("Expected edges\n%s\ngot\n%s", expect, graphEdges(g))
+	}
+	if len(g.Nodes) != 7 {
+		t.Errorf("Expected 7 nodes, got %d", len(g.Nodes))
+	} else if n := g.Nodes[5]; n.Id != "OUTER.INNER.REPORT" || n.Parent != "OUTER.INNER" {
+		t.Errorf("Expected REPORT inside INNER, got %#v", n)
+	}
+	dot := g.Dot()
+	if !strings.Contains(dot, `
+    subgraph "cluster_OUTER.INNER" {
+        label="INNER";
+        "OUTER.INNER.REPORT" [label="REPORT", shape=box];
+    }
+`) {
+		t.Errorf("Missing cluster in\n%s", dot)
+	}
+	mermaid := g.Mermaid()
+	if !strings.Contains(mermaid, "    n3 -->|count| n5\n") {
+		t.Errorf("Missing edge in\n%s", mermaid)
+	}
+}
+
+func TestGraphCollapsed(t *testing.T) {
+	ast := testGood(t, graphSrc)
+	if ast == nil {
+		return
+	}
+	g, err := ast.Graph("OUTER", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `in:reads -> OUTER.SORT.reads
+OUTER.SORT.sorted -> OUTER.COUNT.reads
+in:skip -> OUTER.COUNT.disabled
+OUTER.COUNT.count -> OUTER.INNER.count
+OUTER.INNER.report -> out:report
+`; graphEdges(g) != expect {
+		t.Errorf("Expected edges\n%s\ngot\n%s", expect, graphEdges(g))
+	}
+	if !strings.Contains(g.Dot(), `"OUTER.INNER" [label="INNER", shape=box3d];`) {
+		t.Errorf("Missing collapsed pipeline in\n%s", g.Dot())
+	}
+	if _, err := ast.Graph("SORT", false); err == nil {
+		t.Error("Expected an error graphing a stage.")
+	}
+}
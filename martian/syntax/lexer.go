@@ -27,7 +27,7 @@ var rules = []*rule{
 	// Order matters.
 	newRule("\\s+", SKIP),      // whitespace
 	newRule("#.*\\n", COMMENT), // Python-style comments
-	newRule(`(?m:^@include\s+"[^\"]+")`, PREPROCESS_DIRECTIVE),
+	newRule(`(?m:^@(?:include|import)\s+"[^\"]+"(?:[ \t]+as[ \t]+\w+|[ \t]*\([^)]*\))?)`, PREPROCESS_DIRECTIVE),
 	newRule("=", EQUALS),
 	newRule("\\(", LPAREN),
 	newRule("\\)", RPAREN),
@@ -35,12 +35,16 @@ var rules = []*rule{
 	newRule("}", RBRACE),
 	newRule("\\[", LBRACKET),
 	newRule("\\]", RBRACKET),
+	newRule("<", LANGLE),
+	newRule(">", RANGLE),
 	newRule(":", COLON),
 	newRule(";", SEMICOLON),
 	newRule(",", COMMA),
 	newRule("\\.", DOT),
-	newRule("\"[^\\\"]*\"", LITSTRING), // double-quoted strings. escapes not supported
+	// Double-quoted strings, with JSON escapes.  Literal newlines are allowed.
+	newRule(`"(?:[^"\\]|\\["\\/bfnrt]|\\u[0-9a-fA-F]{4})*"`, LITSTRING),
 	newRule("filetype\\b", FILETYPE),
+	newRule("struct\\b", STRUCT),
 	newRule("stage\\b", STAGE),
 	newRule("pipeline\\b", PIPELINE),
 	newRule("call\\b", CALL),
@@ -48,9 +52,15 @@ var rules = []*rule{
 	newRule(preflight+"\\b", PREFLIGHT),
 	newRule(volatile+"\\b", VOLATILE),
 	newRule(disabled+"\\b", DISABLED),
+	newRule("or\\b", OR),
 	newRule("threads\\b", THREADS),
 	newRule("mem_?gb\\b", MEM_GB),
 	newRule("special\\b", SPECIAL),
+	newRule("timeout\\b", TIMEOUT),
+	newRule("retries\\b", RETRIES),
+	newRule("retry_backoff\\b", RETRY_BACKOFF),
+	newRule("retry_on\\b", RETRY_ON),
+	newRule("retain\\b", RETAIN),
 	newRule("sweep\\b", SWEEP),
 	newRule("split\\b", SPLIT),
 	newRule("using\\b", USING),
@@ -79,17 +89,36 @@ var rules = []*rule{
 	newRule("-?[0-9]+\\.[0-9]+\\b", NUM_FLOAT),                   // support exponential
 	newRule("-?[0-9]+(\\.[0-9]+)?[eE][-+]?[0-9]+\\b", NUM_FLOAT), // support exponential
 	newRule("-?[0-9]+\\b", NUM_INT),
+	newRule("\\+", PLUS),
+	newRule("-", MINUS),
+	newRule("\\*", STAR),
+	newRule("/", SLASH),
 	newRule(".", INVALID),
 }
 
 type mmLexInfo struct {
-	src      string // All the data we're scanning
-	pos      int    // Position of the scan head
-	loc      int    // Keep track of the line number
-	token    string // Cache the last token for error messaging
-	global   *Ast
-	locmap   []FileLoc
-	comments []*commentBlock
+	src       string   // All the data we're scanning
+	pos       int      // Position of the scan head
+	loc       int      // Keep track of the line number
+	lineStart int      // Position of the start of the current line
+	token     string   // Cache the last token for error messaging
+	tokid     int      // The last token type returned
+	tokLoc    tokenLoc // The location of the last token
+	global    *Ast
+	locmap    []FileLoc
+	comments  []*commentBlock
+	errors    []*ParseError
+
+	// If the current line is the continuation of a multi-line string, the
+	// line on which the string started.
+	stringLoc int
+
+	// The name and location of the declaration being parsed, if known.
+	decName string
+	decLoc  tokenLoc
+
+	// Declarations which had syntax errors.
+	failedDecs map[string]AstNode
 }
 
 func (self *mmLexInfo) Lex(lval *mmSymType) int {
@@ -112,27 +141,67 @@ func (self *mmLexInfo) Lex(lval *mmSymType) int {
 			}
 		}
 
+		// A minus sign directly after an operand is subtraction, not the
+		// sign of a number.
+		if (r.tokid == NUM_INT || r.tokid == NUM_FLOAT) &&
+			val[0] == '-' && endsOperand(self.tokid) {
+			val = "-"
+			r = minusRule
+		}
+
 		// Advance the cursor pos.
 		self.pos += len(val)
 
 		// If whitespace or comment, advance line count by counting newlines.
 		if r.tokid == SKIP {
-			self.loc += strings.Count(val, "\n")
+			if strings.Contains(val, "\n") {
+				self.stringLoc = 0
+			}
+			self.countLines(val)
 			continue
 		} else if r.tokid == COMMENT {
-			self.comments = append(self.comments, &commentBlock{
-				self.loc,
-				strings.TrimSpace(val),
-			})
-			self.loc++
+			// A comment after a token on the same line is attached to the
+			// line where that statement started.
+			comment := &commentBlock{
+				Loc:      self.loc,
+				Value:    strings.TrimSpace(val),
+				Trailing: self.tokid != 0 && self.tokLoc.endLine == self.loc,
+			}
+			if comment.Trailing && self.stringLoc != 0 {
+				comment.Loc = self.stringLoc
+			}
+			self.comments = append(self.comments, comment)
+			self.stringLoc = 0
+			self.countLines(val)
 			continue
 		}
 
 		// If got parseable token, pass it and line number to parser.
 		// fmt.Println(r.tokid, val, self.loc)
 		self.token = val
+		switch {
+		case r.tokid == FILETYPE || r.tokid == STRUCT ||
+			r.tokid == STAGE || r.tokid == PIPELINE:
+			self.decName = ""
+		case r.tokid == ID && (self.tokid == FILETYPE || self.tokid == STRUCT ||
+			self.tokid == STAGE || self.tokid == PIPELINE):
+			self.decName = val
+			self.decLoc = tokenLoc{line: self.loc}
+		}
+		self.tokid = r.tokid
+		self.tokLoc.line = self.loc
+		self.tokLoc.col = self.pos - len(val) - self.lineStart + 1
+		if r.tokid == LITSTRING {
+			// Multi-line strings advance the line count after the token.
+			if self.stringLoc == 0 && strings.Contains(val, "\n") {
+				self.stringLoc = self.loc
+			}
+			self.countLines(val)
+		}
+		self.tokLoc.endLine = self.loc
+		self.tokLoc.endCol = self.pos - self.lineStart + 1
 		lval.val = val
-		lval.loc = self.loc // give grammar rules access to loc
+		lval.loc = self.tokLoc // give grammar rules access to loc
 
 		// give NewAstNode access to locmap to calculate file-local locations
 		lval.locmap = self.locmap
@@ -142,7 +211,79 @@ func (self *mmLexInfo) Lex(lval *mmSymType) int {
 	}
 }
 
-func (self *mmLexInfo) Error(s string) {}
+var minusRule = newRule("-", MINUS)
+
+// The location of a token in the preprocessed source.  Lines and columns are
+// 1-based, and the end is just past the last character of the token.
+type tokenLoc struct {
+	line, col       int
+	endLine, endCol int
+}
+
+// Returns true if the given token can be the end of an operand in an
+// arithmetic expression.
+func endsOperand(tokid int) bool {
+	switch tokid {
+	case ID, NUM_INT, NUM_FLOAT, RPAREN,
+		THREADS, MEM_GB, SPECIAL, TIMEOUT, RETRIES, RETRY_BACKOFF, RETRY_ON,
+		RETAIN, DISABLED, OR, LOCAL, PREFLIGHT,
+		VOLATILE, EXEC, COMPILED, FILETYPE, STRUCT, SPLIT, USING:
+		return true
+	}
+	return false
+}
+
+// Advance the line count past the given text, which ends at the current
+// position.
+func (self *mmLexInfo) countLines(val string) {
+	if n := strings.Count(val, "\n"); n > 0 {
+		self.loc += n
+		self.lineStart = self.pos - len(val) + strings.LastIndexByte(val, '\n') + 1
+	}
+}
+
+// Called by the parser for each syntax error.  The parser recovers from
+// errors at the end of the declaration, so there may be several.
+func (self *mmLexInfo) Error(s string) {
+	if self.decName != "" {
+		if self.failedDecs == nil {
+			self.failedDecs = make(map[string]AstNode)
+		}
+		self.failedDecs[self.decName] = NewAstNode(self.decLoc, self.locmap)
+	}
+	self.errors = append(self.errors, &ParseError{
+		token:  self.token,
+		loc:    self.tokLoc.line,
+		col:    self.tokLoc.col,
+		endLoc: self.tokLoc.endLine,
+		endCol: self.tokLoc.endCol,
+	})
+}
+
+// Get the syntax errors, with locations mapped back to their source files.
+// If there is no locmap, fname is used as the file name.
+func (self *mmLexInfo) errorList(fname string) ErrorList {
+	errs := make(ErrorList, 0, len(self.errors))
+	for _, perr := range self.errors {
+		if len(self.locmap) > 0 {
+			// Guard against index out of range, which can happen if there
+			// is a syntax error at the end of the file, e.g. forgetting to
+			// put a close paren at the end of an invocation call/file.
+			loc := perr.loc
+			if loc >= len(self.locmap) {
+				loc = len(self.locmap) - 1
+			}
+			perr.fname = self.locmap[loc].fname
+			perr.endLoc = self.locmap[loc].loc + perr.endLoc - perr.loc
+			perr.loc = self.locmap[loc].loc
+			perr.includeStack = self.locmap[loc].includedFrom
+		} else {
+			perr.fname = fname
+		}
+		errs = append(errs, perr)
+	}
+	return errs
+}
 
 func yaccParse(src string, locmap []FileLoc) (*Ast, *mmLexInfo) {
 	lexinfo := mmLexInfo{
@@ -156,5 +297,11 @@ func yaccParse(src string, locmap []FileLoc) (*Ast, *mmLexInfo) {
 		return nil, &lexinfo // return lex on error to provide loc and token info
 	}
 	lexinfo.global.comments = lexinfo.comments
+	lexinfo.global.failedDecs = lexinfo.failedDecs
+	if len(lexinfo.errors) > 0 {
+		// Recovered from errors.  Return the partial AST as well, so that
+		// semantic errors can be reported.
+		return lexinfo.global, &lexinfo
+	}
 	return lexinfo.global, nil // success
 }
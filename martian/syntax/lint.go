@@ -0,0 +1,281 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Lint checks, for problems which are legal MRO but probably mistakes.
+
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// The available lint checks, by name.
+var LintChecks = map[string]string{
+	"unused-stage":         "stages which are never called",
+	"unused-input":         "pipeline inputs which every caller leaves null",
+	"unused-output":        "outputs which no caller ever binds",
+	"split-without-chunks": "stages which split but have no chunk inputs",
+	"naming":               "stage and pipeline names which are not UPPER_SNAKE_CASE",
+	"missing-help":         "parameters without help strings",
+	"duplicate-literal":    "literal values bound repeatedly in a pipeline",
+}
+
+// A problem found by a lint check.
+type LintWarning struct {
+	Check string
+	Node  *AstNode
+	Msg   string
+}
+
+func (self *LintWarning) Error() string {
+	return fmt.Sprintf("MRO LintWarning: %s [%s] at %s.",
+		self.Msg, self.Check, formatLoc(self.Node))
+}
+
+var upperSnakeRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+type linter struct {
+	disabled map[string]bool
+	warnings []*LintWarning
+
+	// Declarations which have already been checked, by file and name.
+	seen map[string]bool
+
+	// Callables which are called by a pipeline or top-level call.
+	called map[string]bool
+
+	// Callables which are the top-level call of some file, all of whose
+	// outputs are therefore used.
+	final map[string]bool
+
+	// Outputs of each callable which are bound by some caller.
+	outputsUsed map[string]map[string]bool
+
+	// Inputs of each callable which some caller binds to a value other
+	// than null.
+	inputsGiven map[string]map[string]bool
+}
+
+// Run the lint checks which are not disabled on the given compiled ASTs.
+//
+// Only declarations in the top-level file of each AST are checked, but
+// usage is counted across all of them, so that for example a stage is not
+// reported as unused if any of the files calls it.  The warnings are sorted
+// by location.
+func Lint(asts []*Ast, disabled map[string]bool) []*LintWarning {
+	l := linter{
+		disabled:    disabled,
+		seen:        make(map[string]bool),
+		called:      make(map[string]bool),
+		final:       make(map[string]bool),
+		outputsUsed: make(map[string]map[string]bool),
+		inputsGiven: make(map[string]map[string]bool),
+	}
+	for _, ast := range asts {
+		l.countUses(ast)
+	}
+	for _, ast := range asts {
+		l.check(ast)
+	}
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		return errorBefore(l.warnings[i], l.warnings[j])
+	})
+	return l.warnings
+}
+
+func (l *linter) warn(check string, node *AstNode, msg string, v ...interface{}) {
+	if !l.disabled[check] {
+		l.warnings = append(l.warnings, &LintWarning{
+			Check: check,
+			Node:  node,
+			Msg:   fmt.Sprintf(msg, v...),
+		})
+	}
+}
+
+func (l *linter) countCall(call *CallStm) {
+	l.called[call.DecId] = true
+	inputs := l.inputsGiven[call.DecId]
+	if inputs == nil {
+		inputs = make(map[string]bool)
+		l.inputsGiven[call.DecId] = inputs
+	}
+	for _, binding := range call.Bindings.List {
+		if exp, ok := binding.Exp.(*ValExp); !ok || exp.Kind != KindNull {
+			inputs[binding.Id] = true
+		}
+	}
+}
+
+func (l *linter) countUses(ast *Ast) {
+	for _, pipeline := range ast.Pipelines {
+		calls := make(map[string]*CallStm, len(pipeline.Calls))
+		for _, call := range pipeline.Calls {
+			calls[call.Id] = call
+			l.countCall(call)
+		}
+		countRef := func(ref *RefExp) {
+			if call := calls[ref.Id]; ref.Kind == KindCall && call != nil {
+				if ref.OutputId == "default" {
+					l.final[call.DecId] = true
+				} else {
+					outputs := l.outputsUsed[call.DecId]
+					if outputs == nil {
+						outputs = make(map[string]bool)
+						l.outputsUsed[call.DecId] = outputs
+					}
+					outputs[ref.OutputId] = true
+				}
+			}
+		}
+		for _, call := range pipeline.Calls {
+			for _, binding := range call.Bindings.List {
+				forEachRef(binding.Exp, countRef)
+			}
+			if call.Modifiers.Bindings != nil {
+				for _, binding := range call.Modifiers.Bindings.List {
+					forEachRef(binding.Exp, countRef)
+				}
+			}
+		}
+		if pipeline.Ret != nil {
+			for _, binding := range pipeline.Ret.Bindings.List {
+				forEachRef(binding.Exp, countRef)
+			}
+		}
+	}
+	if ast.Call != nil {
+		l.countCall(ast.Call)
+		l.final[ast.Call.DecId] = true
+	}
+}
+
+// Call the given function for every reference in an expression.
+func forEachRef(exp Exp, f func(*RefExp)) {
+	switch exp := exp.(type) {
+	case *RefExp:
+		f(exp)
+	case *OrExp:
+		for _, ref := range exp.Refs {
+			f(ref)
+		}
+	case *ValExp:
+		switch v := exp.Value.(type) {
+		case []Exp:
+			for _, e := range v {
+				forEachRef(e, f)
+			}
+		case map[string]Exp:
+			for _, e := range v {
+				forEachRef(e, f)
+			}
+		}
+	}
+}
+
+// Returns true if the node was declared in the top-level file of its AST
+// and has not already been checked.
+func (l *linter) isNew(node *AstNode, id string) bool {
+	if len(node.IncludeStack) != 0 {
+		return false
+	}
+	key := node.Fname + ":" + id
+	if l.seen[key] {
+		return false
+	}
+	l.seen[key] = true
+	return true
+}
+
+func (l *linter) check(ast *Ast) {
+	for _, stage := range ast.Stages {
+		if !l.isNew(&stage.Node, stage.Id) {
+			continue
+		}
+		if !l.called[stage.Id] {
+			l.warn("unused-stage", &stage.Node,
+				"stage %s is never called", stage.Id)
+		}
+		if stage.Split && (stage.ChunkIns == nil || len(stage.ChunkIns.List) == 0) {
+			l.warn("split-without-chunks", &stage.Node,
+				"stage %s splits but has no chunk inputs", stage.Id)
+		}
+		l.checkCallable(stage)
+	}
+	for _, pipeline := range ast.Pipelines {
+		if !l.isNew(&pipeline.Node, pipeline.Id) {
+			continue
+		}
+		if l.called[pipeline.Id] {
+			for _, param := range pipeline.InParams.List {
+				if !l.inputsGiven[pipeline.Id][param.GetId()] {
+					l.warn("unused-input", param.getNode(),
+						"input '%s' of pipeline %s is null in every call",
+						param.GetId(), pipeline.Id)
+				}
+			}
+		}
+		l.checkCallable(pipeline)
+		l.checkLiterals(pipeline)
+	}
+}
+
+func (l *linter) checkCallable(callable Callable) {
+	id := callable.GetId()
+	if !upperSnakeRe.MatchString(id) {
+		l.warn("naming", callable.getNode(),
+			"%s name %s is not UPPER_SNAKE_CASE", callable.Type(), id)
+	}
+	if l.called[id] && !l.final[id] {
+		for _, param := range callable.GetOutParams().List {
+			if !l.outputsUsed[id][param.GetId()] {
+				l.warn("unused-output", param.getNode(),
+					"output '%s' of %s %s is never bound by any caller",
+					param.GetId(), callable.Type(), id)
+			}
+		}
+	}
+	for _, params := range []*Params{
+		callable.GetInParams(), callable.GetOutParams(),
+	} {
+		for _, param := range params.List {
+			if param.GetHelp() == "" {
+				l.warn("missing-help", param.getNode(),
+					"parameter '%s' of %s %s has no help string",
+					param.GetId(), callable.Type(), id)
+			}
+		}
+	}
+}
+
+// Find scalar literals which are bound to more than one call input in a
+// pipeline.  These should usually be pipeline inputs instead.
+func (l *linter) checkLiterals(pipeline *Pipeline) {
+	var order []string
+	first := make(map[string]*BindStm)
+	count := make(map[string]int)
+	for _, call := range pipeline.Calls {
+		for _, binding := range call.Bindings.List {
+			exp, ok := binding.Exp.(*ValExp)
+			if !ok || exp.Kind != KindString &&
+				exp.Kind != KindInt && exp.Kind != KindFloat {
+				continue
+			}
+			key := exp.format("")
+			if count[key] == 0 {
+				first[key] = binding
+				order = append(order, key)
+			}
+			count[key]++
+		}
+	}
+	for _, key := range order {
+		if n := count[key]; n > 1 {
+			l.warn("duplicate-literal", &first[key].Node,
+				"literal %s is bound %d times in pipeline %s; "+
+					"consider making it a pipeline input",
+				key, n, pipeline.Id)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+const lintSrc = `
+filetype txt;
+
+stage SPLITTER(
+    in  int  count "The count",
+    in  int  offset "The offset",
+    out txt  result "The output",
+    src py   "stages/splitter",
+) split using (
+)
+
+stage unusedStage(
+    in  int  x     "An input",
+    out int  y     "An output",
+    src py   "stages/unused",
+)
+
+stage ADD(
+    in  int  a,
+    in  int  b     "The second addend",
+    out int  sum   "The sum",
+    out int  carry "Whether the sum overflowed",
+    src py   "stages/add",
+)
+
+pipeline PIPE(
+    in  int  x     "An input",
+    in  int  extra "Not used",
+    out int  sum   "The sum",
+    out txt  result "The output",
+)
+{
+    call ADD(
+        a = self.x,
+        b = 12,
+    )
+
+    call SPLITTER(
+        count  = 12,
+        offset = self.extra,
+    )
+
+    return (
+        sum = ADD.sum,
+        result = SPLITTER.result,
+    )
+}
+
+call PIPE(
+    x     = 1,
+    extra = null,
+)
+`
+
+func lintChecks(warnings []*LintWarning) []string {
+	checks := make([]string, len(warnings))
+	for i, w := range warnings {
+		checks[i] = w.Check
+	}
+	return checks
+}
+
+func TestLint(t *testing.T) {
+	ast := testGood(t, lintSrc)
+	if ast == nil {
+		return
+	}
+	warnings := Lint([]*Ast{ast}, nil)
+	if expect := []string{
+		"split-without-chunks",
+		"unused-stage",
+		"naming",
+		"missing-help",
+		"unused-output",
+		"unused-input",
+		"duplicate-literal",
+	}; !reflect.DeepEqual(lintChecks(warnings), expect) {
+		for _, w := range warnings {
+			t.Log(w)
+		}
+		t.Errorf("Expected %v, got %v", expect, lintChecks(warnings))
+	}
+	if w := warnings[4]; w.Msg != "output 'carry' of stage ADD is never bound by any caller" {
+		t.Errorf("Incorrect message %q", w.Msg)
+	}
+	if w := warnings[6]; w.Node.Loc != 35 {
+		t.Errorf("Expected duplicate literal on line 35, got %d", w.Node.Loc)
+	}
+}
+
+func TestLintDisabled(t *testing.T) {
+	ast := testGood(t, lintSrc)
+	if ast == nil {
+		return
+	}
+	warnings := Lint([]*Ast{ast}, map[string]bool{
+		"naming":            true,
+		"unused-stage":      true,
+		"duplicate-literal": true,
+	})
+	if expect := []string{
+		"split-without-chunks",
+		"missing-help",
+		"unused-output",
+		"unused-input",
+	}; !reflect.DeepEqual(lintChecks(warnings), expect) {
+		t.Errorf("Expected %v, got %v", expect, lintChecks(warnings))
+	}
+}
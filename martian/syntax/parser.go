@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -21,7 +22,65 @@ import (
 // Semantic Checking Methods
 //
 func (global *Ast) err(nodable AstNodable, msg string, v ...interface{}) error {
-	return &AstError{global, nodable.getNode(), fmt.Sprintf(msg, v...)}
+	return &AstError{
+		global: global,
+		Node:   nodable.getNode(),
+		Msg:    fmt.Sprintf(msg, v...),
+	}
+}
+
+// Returns true if the declaration with the given name had syntax errors.
+func (global *Ast) hadSyntaxError(id string) bool {
+	_, ok := global.failedDecs[id]
+	return ok
+}
+
+// Returns true if the expression refers to something which is missing
+// because of a syntax error, either the outputs of a call to a declaration
+// which had syntax errors, or, in a pipeline which had syntax errors, a call
+// or input parameter which could not be parsed.
+func (global *Ast) refersToFailed(callable Callable, uexp Exp) bool {
+	pipeline, ok := callable.(*Pipeline)
+	if !ok || len(global.failedDecs) == 0 {
+		return false
+	}
+	switch exp := uexp.(type) {
+	case *RefExp:
+		switch exp.Kind {
+		case KindCall:
+			if call := pipeline.findCall(exp.Id); call != nil {
+				return global.hadSyntaxError(call.DecId)
+			}
+			return global.hadSyntaxError(pipeline.Id)
+		case KindSelf:
+			_, ok := pipeline.InParams.Table[exp.Id]
+			return !ok && global.hadSyntaxError(pipeline.Id)
+		}
+	case *OrExp:
+		for _, ref := range exp.Refs {
+			if global.refersToFailed(callable, ref) {
+				return true
+			}
+		}
+	case *ValExp:
+		switch exp.Kind {
+		case KindArray:
+			for _, sub := range exp.Value.([]Exp) {
+				if global.refersToFailed(callable, sub) {
+					return true
+				}
+			}
+		case KindMap:
+			if m, ok := exp.Value.(map[string]Exp); ok {
+				for _, sub := range m {
+					if global.refersToFailed(callable, sub) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
 }
 
 func (callables *Callables) compile(global *Ast) error {
@@ -51,7 +110,9 @@ func (params *Params) compile(global *Ast) error {
 	var errs ErrorList
 	for _, param := range params.List {
 		// Check for duplicates
+		duplicate := false
 		if _, ok := params.Table[param.GetId()]; ok {
+			duplicate = true
 			errs = append(errs, global.err(param,
 				"DuplicateNameError: parameter '%s' was already declared when encountered again",
 				param.GetId()))
@@ -60,7 +121,8 @@ func (params *Params) compile(global *Ast) error {
 		}
 
 		// Check that types exist.
-		if _, ok := global.TypeTable[param.GetTname()]; !ok {
+		if !global.hasType(param.GetTname()) &&
+			!global.hadSyntaxError(mapElemType(param.GetTname())) {
 			errs = append(errs, global.err(param,
 				"TypeError: undefined type '%s'",
 				param.GetTname()))
@@ -69,6 +131,22 @@ func (params *Params) compile(global *Ast) error {
 		// Cache if param is file or path.
 		_, ok := global.UserTypeTable[param.GetTname()]
 		param.setIsFile(ok)
+
+		// Cache the struct definition, if any.  For typed maps, this is
+		// the struct definition of the map elements.
+		param.setStructType(global.StructTypeTable[mapElemType(param.GetTname())])
+
+		// Typecheck the default value as if it were bound to the parameter.
+		if def := param.GetDefault(); def != nil && !duplicate {
+			binding := BindStm{
+				Node: *param.getNode(),
+				Id:   param.GetId(),
+				Exp:  def,
+			}
+			if err := binding.compile(global, nil, params); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 	return errs.If()
 }
@@ -152,23 +230,86 @@ func (exp *RefExp) resolveType(global *Ast, callable Callable) ([]string, int, e
 				return []string{""}, 0, global.err(exp, "NoSuchOutputError: '%s' is not an output parameter of '%s'", exp.OutputId, callable.GetId())
 			}
 
+			// Outputs of a mapped call are collected into arrays.
+			if call := pipeline.findCall(exp.Id); call != nil && call.Modifiers.Mapped {
+				return []string{param.GetTname()}, param.GetArrayDim() + 1, nil
+			}
 			return []string{param.GetTname()}, param.GetArrayDim(), nil
 		}
 	}
 	return []string{"unknown"}, 0, nil
 }
 
+// A disjunction has the types of each of its references, none of which may
+// be arrays.
+func (exp *OrExp) resolveType(global *Ast, callable Callable) ([]string, int, error) {
+	var errs ErrorList
+	types := make([]string, 0, len(exp.Refs))
+	for _, ref := range exp.Refs {
+		refTypes, arrayDim, err := ref.resolveType(global, callable)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if arrayDim > 0 {
+			errs = append(errs, global.err(ref,
+				"TypeMismatchError: got array value in disjunction"))
+		}
+		types = append(types, refTypes...)
+	}
+	return types, 0, errs.If()
+}
+
+// Find the call statement with the given id in this pipeline.
+func (pipeline *Pipeline) findCall(id string) *CallStm {
+	for _, call := range pipeline.Calls {
+		if call.Id == id {
+			return call
+		}
+	}
+	return nil
+}
+
 func (global *Ast) isUserType(t string) bool {
 	_, ok := global.UserTypeTable[t]
 	return ok
 }
 
+func (global *Ast) isStructType(t string) bool {
+	_, ok := global.StructTypeTable[t]
+	return ok
+}
+
+// Returns true if the type is declared, or is a typed map of a declared type.
+func (global *Ast) hasType(t string) bool {
+	if elem, _, ok := ParseMapType(t); ok {
+		return global.hasType(elem)
+	}
+	_, ok := global.TypeTable[t]
+	return ok
+}
+
+// Get the innermost element type of a (possibly nested) typed map.
+func mapElemType(t string) string {
+	for {
+		if elem, _, ok := ParseMapType(t); ok {
+			t = elem
+		} else {
+			return t
+		}
+	}
+}
+
 func (global *Ast) checkTypeMatch(paramType string, valueType string) bool {
 	return (valueType == "null" ||
 		paramType == valueType ||
 		(paramType == "path" && valueType == "string") ||
 		(paramType == "file" && valueType == "string") ||
 		(paramType == "float" && valueType == "int") ||
+		// Any struct or typed map value is also a valid map.
+		(paramType == "map" && global.isStructType(valueType)) ||
+		(paramType == "map" && strings.HasPrefix(valueType, "map<")) ||
+		global.checkMapTypeMatch(paramType, valueType) ||
 		// Allow implicit cast between string and user file type
 		(global.isUserType(paramType) &&
 			(valueType == "string" || valueType == "file")) ||
@@ -176,6 +317,19 @@ func (global *Ast) checkTypeMatch(paramType string, valueType string) bool {
 			(paramType == "string" || paramType == "file")))
 }
 
+// Typed maps match if their element types match.
+func (global *Ast) checkMapTypeMatch(paramType string, valueType string) bool {
+	paramElem, paramDim, ok := ParseMapType(paramType)
+	if !ok {
+		return false
+	}
+	valueElem, valueDim, ok := ParseMapType(valueType)
+	if !ok || paramDim != valueDim {
+		return false
+	}
+	return global.checkTypeMatch(paramElem, valueElem)
+}
+
 func (bindings *BindStms) compile(global *Ast, callable Callable, params *Params) error {
 	// Check the bindings
 	var errs ErrorList
@@ -196,9 +350,14 @@ func (bindings *BindStms) compile(global *Ast, callable Callable, params *Params
 		}
 	}
 
-	// Check that all input params of the called segment are bound.
+	// Check that all input params of the called segment without a default
+	// value are bound.  In a pipeline with syntax errors the missing
+	// bindings may simply have failed to parse.
+	if callable != nil && global.hadSyntaxError(callable.GetId()) {
+		return errs.If()
+	}
 	for _, param := range params.List {
-		if _, ok := bindings.Table[param.GetId()]; !ok {
+		if _, ok := bindings.Table[param.GetId()]; !ok && param.GetDefault() == nil {
 			errs = append(errs, global.err(bindings,
 				"ArgumentNotSuppliedError: no argument supplied for parameter '%s'",
 				param.GetId()))
@@ -208,6 +367,9 @@ func (bindings *BindStms) compile(global *Ast, callable Callable, params *Params
 }
 
 func (binding *BindStm) compile(global *Ast, callable Callable, params *Params) error {
+	if global.refersToFailed(callable, binding.Exp) {
+		return nil
+	}
 	// Make sure the bound-to id is a declared parameter of the callable.
 	param, ok := params.Table[binding.Id]
 	if !ok {
@@ -226,6 +388,14 @@ func (binding *BindStm) compile(global *Ast, callable Callable, params *Params)
 			return global.err(binding, "TypeMismatchError: got non-array value for sweep parameter '%s'", param.GetId())
 		}
 		arrayDim -= 1
+	} else if binding.Split {
+		if arrayDim == 0 {
+			if len(valueTypes) < 1 || valueTypes[0] != "null" {
+				return global.err(binding, "TypeMismatchError: got non-array value for split parameter '%s'", param.GetId())
+			}
+		} else {
+			arrayDim -= 1
+		}
 	}
 	if param.GetArrayDim() != arrayDim {
 		if param.GetArrayDim() == 0 && arrayDim > 0 {
@@ -240,15 +410,153 @@ func (binding *BindStm) compile(global *Ast, callable Callable, params *Params)
 		}
 	}
 
-	for _, valueType := range valueTypes {
-		if !global.checkTypeMatch(param.GetTname(), valueType) {
-			return global.err(binding, "TypeMismatchError: expected type '%s' for '%s' but got '%s' instead", param.GetTname(), param.GetId(), valueType)
+	if elemType, elemDim, ok := ParseMapType(param.GetTname()); ok {
+		elem := &InParam{
+			Node:     *param.getNode(),
+			Tname:    elemType,
+			ArrayDim: elemDim,
+			Struct:   param.GetStructType(),
+		}
+		if err := global.checkMapValue(callable, param, elem, binding.Exp); err != nil {
+			return err
+		}
+	} else if st := param.GetStructType(); st != nil {
+		if err := st.checkValue(global, callable, binding.Exp); err != nil {
+			return err
+		}
+	} else {
+		for _, valueType := range valueTypes {
+			if !global.checkTypeMatch(param.GetTname(), valueType) {
+				return global.err(binding, "TypeMismatchError: expected type '%s' for '%s' but got '%s' instead", param.GetTname(), param.GetId(), valueType)
+			}
 		}
 	}
 	binding.Tname = param.GetTname()
 	return nil
 }
 
+// Check that a value expression is compatible with a typed map parameter.
+//
+// Map literals have each of their values checked against the element type.
+// References must be to a parameter with a compatible typed map type.
+func (global *Ast) checkMapValue(callable Callable, param Param, elem *InParam, uexp Exp) error {
+	switch exp := uexp.(type) {
+	case *RefExp:
+		valueTypes, _, err := exp.resolveType(global, callable)
+		if err != nil {
+			return err
+		}
+		for _, valueType := range valueTypes {
+			if valueType != "null" && !global.checkMapTypeMatch(param.GetTname(), valueType) {
+				return global.err(exp,
+					"TypeMismatchError: expected type '%s' but got '%s' instead",
+					param.GetTname(), valueType)
+			}
+		}
+		return nil
+	case *ValExp:
+		switch exp.Kind {
+		case KindNull:
+			return nil
+		case KindArray:
+			var errs ErrorList
+			for _, subExp := range exp.Value.([]Exp) {
+				errs = append(errs, global.checkMapValue(callable, param, elem, subExp))
+			}
+			return errs.If()
+		case KindMap:
+			values, _ := exp.Value.(map[string]Exp)
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			bindings := BindStms{
+				Node:  exp.Node,
+				List:  make([]*BindStm, 0, len(keys)),
+				Table: make(map[string]*BindStm, len(keys)),
+			}
+			elems := Params{
+				List:  make([]Param, 0, len(keys)),
+				Table: make(map[string]Param, len(keys)),
+			}
+			for _, key := range keys {
+				bindings.List = append(bindings.List, &BindStm{
+					Node: *values[key].getNode(),
+					Id:   key,
+					Exp:  values[key],
+				})
+				keyElem := *elem
+				keyElem.Id = key
+				elems.List = append(elems.List, &keyElem)
+				elems.Table[key] = &keyElem
+			}
+			return bindings.compile(global, callable, &elems)
+		}
+		return global.err(exp,
+			"TypeMismatchError: expected type '%s' but got '%s' instead",
+			param.GetTname(), exp.Kind)
+	}
+	return nil
+}
+
+// Check that a value expression is compatible with the struct type.
+//
+// Map literals are checked member by member, the same way as the bindings
+// for a call.  References must be to a parameter of the same struct type.
+func (st *StructType) checkValue(global *Ast, callable Callable, uexp Exp) error {
+	switch exp := uexp.(type) {
+	case *RefExp:
+		valueTypes, _, err := exp.resolveType(global, callable)
+		if err != nil {
+			return err
+		}
+		for _, valueType := range valueTypes {
+			if valueType != st.Id && valueType != "null" {
+				return global.err(exp,
+					"TypeMismatchError: expected type '%s' but got '%s' instead",
+					st.Id, valueType)
+			}
+		}
+		return nil
+	case *ValExp:
+		switch exp.Kind {
+		case KindNull:
+			return nil
+		case KindArray:
+			var errs ErrorList
+			for _, subExp := range exp.Value.([]Exp) {
+				errs = append(errs, st.checkValue(global, callable, subExp))
+			}
+			return errs.If()
+		case KindMap:
+			members, _ := exp.Value.(map[string]Exp)
+			keys := make([]string, 0, len(members))
+			for key := range members {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			bindings := BindStms{
+				Node:  exp.Node,
+				List:  make([]*BindStm, 0, len(keys)),
+				Table: make(map[string]*BindStm, len(keys)),
+			}
+			for _, key := range keys {
+				bindings.List = append(bindings.List, &BindStm{
+					Node: *members[key].getNode(),
+					Id:   key,
+					Exp:  members[key],
+				})
+			}
+			return bindings.compile(global, callable, st.Members)
+		}
+		return global.err(exp,
+			"TypeMismatchError: expected type '%s' but got '%s' instead",
+			st.Id, exp.Kind)
+	}
+	return nil
+}
+
 // Do a stable sort of the calls in topological order.  Returns an error
 // if there is a dependency cycle or self-dependency.
 func (pipeline *Pipeline) topoSort(global *Ast) error {
@@ -382,6 +690,61 @@ func (global *Ast) compileTypes() error {
 		global.TypeTable[userType.Id] = userType
 		global.UserTypeTable[userType.Id] = userType
 	}
+	var errs ErrorList
+	for _, structType := range global.StructTypes {
+		if _, ok := global.TypeTable[structType.Id]; ok {
+			errs = append(errs, global.err(structType,
+				"DuplicateNameError: type '%s' was already declared when encountered again",
+				structType.Id))
+			continue
+		}
+		global.TypeTable[structType.Id] = structType
+		global.StructTypeTable[structType.Id] = structType
+	}
+	// Check struct members after all types are declared, so that structs
+	// can refer to structs declared later.
+	for _, structType := range global.StructTypes {
+		for _, member := range structType.Members.List {
+			if member.GetDefault() != nil {
+				errs = append(errs, global.err(member,
+					"UnsupportedTagError: struct member '%s' cannot have a default value",
+					member.GetId()))
+			}
+		}
+		if err := structType.Members.compile(global); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, structType := range global.StructTypes {
+		if err := structType.checkCycles(global, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Structs may not contain themselves, directly or transitively.
+func (st *StructType) checkCycles(global *Ast, stack []*StructType) error {
+	for i, s := range stack {
+		if s == st {
+			ids := make([]string, 0, len(stack)-i+1)
+			for _, s := range stack[i:] {
+				ids = append(ids, s.Id)
+			}
+			ids = append(ids, st.Id)
+			return global.err(stack[0],
+				"RecursiveStructError: struct '%s' contains itself (%s)",
+				st.Id, strings.Join(ids, " -> "))
+		}
+	}
+	stack = append(stack, st)
+	for _, member := range st.Members.List {
+		if sub := member.GetStructType(); sub != nil {
+			if err := sub.checkCycles(global, stack); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -454,14 +817,67 @@ func (stage *Stage) compile(global *Ast, stagecodePaths []string, checkSrcPath b
 			}
 		}
 	}
+	if res := stage.Resources; res != nil {
+		if res.ThreadExp != nil {
+			if err := res.ThreadExp.compile(global, stage); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if res.MemExp != nil {
+			if err := res.MemExp.compile(global, stage); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if res.RetryOnNode != nil {
+			if _, err := regexp.Compile(res.RetryOn); err != nil {
+				errs = append(errs, global.err(res.RetryOnNode,
+					"RetryError: invalid retry_on pattern for stage %s: %v",
+					stage.Id, err))
+			}
+		}
+	}
+	if stage.Retain != nil {
+		if err := stage.Retain.compile(global, stage); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Check that retained outputs are distinct outputs of the stage which might
+// contain file names.
+func (retain *RetainParams) compile(global *Ast, stage *Stage) error {
+	var errs ErrorList
+	found := make(map[string]bool, len(retain.Params))
+	for _, param := range retain.Params {
+		if found[param.Id] {
+			errs = append(errs, global.err(param,
+				"DuplicateNameError: output '%s' of stage %s is retained more than once",
+				param.Id, stage.Id))
+			continue
+		}
+		found[param.Id] = true
+		if out, ok := stage.OutParams.Table[param.Id]; !ok {
+			errs = append(errs, global.err(param,
+				"RetainError: stage %s has no output named '%s'",
+				stage.Id, param.Id))
+		} else if t := out.GetTname(); t == "int" || t == "float" || t == "bool" {
+			errs = append(errs, global.err(param,
+				"RetainError: output '%s' of stage %s is of type %s, which cannot contain files",
+				param.Id, stage.Id, t))
+		}
+	}
 	return errs.If()
 }
 
 const (
-	disabled  = "disabled"
-	local     = "local"
-	preflight = "preflight"
-	volatile  = "volatile"
+	disabled     = "disabled"
+	local        = "local"
+	preflight    = "preflight"
+	volatile     = "volatile"
+	retries      = "retries"
+	retryBackoff = "retry_backoff"
+	retryOn      = "retry_on"
 )
 
 // For checking modifier bindings.  Modifiers are optional so
@@ -472,6 +888,10 @@ var modParams = Params{
 		local:     &InParam{Id: local, Tname: "bool"},
 		preflight: &InParam{Id: preflight, Tname: "bool"},
 		volatile:  &InParam{Id: volatile, Tname: "bool"},
+
+		retries:      &InParam{Id: retries, Tname: "int"},
+		retryBackoff: &InParam{Id: retryBackoff, Tname: "int"},
+		retryOn:      &InParam{Id: retryOn, Tname: "string"},
 	},
 }
 
@@ -529,6 +949,58 @@ func (mods *Modifiers) compile(global *Ast, parent Callable, call *CallStm) erro
 				"UnsupportedTagError: Pipeline '%s' cannot be called with 'volatile' tag",
 				call.Id))
 		}
+		if mods.Bindings != nil {
+			for _, id := range []string{retries, retryBackoff, retryOn} {
+				if binding := mods.Bindings.Table[id]; binding != nil {
+					errs = append(errs, global.err(binding,
+						"UnsupportedTagError: Pipeline '%s' cannot be called with '%s'",
+						call.Id, id))
+				}
+			}
+		}
+	}
+	if mods.Bindings != nil {
+		if binding := mods.Bindings.Table[retryOn]; binding != nil {
+			if _, err := regexp.Compile(binding.Exp.ToInterface().(string)); err != nil {
+				errs = append(errs, global.err(binding,
+					"RetryError: invalid retry_on pattern for call %s: %v",
+					call.Id, err))
+			}
+		}
+	}
+
+	if mods.Mapped {
+		if pipeline, ok := callable.(*Pipeline); ok {
+			errs = append(errs, global.checkMappedPipeline(call, pipeline)...)
+		} else if stage, ok := callable.(*Stage); ok && stage.Split {
+			errs = append(errs, global.err(call,
+				"UnsupportedTagError: Stage '%s' cannot be called with 'map' tag because it has a split",
+				call.Id))
+		}
+		if mods.Preflight {
+			errs = append(errs, global.err(call,
+				"UnsupportedTagError: Preflight stages cannot be mapped."))
+		}
+		hasSplit := false
+		for _, binding := range call.Bindings.List {
+			if binding.Split {
+				hasSplit = true
+				break
+			}
+		}
+		if !hasSplit {
+			errs = append(errs, global.err(call,
+				"MapCallError: mapped call '%s' does not split any of its parameters",
+				call.Id))
+		}
+	} else {
+		for _, binding := range call.Bindings.List {
+			if binding.Split {
+				errs = append(errs, global.err(binding,
+					"MapCallError: parameter '%s' can only be split in a mapped call",
+					binding.Id))
+			}
+		}
 	}
 
 	if mods.Preflight {
@@ -563,6 +1035,126 @@ func (mods *Modifiers) compile(global *Ast, parent Callable, call *CallStm) erro
 	return errs.If()
 }
 
+// Check that a pipeline can be mapped.  Every call within it runs once for
+// each element of the split arguments, so none of them may split, be
+// mapped, run as preflight or be disabled by a per-element value, and each
+// output of the pipeline must collect a per-element value.
+func (global *Ast) checkMappedPipeline(call *CallStm, pipeline *Pipeline) ErrorList {
+	perElement := make(map[string]bool, len(call.Bindings.List))
+	for _, binding := range call.Bindings.List {
+		perElement[binding.Id] = binding.Split
+	}
+	errs := global.checkMappedCalls(call, pipeline, perElement,
+		map[*Pipeline]bool{pipeline: true})
+	for _, binding := range pipeline.Ret.Bindings.List {
+		if !global.isPerElement(binding.Exp, pipeline, perElement, true) {
+			errs = append(errs, global.err(call,
+				"MapCallError: output '%s' of mapped pipeline '%s' must be bound to an output of one of its calls or to a split parameter",
+				binding.Id, pipeline.Id))
+		}
+	}
+	return errs
+}
+
+// Check the calls within a mapped pipeline, given which of the pipeline's
+// parameters have a different value for each element.
+func (global *Ast) checkMappedCalls(call *CallStm, pipeline *Pipeline,
+	perElement map[string]bool, visiting map[*Pipeline]bool) ErrorList {
+	var errs ErrorList
+	for _, sub := range pipeline.Calls {
+		callable := global.Callables.Table[sub.DecId]
+		if stage, ok := callable.(*Stage); ok && stage.Split {
+			errs = append(errs, global.err(call,
+				"MapCallError: pipeline '%s' cannot be mapped because stage '%s' has a split",
+				pipeline.Id, sub.Id))
+		}
+		if sub.Modifiers.Mapped {
+			errs = append(errs, global.err(call,
+				"MapCallError: pipeline '%s' cannot be mapped because it maps '%s'",
+				pipeline.Id, sub.Id))
+		}
+		if sub.Modifiers.Preflight {
+			errs = append(errs, global.err(call,
+				"MapCallError: pipeline '%s' cannot be mapped because '%s' is preflight",
+				pipeline.Id, sub.Id))
+		}
+		if sub.Modifiers.Bindings != nil {
+			if binding := sub.Modifiers.Bindings.Table[disabled]; binding != nil &&
+				global.isPerElement(binding.Exp, pipeline, perElement, false) {
+				errs = append(errs, global.err(call,
+					"MapCallError: '%s' in mapped pipeline '%s' cannot be disabled by a per-element value",
+					sub.Id, pipeline.Id))
+			}
+		}
+		if inner, ok := callable.(*Pipeline); ok && !visiting[inner] {
+			innerPerElement := make(map[string]bool, len(sub.Bindings.List))
+			for _, binding := range sub.Bindings.List {
+				innerPerElement[binding.Id] = global.isPerElement(
+					binding.Exp, pipeline, perElement, false)
+			}
+			visiting[inner] = true
+			errs = append(errs, global.checkMappedCalls(
+				call, inner, innerPerElement, visiting)...)
+			delete(visiting, inner)
+		}
+	}
+	return errs
+}
+
+// Returns true if the expression, in a mapped pipeline, has a different
+// value for each element.  That is the case for outputs of stages called
+// within the pipeline, and for parameters bound to such values.  Unless
+// direct is true, arrays containing such values count as well.
+func (global *Ast) isPerElement(exp Exp, pipeline *Pipeline,
+	perElement map[string]bool, direct bool) bool {
+	switch exp := exp.(type) {
+	case *RefExp:
+		if exp.Kind == KindSelf {
+			return perElement[exp.Id]
+		}
+		call := pipeline.findCall(exp.Id)
+		if call == nil {
+			return false
+		}
+		switch callable := global.Callables.Table[call.DecId].(type) {
+		case *Stage:
+			return true
+		case *Pipeline:
+			if callable == pipeline {
+				return false
+			}
+		default:
+			return false
+		}
+		inner := global.Callables.Table[call.DecId].(*Pipeline)
+		innerPerElement := make(map[string]bool, len(call.Bindings.List))
+		for _, binding := range call.Bindings.List {
+			innerPerElement[binding.Id] = global.isPerElement(
+				binding.Exp, pipeline, perElement, false)
+		}
+		for _, binding := range inner.Ret.Bindings.List {
+			if binding.Id == exp.OutputId {
+				return global.isPerElement(binding.Exp, inner, innerPerElement, direct)
+			}
+		}
+	case *OrExp:
+		for _, ref := range exp.Refs {
+			if global.isPerElement(ref, pipeline, perElement, direct) {
+				return true
+			}
+		}
+	case *ValExp:
+		if exp.Kind == KindArray && !direct {
+			for _, sub := range exp.Value.([]Exp) {
+				if global.isPerElement(sub, pipeline, perElement, direct) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func (pipeline *Pipeline) compile(global *Ast) error {
 	var errs ErrorList
 	// Check in parameters.
@@ -586,26 +1178,29 @@ func (pipeline *Pipeline) compile(global *Ast) error {
 		// Check we're calling something declared.
 		callable, ok := global.Callables.Table[call.DecId]
 		if !ok {
-			errs = append(errs, global.err(call,
-				"ScopeNameError: '%s' is not defined in this scope",
-				call.Id))
+			if !global.hadSyntaxError(call.DecId) {
+				errs = append(errs, global.err(call,
+					"ScopeNameError: '%s' is not defined in this scope",
+					call.Id))
+			}
 			continue
 		}
 		// Save the valid callables for this scope.
 		pipeline.Callables.Table[call.Id] = callable
 	}
-	if err := errs.If(); err != nil {
-		return err
-	}
 	// Check call bindings after all calls are checked, so that the Callables
-	// table is fully populated.
+	// table is fully populated.  Calls to declarations which had syntax
+	// errors are not checked.
 	for _, call := range pipeline.Calls {
+		callable := global.Callables.Table[call.DecId]
+		if callable == nil || global.hadSyntaxError(call.DecId) {
+			continue
+		}
 		if err := call.Modifiers.compile(global, pipeline, call); err != nil {
 			errs = append(errs, err)
 		}
 
 		// Check the bindings
-		callable := global.Callables.Table[call.DecId]
 		if err := call.Bindings.compile(
 			global, pipeline, callable.GetInParams()); err != nil {
 			errs = append(errs, err)
@@ -614,17 +1209,17 @@ func (pipeline *Pipeline) compile(global *Ast) error {
 
 		// Check that all input params of the callable are bound.
 		for _, param := range callable.GetInParams().List {
-			if _, ok := call.Bindings.Table[param.GetId()]; !ok {
+			if _, ok := call.Bindings.Table[param.GetId()]; !ok && param.GetDefault() == nil {
 				errs = append(errs, global.err(call,
 					"ArgumentNotSuppliedError: no argument supplied for parameter '%s'",
 					param.GetId()))
 			}
 		}
 	}
-	if err := errs.If(); err != nil {
-		return err
+	if err := pipeline.topoSort(global); err != nil {
+		errs = append(errs, err)
 	}
-	return pipeline.topoSort(global)
+	return errs.If()
 }
 
 // Check pipeline declarations.
@@ -642,6 +1237,12 @@ func getBoundParamIds(uexp Exp) []string {
 	switch exp := uexp.(type) {
 	case *RefExp:
 		return []string{exp.Id}
+	case *OrExp:
+		ids := make([]string, 0, len(exp.Refs))
+		for _, ref := range exp.Refs {
+			ids = append(ids, ref.Id)
+		}
+		return ids
 	case *ValExp:
 		if exp.Kind == KindArray {
 			var ids []string
@@ -658,6 +1259,7 @@ func getBoundParamIds(uexp Exp) []string {
 func (global *Ast) compilePipelineArgs() error {
 	// Doing these in a separate loop gives the user better incremental
 	// error messages while writing a long pipeline declaration.
+	var errs ErrorList
 	for _, pipeline := range global.Pipelines {
 		boundParamIds := map[string]bool{}
 		for _, call := range pipeline.Calls {
@@ -668,63 +1270,80 @@ func (global *Ast) compilePipelineArgs() error {
 			}
 			if call.Modifiers.Bindings != nil {
 				for _, binding := range call.Modifiers.Bindings.List {
-					refexp, ok := binding.Exp.(*RefExp)
-					if ok {
-						boundParamIds[refexp.Id] = true
+					for _, id := range getBoundParamIds(binding.Exp) {
+						boundParamIds[id] = true
 					}
 				}
 			}
 		}
-		for _, param := range pipeline.InParams.List {
-			if _, ok := boundParamIds[param.GetId()]; !ok {
-				return global.err(param, "UnusedInputError: no calls use pipeline input parameter '%s'", param.GetId())
+		// Calls and bindings which could not be parsed may have used the
+		// inputs or returned the outputs.
+		returned := true
+		if !global.hadSyntaxError(pipeline.Id) {
+			for _, param := range pipeline.InParams.List {
+				if _, ok := boundParamIds[param.GetId()]; !ok {
+					errs = append(errs, global.err(param, "UnusedInputError: no calls use pipeline input parameter '%s'", param.GetId()))
+				}
 			}
-		}
 
-		// Check all pipeline output params are returned.
-		returnedParamIds := map[string]bool{}
-		for _, binding := range pipeline.Ret.Bindings.List {
-			returnedParamIds[binding.Id] = true
-		}
-		for _, param := range pipeline.OutParams.List {
-			if _, ok := returnedParamIds[param.GetId()]; !ok {
-				return global.err(pipeline.Ret, "ReturnError: pipeline output parameter '%s' is not returned", param.GetId())
+			// Check all pipeline output params are returned.
+			returnedParamIds := map[string]bool{}
+			for _, binding := range pipeline.Ret.Bindings.List {
+				returnedParamIds[binding.Id] = true
+			}
+			for _, param := range pipeline.OutParams.List {
+				if _, ok := returnedParamIds[param.GetId()]; !ok {
+					errs = append(errs, global.err(pipeline.Ret, "ReturnError: pipeline output parameter '%s' is not returned", param.GetId()))
+					returned = false
+				}
 			}
 		}
 
-		// Check return bindings.
-		if err := pipeline.Ret.Bindings.compile(global, pipeline, pipeline.OutParams); err != nil {
-			return err
+		// Check return bindings.  Skip this if outputs were missing, since
+		// that was already reported.
+		if returned {
+			if err := pipeline.Ret.Bindings.compile(global, pipeline, pipeline.OutParams); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
-	return nil
+	return errs.If()
 }
 
 // If call statement present, check the call and its bindings.
 func (global *Ast) compileCall() error {
-	if global.Call != nil {
-		callable, ok := global.Callables.Table[global.Call.Id]
-		if !ok {
-			return global.err(global.Call, "ScopeNameError: '%s' is not defined in this scope", global.Call.Id)
-		}
-		if err := global.Call.Bindings.compile(global, nil, callable.GetInParams()); err != nil {
-			return err
+	if global.Call == nil {
+		return nil
+	}
+	callable, ok := global.Callables.Table[global.Call.DecId]
+	if !ok {
+		if global.hadSyntaxError(global.Call.DecId) {
+			return nil
 		}
-		if err := global.Call.Modifiers.compile(global, nil, global.Call); err != nil {
-			return err
+		return global.err(global.Call, "ScopeNameError: '%s' is not defined in this scope", global.Call.DecId)
+	}
+	var errs ErrorList
+	if global.Call.Modifiers.Mapped {
+		errs = append(errs, global.err(global.Call,
+			"UnsupportedTagError: Top-level call cannot be mapped."))
+	}
+	if err := global.Call.Bindings.compile(global, nil, callable.GetInParams()); err != nil {
+		errs = append(errs, err)
+	}
+	if err := global.Call.Modifiers.compile(global, nil, global.Call); err != nil {
+		errs = append(errs, err)
+	}
+	if global.Call.Modifiers.Bindings != nil {
+		if _, ok := global.Call.Modifiers.Bindings.Table[disabled]; ok {
+			errs = append(errs, global.err(global.Call,
+				"UnsupportedTagError: Top-level call cannot be disabled."))
 		}
-		if global.Call.Modifiers.Bindings != nil {
-			if _, ok := global.Call.Modifiers.Bindings.Table[disabled]; ok {
-				return global.err(global.Call,
-					"UnsupportedTagError: Top-level call cannot be disabled.")
-			}
-			if global.Call.Modifiers.Preflight {
-				return global.err(global.Call,
-					"UnsupportedTagError: Top-level call cannot be preflight.")
-			}
+		if global.Call.Modifiers.Preflight {
+			errs = append(errs, global.err(global.Call,
+				"UnsupportedTagError: Top-level call cannot be preflight."))
 		}
 	}
-	return nil
+	return errs.If()
 }
 
 func attachComments(comments []*commentBlock, node *AstNode) []*commentBlock {
@@ -768,35 +1387,37 @@ func compileComments(comments []*commentBlock, node nodeContainer) []*commentBlo
 	return comments
 }
 
+// Run all of the semantic checks, returning every error found.
 func (global *Ast) compile(stagecodePaths []string, checkSrcPath bool) error {
+	var errs ErrorList
 	if err := global.compileTypes(); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	// Check for duplicate names amongst callables.
 	if err := global.Callables.compile(global); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	if err := global.compileStages(stagecodePaths, checkSrcPath); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	if err := global.compilePipelineDecs(); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	if err := global.compilePipelineArgs(); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	if err := global.compileCall(); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	compileComments(global.comments, global)
 
-	return nil
+	return errs.If()
 }
 
 //
@@ -811,30 +1432,54 @@ func ParseSource(src string, srcPath string, incPaths []string, checkSrc bool) (
 	stagecodePaths := append(incPaths, strings.Split(os.Getenv("PATH"), ":")...)
 
 	// Preprocess: generate new source and a locmap.
-	postsrc, ifnames, locmap, err := preprocess(src, filepath.Base(srcPath), make(map[string]struct{}), nil, incPaths)
+	root := newRootScope(filepath.Base(srcPath))
+	var includes []*IncludeUsage
+	postsrc, ifnames, locmap, err := preprocess(src, filepath.Base(srcPath), make(map[string]struct{}), nil, incPaths, root, &includes)
 	if err != nil {
 		return "", nil, nil, err
 	}
 	//printSourceMap(postsrc, locmap)
 
 	// Parse the source into an AST and attach the locmap.
+	var errs ErrorList
+	fail := func() (string, []string, *Ast, error) {
+		err := errs.sorted()
+		attachSource(err, postsrc, locmap)
+		return "", nil, nil, err
+	}
 	ast, perr := yaccParse(postsrc, locmap)
 	if perr != nil { // perr is an mmLexInfo struct
-		// Guard against index out of range, which can happen if there is syntax error
-		// at the end of the file, e.g. forgetting to put a close paren at the end of
-		// and invocation call/file.
-		if perr.loc >= len(locmap) {
-			perr.loc = len(locmap) - 1
+		errs = perr.errorList("")
+		if ast == nil {
+			return fail()
 		}
-		return "", nil, nil, &ParseError{perr.token,
-			locmap[perr.loc].fname,
-			locmap[perr.loc].loc,
-			locmap[perr.loc].includedFrom}
 	}
 
-	// Run semantic checks.
+	if err := ast.checkDeclarationNames(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Move declarations from @imported files into their namespaces.
+	if err := ast.applyImports(root, locmap); err != nil {
+		errs = append(errs, err)
+		return fail()
+	}
+
+	// Run semantic checks.  If there were syntax errors, this is done on
+	// the declarations which parsed successfully.
 	if err := ast.compile(stagecodePaths, checkSrc); err != nil {
-		return "", nil, nil, err
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fail()
+	}
+	ast.Includes = includes
+	ast.trackIncludeUsage()
+
+	// The preprocessed source of @imported files would have conflicting
+	// names if parsed again, so return source with the qualified names.
+	if len(root.children) > 0 {
+		postsrc = ast.flatten()
 	}
 
 	return postsrc, ifnames, ast, nil
@@ -7,7 +7,10 @@
 package syntax
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -19,8 +22,7 @@ func TestMain(m *testing.M) {
 func testGood(t *testing.T, src string) *Ast {
 	t.Helper()
 	if ast, err := yaccParse(src, nil); err != nil {
-		t.Fatalf("ParseError: unexpected token '%s' at line %d:%d in\n%s",
-			err.token, err.loc, err.pos, err.src)
+		t.Fatalf("%v in\n%s", err.errorList("test"), err.src)
 		return nil
 	} else if err := ast.compile(nil, false); err != nil {
 		t.Errorf("Failed to compile src: %v\n%s", err, err.Error())
@@ -40,8 +42,7 @@ func testBadGrammar(t *testing.T, src string) {
 func testBadCompile(t *testing.T, src string) {
 	t.Helper()
 	if ast, err := yaccParse(src, nil); err != nil {
-		t.Fatalf("ParseError: unexpected token '%s' at line %d:%d in\n%s",
-			err.token, err.loc, err.pos, err.src)
+		t.Fatalf("%v in\n%s", err.errorList("test"), err.src)
 	} else if err := ast.compile(nil, false); err == nil {
 		t.Error("Expected failure to compile.")
 	}
@@ -518,6 +519,164 @@ stage SUM_SQUARES(
 `)
 }
 
+func TestResourceTimeout(t *testing.T) {
+	ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    timeout = 3600,
+)
+`)
+	if ast == nil {
+		return
+	}
+	if res := ast.Stages[0].Resources; res.TimeoutNode == nil || res.Timeout != 3600 {
+		t.Errorf("Expected a 3600 second timeout, got %d", res.Timeout)
+	}
+}
+
+func TestResourceRetries(t *testing.T) {
+	ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    retries       = 3,
+    retry_backoff = 60,
+    retry_on      = "^IOError: ",
+)
+`)
+	if ast == nil {
+		return
+	}
+	res := ast.Stages[0].Resources
+	if res.Retries != 3 || res.Backoff != 60 || res.RetryOn != "^IOError: " {
+		t.Errorf("Incorrect retry policy %d %d %q",
+			res.Retries, res.Backoff, res.RetryOn)
+	}
+}
+
+func TestBadRetryOn(t *testing.T) {
+	testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    retry_on = "(unclosed",
+)
+`)
+}
+
+func TestCallRetries(t *testing.T) {
+	ast := testGood(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+) using (
+    retries = 1,
+)
+
+pipeline SUM(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    ) using (
+        retries       = 3,
+        retry_backoff = 60,
+        retry_on      = "^IOError: ",
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	mods := ast.Pipelines[0].Calls[0].Modifiers.Bindings
+	if b := mods.Table["retries"]; b == nil || b.Exp.ToInterface() != int64(3) {
+		t.Errorf("Incorrect retries %v", b)
+	}
+	if b := mods.Table["retry_backoff"]; b == nil || b.Exp.ToInterface() != int64(60) {
+		t.Errorf("Incorrect retry backoff %v", b)
+	}
+	if b := mods.Table["retry_on"]; b == nil || b.Exp.ToInterface() != "^IOError: " {
+		t.Errorf("Incorrect retry pattern %v", b)
+	}
+}
+
+func TestBadCallRetries(t *testing.T) {
+	testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+
+pipeline SUM(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    ) using (
+        retry_on = "(unclosed",
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+`)
+	testBadCompile(t, `
+stage SUM_SQUARES(
+    in  float[] values,
+    out float   sum,
+    src py      "stages/sum_squares",
+)
+
+pipeline SUM(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM_SQUARES(
+        values = self.values,
+    )
+
+    return (
+        sum = SUM_SQUARES.sum,
+    )
+}
+
+pipeline OUTER(
+    in  float[] values,
+    out float   sum,
+)
+{
+    call SUM(
+        values = self.values,
+    ) using (
+        retries = 2,
+    )
+
+    return (
+        sum = SUM.sum,
+    )
+}
+`)
+}
+
 func TestBadMemGB(t *testing.T) {
 	testBadGrammar(t, `
 stage SUM_SQUARES(
@@ -1179,3 +1338,1363 @@ call SQ_PIPE(
 )
 `)
 }
+
+func TestStruct(t *testing.T) {
+	if ast := testGood(t, `
+filetype bam;
+
+struct READ_GROUP(
+    in string  sample,
+    in int     lane,
+    in bam[]   reads  "Aligned reads",
+    in LIBRARY library,
+)
+
+struct LIBRARY(
+    in string name,
+)
+
+stage ALIGN(
+    in  READ_GROUP[] groups,
+    out READ_GROUP   merged,
+    out map          info,
+    src py           "stages/align",
+)
+
+pipeline ALIGN_PIPE(
+    in  READ_GROUP[] groups,
+    out READ_GROUP   merged,
+    out map          info,
+)
+{
+    call ALIGN(
+        groups = self.groups,
+    )
+    return (
+        merged = ALIGN.merged,
+        info   = ALIGN.merged,
+    )
+}
+
+call ALIGN_PIPE(
+    groups = [{
+        "sample": "foo",
+        "lane": 1,
+        "reads": ["a.bam"],
+        "library": {"name": "lib"},
+    }],
+)
+`); ast != nil {
+		st := ast.StructTypeTable["READ_GROUP"]
+		if st == nil {
+			t.Fatal("No struct named READ_GROUP found")
+		}
+		if len(st.Members.List) != 4 {
+			t.Errorf("Expected 4 members, got %d", len(st.Members.List))
+		}
+		if !st.Members.Table["reads"].IsFile() {
+			t.Error("Expected reads to be a file.")
+		}
+		if lib := st.Members.Table["library"].GetStructType(); lib == nil {
+			t.Error("Expected library member to be a struct.")
+		} else if lib.Id != "LIBRARY" {
+			t.Errorf("Incorrect struct type %s", lib.Id)
+		}
+		if in := ast.Callables.Table["ALIGN"].GetInParams().Table["groups"]; in.GetStructType() != st {
+			t.Error("Expected groups param to be a READ_GROUP")
+		}
+	}
+}
+
+func TestStructMissingMember(t *testing.T) {
+	testBadCompile(t, `
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage PLOT(
+    in  POINT point,
+    src py    "stages/plot",
+)
+
+call PLOT(
+    point = {"x": 1},
+)
+`)
+}
+
+func TestStructBadMember(t *testing.T) {
+	testBadCompile(t, `
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage PLOT(
+    in  POINT point,
+    src py    "stages/plot",
+)
+
+call PLOT(
+    point = {"x": 1, "y": "two"},
+)
+`)
+}
+
+func TestStructExtraMember(t *testing.T) {
+	testBadCompile(t, `
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage PLOT(
+    in  POINT point,
+    src py    "stages/plot",
+)
+
+call PLOT(
+    point = {"x": 1, "y": 2, "z": 3},
+)
+`)
+}
+
+func TestStructMismatch(t *testing.T) {
+	testBadCompile(t, `
+struct POINT(
+    in int x,
+    in int y,
+)
+
+struct LINE(
+    in POINT start,
+    in POINT end,
+)
+
+stage DRAW(
+    in  map   anything,
+    out POINT point,
+    src py    "stages/draw",
+)
+
+stage PLOT(
+    in  LINE  line,
+    src py    "stages/plot",
+)
+
+pipeline PLOT_PIPE(
+    in  map  anything,
+)
+{
+    call DRAW(
+        anything = self.anything,
+    )
+    call PLOT(
+        line = DRAW.point,
+    )
+    return ()
+}
+`)
+}
+
+func TestStructFromMap(t *testing.T) {
+	testBadCompile(t, `
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage PLOT(
+    in  POINT point,
+    src py    "stages/plot",
+)
+
+pipeline PLOT_PIPE(
+    in  map point,
+)
+{
+    call PLOT(
+        point = self.point,
+    )
+    return ()
+}
+`)
+}
+
+func TestRecursiveStruct(t *testing.T) {
+	testBadCompile(t, `
+struct NODE(
+    in int    value,
+    in CHILD  child,
+)
+
+struct CHILD(
+    in NODE[] nodes,
+)
+`)
+}
+
+func TestDuplicateStruct(t *testing.T) {
+	testBadCompile(t, `
+filetype POINT;
+
+struct POINT(
+    in int x,
+    in int y,
+)
+`)
+}
+
+func TestTypedMap(t *testing.T) {
+	if ast := testGood(t, `
+filetype bam;
+
+struct POINT(
+    in int x,
+    in int y,
+)
+
+stage COUNT(
+    in  map<bam>        reads,
+    in  map<int[]>      lanes,
+    in  map<POINT>      points,
+    out map<int>        counts,
+    out map<map<float>> nested,
+    src py              "stages/count",
+)
+
+stage REPORT(
+    in  map<float>  counts,
+    in  map         anything,
+    src py          "stages/report",
+)
+
+pipeline COUNT_PIPE(
+    in  map<bam> reads,
+    out map<int> counts,
+)
+{
+    call COUNT(
+        reads  = self.reads,
+        lanes  = {
+            "a": [1, 2],
+            "b": [],
+        },
+        points = {"p": {"x": 1, "y": 2}},
+    )
+    call REPORT(
+        counts   = COUNT.counts,
+        anything = COUNT.nested,
+    )
+    return (
+        counts = COUNT.counts,
+    )
+}
+
+call COUNT_PIPE(
+    reads = {
+        "a": "a.bam",
+        "b": null,
+    },
+)
+`); ast != nil {
+		params := ast.Callables.Table["COUNT"].GetInParams()
+		if tname := params.Table["lanes"].GetTname(); tname != "map<int[]>" {
+			t.Errorf("Incorrect type name %s", tname)
+		}
+		if st := params.Table["points"].GetStructType(); st == nil || st.Id != "POINT" {
+			t.Error("Expected struct element type for points.")
+		}
+		if params.Table["reads"].IsFile() {
+			t.Error("A map of files is not a file.")
+		}
+	}
+}
+
+func TestTypedMapBadLiteral(t *testing.T) {
+	testBadCompile(t, `
+stage COUNT(
+    in  map<int> counts,
+    src py       "stages/count",
+)
+
+call COUNT(
+    counts = {"a": 1, "b": "two"},
+)
+`)
+}
+
+func TestTypedMapBadArray(t *testing.T) {
+	testBadCompile(t, `
+stage COUNT(
+    in  map<int[]> counts,
+    src py         "stages/count",
+)
+
+call COUNT(
+    counts = {"a": 1},
+)
+`)
+}
+
+func TestTypedMapMismatch(t *testing.T) {
+	testBadCompile(t, `
+stage PRODUCE(
+    out map<string> values,
+    src py          "stages/produce",
+)
+
+stage CONSUME(
+    in  map<int> values,
+    src py       "stages/consume",
+)
+
+pipeline PIPE()
+{
+    call PRODUCE()
+    call CONSUME(
+        values = PRODUCE.values,
+    )
+    return ()
+}
+`)
+}
+
+func TestTypedMapFromUntyped(t *testing.T) {
+	testBadCompile(t, `
+stage CONSUME(
+    in  map<int> values,
+    src py       "stages/consume",
+)
+
+pipeline PIPE(
+    in map values,
+)
+{
+    call CONSUME(
+        values = self.values,
+    )
+    return ()
+}
+`)
+}
+
+func TestTypedMapUndefined(t *testing.T) {
+	testBadCompile(t, `
+stage CONSUME(
+    in  map<bam> values,
+    src py       "stages/consume",
+)
+`)
+}
+
+func TestMapCall(t *testing.T) {
+	if ast := testGood(t, `
+stage ALIGN(
+    in  string sample,
+    in  string reference,
+    out int    reads,
+    src py     "stages/align",
+)
+
+stage SUM(
+    in  int[] values,
+    out int   total,
+    src py    "stages/sum",
+)
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    in  string   reference,
+    out int      total,
+)
+{
+    map call ALIGN(
+        sample    = split self.samples,
+        reference = self.reference,
+    )
+
+    call SUM(
+        values = ALIGN.reads,
+    )
+
+    return (
+        total = SUM.total,
+    )
+}
+`); ast != nil {
+		call := ast.Pipelines[0].Calls[0]
+		if !call.Modifiers.Mapped {
+			t.Errorf("Expected mapped call.")
+		}
+		if !call.Bindings.Table["sample"].Split {
+			t.Errorf("Expected split binding for sample.")
+		}
+		if call.Bindings.Table["reference"].Split {
+			t.Errorf("Expected non-split binding for reference.")
+		}
+	}
+}
+
+func TestMapCallLiteral(t *testing.T) {
+	testGood(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    out int[] reads,
+)
+{
+    map call ALIGN as ALIGN_TWO(
+        sample = split ["a", "b"],
+    ) using (
+        volatile = true,
+    )
+
+    return (
+        reads = ALIGN_TWO.reads,
+    )
+}
+`)
+}
+
+func TestMapCallNonArray(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  string sample,
+    out int[]  reads,
+)
+{
+    map call ALIGN(
+        sample = split self.sample,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+`)
+}
+
+func TestMapCallScalarOutput(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int      reads,
+)
+{
+    map call ALIGN(
+        sample = split self.samples,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+`)
+}
+
+func TestMapCallNoSplit(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  string sample,
+    out int[]  reads,
+)
+{
+    map call ALIGN(
+        sample = self.sample,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+`)
+}
+
+func TestSplitWithoutMap(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int      reads,
+)
+{
+    call ALIGN(
+        sample = split self.samples,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+`)
+}
+
+func TestMapCallPipeline(t *testing.T) {
+	testGood(t, `
+stage ALIGN(
+    in  string sample,
+    in  string reference,
+    out int    reads,
+    src py     "stages/align",
+)
+
+stage COUNT(
+    in  int    reads,
+    out int    count,
+    src py     "stages/count",
+)
+
+pipeline ALIGN_ONE(
+    in  string sample,
+    in  string reference,
+    in  bool   skip_count,
+    out int    reads,
+    out int    count,
+    out string sample,
+)
+{
+    call ALIGN(
+        sample    = self.sample,
+        reference = self.reference,
+    )
+
+    call COUNT(
+        reads = ALIGN.reads,
+    ) using (
+        disabled = self.skip_count,
+    )
+
+    return (
+        reads  = ALIGN.reads,
+        count  = COUNT.count,
+        sample = self.sample,
+    )
+}
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    in  string   reference,
+    out int[]    reads,
+    out int[]    count,
+    out string[] sample,
+)
+{
+    map call ALIGN_ONE(
+        sample     = split self.samples,
+        reference  = self.reference,
+        skip_count = false,
+    )
+
+    return (
+        reads  = ALIGN_ONE.reads,
+        count  = ALIGN_ONE.count,
+        sample = ALIGN_ONE.sample,
+    )
+}
+`)
+}
+
+func TestMapCallPipelineUnmappedOutput(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+)
+
+pipeline ALIGN_ONE(
+    in  string sample,
+    in  string reference,
+    out int    reads,
+    out string reference,
+)
+{
+    call ALIGN(
+        sample = self.sample,
+    )
+
+    return (
+        reads     = ALIGN.reads,
+        reference = self.reference,
+    )
+}
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int[]    reads,
+    out string[] reference,
+)
+{
+    map call ALIGN_ONE(
+        sample    = split self.samples,
+        reference = "hg19",
+    )
+
+    return (
+        reads     = ALIGN_ONE.reads,
+        reference = ALIGN_ONE.reference,
+    )
+}
+`)
+}
+
+func TestMapCallPipelineSplitStage(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+) split using (
+    in  int    chunk,
+)
+
+pipeline ALIGN_ONE(
+    in  string sample,
+    out int    reads,
+)
+{
+    call ALIGN(
+        sample = self.sample,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int[]    reads,
+)
+{
+    map call ALIGN_ONE(
+        sample = split self.samples,
+    )
+
+    return (
+        reads = ALIGN_ONE.reads,
+    )
+}
+`)
+}
+
+func TestMapCallSplitStage(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    out int    reads,
+    src py     "stages/align",
+) split using (
+    in  int    chunk,
+)
+
+pipeline ALIGN_ALL(
+    in  string[] samples,
+    out int[]    reads,
+)
+{
+    map call ALIGN(
+        sample = split self.samples,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+`)
+}
+
+func TestDisableUpstream(t *testing.T) {
+	if ast := testGood(t, `
+stage CHECK(
+    in  int  value,
+    out bool no_data,
+    src py   "stages/check",
+)
+
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SQ_PIPE(
+    in  int  value,
+    in  bool skip_square,
+    out int  square,
+)
+{
+    call CHECK(
+        value = self.value,
+    )
+
+    call SQUARE(
+        value = self.value,
+    ) using (
+        disabled = self.skip_square or CHECK.no_data,
+    )
+
+    return (
+        square = SQUARE.square,
+    )
+}
+`); ast != nil {
+		mods := ast.Pipelines[0].Calls[1].Modifiers
+		if dis := mods.Bindings.Table[disabled]; dis == nil {
+			t.Errorf("Expected disable binding.")
+		} else if disj, ok := dis.Exp.(*OrExp); !ok {
+			t.Errorf("Expected disjunction, got %T", dis.Exp)
+		} else if len(disj.Refs) != 2 {
+			t.Errorf("Expected 2 references, got %d", len(disj.Refs))
+		} else if disj.Refs[1].Kind != KindCall || disj.Refs[1].Id != "CHECK" {
+			t.Errorf("Expected reference to CHECK, got %v", disj.Refs[1])
+		}
+	}
+}
+
+func TestDisableUpstreamBadType(t *testing.T) {
+	testBadCompile(t, `
+stage CHECK(
+    in  int value,
+    out int no_data,
+    src py  "stages/check",
+)
+
+stage SQUARE(
+    in  int value,
+    out int square,
+    src py  "stages/square",
+)
+
+pipeline SQ_PIPE(
+    in  int  value,
+    in  bool skip_square,
+    out int  square,
+)
+{
+    call CHECK(
+        value = self.value,
+    )
+
+    call SQUARE(
+        value = self.value,
+    ) using (
+        disabled = self.skip_square or CHECK.no_data,
+    )
+
+    return (
+        square = SQUARE.square,
+    )
+}
+`)
+}
+
+func TestDefaultValue(t *testing.T) {
+	if ast := testGood(t, `
+stage ALIGN(
+    in  string   sample,
+    in  int      threads = 4,
+    in  string[] flags   = ["-a", "-b"] "extra aligner flags",
+    out int      reads,
+    src py       "stages/align",
+)
+
+pipeline ALIGN_ONE(
+    in  string sample,
+    in  int    threads = 8,
+    out int    reads,
+)
+{
+    call ALIGN(
+        sample  = self.sample,
+        threads = self.threads,
+    )
+
+    return (
+        reads = ALIGN.reads,
+    )
+}
+
+call ALIGN_ONE(
+    sample = "foo",
+)
+`); ast != nil {
+		param := ast.Stages[0].InParams.Table["threads"]
+		if def, ok := param.GetDefault().(*ValExp); !ok {
+			t.Errorf("Expected default value, got %v", param.GetDefault())
+		} else if def.Value != int64(4) {
+			t.Errorf("Expected default 4, got %v", def.Value)
+		}
+		if help := ast.Stages[0].InParams.Table["flags"].GetHelp(); help != "extra aligner flags" {
+			t.Errorf("Expected help string, got %q", help)
+		}
+		if def := ast.Stages[0].InParams.Table["sample"].GetDefault(); def != nil {
+			t.Errorf("Expected no default value, got %v", def)
+		}
+	}
+}
+
+func TestDefaultValueBadType(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    in  int    threads = "four",
+    out int    reads,
+    src py     "stages/align",
+)
+`)
+}
+
+func TestDefaultValueRequired(t *testing.T) {
+	testBadCompile(t, `
+stage ALIGN(
+    in  string sample,
+    in  int    threads = 4,
+    out int    reads,
+    src py     "stages/align",
+)
+
+call ALIGN(
+    threads = 2,
+)
+`)
+}
+
+func TestDefaultValueStructMember(t *testing.T) {
+	testBadCompile(t, `
+struct SAMPLE(
+    in string name,
+    in int    lanes = 1,
+)
+`)
+}
+
+func TestStringEscapes(t *testing.T) {
+	if ast := testGood(t, `
+stage ECHO(
+    in  string message  "the \"message\" to echo",
+    out string echoed,
+    src py     "stages/echo",
+)
+
+call ECHO(
+    message = "tab\there
+café \\ \/",
+)
+`); ast != nil {
+		if help := ast.Stages[0].InParams.Table["message"].GetHelp(); help != `the "message" to echo` {
+			t.Errorf("Incorrect help string %q", help)
+		}
+		exp := ast.Call.Bindings.Table["message"].Exp.(*ValExp)
+		if exp.Value != "tab\there\ncafé \\ /" {
+			t.Errorf("Incorrect string value %q", exp.Value)
+		}
+	}
+}
+
+func TestMultiLineStringLines(t *testing.T) {
+	if _, err := yaccParse(`
+stage ECHO(
+    in  string message  "a help
+string spanning
+lines",
+    out string echoed,
+    src py     "stages/echo",
+)
+
+call ECHO(
+    message = "foo",
+    ,
+)
+`, nil); err == nil {
+		t.Error("Expected failure.")
+	} else if err.errors[0].loc != 12 {
+		t.Errorf("Expected error on line 12, got %d", err.errors[0].loc)
+	}
+}
+
+func TestBadStringEscape(t *testing.T) {
+	testBadGrammar(t, `
+stage ECHO(
+    in  string message  "bad \q escape",
+    out string echoed,
+    src py     "stages/echo",
+)
+`)
+}
+
+func TestRetain(t *testing.T) {
+	if ast := testGood(t, `
+filetype json;
+filetype bam;
+
+stage QC(
+    in  bam  reads,
+    out json summary,
+    out bam  sorted,
+    src py   "stages/qc",
+) using (
+    mem_gb = 2,
+) retain (
+    summary,
+)
+`); ast != nil {
+		retain := ast.Stages[0].Retain
+		if retain == nil || len(retain.Params) != 1 || retain.Params[0].Id != "summary" {
+			t.Errorf("Incorrect retained outputs %v", retain)
+		}
+	}
+}
+
+func TestRetainUnknown(t *testing.T) {
+	testBadCompile(t, `
+filetype json;
+
+stage QC(
+    out json summary,
+    src py   "stages/qc",
+) retain (
+    metrics,
+)
+`)
+}
+
+func TestRetainNotFile(t *testing.T) {
+	testBadCompile(t, `
+stage QC(
+    out int count,
+    src py  "stages/qc",
+) retain (
+    count,
+)
+`)
+}
+
+func TestResourceExpressions(t *testing.T) {
+	ast := testGood(t, `
+filetype bam;
+
+stage SORT(
+    in  bam[] reads,
+    in  int   n,
+    in  float scale,
+    out bam   sorted,
+    src py    "stages/sort",
+) using (
+    threads = min(len(self.reads), 4),
+    mem_gb  = ceil(size(self.reads) * self.scale + self.n-1),
+)
+`)
+	if ast == nil {
+		return
+	}
+	res := ast.Stages[0].Resources
+	if res.ThreadExp == nil || res.MemExp == nil {
+		t.Fatal("Expected resource expressions.")
+	}
+	args := map[string]interface{}{
+		"reads": []interface{}{"a.bam", "b.bam"},
+		"n":     json.Number("3"),
+		"scale": 1.5,
+	}
+	if threads, err := res.ThreadExp.Eval(args); err != nil {
+		t.Error(err)
+	} else if threads != 2 {
+		t.Errorf("Expected 2 threads, got %g", threads)
+	}
+}
+
+func TestResourceSize(t *testing.T) {
+	f, err := ioutil.TempFile("", "resource_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if err := f.Truncate(512 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	exp := &ResourceBinExp{
+		Op: "*",
+		Left: &ResourceFunc{
+			Name: "size",
+			Args: []ResourceExp{&ResourceRef{Id: "reads"}},
+		},
+		Right: &ResourceNum{Value: 3},
+	}
+	if mem, err := exp.Eval(map[string]interface{}{
+		"reads": []interface{}{f.Name(), nil},
+	}); err != nil {
+		t.Error(err)
+	} else if mem != 1.5 {
+		t.Errorf("Expected 1.5, got %g", mem)
+	}
+	if _, err := exp.Eval(map[string]interface{}{
+		"reads": []interface{}{f.Name() + ".missing"},
+	}); err == nil {
+		t.Error("Expected missing file to fail.")
+	}
+}
+
+func TestResourceExpressionBadInput(t *testing.T) {
+	testBadCompile(t, `
+stage SORT(
+    in  int n,
+    out int m,
+    src py  "stages/sort",
+) using (
+    mem_gb = self.k * 2,
+)
+`)
+	testBadCompile(t, `
+stage SORT(
+    in  string n,
+    out int    m,
+    src py     "stages/sort",
+) using (
+    mem_gb = self.n * 2,
+)
+`)
+	testBadCompile(t, `
+stage SORT(
+    in  int n,
+    out int m,
+    src py  "stages/sort",
+) using (
+    mem_gb = log(self.n),
+)
+`)
+}
+
+func TestErrorRecovery(t *testing.T) {
+	_, err := parseFiles(t, map[string]string{
+		"main.mro": `
+filetype bam;
+filetype ;
+
+pipeline PIPE(
+    in  int x,
+    out int y,
+)
+{
+    call STAGE(
+        x = self.bogus,
+    )
+
+    return (
+        y = STAGE.y,
+    )
+}
+
+stage BROKEN(
+    in  int x
+    out int y,
+    src py  "stages/broken",
+)
+
+filetype txt;
+
+stage STAGE(
+    in  int x,
+    out int y,
+    src py  "stages/stage",
+)
+`,
+	})
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an error list, got %v", err)
+	}
+	if len(errs) != 4 {
+		t.Fatalf("Expected 4 errors, got %d:\n%v", len(errs), errs)
+	}
+	if perr, ok := errs[0].(*ParseError); !ok {
+		t.Errorf("Expected a parse error, got %v", errs[0])
+	} else if perr.fname != "main.mro" || perr.loc != 3 || perr.col != 10 {
+		t.Errorf("Incorrect location %s:%d:%d", perr.fname, perr.loc, perr.col)
+	}
+	for i, line := range []int{6, 11} {
+		if aerr, ok := errs[i+1].(*AstError); !ok {
+			t.Errorf("Expected a semantic error, got %v", errs[i+1])
+		} else if aerr.Node.Loc != line {
+			t.Errorf("Incorrect location %d", aerr.Node.Loc)
+		}
+	}
+	if perr, ok := errs[3].(*ParseError); !ok {
+		t.Errorf("Expected a parse error, got %v", errs[3])
+	} else if perr.token != "out" || perr.loc != 21 || perr.col != 5 {
+		t.Errorf("Incorrect error %v", perr)
+	}
+}
+
+// Tests that semantic errors are all reported, and that references to
+// declarations with syntax errors are not reported again.
+func TestErrorRecoveryAllErrors(t *testing.T) {
+	_, err := parseFiles(t, map[string]string{
+		"main.mro": `
+struct PAIR(
+    in int   a,
+    in bogus b,
+)
+
+stage A(
+    in  int x
+    out int y,
+    src py  "stages/a",
+)
+
+stage B(
+    in  int    v,
+    in  undef  u,
+    out int    w,
+    src py     "stages/b",
+)
+
+pipeline P(
+    in  int p,
+    out int r,
+)
+{
+    call A(
+        x = self.p,
+    )
+
+    call B(
+        v = self.q,
+        u = A.y,
+    )
+
+    return (
+        r = B.z,
+    )
+}
+
+pipeline Q(
+    in  int p,
+    out int r,
+    out int s,
+)
+{
+    call B(
+        v = self.p,
+    )
+
+    return (
+        r = B.w,
+    )
+}
+
+call Q(
+    p = "x",
+)
+`,
+	})
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an error list, got %v", err)
+	}
+	expected := []string{
+		"TypeError: undefined type 'bogus' at main.mro:4:5.",
+		"ParseError: unexpected token 'out' at main.mro:9:5.",
+		"TypeError: undefined type 'undef' at main.mro:15:5.",
+		"ScopeNameError: 'q' is not an input parameter of pipeline 'P' at main.mro:30:13.",
+		"NoSuchOutputError: 'z' is not an output parameter of 'B' at main.mro:35:13.",
+		"ArgumentNotSuppliedError: no argument supplied for parameter 'u' at main.mro:45:11.",
+		"ReturnError: pipeline output parameter 's' is not returned at main.mro:49:5.",
+		"TypeMismatchError: expected type 'int' for 'p' but got 'string' instead at main.mro:55:5.",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d:\n%v",
+			len(expected), len(errs), errs)
+	}
+	for i, msg := range expected {
+		if !strings.Contains(errs[i].Error(), msg) {
+			t.Errorf("Expected %q, got %v", msg, errs[i])
+		}
+	}
+}
+
+func TestErrorRecoveryConsecutive(t *testing.T) {
+	_, err := parseFiles(t, map[string]string{
+		"main.mro": `
+filetype txt
+
+stage FIRST(
+    in  int x,
+    out int y,
+    src py  "stages/first",
+) using (
+    threads = 2 2,
+)
+
+stage SECOND(
+    in  int x
+    out int y,
+    src py  "stages/second",
+)
+
+stage THIRD(
+    in  int x,
+    out int y,
+    src py  "stages/third",
+)
+
+pipeline PIPE(
+    in  int x,
+    out int y,
+)
+{
+    call THIRD(
+        x = self.x self.x,
+    )
+
+    call THIRD as AGAIN(
+        x = 1 2,
+    )
+
+    return (
+        y = THIRD.y,
+    )
+}
+`,
+	})
+	all, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an error list, got %v", err)
+	}
+	// The skipped bindings are also reported as missing.
+	var errs []*ParseError
+	for _, err := range all {
+		if perr, ok := err.(*ParseError); ok {
+			errs = append(errs, perr)
+		}
+	}
+	expect := []struct {
+		token string
+		loc   int
+	}{
+		{"stage", 4},
+		{"2", 9},
+		{"out", 14},
+		{"self", 30},
+		{"2", 34},
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("Expected %d syntax errors, got %d:\n%v", len(expect), len(errs), all)
+	}
+	for i, e := range expect {
+		if perr := errs[i]; perr.token != e.token || perr.loc != e.loc {
+			t.Errorf("Expected '%s' at line %d, got '%s' at line %d",
+				e.token, e.loc, perr.token, perr.loc)
+		}
+	}
+}
+
+func TestErrorCaret(t *testing.T) {
+	_, err := parseFiles(t, map[string]string{
+		"main.mro": `
+stage STAGE(
+	in  int x,
+	out int y,
+	src py  "stages/stage",
+)
+
+call STAGE(
+	x = "foo",
+)
+`,
+	})
+	if err == nil {
+		t.Fatal("Expected failure.")
+	}
+	const expect = "at main.mro:9:2.\n" +
+		"\t\tx = \"foo\",\n" +
+		"\t\t^"
+	if msg := err.Error(); !strings.Contains(msg, expect) {
+		t.Errorf("Expected caret in error message, got\n%s", msg)
+	}
+}
+
+func TestNodeSpan(t *testing.T) {
+	ast := testGood(t, `
+stage SORT(
+    in  int[] values,
+    out int[] sorted,
+    src py    "stages/sort",
+) split (
+) using (
+    threads = 2,
+)
+
+pipeline SORT_ALL(
+    out int[] sorted,
+)
+{
+    call SORT(
+        values = [
+            1,
+            2,
+        ],
+    ) using (
+        local = true,
+    )
+
+    return (
+        sorted = SORT.sorted,
+    )
+}
+`)
+	if ast == nil {
+		return
+	}
+	check := func(what string, node *AstNode, loc, col, endLoc, endCol int) {
+		t.Helper()
+		if node.Loc != loc || node.Col != col ||
+			node.EndLoc != endLoc || node.EndCol != endCol {
+			t.Errorf("Expected %s at %d:%d-%d:%d, got %d:%d-%d:%d",
+				what, loc, col, endLoc, endCol,
+				node.Loc, node.Col, node.EndLoc, node.EndCol)
+		}
+	}
+	stage := ast.Stages[0]
+	check("stage", &stage.Node, 2, 7, 9, 2)
+	check("input", stage.InParams.List[0].getNode(), 3, 5, 3, 22)
+	check("src", &stage.Src.Node, 5, 5, 5, 29)
+	check("resources", &stage.Resources.Node, 7, 3, 9, 2)
+	pipeline := ast.Pipelines[0]
+	check("pipeline", &pipeline.Node, 11, 10, 27, 2)
+	call := pipeline.Calls[0]
+	check("call", &call.Node, 15, 5, 22, 6)
+	check("binding", &call.Bindings.List[0].Node, 16, 9, 19, 11)
+	check("array", call.Bindings.List[0].Exp.getNode(), 16, 18, 19, 10)
+	check("return", &pipeline.Ret.Node, 24, 5, 26, 6)
+}
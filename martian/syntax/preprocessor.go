@@ -22,6 +22,7 @@ type FileLoc struct {
 	fname        string
 	loc          int
 	includedFrom []string
+	scope        *importScope
 }
 
 func lineCount(src string) int {
@@ -33,16 +34,26 @@ func lineNumOfOffset(src string, offset int) int {
 	return strings.Count(src[0:offset], "\n")
 }
 
-var includeRe = regexp.MustCompile("(?mi:^\\s*@include\\s+\"([^\\\"]+)\")")
+var includeRe = regexp.MustCompile(
+	`(?mi:^[ \t]*@(include|import)\s+"([^\"]+)"(?:[ \t]+as[ \t]+(\w+)|[ \t]*\(([^)]*)\))?)`)
 
 /*
  * Inject contents of included files, recursively.
+ *
+ * Imported files are injected the same way as included files, but their
+ * lines are tagged with a new import scope, so that their declarations can
+ * be renamed into the importing file's namespace after parsing.
+ *
+ * Directives in the top-level file are recorded in includes, so that
+ * unused includes can be reported after parsing.
  */
 func preprocess(src string,
 	fname string,
 	foundNames map[string]struct{},
 	stack []string,
-	incPaths []string) (string, []string, []FileLoc, *PreprocessError) {
+	incPaths []string,
+	scope *importScope,
+	includes *[]*IncludeUsage) (string, []string, []FileLoc, *PreprocessError) {
 
 	for i, inc := range stack {
 		if inc == fname {
@@ -63,7 +74,7 @@ func preprocess(src string,
 	// the source insertion mechanics.
 	locmap := make([]FileLoc, lineCount(src))
 	for i := range locmap {
-		locmap[i] = FileLoc{fname, i, nil}
+		locmap[i] = FileLoc{fname, i, nil, scope}
 	}
 	insertOffset := 0
 
@@ -77,13 +88,49 @@ func preprocess(src string,
 	origLocmap := append(make([]FileLoc, 0, len(locmap)), locmap...)
 	processedSrc := includeRe.ReplaceAllStringFunc(src, func(match string) string {
 		// Get name of file to be included.
-		ifname := includeRe.FindStringSubmatch(match)[1]
+		submatch := includeRe.FindStringSubmatch(match)
+		ifname := submatch[2]
+
+		// Determine line number of src to insert included source.
+		includeLine := lineNumOfOffset(src, offsets[0][0]) + insertOffset
+		includeLoc := origLocmap[includeLine-insertOffset]
+		// Included lines add this to their included from stack.
+		includedFrom := fmt.Sprintf("%s:%d",
+			includeLoc.fname,
+			includeLoc.loc+1)
+		offsets = offsets[1:] // shift()
+
 		if ifname == fname {
 			fileNotFoundError.messages = append(fileNotFoundError.messages, fname+" includes itself.")
 			return ""
 		}
 
-		if _, ok := foundNames[ifname]; ok {
+		// Imported files get their own scope, and are only deduplicated
+		// against imports of the same file into the same namespace.
+		subScope := scope
+		subFoundNames := foundNames
+		if strings.ToLower(submatch[1]) == "import" {
+			node := AstNode{
+				Loc:          includeLoc.loc + 1,
+				Fname:        includeLoc.fname,
+				IncludeStack: includeLoc.includedFrom,
+			}
+			var err error
+			subScope, err = scope.addImport(ifname, submatch[3], submatch[4], node)
+			if err != nil {
+				fileNotFoundError.messages = append(fileNotFoundError.messages, err.Error())
+				return ""
+			} else if subScope == nil {
+				// Already imported.
+				return ""
+			}
+			subFoundNames = make(map[string]struct{})
+		} else if submatch[3] != "" || submatch[4] != "" {
+			fileNotFoundError.messages = append(fileNotFoundError.messages,
+				fmt.Sprintf("@include of %s at %s cannot select names; use @import instead.",
+					ifname, includedFrom))
+			return ""
+		} else if _, ok := foundNames[ifname]; ok {
 			return ""
 		} else {
 			foundNames[ifname] = struct{}{}
@@ -91,6 +138,15 @@ func preprocess(src string,
 
 		// Add name of file to include files list.
 		ifnames = append(ifnames, ifname)
+		if len(stack) == 1 {
+			*includes = append(*includes, &IncludeUsage{
+				Node: AstNode{
+					Loc:   includeLoc.loc + 1,
+					Fname: includeLoc.fname,
+				},
+				Fname: ifname,
+			})
+		}
 
 		// Search incPaths for the file.
 		// If not found, add this file to error list.
@@ -104,16 +160,9 @@ func preprocess(src string,
 		data, _ := ioutil.ReadFile(ifpath)
 		includeSrc := string(data)
 
-		// Determine line number of src to insert included source.
-		includeLine := lineNumOfOffset(src, offsets[0][0]) + insertOffset
-		// Included lines add this to their included from stack.
-		includedFrom := fmt.Sprintf("%s:%d",
-			origLocmap[includeLine-insertOffset].fname,
-			origLocmap[includeLine-insertOffset].loc+1)
-		offsets = offsets[1:] // shift()
-
 		// Recursively preprocess the included source.
-		processedIncludeSrc, _, processedIncludeLocmap, err := preprocess(includeSrc, ifname, foundNames, stack, incPaths)
+		processedIncludeSrc, _, processedIncludeLocmap, err := preprocess(
+			includeSrc, ifname, subFoundNames, stack, incPaths, subScope, includes)
 		if err != nil {
 			fileNotFoundError.files = append(fileNotFoundError.files, err.files...)
 			fileNotFoundError.messages = append(fileNotFoundError.messages, err.messages...)
@@ -124,13 +173,15 @@ func preprocess(src string,
 		// we linearly insert more included source blocks.
 		insertOffset += processedIncludeLineCount - 1 // because we're replacing 1 line with many
 
-		// Mirror the actual source insertion in the locmap.
-		newLocMap := locmap[:includeLine]
+		// Mirror the actual source insertion in the locmap.  Cap the prefix
+		// so that appending to it does not overwrite the lines after it.
+		newLocMap := locmap[:includeLine:includeLine]
 		for _, loc := range processedIncludeLocmap {
 			newLocMap = append(newLocMap, FileLoc{
 				fname:        loc.fname,
 				loc:          loc.loc,
 				includedFrom: append(loc.includedFrom, includedFrom),
+				scope:        loc.scope,
 			})
 		}
 		locmap = append(newLocMap, locmap[includeLine+1:]...)
@@ -142,3 +193,312 @@ func preprocess(src string,
 	}
 	return processedSrc, ifnames, locmap, nil
 }
+
+//
+// Import scopes
+//
+
+// The namespace of the declarations in an imported file.
+//
+// Declarations are renamed after parsing so that they do not collide with
+// declarations in other scopes.  If the import has a prefix, every name
+// visible in the imported file is visible in the importing file as
+// prefix.NAME.  Otherwise, only the selected names are visible, unchanged.
+// Names which are not visible are qualified with a generated prefix, so that
+// the renamed declarations can still be written out as MRO source.
+type importScope struct {
+	parent   *importScope
+	fname    string
+	prefix   string
+	names    map[string]bool
+	node     AstNode
+	children map[string]*importScope
+
+	// The generated prefix for names which are not visible in the parent
+	// scope.
+	hidden string
+
+	// The number of imports in the tree of scopes, if this is the root.
+	imports int
+
+	// Names declared in this scope, filled in after parsing.
+	callables map[string]bool
+	structs   map[string]bool
+}
+
+func newRootScope(fname string) *importScope {
+	return &importScope{
+		fname:     fname,
+		children:  make(map[string]*importScope),
+		callables: make(map[string]bool),
+		structs:   make(map[string]bool),
+	}
+}
+
+// Add an import of the given file into this scope.  Returns nil if an
+// equivalent import was already added, in which case any newly selected
+// names are merged into it.
+func (scope *importScope) addImport(fname, prefix, names string,
+	node AstNode) (*importScope, error) {
+	var selected map[string]bool
+	if prefix == "" {
+		if strings.TrimSpace(names) == "" {
+			return nil, fmt.Errorf(
+				"@import of %s at %s:%d must have a prefix or select names.",
+				fname, node.Fname, node.Loc)
+		}
+		selected = make(map[string]bool)
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				selected[name] = true
+			}
+		}
+	}
+	key := fname + " as " + prefix
+	if existing := scope.children[key]; existing != nil {
+		for name := range selected {
+			existing.names[name] = true
+		}
+		return nil, nil
+	}
+	root := scope
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.imports++
+	child := newRootScope(fname)
+	child.parent = scope
+	child.prefix = prefix
+	child.names = selected
+	child.node = node
+	child.hidden = fmt.Sprintf("_import%d", root.imports)
+	scope.children[key] = child
+	return child, nil
+}
+
+// Get the name by which a name declared or visible in this scope is known
+// in the outermost scope.
+func (scope *importScope) fullName(name string) string {
+	if scope.parent == nil {
+		return name
+	} else if scope.prefix != "" {
+		return scope.parent.fullName(scope.prefix + "." + name)
+	} else if scope.names[name] {
+		return scope.parent.fullName(name)
+	} else {
+		return scope.parent.fullName(scope.hidden + "." + name)
+	}
+}
+
+// Get the names visible in this scope, mapped to their full names, given
+// the names declared in each scope.
+func (scope *importScope) visible(declared func(*importScope) map[string]bool) map[string]string {
+	names := make(map[string]string)
+	for name := range declared(scope) {
+		names[name] = scope.fullName(name)
+	}
+	for _, child := range scope.children {
+		for name, full := range child.visible(declared) {
+			if child.prefix != "" {
+				names[child.prefix+"."+name] = full
+			} else if child.names[name] {
+				names[name] = full
+			}
+		}
+	}
+	return names
+}
+
+// Check that every name selected by an import is visible in the imported
+// scope.
+func (scope *importScope) checkSelected() error {
+	var errs ErrorList
+	for _, child := range scope.children {
+		if child.names != nil {
+			callables := child.visible(func(s *importScope) map[string]bool {
+				return s.callables
+			})
+			structs := child.visible(func(s *importScope) map[string]bool {
+				return s.structs
+			})
+			for name := range child.names {
+				if _, ok := callables[name]; ok {
+					continue
+				}
+				if _, ok := structs[name]; ok {
+					continue
+				}
+				node := child.node
+				errs = append(errs, &AstError{
+					Node: &node,
+					Msg: fmt.Sprintf(
+						"ImportError: '%s' is not declared in %s",
+						name, child.fname),
+				})
+			}
+		}
+		if err := child.checkSelected(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+// Check that struct, stage and pipeline names are not qualified.  Qualified
+// names come only from @import directives, which apply them after this
+// check, or from the source generated by flatten.
+func (global *Ast) checkDeclarationNames() error {
+	if len(global.comments) > 0 && global.comments[0].Loc == 1 &&
+		global.comments[0].Value == flattenedHeader {
+		return nil
+	}
+	var errs ErrorList
+	check := func(node AstNodable, id string) {
+		if strings.ContainsRune(id, '.') {
+			errs = append(errs, global.err(node,
+				"QualifiedNameError: cannot declare qualified name '%s'", id))
+		}
+	}
+	for _, st := range global.StructTypes {
+		check(st, st.Id)
+	}
+	for _, callable := range global.Callables.List {
+		check(callable, callable.GetId())
+	}
+	return errs.If()
+}
+
+// Rename the declarations of imported files, and the references to them, into
+// the namespace of the root scope.
+func (global *Ast) applyImports(root *importScope, locmap []FileLoc) error {
+	if len(root.children) == 0 {
+		return nil
+	}
+
+	// Every inclusion of a file has a distinct include stack, so that
+	// together with the file name identifies the scope of a node.
+	scopeKey := func(fname string, includedFrom []string) string {
+		return fname + "\x00" + strings.Join(includedFrom, "\x00")
+	}
+	scopes := make(map[string]*importScope)
+	for _, loc := range locmap {
+		if loc.scope != nil {
+			scopes[scopeKey(loc.fname, loc.includedFrom)] = loc.scope
+		}
+	}
+	scopeOf := func(node *AstNode) *importScope {
+		if scope := scopes[scopeKey(node.Fname, node.IncludeStack)]; scope != nil {
+			return scope
+		}
+		return root
+	}
+
+	for _, st := range global.StructTypes {
+		scopeOf(&st.Node).structs[st.Id] = true
+	}
+	for _, callable := range global.Callables.List {
+		scopeOf(callable.getNode()).callables[callable.GetId()] = true
+	}
+	// Declarations with syntax errors may be either kind.
+	for id, node := range global.failedDecs {
+		node := node
+		scope := scopeOf(&node)
+		scope.structs[id] = true
+		scope.callables[id] = true
+	}
+	if err := root.checkSelected(); err != nil {
+		return err
+	}
+
+	type scopeNames struct {
+		callables map[string]string
+		structs   map[string]string
+	}
+	cache := make(map[*importScope]*scopeNames)
+	namesOf := func(node *AstNode) (*importScope, *scopeNames) {
+		scope := scopeOf(node)
+		names := cache[scope]
+		if names == nil {
+			names = &scopeNames{
+				callables: scope.visible(func(s *importScope) map[string]bool {
+					return s.callables
+				}),
+				structs: scope.visible(func(s *importScope) map[string]bool {
+					return s.structs
+				}),
+			}
+			cache[scope] = names
+		}
+		return scope, names
+	}
+	var renameType func(names *scopeNames, tname string) string
+	renameType = func(names *scopeNames, tname string) string {
+		if elem, dim, ok := ParseMapType(tname); ok {
+			return "map<" + renameType(names, elem) + strings.Repeat("[]", dim) + ">"
+		} else if full, ok := names.structs[tname]; ok {
+			return full
+		}
+		return tname
+	}
+	renameParams := func(names *scopeNames, params *Params) {
+		if params == nil {
+			return
+		}
+		for _, param := range params.List {
+			switch param := param.(type) {
+			case *InParam:
+				param.Tname = renameType(names, param.Tname)
+			case *OutParam:
+				param.Tname = renameType(names, param.Tname)
+			}
+		}
+	}
+	renameCall := func(names *scopeNames, call *CallStm) {
+		if full, ok := names.callables[call.DecId]; ok {
+			call.DecId = full
+		}
+	}
+
+	// Compute all of the names before renaming anything.
+	for _, st := range global.StructTypes {
+		namesOf(&st.Node)
+	}
+	for _, callable := range global.Callables.List {
+		namesOf(callable.getNode())
+	}
+	for _, st := range global.StructTypes {
+		scope, names := namesOf(&st.Node)
+		renameParams(names, st.Members)
+		st.Id = scope.fullName(st.Id)
+	}
+	for _, stage := range global.Stages {
+		scope, names := namesOf(&stage.Node)
+		renameParams(names, stage.InParams)
+		renameParams(names, stage.OutParams)
+		renameParams(names, stage.ChunkIns)
+		renameParams(names, stage.ChunkOuts)
+		stage.Id = scope.fullName(stage.Id)
+	}
+	for _, pipeline := range global.Pipelines {
+		scope, names := namesOf(&pipeline.Node)
+		renameParams(names, pipeline.InParams)
+		renameParams(names, pipeline.OutParams)
+		for _, call := range pipeline.Calls {
+			renameCall(names, call)
+		}
+		pipeline.Id = scope.fullName(pipeline.Id)
+	}
+	if global.Call != nil {
+		_, names := namesOf(&global.Call.Node)
+		renameCall(names, global.Call)
+	}
+	if len(global.failedDecs) > 0 {
+		failed := make(map[string]AstNode, len(global.failedDecs))
+		for id, node := range global.failedDecs {
+			node := node
+			failed[scopeOf(&node).fullName(id)] = node
+		}
+		global.failedDecs = failed
+	}
+	return nil
+}
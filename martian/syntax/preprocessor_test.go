@@ -0,0 +1,366 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// Write the given files into a temporary directory and parse the one named
+// main.mro.
+func parseFiles(t *testing.T, files map[string]string) (*Ast, error) {
+	t.Helper()
+	_, ast, err := parseFilesSource(t, files)
+	return ast, err
+}
+
+// Write the given files into a temporary directory and parse the one named
+// main.mro, returning the preprocessed source as well.
+func parseFilesSource(t *testing.T, files map[string]string) (string, *Ast, error) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "preprocess")
+	if err != nil {
+		t.Fatal("Failed to create tempdir:", err)
+	}
+	defer os.RemoveAll(root)
+	for name, src := range files {
+		if err := ioutil.WriteFile(path.Join(root, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	postsrc, _, ast, err := ParseSource(files["main.mro"],
+		path.Join(root, "main.mro"), nil, false)
+	return postsrc, ast, err
+}
+
+const sortLibA = `
+filetype bam;
+
+stage SORT_BAM(
+    in  bam input,
+    out bam sorted,
+    src py  "stages/a/sort",
+)
+`
+
+const sortLibB = `
+filetype bam;
+
+struct SORTED(
+    in bam sorted,
+    in int reads,
+)
+
+stage HELPER(
+    in  bam    input,
+    out SORTED result,
+    src py     "stages/b/helper",
+)
+
+pipeline SORT_BAM(
+    in  bam    input,
+    out SORTED result,
+)
+{
+    call HELPER(
+        input = self.input,
+    )
+
+    return (
+        result = HELPER.result,
+    )
+}
+`
+
+func TestImportPrefix(t *testing.T) {
+	ast, err := parseFiles(t, map[string]string{
+		"a.mro": sortLibA,
+		"b.mro": sortLibB,
+		"main.mro": `
+@import "a.mro" as a
+@import "b.mro" as b
+
+pipeline SORT_BOTH(
+    in  bam       input,
+    out bam       sorted_a,
+    out b.SORTED  sorted_b,
+)
+{
+    call a.SORT_BAM(
+        input = self.input,
+    )
+
+    call b.SORT_BAM as SORT_B(
+        input = self.input,
+    )
+
+    return (
+        sorted_a = SORT_BAM.sorted,
+        sorted_b = SORT_B.result,
+    )
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{
+		"a.SORT_BAM", "b.SORT_BAM", "b.HELPER", "SORT_BOTH",
+	} {
+		if ast.Callables.Table[id] == nil {
+			t.Errorf("Expected %s to be declared.", id)
+		}
+	}
+	if ast.StructTypeTable["b.SORTED"] == nil {
+		t.Error("Expected b.SORTED to be declared.")
+	}
+	pipeline := ast.Callables.Table["SORT_BOTH"].(*Pipeline)
+	if call := pipeline.Calls[0]; call.Id != "SORT_BAM" || call.DecId != "a.SORT_BAM" {
+		t.Errorf("Incorrect call %s of %s", call.Id, call.DecId)
+	}
+	if call := pipeline.Calls[1]; call.Id != "SORT_B" || call.DecId != "b.SORT_BAM" {
+		t.Errorf("Incorrect call %s of %s", call.Id, call.DecId)
+	}
+}
+
+func TestImportSelected(t *testing.T) {
+	files := map[string]string{
+		"b.mro": sortLibB,
+		"main.mro": `
+@import "b.mro" (SORT_BAM, SORTED)
+
+pipeline SORT(
+    in  bam    input,
+    out SORTED result,
+)
+{
+    call SORT_BAM(
+        input = self.input,
+    )
+
+    return (
+        result = SORT_BAM.result,
+    )
+}
+`,
+	}
+	if ast, err := parseFiles(t, files); err != nil {
+		t.Fatal(err)
+	} else if ast.Callables.Table["HELPER"] != nil {
+		t.Error("Expected HELPER to be hidden.")
+	}
+
+	// Unselected declarations are not visible.
+	files["main.mro"] = `
+@import "b.mro" (SORT_BAM, SORTED)
+
+pipeline SORT(
+    in  bam    input,
+    out SORTED result,
+)
+{
+    call HELPER(
+        input = self.input,
+    )
+
+    return (
+        result = HELPER.result,
+    )
+}
+`
+	if _, err := parseFiles(t, files); err == nil {
+		t.Error("Expected hidden callable to be undefined.")
+	} else if !strings.Contains(err.Error(), "ScopeNameError") {
+		t.Error("Expected a scope error, got", err)
+	}
+
+	// Names which do not exist are errors.
+	files["main.mro"] = `
+@import "b.mro" (SORT_BAM, NOT_THERE)
+`
+	if _, err := parseFiles(t, files); err == nil {
+		t.Error("Expected undeclared import to fail.")
+	} else if !strings.Contains(err.Error(), "NOT_THERE") {
+		t.Error("Expected error to name the missing declaration, got", err)
+	}
+}
+
+func TestImportCollision(t *testing.T) {
+	// Without namespaces, the two declarations collide.
+	if _, err := parseFiles(t, map[string]string{
+		"a.mro": sortLibA,
+		"b.mro": sortLibB,
+		"main.mro": `
+@include "a.mro"
+@include "b.mro"
+`,
+	}); err == nil {
+		t.Error("Expected duplicate declarations to fail.")
+	}
+}
+
+func TestImportSource(t *testing.T) {
+	postsrc, ast, err := parseFilesSource(t, map[string]string{
+		"a.mro": sortLibA,
+		"b.mro": sortLibB,
+		"main.mro": `
+@import "a.mro" as a
+@import "b.mro" (SORT_BAM, SORTED)
+
+pipeline SORT_BOTH(
+    in  bam    input,
+    out bam    sorted_a,
+    out SORTED sorted_b,
+)
+{
+    call a.SORT_BAM(
+        input = self.input,
+    )
+
+    call SORT_BAM as SORT_B(
+        input = self.input,
+    )
+
+    return (
+        sorted_a = SORT_BAM.sorted,
+        sorted_b = SORT_B.result,
+    )
+}
+
+call SORT_BOTH(
+    input = "in.bam",
+)
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The preprocessed source is what the runtime saves with a pipestance,
+	// so it must parse again by itself, to the same declarations.
+	_, _, reparsed, err := ParseSource(postsrc, "_mrosource", nil, false)
+	if err != nil {
+		t.Fatal("Failed to parse the preprocessed source:", err, "\n", postsrc)
+	}
+	if len(reparsed.Callables.List) != len(ast.Callables.List) {
+		t.Errorf("Expected %d callables, got %d",
+			len(ast.Callables.List), len(reparsed.Callables.List))
+	}
+	for _, callable := range ast.Callables.List {
+		if reparsed.Callables.Table[callable.GetId()] == nil {
+			t.Errorf("Expected %s to be declared.", callable.GetId())
+		}
+	}
+	if reparsed.StructTypeTable["SORTED"] == nil {
+		t.Error("Expected SORTED to be declared.")
+	}
+	pipeline := reparsed.Callables.Table["SORT_BOTH"].(*Pipeline)
+	if call := pipeline.Calls[0]; call.Id != "SORT_BAM" || call.DecId != "a.SORT_BAM" {
+		t.Errorf("Incorrect call %s of %s", call.Id, call.DecId)
+	}
+	if call := pipeline.Calls[1]; call.Id != "SORT_B" || call.DecId != "SORT_BAM" {
+		t.Errorf("Incorrect call %s of %s", call.Id, call.DecId)
+	}
+	if reparsed.Call == nil || reparsed.Call.DecId != "SORT_BOTH" {
+		t.Error("Expected the call to SORT_BOTH.")
+	}
+}
+
+func TestImportErrorLocation(t *testing.T) {
+	_, err := parseFiles(t, map[string]string{
+		"bad.mro": `
+stage BAD(
+    in  int input,
+    out int output,
+    src py  "stages/bad",
+)
+
+stage BAD(
+    in  int input,
+    out int output,
+    src py  "stages/bad",
+)
+`,
+		"main.mro": `
+@import "bad.mro" as lib
+`,
+	})
+	if err == nil {
+		t.Fatal("Expected duplicate declarations to fail.")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "bad.mro:8") {
+		t.Error("Expected error in imported file, got", msg)
+	}
+	if !strings.Contains(msg, "main.mro:2") {
+		t.Error("Expected error to report where the file was imported, got", msg)
+	}
+}
+
+func TestImportSyntaxError(t *testing.T) {
+	files := map[string]string{
+		"a.mro": strings.Replace(sortLibA, "in  bam input,", "in  bam input", 1),
+		"main.mro": `
+@import "a.mro" as a
+
+pipeline SORT(
+    in  bam input,
+    out bam sorted,
+)
+{
+    call a.SORT_BAM(
+        input = self.input,
+    )
+
+    return (
+        sorted = SORT_BAM.sorted,
+    )
+}
+`,
+	}
+	// Only the syntax error is reported, not the uses of the declaration
+	// which failed to parse.
+	check := func() {
+		t.Helper()
+		_, err := parseFiles(t, files)
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Expected only a parse error, got %v", err)
+		}
+	}
+	check()
+
+	files["main.mro"] = strings.Replace(strings.Replace(files["main.mro"],
+		`@import "a.mro" as a`, `@import "a.mro" (SORT_BAM)`, 1),
+		"call a.SORT_BAM", "call SORT_BAM", 1)
+	check()
+}
+
+func TestQualifiedDeclaration(t *testing.T) {
+	src := `
+filetype bam;
+
+stage a.SORT_BAM(
+    in  bam input,
+    out bam sorted,
+    src py  "stages/a/sort",
+)
+`
+	if _, err := parseFiles(t, map[string]string{
+		"main.mro": src,
+	}); err == nil {
+		t.Error("Expected a qualified declaration to fail.")
+	} else if !strings.Contains(err.Error(), "QualifiedNameError") {
+		t.Error("Expected a qualified name error, got", err)
+	}
+
+	// Source generated from @imports declares qualified names.
+	if _, err := parseFiles(t, map[string]string{
+		"main.mro": flattenedHeader + src,
+	}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,312 @@
+//
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+//
+// Resource expressions.
+//
+
+package syntax
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/martian-lang/martian/martian/util"
+)
+
+func (s *ResourceNum) getNode() *AstNode         { return &s.Node }
+func (s *ResourceNum) inheritComments() bool     { return false }
+func (s *ResourceNum) getSubnodes() []AstNodable { return nil }
+
+func (s *ResourceRef) getNode() *AstNode         { return &s.Node }
+func (s *ResourceRef) inheritComments() bool     { return false }
+func (s *ResourceRef) getSubnodes() []AstNodable { return nil }
+
+func (s *ResourceFunc) getNode() *AstNode     { return &s.Node }
+func (s *ResourceFunc) inheritComments() bool { return false }
+func (s *ResourceFunc) getSubnodes() []AstNodable {
+	subs := make([]AstNodable, 0, len(s.Args))
+	for _, arg := range s.Args {
+		subs = append(subs, arg)
+	}
+	return subs
+}
+
+func (s *ResourceBinExp) getNode() *AstNode     { return &s.Node }
+func (s *ResourceBinExp) inheritComments() bool { return false }
+func (s *ResourceBinExp) getSubnodes() []AstNodable {
+	return []AstNodable{s.Left, s.Right}
+}
+
+//
+// Evaluation
+//
+
+func (exp *ResourceNum) Eval(map[string]interface{}) (float64, error) {
+	return exp.Value, nil
+}
+
+func (exp *ResourceRef) Eval(args map[string]interface{}) (float64, error) {
+	switch v := args[exp.Id].(type) {
+	case nil:
+		return 0, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return 0, fmt.Errorf("input %s is not a number", exp.Id)
+	}
+}
+
+func (exp *ResourceFunc) Eval(args map[string]interface{}) (float64, error) {
+	switch exp.Name {
+	case "size":
+		// Total size, in GB, of the files named by the input.
+		ref := exp.Args[0].(*ResourceRef)
+		var size int64
+		for _, p := range filesIn(args[ref.Id]) {
+			if _, err := os.Stat(p); err != nil {
+				return 0, err
+			}
+			if err := util.Walk(p, func(_ string, info os.FileInfo, err error) error {
+				if err == nil {
+					size += info.Size()
+				}
+				return err
+			}); err != nil {
+				return 0, err
+			}
+		}
+		return float64(size) / (1024 * 1024 * 1024), nil
+	case "len":
+		ref := exp.Args[0].(*ResourceRef)
+		switch v := args[ref.Id].(type) {
+		case nil:
+			return 0, nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		default:
+			return 0, fmt.Errorf("input %s is not an array or map", ref.Id)
+		}
+	}
+	vals := make([]float64, len(exp.Args))
+	for i, arg := range exp.Args {
+		if v, err := arg.Eval(args); err != nil {
+			return 0, err
+		} else {
+			vals[i] = v
+		}
+	}
+	switch exp.Name {
+	case "ceil":
+		return math.Ceil(vals[0]), nil
+	case "max":
+		result := vals[0]
+		for _, v := range vals[1:] {
+			result = math.Max(result, v)
+		}
+		return result, nil
+	case "min":
+		result := vals[0]
+		for _, v := range vals[1:] {
+			result = math.Min(result, v)
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("unknown function %s", exp.Name)
+}
+
+func (exp *ResourceBinExp) Eval(args map[string]interface{}) (float64, error) {
+	left, err := exp.Left.Eval(args)
+	if err != nil {
+		return 0, err
+	}
+	right, err := exp.Right.Eval(args)
+	if err != nil {
+		return 0, err
+	}
+	switch exp.Op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	}
+	return 0, fmt.Errorf("unknown operator %s", exp.Op)
+}
+
+// Get all of the file names in an argument value.
+func filesIn(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var files []string
+		for _, elem := range v {
+			files = append(files, filesIn(elem)...)
+		}
+		return files
+	case map[string]interface{}:
+		var files []string
+		for _, elem := range v {
+			files = append(files, filesIn(elem)...)
+		}
+		return files
+	}
+	return nil
+}
+
+//
+// Semantic checking
+//
+
+func (exp *ResourceNum) compile(*Ast, *Stage) error {
+	return nil
+}
+
+func (exp *ResourceRef) compile(global *Ast, stage *Stage) error {
+	param, ok := stage.InParams.Table[exp.Id]
+	if !ok {
+		return global.err(exp,
+			"ScopeNameError: '%s' is not an input parameter of stage %s",
+			exp.Id, stage.Id)
+	}
+	if t := param.GetTname(); param.GetArrayDim() > 0 ||
+		t != "int" && t != "float" && t != "bool" {
+		return global.err(exp,
+			"TypeMismatchError: input '%s' of stage %s is not a number",
+			exp.Id, stage.Id)
+	}
+	return nil
+}
+
+func (exp *ResourceFunc) compile(global *Ast, stage *Stage) error {
+	switch exp.Name {
+	case "size", "len":
+		if len(exp.Args) != 1 {
+			return global.err(exp,
+				"ResourceError: %s() takes exactly one argument",
+				exp.Name)
+		}
+		ref, ok := exp.Args[0].(*ResourceRef)
+		if !ok {
+			return global.err(exp,
+				"ResourceError: the argument to %s() must be an input parameter",
+				exp.Name)
+		}
+		param, ok := stage.InParams.Table[ref.Id]
+		if !ok {
+			return global.err(ref,
+				"ScopeNameError: '%s' is not an input parameter of stage %s",
+				ref.Id, stage.Id)
+		}
+		if exp.Name == "len" {
+			if param.GetArrayDim() == 0 && !strings.HasPrefix(param.GetTname(), "map") {
+				return global.err(ref,
+					"TypeMismatchError: input '%s' of stage %s is not an array or map",
+					ref.Id, stage.Id)
+			}
+		} else if t := param.GetTname(); t == "int" || t == "float" || t == "bool" {
+			return global.err(ref,
+				"TypeMismatchError: input '%s' of stage %s cannot contain files",
+				ref.Id, stage.Id)
+		}
+		return nil
+	case "ceil":
+		if len(exp.Args) != 1 {
+			return global.err(exp,
+				"ResourceError: ceil() takes exactly one argument")
+		}
+	case "max", "min":
+		if len(exp.Args) == 0 {
+			return global.err(exp,
+				"ResourceError: %s() requires at least one argument",
+				exp.Name)
+		}
+	default:
+		return global.err(exp,
+			"ResourceError: unknown function '%s'", exp.Name)
+	}
+	var errs ErrorList
+	for _, arg := range exp.Args {
+		if err := arg.compile(global, stage); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.If()
+}
+
+func (exp *ResourceBinExp) compile(global *Ast, stage *Stage) error {
+	var errs ErrorList
+	if err := exp.Left.compile(global, stage); err != nil {
+		errs = append(errs, err)
+	}
+	if err := exp.Right.compile(global, stage); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.If()
+}
+
+//
+// Formatting
+//
+
+func (exp *ResourceNum) format() string {
+	return strconv.FormatFloat(exp.Value, 'f', -1, 64)
+}
+
+func (exp *ResourceRef) format() string {
+	return "self." + exp.Id
+}
+
+func (exp *ResourceFunc) format() string {
+	args := make([]string, len(exp.Args))
+	for i, arg := range exp.Args {
+		args[i] = arg.format()
+	}
+	return exp.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func opPrecedence(op string) int {
+	if op == "*" || op == "/" {
+		return 2
+	}
+	return 1
+}
+
+func (exp *ResourceBinExp) format() string {
+	prec := opPrecedence(exp.Op)
+	left := exp.Left.format()
+	if bin, ok := exp.Left.(*ResourceBinExp); ok && opPrecedence(bin.Op) < prec {
+		left = "(" + left + ")"
+	}
+	right := exp.Right.format()
+	if bin, ok := exp.Right.(*ResourceBinExp); ok && (opPrecedence(bin.Op) < prec ||
+		opPrecedence(bin.Op) == prec && (exp.Op == "-" || exp.Op == "/")) {
+		right = "(" + right + ")"
+	}
+	return left + " " + exp.Op + " " + right
+}
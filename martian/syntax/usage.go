@@ -0,0 +1,184 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+// Tracking of unused includes and declarations.
+
+package syntax
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// A reference to a callable, user type or struct type.
+type reference struct {
+	name string
+	node *AstNode
+}
+
+// Get the references to callables, file types and struct types in the AST.
+func (global *Ast) references() []reference {
+	var refs []reference
+	typeRefs := func(params *Params) {
+		if params == nil {
+			return
+		}
+		for _, param := range params.List {
+			t := mapElemType(param.GetTname())
+			if global.UserTypeTable[t] != nil || global.StructTypeTable[t] != nil {
+				refs = append(refs, reference{t, param.getNode()})
+			}
+		}
+	}
+	for _, st := range global.StructTypes {
+		typeRefs(st.Members)
+	}
+	for _, stage := range global.Stages {
+		typeRefs(stage.InParams)
+		typeRefs(stage.OutParams)
+		typeRefs(stage.ChunkIns)
+		typeRefs(stage.ChunkOuts)
+	}
+	for _, pipeline := range global.Pipelines {
+		typeRefs(pipeline.InParams)
+		typeRefs(pipeline.OutParams)
+		for _, call := range pipeline.Calls {
+			refs = append(refs, reference{call.DecId, &call.Node})
+		}
+	}
+	if global.Call != nil {
+		refs = append(refs, reference{global.Call.DecId, &global.Call.Node})
+	}
+	return refs
+}
+
+// Fill in the declarations contributed by each include, and which of them
+// were referenced from outside of the included file.
+func (global *Ast) trackIncludeUsage() {
+	if len(global.Includes) == 0 {
+		return
+	}
+	// Nodes from an included file have the location of the directive at
+	// the end of their include stack.
+	includeOf := func(node *AstNode) string {
+		if len(node.IncludeStack) == 0 {
+			return ""
+		}
+		return node.IncludeStack[len(node.IncludeStack)-1]
+	}
+	byKey := make(map[string]*IncludeUsage, len(global.Includes))
+	for _, inc := range global.Includes {
+		byKey[fmt.Sprintf("%s:%d", inc.Node.Fname, inc.Node.Loc)] = inc
+		inc.Used = make(map[string]bool)
+	}
+	// File types may be declared by more than one file.
+	declaredBy := make(map[string][]*IncludeUsage)
+	for _, callable := range global.Callables.List {
+		if inc := byKey[includeOf(callable.getNode())]; inc != nil {
+			inc.Callables = append(inc.Callables, callable.GetId())
+			declaredBy[callable.GetId()] = append(declaredBy[callable.GetId()], inc)
+		}
+	}
+	for _, ut := range global.UserTypes {
+		if inc := byKey[includeOf(&ut.Node)]; inc != nil {
+			inc.UserTypes = append(inc.UserTypes, ut.Id)
+			declaredBy[ut.Id] = append(declaredBy[ut.Id], inc)
+		}
+	}
+	for _, st := range global.StructTypes {
+		if inc := byKey[includeOf(&st.Node)]; inc != nil {
+			inc.StructTypes = append(inc.StructTypes, st.Id)
+			declaredBy[st.Id] = append(declaredBy[st.Id], inc)
+		}
+	}
+	for _, ref := range global.references() {
+		from := byKey[includeOf(ref.node)]
+		for _, inc := range declaredBy[ref.name] {
+			if inc != from {
+				inc.Used[ref.name] = true
+			}
+		}
+	}
+}
+
+// Report includes in the top-level files of the given ASTs which contribute
+// no referenced declarations, and stages, file types and struct types
+// declared in those files which are not referenced by any of the ASTs.
+//
+// When checking all of the files in MROPATH, declarations are matched by
+// the base name of the file which declared them, since included file names
+// are relative to the MROPATH entry.
+func Unused(asts []*Ast) []*LintWarning {
+	declKey := func(node *AstNode) string {
+		return fmt.Sprintf("%s:%d", filepath.Base(node.Fname), node.Loc)
+	}
+	used := make(map[string]bool)
+	for _, ast := range asts {
+		refs := ast.references()
+		names := make(map[string]bool, len(refs))
+		for _, ref := range refs {
+			names[ref.name] = true
+		}
+		for _, callable := range ast.Callables.List {
+			if names[callable.GetId()] {
+				used[declKey(callable.getNode())] = true
+			}
+		}
+		// File types may be declared by more than one file.
+		for _, ut := range ast.UserTypes {
+			if names[ut.Id] {
+				used[declKey(&ut.Node)] = true
+			}
+		}
+		for _, st := range ast.StructTypes {
+			if names[st.Id] {
+				used[declKey(&st.Node)] = true
+			}
+		}
+	}
+	var warnings []*LintWarning
+	seen := make(map[string]bool)
+	warn := func(check string, node *AstNode, msg string, v ...interface{}) {
+		warnings = append(warnings, &LintWarning{
+			Check: check,
+			Node:  node,
+			Msg:   fmt.Sprintf(msg, v...),
+		})
+	}
+	for _, ast := range asts {
+		for _, inc := range ast.Includes {
+			if len(inc.Used) == 0 {
+				warn("unused-include", &inc.Node,
+					"nothing declared in %s is used", inc.Fname)
+			}
+		}
+		for _, stage := range ast.Stages {
+			if key := declKey(&stage.Node); len(stage.Node.IncludeStack) == 0 &&
+				!seen[key] && !used[key] {
+				seen[key] = true
+				warn("unused-declaration", &stage.Node,
+					"stage %s is never called", stage.Id)
+			}
+		}
+		for _, ut := range ast.UserTypes {
+			if key := declKey(&ut.Node); len(ut.Node.IncludeStack) == 0 &&
+				!seen[key] && !used[key] {
+				seen[key] = true
+				warn("unused-declaration", &ut.Node,
+					"filetype %s is never used", ut.Id)
+			}
+		}
+		for _, st := range ast.StructTypes {
+			if key := declKey(&st.Node); len(st.Node.IncludeStack) == 0 &&
+				!seen[key] && !used[key] {
+				seen[key] = true
+				warn("unused-declaration", &st.Node,
+					"struct %s is never used", st.Id)
+			}
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return errorBefore(warnings[i], warnings[j])
+	})
+	return warnings
+}
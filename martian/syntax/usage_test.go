@@ -0,0 +1,123 @@
+// Copyright (c) 2018 10X Genomics, Inc. All rights reserved.
+
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnused(t *testing.T) {
+	ast, err := parseFiles(t, map[string]string{
+		"main.mro": `@include "lib.mro"
+@include "other.mro"
+
+filetype txt;
+
+stage DEAD(
+    in  bam input,
+    src py  "stages/dead",
+)
+
+pipeline PIPE(
+    in  bam input,
+    out bam sorted,
+)
+{
+    call SORT_BAM(
+        input = self.input,
+    )
+
+    return (
+        sorted = SORT_BAM.sorted,
+    )
+}
+`,
+		"lib.mro": sortLibA,
+		"other.mro": `
+filetype json;
+
+stage OTHER(
+    in  json input,
+    src py   "stages/other",
+)
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Includes) != 2 {
+		t.Fatalf("Expected 2 includes, got %d", len(ast.Includes))
+	}
+	if inc := ast.Includes[0]; !reflect.DeepEqual(inc.Used, map[string]bool{
+		"bam":      true,
+		"SORT_BAM": true,
+	}) {
+		t.Errorf("Incorrect usage for %s: %v", inc.Fname, inc.Used)
+	}
+	if inc := ast.Includes[1]; len(inc.Used) != 0 ||
+		!reflect.DeepEqual(inc.Callables, []string{"OTHER"}) {
+		t.Errorf("Incorrect usage for %s: %v declaring %v",
+			inc.Fname, inc.Used, inc.Callables)
+	}
+	var msgs []string
+	for _, w := range Unused([]*Ast{ast}) {
+		msgs = append(msgs, w.Msg)
+	}
+	if expect := []string{
+		"nothing declared in other.mro is used",
+		"filetype txt is never used",
+		"stage DEAD is never called",
+	}; !reflect.DeepEqual(msgs, expect) {
+		t.Errorf("Expected %v, got %v", expect, msgs)
+	}
+}
+
+func TestUnusedStruct(t *testing.T) {
+	ast, err := parseFiles(t, map[string]string{
+		"main.mro": `@include "pair.mro"
+
+struct WRAPPER(
+    in PAIR[] pairs,
+)
+
+struct DEAD(
+    in int x,
+)
+
+stage USE(
+    in  PAIR         p,
+    in  map<WRAPPER> w,
+    src py           "stages/use",
+)
+`,
+		"pair.mro": `
+struct PAIR(
+    in int a,
+    in int b,
+)
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Includes) != 1 {
+		t.Fatalf("Expected 1 include, got %d", len(ast.Includes))
+	}
+	if inc := ast.Includes[0]; !reflect.DeepEqual(inc.Used, map[string]bool{
+		"PAIR": true,
+	}) || !reflect.DeepEqual(inc.StructTypes, []string{"PAIR"}) {
+		t.Errorf("Incorrect usage for %s: %v declaring %v",
+			inc.Fname, inc.Used, inc.StructTypes)
+	}
+	var msgs []string
+	for _, w := range Unused([]*Ast{ast}) {
+		msgs = append(msgs, w.Msg)
+	}
+	if expect := []string{
+		"struct DEAD is never used",
+		"stage USE is never called",
+	}; !reflect.DeepEqual(msgs, expect) {
+		t.Errorf("Expected %v, got %v", expect, msgs)
+	}
+}
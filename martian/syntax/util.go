@@ -6,6 +6,13 @@
 
 package syntax
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 func SearchPipestanceParams(pipestance *Ast, what string) interface{} {
 	b1 := pipestance.Call.Bindings.Table[what]
 	if b1 == nil {
@@ -14,3 +21,57 @@ func SearchPipestanceParams(pipestance *Ast, what string) interface{} {
 		return b1.Exp.(*ValExp).Value
 	}
 }
+
+// Strips the quotes from a string literal and decodes its escape sequences.
+// String literals use JSON escapes, but unlike JSON may also contain literal
+// newlines, tabs, and other control characters.
+func unquote(qs string) string {
+	var buf bytes.Buffer
+	buf.Grow(len(qs))
+	for _, r := range qs {
+		if r < 0x20 {
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	var s string
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		// The lexer only accepts valid escapes, so this should not happen.
+		return strings.Trim(qs, "\"")
+	}
+	return s
+}
+
+// Quotes a string as a string literal, escaping it if required.
+func quoteString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		panic(err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Returns the element type name and array dimension of a typed map
+// type name such as map<int> or map<bam[]>.  If the type name is not a typed
+// map (including the untyped map), returns false.
+func ParseMapType(tname string) (string, int, bool) {
+	if !strings.HasPrefix(tname, "map<") || !strings.HasSuffix(tname, ">") {
+		return "", 0, false
+	}
+	elem := tname[len("map<") : len(tname)-1]
+	dim := 0
+	for strings.HasSuffix(elem, "[]") {
+		elem = elem[:len(elem)-2]
+		dim++
+	}
+	return elem, dim, true
+}
+
+// Returns the last component of a possibly namespace-qualified name, such as
+// SORT_BAM for lib.SORT_BAM.
+func unqualified(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}